@@ -0,0 +1,86 @@
+package immcheck
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// ReportAggregator aggregates repeated mutation reports by capture origin, detection origin, type of guarded value
+// and Options.Label, so a hot path producing thousands of identical violations emits one summarized report per flush interval.
+// Set it to Options.Aggregator to use it instead of logging every report. It is safe for concurrent use.
+// Summarized reports are written in Options.ReportFormat of the first aggregated report.
+type ReportAggregator struct {
+	logWriter     io.Writer
+	flushInterval time.Duration
+
+	m          sync.Mutex
+	reports    map[reportKey]*aggregatedReport
+	order      []reportKey
+	flushTimer *time.Timer
+}
+
+type reportKey struct {
+	captureOrigin   OriginID
+	detectionOrigin OriginID
+	valueType       string
+	label           string
+}
+
+type aggregatedReport struct {
+	example error
+	count   int
+	format  ReportFormat
+}
+
+// NewReportAggregator creates ReportAggregator that writes summarized reports to logWriter every flushInterval.
+// logWriter can be nil, os.Stderr is used by default.
+func NewReportAggregator(logWriter io.Writer, flushInterval time.Duration) *ReportAggregator {
+	if logWriter == nil {
+		logWriter = os.Stderr
+	}
+	return &ReportAggregator{
+		logWriter:     logWriter,
+		flushInterval: flushInterval,
+		reports:       make(map[reportKey]*aggregatedReport),
+	}
+}
+
+// Flush writes summarized reports collected since the previous flush.
+func (a *ReportAggregator) Flush() {
+	a.m.Lock()
+	order, reports := a.order, a.reports
+	a.order, a.reports = nil, make(map[reportKey]*aggregatedReport, len(reports))
+	if a.flushTimer != nil {
+		a.flushTimer.Stop()
+		a.flushTimer = nil
+	}
+	a.m.Unlock()
+
+	for _, key := range order {
+		report := reports[key]
+		writeReport(a.logWriter, report.example, report.count, Options{ReportFormat: report.format, Label: key.label})
+	}
+}
+
+func (a *ReportAggregator) add(checkErr error, options Options) {
+	key := reportKey{label: options.Label}
+	if mutationErr, ok := checkErr.(*MutationError); ok {
+		key.captureOrigin = mutationErr.CaptureOrigin
+		key.detectionOrigin = mutationErr.DetectionOrigin
+		key.valueType = mutationErr.Type
+	}
+	a.m.Lock()
+	defer a.m.Unlock()
+	report, ok := a.reports[key]
+	if !ok {
+		report = &aggregatedReport{example: checkErr, format: options.ReportFormat}
+		a.reports[key] = report
+		a.order = append(a.order, key)
+	}
+	report.count++
+	if a.flushTimer == nil {
+		a.flushTimer = time.AfterFunc(a.flushInterval, a.Flush)
+	}
+}
@@ -0,0 +1,107 @@
+package immcheck_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+func TestReportAggregator(t *testing.T) {
+	t.Parallel()
+	logBuffer := &lockedWriterBuffer{buf: &bytes.Buffer{}}
+	aggregator := immcheck.NewReportAggregator(logBuffer, time.Hour)
+	options := immcheck.Options{Flags: immcheck.SkipPanicOnDetectedMutation, Aggregator: aggregator}
+	counter := 0
+	for i := 0; i < 1000; i++ {
+		check := immcheck.EnsureImmutabilityWithOptions(&counter, options)
+		counter++
+		check()
+	}
+	name := "name"
+	func() {
+		defer immcheck.EnsureImmutabilityWithOptions(&name, options)()
+		name = "changed"
+	}()
+	if logBuffer.String() != "" {
+		t.Fatalf("reports aren't aggregated: %v", logBuffer.String())
+	}
+
+	aggregator.Flush()
+	resultingLog := logBuffer.String()
+	if strings.Count(resultingLog, "[ERROR] runtime mutation detected") != 2 ||
+		!strings.Contains(resultingLog, "[ERROR] runtime mutation detected 1000 times; error: ") ||
+		!strings.Contains(resultingLog, "[ERROR] runtime mutation detected 1 times; error: ") {
+		t.Fatalf("unexpected summarized reports: %v", resultingLog)
+	}
+	aggregator.Flush()
+	if logBuffer.String() != resultingLog {
+		t.Fatalf("reports are flushed twice: %v", logBuffer.String())
+	}
+}
+
+func TestReportAggregatorFlushInterval(t *testing.T) {
+	t.Parallel()
+	logBuffer := &lockedWriterBuffer{buf: &bytes.Buffer{}}
+	options := immcheck.Options{
+		Flags:      immcheck.SkipPanicOnDetectedMutation,
+		Aggregator: immcheck.NewReportAggregator(logBuffer, time.Millisecond),
+	}
+	counter := 0
+	func() {
+		defer immcheck.EnsureImmutabilityWithOptions(&counter, options)()
+		counter++
+	}()
+	deadline := time.Now().Add(10 * time.Second)
+	for logBuffer.String() == "" && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if !strings.Contains(logBuffer.String(), "[ERROR] runtime mutation detected 1 times; error: ") {
+		t.Fatalf("reports aren't flushed: %v", logBuffer.String())
+	}
+}
+
+func TestReportAggregatorFormat(t *testing.T) {
+	t.Parallel()
+	logBuffer := &lockedWriterBuffer{buf: &bytes.Buffer{}}
+	aggregator := immcheck.NewReportAggregator(logBuffer, time.Hour)
+	options := immcheck.Options{
+		Flags:        immcheck.SkipPanicOnDetectedMutation,
+		Aggregator:   aggregator,
+		ReportFormat: immcheck.JSONReportFormat,
+		Label:        "counters",
+	}
+	counter := 0
+	for i := 0; i < 3; i++ {
+		check := immcheck.EnsureImmutabilityWithOptions(&counter, options)
+		counter++
+		check()
+	}
+	aggregator.Flush()
+	var report struct {
+		Label      string `json:"label"`
+		Detections int    `json:"detections"`
+		Type       string `json:"type"`
+	}
+	if err := json.Unmarshal([]byte(logBuffer.String()), &report); err != nil {
+		t.Fatalf("report isn't valid JSON: %v; %v", err, logBuffer.String())
+	}
+	if report.Label != "counters" || report.Detections != 3 || report.Type != "*int" {
+		t.Fatalf("unexpected summarized report: %v", logBuffer.String())
+	}
+
+	textBuffer := &lockedWriterBuffer{buf: &bytes.Buffer{}}
+	options.Aggregator = immcheck.NewReportAggregator(textBuffer, time.Hour)
+	options.ReportFormat = immcheck.TextReportFormat
+	func() {
+		defer immcheck.EnsureImmutabilityWithOptions(&counter, options)()
+		counter++
+	}()
+	options.Aggregator.Flush()
+	if !strings.HasPrefix(textBuffer.String(), "[ERROR] runtime mutation detected 1 times; label: counters; error: ") {
+		t.Fatalf("unexpected summarized report: %v", textBuffer.String())
+	}
+}
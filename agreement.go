@@ -0,0 +1,128 @@
+package immcheck
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+)
+
+// PublishDigests computes stable digests of designated values of the replica according to settings specified in options
+// and stores them in the store shared by replicas, so immcheck.CheckAgreement can find replicas that drifted.
+// values maps names of designated values to the values, the same names should be used by all replicas.
+func PublishDigests(
+	ctx context.Context, store DigestStore, replica string, values map[string]interface{}, options Options,
+) error {
+	options = withDefaultOptions(options)
+	for name, value := range values {
+		if err := store.StoreDigest(ctx, replicaDigestName(replica, name), ComputeStableDigest(value, options)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AgreementReport describes replicas whose published digests diverge, see immcheck.CheckAgreement.
+type AgreementReport struct {
+	// Divergences are ordered by name and then by replica.
+	Divergences []Divergence
+}
+
+// Divergence describes digest of the value published by the replica that differs from the digest agreed by majority.
+type Divergence struct {
+	// Name is the name of the designated value.
+	Name string
+	// Replica is the name of the divergent replica.
+	Replica string
+	// Digest is the digest published by the replica. Zero if Missing is true.
+	Digest StableDigest
+	// Expected is the digest published by the majority of replicas.
+	Expected StableDigest
+	// Missing is true if the replica hasn't published digest of the value.
+	Missing bool
+}
+
+// Agreed reports whether all replicas published the same digests.
+func (r *AgreementReport) Agreed() bool {
+	return len(r.Divergences) == 0
+}
+
+// String provides human-readable description of divergences, one divergence per line.
+func (r *AgreementReport) String() string {
+	buf := &bytes.Buffer{}
+	for _, divergence := range r.Divergences {
+		if divergence.Missing {
+			_, _ = fmt.Fprintf(buf, "%v: replica %v hasn't published digest; expected %v\n",
+				divergence.Name, divergence.Replica, divergence.Expected)
+			continue
+		}
+		_, _ = fmt.Fprintf(buf, "%v: replica %v has %v; expected %v\n",
+			divergence.Name, divergence.Replica, divergence.Digest, divergence.Expected)
+	}
+	return buf.String()
+}
+
+// CheckAgreement loads digests of designated values published by replicas with immcheck.PublishDigests
+// and reports replicas whose digests differ from the digest published by the majority of replicas.
+// If there is no majority, the digest published by the most replicas wins, ties are broken by the smallest digest,
+// so every coordinator computes the same report.
+// Values that no replica has published are skipped.
+func CheckAgreement(
+	ctx context.Context, store DigestStore, replicas []string, names []string,
+) (*AgreementReport, error) {
+	report := &AgreementReport{}
+	sortedNames := append([]string(nil), names...)
+	sort.Strings(sortedNames)
+	sortedReplicas := append([]string(nil), replicas...)
+	sort.Strings(sortedReplicas)
+	for _, name := range sortedNames {
+		published := make(map[string]StableDigest, len(sortedReplicas))
+		votes := make(map[StableDigest]int)
+		for _, replica := range sortedReplicas {
+			digest, ok, err := store.LoadDigest(ctx, replicaDigestName(replica, name))
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				published[replica] = digest
+				votes[digest]++
+			}
+		}
+		if len(votes) == 0 {
+			continue
+		}
+		expected := agreedDigest(votes)
+		for _, replica := range sortedReplicas {
+			digest, ok := published[replica]
+			if ok && digest == expected {
+				continue
+			}
+			report.Divergences = append(report.Divergences, Divergence{
+				Name:     name,
+				Replica:  replica,
+				Digest:   digest,
+				Expected: expected,
+				Missing:  !ok,
+			})
+		}
+	}
+	return report, nil
+}
+
+func agreedDigest(votes map[StableDigest]int) StableDigest {
+	var agreed StableDigest
+	maxVotes := 0
+	for digest, count := range votes {
+		tieBreak := digest.Version < agreed.Version || (digest.Version == agreed.Version && digest.Sum < agreed.Sum)
+		if count > maxVotes || (count == maxVotes && tieBreak) {
+			agreed = digest
+			maxVotes = count
+		}
+	}
+	return agreed
+}
+
+// replicaDigestName returns name of digest of the value published by the replica.
+func replicaDigestName(replica string, name string) string {
+	return replica + "/" + name
+}
@@ -0,0 +1,51 @@
+package immcheck_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+func TestCheckAgreement(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	store := immcheck.NewMemoryDigestStore()
+	for _, replica := range []string{"pod-a", "pod-b", "pod-c"} {
+		config := map[string]string{"region": "eu"}
+		limits := []int{10, 20}
+		if replica == "pod-b" {
+			limits[1] = 30
+		}
+		values := map[string]interface{}{"config": &config, "limits": &limits}
+		if err := immcheck.PublishDigests(ctx, store, replica, values, immcheck.Options{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	report, err := immcheck.CheckAgreement(ctx, store, []string{"pod-c", "pod-b", "pod-a", "pod-d"}, []string{
+		"limits", "config", "unknown",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(report)
+	if report.Agreed() || len(report.Divergences) != 3 {
+		t.Fatalf("unexpected divergences: %v", report)
+	}
+	expectedLimits := immcheck.ComputeStableDigest(&[]int{10, 20}, immcheck.Options{})
+	divergence := report.Divergences[1]
+	if divergence.Name != "limits" || divergence.Replica != "pod-b" || divergence.Missing ||
+		divergence.Expected != expectedLimits || divergence.Digest == expectedLimits {
+		t.Fatalf("unexpected divergence: %+v", divergence)
+	}
+	if !report.Divergences[0].Missing || report.Divergences[0].Replica != "pod-d" ||
+		!strings.Contains(report.String(), "limits: replica pod-d hasn't published digest") {
+		t.Fatalf("missing digest isn't reported: %v", report)
+	}
+
+	report, err = immcheck.CheckAgreement(ctx, store, []string{"pod-a", "pod-c"}, []string{"config", "limits"})
+	if err != nil || !report.Agreed() {
+		t.Fatalf("agreed replicas are reported: %v %v", report, err)
+	}
+}
@@ -0,0 +1,99 @@
+package immcheck
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// MemoryOverlap describes memory region that is reachable from both values passed to immcheck.DetectAliasing.
+type MemoryOverlap struct {
+	// Address is the start of the shared memory region.
+	Address uintptr
+	// Size is the size of the shared memory region in bytes.
+	Size uintptr
+	// Kind is the kind of the value that owns the shared memory region in the first value.
+	Kind reflect.Kind
+}
+
+// String provides string representation of MemoryOverlap.
+func (m MemoryOverlap) String() string {
+	return fmt.Sprintf("MemoryOverlap{address: %#x; size: %v; kind: %v}", m.Address, m.Size, m.Kind.String())
+}
+
+// DetectAliasing walks a and b the same way immutability checks do
+// and reports memory regions reachable from both of them.
+// If two separately guarded values share backing arrays or subgraphs,
+// mutation through one of them will be reported against the origin of the other one.
+// This function helps to explain such reports. Returns nil if a and b don't overlap.
+func DetectAliasing(a interface{}, b interface{}, options Options) []MemoryOverlap {
+	if a == nil || b == nil {
+		panic(fmt.Errorf("%w. target value can't be nil", UnsupportedTypeError))
+	}
+	options.Flags |= SkipOriginCapturing
+	// normalized values are hashed from scratch buffers, which would hide their real memory regions
+	options.Flags &^= normalizationFlags
+	aRegions := captureMemoryRegions(a, options)
+	bRegions := captureMemoryRegions(b, options)
+
+	var overlaps []MemoryOverlap
+	i, j := 0, 0
+	for i < len(aRegions) && j < len(bRegions) {
+		aRegion, bRegion := aRegions[i], bRegions[j]
+		start := aRegion.start
+		if bRegion.start > start {
+			start = bRegion.start
+		}
+		end := aRegion.end
+		if bRegion.end < end {
+			end = bRegion.end
+		}
+		if start < end {
+			overlaps = append(overlaps, MemoryOverlap{Address: start, Size: end - start, Kind: aRegion.kind})
+		}
+		if aRegion.end < bRegion.end {
+			i++
+		} else {
+			j++
+		}
+	}
+	return overlaps
+}
+
+type memoryRegion struct {
+	start uintptr
+	end   uintptr
+	kind  reflect.Kind
+}
+
+func recordMemoryRegion(snapshot *ValueSnapshot, start uintptr, size uintptr, kind reflect.Kind) *ValueSnapshot {
+	if snapshot.memoryRegions == nil {
+		return snapshot
+	}
+	*snapshot.memoryRegions = append(*snapshot.memoryRegions, memoryRegion{start: start, end: start + size, kind: kind})
+	return snapshot
+}
+
+// captureMemoryRegions returns sorted disjoint memory regions covered by snapshot of v.
+func captureMemoryRegions(v interface{}, options Options) []memoryRegion {
+	regions := make([]memoryRegion, 0)
+	snapshot := newValueSnapshot()
+	snapshot.memoryRegions = &regions
+	captureChecksumMap(snapshot, reflect.ValueOf(v), options)
+
+	sort.Slice(regions, func(i, j int) bool {
+		return regions[i].start < regions[j].start
+	})
+	merged := regions[:0]
+	for _, region := range regions {
+		lastIndex := len(merged) - 1
+		if lastIndex >= 0 && region.start < merged[lastIndex].end {
+			if region.end > merged[lastIndex].end {
+				merged[lastIndex].end = region.end
+			}
+			continue
+		}
+		merged = append(merged, region)
+	}
+	return merged
+}
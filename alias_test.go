@@ -0,0 +1,49 @@
+package immcheck_test
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+func TestDetectAliasing(t *testing.T) {
+	t.Parallel()
+	type request struct {
+		id      int
+		payload []int64
+	}
+	backingArray := []int64{1, 2, 3, 4, 5, 6, 7, 8}
+	first := &request{id: 1, payload: backingArray[:4]}
+	second := &request{id: 2, payload: backingArray[2:]}
+	{
+		overlaps := immcheck.DetectAliasing(first, second, immcheck.Options{})
+		t.Log(overlaps)
+		if len(overlaps) != 1 {
+			t.Fatalf("unexpected overlaps: %v", overlaps)
+		}
+		expectedAddress := uintptr(unsafe.Pointer(&backingArray[2]))
+		expectedSize := 2 * unsafe.Sizeof(backingArray[0])
+		if overlaps[0].Address != expectedAddress || overlaps[0].Size != expectedSize {
+			t.Fatalf("unexpected overlap: %v", overlaps[0])
+		}
+	}
+	{
+		independent := &request{id: 3, payload: []int64{1, 2}}
+		overlaps := immcheck.DetectAliasing(first, independent, immcheck.Options{})
+		if len(overlaps) != 0 {
+			t.Fatalf("unexpected overlaps: %v", overlaps)
+		}
+	}
+}
+
+func TestDetectAliasingOfSharedMap(t *testing.T) {
+	t.Parallel()
+	shared := map[string]int{"a": 1}
+	first := []map[string]int{shared}
+	second := map[int]map[string]int{1: shared}
+	overlaps := immcheck.DetectAliasing(&first, &second, immcheck.Options{})
+	if len(overlaps) == 0 {
+		t.Fatal("shared map isn't detected")
+	}
+}
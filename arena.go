@@ -0,0 +1,145 @@
+package immcheck
+
+import (
+	"fmt"
+	"reflect"
+	"unsafe"
+)
+
+// Arena is a user-managed scratch space for temporary objects that immcheck needs during capture:
+// map iterators, map keys and values holders, etc.
+// By default, immcheck takes such objects from global sync.Pool based caches.
+// With Arena, high-frequency guards re-use the same objects over and over again
+// without touching global pools and without producing GC pressure.
+// Specify Arena in Options.Arena to use it.
+//
+// Arena works as a stack allocator and is released automatically after every capture,
+// so it can be re-used across captures but isn't safe for concurrent use.
+// Don't share one Arena between goroutines. Checks that verify values on other goroutines,
+// like immcheck.EnsureImmutabilityAsync, immcheck.EnsureImmutabilityOnNextGC and finalizer checks,
+// panic with immcheck.UnsupportedTypeError if Options.Arena is set.
+type Arena struct {
+	iterators      []*reflect.MapIter
+	iteratorsInUse int
+
+	values map[reflect.Type]*arenaValues
+
+	mapPointers      []*unsafe.Pointer
+	mapPointersInUse int
+}
+
+type arenaValues struct {
+	values []*reflect.Value
+	inUse  int
+}
+
+// NewArena creates new empty Arena.
+func NewArena() *Arena {
+	return &Arena{
+		values: make(map[reflect.Type]*arenaValues),
+	}
+}
+
+// Reset drops all objects retained by the Arena, so they can be garbage collected.
+func (a *Arena) Reset() {
+	a.iterators = nil
+	a.iteratorsInUse = 0
+	a.values = make(map[reflect.Type]*arenaValues)
+	a.mapPointers = nil
+	a.mapPointersInUse = 0
+}
+
+func (a *Arena) acquireMapIter() *reflect.MapIter {
+	if a.iteratorsInUse == len(a.iterators) {
+		a.iterators = append(a.iterators, &reflect.MapIter{})
+	}
+	iterator := a.iterators[a.iteratorsInUse]
+	a.iteratorsInUse++
+	return iterator
+}
+
+func (a *Arena) releaseMapIter(iterator *reflect.MapIter) {
+	iterator.Reset(reflect.Value{})
+	a.iteratorsInUse--
+}
+
+func (a *Arena) acquireValue(valueType reflect.Type) *reflect.Value {
+	values, ok := a.values[valueType]
+	if !ok {
+		values = &arenaValues{}
+		a.values[valueType] = values
+	}
+	if values.inUse == len(values.values) {
+		value := reflect.New(valueType).Elem()
+		values.values = append(values.values, &value)
+	}
+	value := values.values[values.inUse]
+	values.inUse++
+	return value
+}
+
+func (a *Arena) releaseValue(valueType reflect.Type) {
+	values := a.values[valueType]
+	values.inUse--
+	// released value shouldn't keep guarded data reachable until the next capture
+	values.values[values.inUse].Set(reflect.Zero(valueType))
+}
+
+func (a *Arena) acquireMapPointer() *unsafe.Pointer {
+	if a.mapPointersInUse == len(a.mapPointers) {
+		a.mapPointers = append(a.mapPointers, new(unsafe.Pointer))
+	}
+	mapPointer := a.mapPointers[a.mapPointersInUse]
+	a.mapPointersInUse++
+	return mapPointer
+}
+
+func (a *Arena) releaseMapPointer(mapPointer *unsafe.Pointer) {
+	*mapPointer = nil
+	a.mapPointersInUse--
+}
+
+// checkArenaConfined panics if options.Arena is set for check that captures values on other goroutines,
+// since Arena isn't safe for concurrent use.
+func checkArenaConfined(options Options, check string) {
+	if options.Arena != nil {
+		panic(fmt.Errorf("%w. Arena isn't safe for concurrent use by %v", UnsupportedTypeError, check))
+	}
+}
+
+func perEntrySnapshotInArena(snapshot *ValueSnapshot, value reflect.Value, options Options) *ValueSnapshot {
+	arena := options.Arena
+	if !value.CanInterface() {
+		mapPointer := arena.acquireMapPointer()
+		defer arena.releaseMapPointer(mapPointer)
+		value = internalsOf(options).mapValueAt(value, mapPointer)
+		if !value.CanInterface() {
+			return perEntrySnapshotReadOnly(snapshot, value, options)
+		}
+	}
+	iterator := arena.acquireMapIter()
+	defer arena.releaseMapIter(iterator)
+	iterator.Reset(value)
+
+	mapType := value.Type()
+	mapKeyType := mapType.Key()
+	mapValueType := mapType.Elem()
+	k := arena.acquireValue(mapKeyType)
+	defer arena.releaseValue(mapKeyType)
+	v := arena.acquireValue(mapValueType)
+	defer arena.releaseValue(mapValueType)
+
+	scope := snapshot.contentPosition
+	for iterator.Next() {
+		k.SetIterKey(iterator)
+		v.SetIterValue(iterator)
+		snapshot = captureMapKey(snapshot, *k, scope, options)
+		snapshot = captureChecksumMap(
+			snapshot, *v,
+			// map can reference itself in value, so we set doNotDetectRefLoop
+			withFlags(options, options.Flags|doNotDetectRefLoop),
+		)
+	}
+	snapshot.contentPosition = scope + 1
+	return snapshot
+}
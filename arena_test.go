@@ -0,0 +1,103 @@
+package immcheck_test
+
+import (
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+func TestArena(t *testing.T) {
+	t.Parallel()
+	type registry struct {
+		entries map[string]map[string]string
+	}
+	r := &registry{entries: map[string]map[string]string{
+		"a": {"k1": "v1"},
+		"b": {"k2": "v2", "k3": "v3"},
+	}}
+	options := immcheck.Options{Arena: immcheck.NewArena()}
+	immcheck.EnsureImmutabilityWithOptions(r, options)() // check that no mutation is fine
+	panicMessage := expectMutationPanic(t, func() {
+		defer immcheck.EnsureImmutabilityWithOptions(r, options)()
+		r.entries["b"]["k2"] = "changed"
+	})
+	checkMutationDetectionMessage(t, panicMessage)
+
+	options.Arena.Reset()
+	immcheck.EnsureImmutabilityWithOptions(r, options)() // check that arena is usable after reset
+}
+
+func TestArenaIsConfinedToCaller(t *testing.T) {
+	t.Parallel()
+	options := immcheck.Options{Arena: immcheck.NewArena()}
+	value := &map[string]int{"a": 1}
+	expectPanic(t, func() {
+		immcheck.EnsureImmutabilityAsync(value, options)
+	}, immcheck.UnsupportedTypeError)
+	expectPanic(t, func() {
+		immcheck.EnsureImmutabilityOnNextGC(value, options)
+	}, immcheck.UnsupportedTypeError)
+	expectPanic(t, func() {
+		immcheck.CheckImmutabilityOnFinalizationWithOptions(value, options)
+	}, immcheck.UnsupportedTypeError)
+	expectPanic(t, func() {
+		immcheck.GuardReturn(value, options)
+	}, immcheck.UnsupportedTypeError)
+	options.Flags = immcheck.AlsoCheckOnFinalization
+	expectPanic(t, func() {
+		immcheck.EnsureImmutabilityWithOptions(value, options)
+	}, immcheck.UnsupportedTypeError)
+}
+
+func TestArenaReleasesValues(t *testing.T) {
+	t.Parallel()
+	type payload struct {
+		data [64]byte
+	}
+	var collected int32
+	entry := &payload{}
+	runtime.SetFinalizer(entry, func(*payload) { atomic.StoreInt32(&collected, 1) })
+	options := immcheck.Options{Arena: immcheck.NewArena()}
+	immcheck.CaptureSnapshotWithOptions(map[string]*payload{"entry": entry}, immcheck.NewValueSnapshot(), options)
+	entry = nil
+
+	// arena is still reachable, but values it holds don't keep guarded data alive
+	deadline := time.Now().Add(10 * time.Second)
+	for atomic.LoadInt32(&collected) == 0 && time.Now().Before(deadline) {
+		runtime.GC()
+		time.Sleep(time.Millisecond)
+	}
+	if atomic.LoadInt32(&collected) == 0 {
+		t.Fatal("guarded value is retained by arena")
+	}
+	runtime.KeepAlive(options.Arena)
+}
+
+func TestArenaDoesNotAllocate(t *testing.T) {
+	if immcheck.ImmcheckRaceEnabled {
+		t.Skip("race detector instrumentation allocates during map iteration")
+	}
+	if sanitizersEnabled {
+		t.Skip("sanitizers instrumentation adds heap allocations")
+	}
+	type registry struct {
+		entries map[int]map[int]int
+	}
+	r := &registry{entries: map[int]map[int]int{1: {1: 1}, 2: {2: 2}}}
+	options := immcheck.Options{Flags: immcheck.SkipOriginCapturing, Arena: immcheck.NewArena()}
+	original := immcheck.NewValueSnapshot()
+	other := immcheck.NewValueSnapshot()
+	allocs := testing.AllocsPerRun(100, func() {
+		original = immcheck.CaptureSnapshotWithOptions(r, original, options)
+		other = immcheck.CaptureSnapshotWithOptions(r, other, options)
+		if err := original.CheckImmutabilityAgainst(other); err != nil {
+			t.Fatalf("unexpected error happened: %v", err)
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("unexpected allocations per run: %v", allocs)
+	}
+}
@@ -0,0 +1,59 @@
+package immcheck
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sync/atomic"
+)
+
+// pendingBaseline owns pooled baseline snapshot of check returned by immcheck.EnsureImmutability.
+// Snapshot is returned to the pool when check is called or, if check is dropped without calling,
+// when pendingBaseline is finalized.
+type pendingBaseline struct {
+	snapshot *ValueSnapshot
+	released int32
+	// captureOrigin is kept aside, since released snapshot can already be re-used by other captures
+	captureOrigin OriginID
+}
+
+func newPendingBaseline(snapshot *ValueSnapshot, lifecycle guardLifecycle, options Options) *pendingBaseline {
+	baseline := &pendingBaseline{snapshot: snapshot, captureOrigin: snapshot.captureOrigin}
+	runtime.SetFinalizer(baseline, func(baseline *pendingBaseline) {
+		if !baseline.release() {
+			return
+		}
+		lifecycle.emit(GuardCancelled, nil)
+		if options.Flags&ReportNeverVerifiedChecks != 0 {
+			reportNeverVerified(baseline.captureOrigin, options)
+		}
+	})
+	return baseline
+}
+
+// release returns baseline snapshot to the pool once. Returns false if it was already released.
+func (b *pendingBaseline) release() bool {
+	if !atomic.CompareAndSwapInt32(&b.released, 0, 1) {
+		return false
+	}
+	putTempSnapshot(b.snapshot)
+	return true
+}
+
+func reportNeverVerified(captureOrigin OriginID, options Options) {
+	var logDestination io.Writer = os.Stderr
+	if options.LogWriter != nil {
+		logDestination = options.LogWriter
+	}
+	origin, ok := LookupOrigin(captureOrigin)
+	if !ok {
+		_, _ = fmt.Fprintf(logDestination, "[WARN] immutability check was never verified\n")
+		return
+	}
+	_, _ = fmt.Fprintf(
+		logDestination,
+		"[WARN] immutability check was never verified; snapshot was captured here %v\n",
+		origin,
+	)
+}
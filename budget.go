@@ -0,0 +1,51 @@
+package immcheck
+
+import "sync/atomic"
+
+// degradedSampleEvery is the sampling rate of guards created after their Budget was exceeded.
+const degradedSampleEvery = 16
+
+// Budget limits amount of memory and number of nodes captured by guards of one request,
+// so a single pathological request object can't blow latency of the request.
+// Guards attached to the same Budget via Options.Budget share it. Once it is exceeded,
+// immcheck.EnsureImmutabilityWithOptions captures only every 16th value guarded with it
+// and reports of mutations detected by such guards note the downgrade, see MutationError.BudgetExceeded.
+// Guards created before the budget was exceeded verify their values as usual.
+//
+// Budget is safe for concurrent use.
+type Budget struct {
+	maxBytes int64
+	maxNodes int64
+
+	bytes int64
+	nodes int64
+	calls uint32
+}
+
+// NewBudget creates new Budget that is exceeded when guards attached to it capture more than maxBytes bytes
+// or more than maxNodes nodes of values in total. 0 means no limit.
+func NewBudget(maxBytes int, maxNodes int) *Budget {
+	return &Budget{maxBytes: int64(maxBytes), maxNodes: int64(maxNodes)}
+}
+
+// Usage returns the number of bytes and nodes captured by guards attached to the budget.
+func (b *Budget) Usage() (bytes int, nodes int) {
+	return int(atomic.LoadInt64(&b.bytes)), int(atomic.LoadInt64(&b.nodes))
+}
+
+// Exceeded reports whether guards attached to the budget captured more than it allows.
+func (b *Budget) Exceeded() bool {
+	return (b.maxBytes != 0 && atomic.LoadInt64(&b.bytes) > b.maxBytes) ||
+		(b.maxNodes != 0 && atomic.LoadInt64(&b.nodes) > b.maxNodes)
+}
+
+// charge accounts snapshot captured by a guard attached to the budget.
+func (b *Budget) charge(snapshot *ValueSnapshot) {
+	atomic.AddInt64(&b.bytes, int64(snapshot.capturedBytes))
+	atomic.AddInt64(&b.nodes, int64(snapshot.nodes))
+}
+
+// sampled reports whether guard created after the budget was exceeded should capture its value.
+func (b *Budget) sampled() bool {
+	return atomic.AddUint32(&b.calls, 1)%degradedSampleEvery == 0
+}
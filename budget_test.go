@@ -0,0 +1,56 @@
+package immcheck_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+func TestBudgetDowngradesGuards(t *testing.T) {
+	t.Parallel()
+	budget := immcheck.NewBudget(1024, 0)
+	reporter := &recordingReporter{}
+	options := immcheck.Options{Budget: budget, Reporter: reporter}
+	payload := make([]byte, 800)
+
+	immcheck.EnsureImmutabilityWithOptions(&payload, options)()
+	if bytes, nodes := budget.Usage(); budget.Exceeded() || bytes < len(payload) || nodes == 0 {
+		t.Fatalf("unexpected usage: %v bytes, %v nodes", bytes, nodes)
+	}
+	immcheck.EnsureImmutabilityWithOptions(&payload, options)()
+	if !budget.Exceeded() {
+		t.Fatal("budget isn't exceeded")
+	}
+
+	verifiedGuards := 0
+	for i := 0; i < 32; i++ {
+		check := immcheck.EnsureImmutabilityWithOptions(&payload, options)
+		if !immcheck.IsNoopCheck(check) {
+			verifiedGuards++
+		}
+		payload[0]++
+		check()
+	}
+	if verifiedGuards != 2 || len(reporter.errs) != 2 {
+		t.Fatalf("guards aren't sampled: %v verified, %v reported", verifiedGuards, len(reporter.errs))
+	}
+	var mutationErr *immcheck.MutationError
+	if !errors.As(reporter.errs[0], &mutationErr) || !mutationErr.BudgetExceeded {
+		t.Fatalf("downgrade isn't reported: %v", reporter.errs[0])
+	}
+	if !strings.Contains(mutationErr.Error(), "guard budget was exceeded") {
+		t.Fatalf("unexpected report: %v", mutationErr)
+	}
+}
+
+func TestBudgetOfNodes(t *testing.T) {
+	t.Parallel()
+	budget := immcheck.NewBudget(0, 8)
+	tree := map[string][]string{"a": {"1"}, "b": {"2"}, "c": {"3"}, "d": {"4"}}
+	immcheck.EnsureImmutabilityWithOptions(&tree, immcheck.Options{Budget: budget})()
+	if _, nodes := budget.Usage(); !budget.Exceeded() || nodes <= 8 {
+		t.Fatalf("budget isn't exceeded: %v nodes", nodes)
+	}
+}
@@ -0,0 +1,93 @@
+package immcheck
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// ImmcheckRaceEnabled can be used in test to verify if mutability should be detected or not.
+// It is true under `race` or `immcheck` build flags that enable both immcheck.RaceInlineChecksEnabled
+// and immcheck.RaceFinalizerChecksEnabled.
+const ImmcheckRaceEnabled = raceBuildTag || immcheckBuildTag
+
+// hashBackend names hash function used to capture checksums and digests of values.
+const hashBackend = "xxh3"
+
+// BuildInfoReport describes the level of protection immcheck runs with, see immcheck.BuildInfo.
+type BuildInfoReport struct {
+	// GoVersion is the Go version the binary is built with.
+	GoVersion string
+	// Tags are build tags that change behavior of immcheck and are active in the binary, like "race".
+	Tags []string
+	// RaceInlineChecksEnabled is the same as immcheck.RaceInlineChecksEnabled.
+	RaceInlineChecksEnabled bool
+	// RaceFinalizerChecksEnabled is the same as immcheck.RaceFinalizerChecksEnabled.
+	RaceFinalizerChecksEnabled bool
+	// ChecksDisabled is true if checks are switched off by off toggle, see immcheck.SetRuntimeToggles.
+	ChecksDisabled bool
+	// InlineChecksDisabled and FinalizerChecksDisabled are true if checks of the mechanism are switched off
+	// by inline and finalizer toggles, see immcheck.SetRuntimeToggles.
+	InlineChecksDisabled    bool
+	FinalizerChecksDisabled bool
+	// HashBackend names hash function used to capture checksums, like "xxh3".
+	HashBackend string
+	// Internals names implementation of access to Go runtime internals used for captures, layout or reflect,
+	// see internals toggle of immcheck.SetRuntimeToggles. Options.SafeMode selects reflect for a single check.
+	Internals string
+	// LayoutsVerified is true if memory layouts of Go runtime internals are verified for GoVersion,
+	// otherwise they were probed at startup.
+	LayoutsVerified bool
+	// GoVersionShim names shim of Go version specific APIs immcheck is built with, like "go1.20".
+	GoVersionShim string
+}
+
+// BuildInfo reports build tags, hashing backend, unsafe mode and Go version shim immcheck runs with,
+// so applications can log at startup what level of protection they have.
+// Runtime parts of the report reflect runtime toggles at the time of the call.
+func BuildInfo() BuildInfoReport {
+	tags := make([]string, 0, 4)
+	for _, tag := range [...]struct {
+		name   string
+		active bool
+	}{
+		{"race", raceBuildTag},
+		{"immcheck", immcheckBuildTag},
+		{"immcheck_inline", inlineBuildTag},
+		{"immcheck_finalizer", finalizerBuildTag},
+	} {
+		if tag.active {
+			tags = append(tags, tag.name)
+		}
+	}
+	current := loadRuntimeToggles()
+	return BuildInfoReport{
+		GoVersion:                  runtime.Version(),
+		Tags:                       tags,
+		RaceInlineChecksEnabled:    RaceInlineChecksEnabled,
+		RaceFinalizerChecksEnabled: RaceFinalizerChecksEnabled,
+		ChecksDisabled:             current.off,
+		InlineChecksDisabled:       current.skipInline,
+		FinalizerChecksDisabled:    current.skipFinalizer,
+		HashBackend:                hashBackend,
+		Internals:                  internalsName(currentInternals()),
+		LayoutsVerified:            layoutsKnown,
+		GoVersionShim:              goVersionShim,
+	}
+}
+
+// String provides a single line suitable for startup logs.
+func (r BuildInfoReport) String() string {
+	tags := "none"
+	if len(r.Tags) != 0 {
+		tags = strings.Join(r.Tags, ",")
+	}
+	return fmt.Sprintf(
+		"immcheck on %v: tags=%v race_inline_checks=%v race_finalizer_checks=%v "+
+			"checks_disabled=%v inline_checks_disabled=%v finalizer_checks_disabled=%v "+
+			"hash=%v internals=%v layouts_verified=%v shim=%v",
+		r.GoVersion, tags, r.RaceInlineChecksEnabled, r.RaceFinalizerChecksEnabled,
+		r.ChecksDisabled, r.InlineChecksDisabled, r.FinalizerChecksDisabled,
+		r.HashBackend, r.Internals, r.LayoutsVerified, r.GoVersionShim,
+	)
+}
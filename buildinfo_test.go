@@ -0,0 +1,39 @@
+package immcheck_test
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+func TestBuildInfo(t *testing.T) {
+	// toggles are process-wide, so the test isn't parallel
+	defer func() {
+		if err := immcheck.SetRuntimeToggles(""); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	info := immcheck.BuildInfo()
+	if info.GoVersion != runtime.Version() || info.HashBackend != "xxh3" || info.GoVersionShim == "" {
+		t.Fatalf("unexpected build info: %+v", info)
+	}
+	if info.RaceInlineChecksEnabled != immcheck.RaceInlineChecksEnabled ||
+		info.RaceFinalizerChecksEnabled != immcheck.RaceFinalizerChecksEnabled ||
+		(len(info.Tags) != 0) != (immcheck.RaceInlineChecksEnabled || immcheck.RaceFinalizerChecksEnabled) {
+		t.Fatalf("unexpected build tags: %+v", info)
+	}
+	if info.ChecksDisabled || !strings.Contains(info.String(), "hash=xxh3") {
+		t.Fatalf("unexpected build info: %v", info)
+	}
+
+	if err := immcheck.SetRuntimeToggles("off,finalizer=0,internals=reflect"); err != nil {
+		t.Fatal(err)
+	}
+	info = immcheck.BuildInfo()
+	if !info.ChecksDisabled || info.InlineChecksDisabled || !info.FinalizerChecksDisabled || info.Internals != "reflect" {
+		t.Fatalf("runtime toggles aren't reported: %v", info)
+	}
+}
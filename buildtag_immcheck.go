@@ -0,0 +1,7 @@
+//go:build immcheck
+// +build immcheck
+
+package immcheck
+
+// immcheckBuildTag reports whether immcheck is built with `immcheck` build tag.
+const immcheckBuildTag = true
@@ -0,0 +1,7 @@
+//go:build immcheck_finalizer
+// +build immcheck_finalizer
+
+package immcheck
+
+// finalizerBuildTag reports whether immcheck is built with `immcheck_finalizer` build tag.
+const finalizerBuildTag = true
@@ -0,0 +1,7 @@
+//go:build !immcheck_inline
+// +build !immcheck_inline
+
+package immcheck
+
+// inlineBuildTag reports whether immcheck is built with `immcheck_inline` build tag.
+const inlineBuildTag = false
@@ -0,0 +1,7 @@
+//go:build race
+// +build race
+
+package immcheck
+
+// raceBuildTag reports whether immcheck is built with `race` build tag, like `go test -race` does.
+const raceBuildTag = true
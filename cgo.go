@@ -0,0 +1,93 @@
+package immcheck
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// CgoGuard guards Go value whose memory is passed to C code as read-only, like a struct of parameters
+// or a buffer passed to C function by pointer, so C code scribbling on it is reported.
+// The value has to consist of Go memory only: memory allocated by C isn't reachable through typed Go values,
+// and cgo pointer passing rules don't allow Go memory passed to C to contain Go pointers anyway,
+// so guarded values are typically structs of numbers and arrays, or byte slices.
+// Mutations made by C code are attributed to the call that made them, see MutationError.CgoCall.
+//
+// CgoGuard is safe for concurrent use, but the value itself must not be mutated while the guard is active.
+type CgoGuard struct {
+	mutex   sync.Mutex
+	options Options
+	target  reflect.Value
+	// baseline is nil if the guard is switched off by immcheck.SetRuntimeToggles
+	baseline    *ValueSnapshot
+	newSnapshot *ValueSnapshot
+}
+
+// GuardCgo captures snapshot of v according to settings specified in options and returns CgoGuard for it.
+// v is typically a pointer to the memory passed to C code.
+// If inline checks are switched off by immcheck.SetRuntimeToggles, returned guard only runs calls.
+func GuardCgo(v interface{}, options Options) *CgoGuard {
+	if v == nil {
+		panic(fmt.Errorf("%w. target value can't be nil", UnsupportedTypeError))
+	}
+	if inlineChecksDisabled() {
+		return &CgoGuard{target: targetValueOf(v)}
+	}
+	options = withDefaultOptions(options)
+	guard := &CgoGuard{
+		options:     options,
+		target:      targetValueOf(v),
+		baseline:    newValueSnapshot(),
+		newSnapshot: newValueSnapshot(),
+	}
+	skipThreeFrames := 3
+	guard.baseline = initValueSnapshot(guard.baseline, options, skipThreeFrames)
+	guard.baseline = captureChecksumMap(guard.baseline, guard.target, options)
+	return guard
+}
+
+// Call wraps a cgo call that receives the guarded memory, like
+//
+//	guard.Call("C.render", func() { C.render((*C.char)(unsafe.Pointer(&buf[0])), C.size_t(len(buf))) })
+//
+// It verifies the value before the call, so mutations made by Go code aren't blamed on C code,
+// runs call and verifies the value again. Mutation detected after the call is attributed to it by name.
+// If mutation is detected Call will panic, unless options specify otherwise.
+// Reported mutation isn't reported again, so the guard keeps guarding the mutated value.
+func (g *CgoGuard) Call(name string, call func()) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	skipThreeFrames := 3
+	g.verify(skipThreeFrames, "")
+	call()
+	g.verify(skipThreeFrames, name)
+}
+
+// Check verifies that value wasn't mutated since the guard was created or since the last verification.
+// It is useful after C code that keeps pointers to the memory returns, like after completion of asynchronous I/O.
+// If mutation is detected Check will panic, unless options specify otherwise.
+func (g *CgoGuard) Check() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	skipThreeFrames := 3
+	g.verify(skipThreeFrames, "")
+}
+
+// verify checks the value against the baseline, cgoCall is the name of the call that has just returned.
+func (g *CgoGuard) verify(framesToSkip int, cgoCall string) {
+	if g.baseline == nil {
+		return
+	}
+	g.newSnapshot = initValueSnapshot(g.newSnapshot, g.options, framesToSkip)
+	g.newSnapshot = captureChecksumMap(g.newSnapshot, g.target, g.options)
+	checkErr := g.baseline.CheckImmutabilityAgainst(g.newSnapshot)
+	if checkErr == nil {
+		return
+	}
+	// re-arm, so the same mutation isn't reported twice
+	g.baseline, g.newSnapshot = g.newSnapshot, g.baseline
+	if mutationErr, ok := checkErr.(*MutationError); ok {
+		mutationErr.CgoCall = cgoCall
+	}
+	reportError(checkErr, g.options)
+}
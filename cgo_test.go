@@ -0,0 +1,60 @@
+package immcheck_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"unsafe"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+type renderParams struct {
+	width   int32
+	height  int32
+	palette [4]byte
+}
+
+// scribble writes through pointer the way C code receiving the pointer does.
+func scribble(pointer unsafe.Pointer, offset uintptr) {
+	*(*byte)(unsafe.Pointer(uintptr(pointer) + offset)) = 0xff
+}
+
+func TestCgoGuard(t *testing.T) {
+	t.Parallel()
+	params := &renderParams{width: 640, height: 480, palette: [4]byte{1, 2, 3, 4}}
+	reporter := &recordingReporter{}
+	guard := immcheck.GuardCgo(params, immcheck.Options{Reporter: reporter})
+	guard.Call("C.render", func() {
+		_ = *(*renderParams)(unsafe.Pointer(params))
+	})
+	guard.Call("C.render", func() {
+		scribble(unsafe.Pointer(params), unsafe.Offsetof(params.palette)+1)
+	})
+	// mutation made by Go code isn't blamed on the next call
+	params.width = 800
+	guard.Call("C.resize", func() {})
+	guard.Check()
+	if len(reporter.errs) != 2 {
+		t.Fatalf("unexpected number of reported mutations: %v", reporter.errs)
+	}
+	var mutationErr *immcheck.MutationError
+	if !errors.As(reporter.errs[0], &mutationErr) || mutationErr.CgoCall != "C.render" {
+		t.Fatalf("mutation isn't attributed to cgo call: %v", reporter.errs[0])
+	}
+	if !strings.Contains(mutationErr.Error(), "mutation occurred during cgo call 'C.render'") {
+		t.Fatalf("unexpected report: %v", mutationErr)
+	}
+	if !errors.As(reporter.errs[1], &mutationErr) || mutationErr.CgoCall != "" {
+		t.Fatalf("mutation made by Go code is attributed to cgo call: %v", reporter.errs[1])
+	}
+
+	buffer := []byte("read-only input")
+	bufferGuard := immcheck.GuardCgo(buffer, immcheck.Options{Flags: immcheck.SkipLoggingOnMutation})
+	expectMutationPanic(t, func() {
+		bufferGuard.Call("C.parse", func() {
+			scribble(unsafe.Pointer(&buffer[0]), 3)
+		})
+	})
+	bufferGuard.Check()
+}
@@ -0,0 +1,84 @@
+package immcheck
+
+import "strings"
+
+// MutationKind is a bitmask of mutation classes, derived from classes of checksums that differ between snapshots.
+// Several kinds can be set for a single mutation. Use it for alert routing and automatic triage.
+type MutationKind uint8
+
+const (
+	// ContentChanged means that bytes reachable from guarded value were changed.
+	ContentChanged MutationKind = 1 << iota
+	// PointerRetargeted means that references or string headers were set to different memory with equal content.
+	PointerRetargeted
+	// LengthChanged means that total length of guarded slices was changed.
+	LengthChanged
+	// EntryAdded means that entries were added into guarded maps or containers.
+	EntryAdded
+	// EntryRemoved means that entries were removed from guarded maps or containers.
+	EntryRemoved
+	// Released means that pointers, interfaces or maps that were set at capture time became nil.
+	Released
+	// Truncated means that total length of guarded slices was decreased.
+	Truncated
+)
+
+//nolint:gochecknoglobals // mutationKindNames is effectively a constant
+var mutationKindNames = [...]string{
+	"content_changed",
+	"pointer_retargeted",
+	"length_changed",
+	"entry_added",
+	"entry_removed",
+	"released",
+	"truncated",
+}
+
+// Has reports whether all kinds are set in k.
+func (k MutationKind) Has(kinds MutationKind) bool {
+	return k&kinds == kinds
+}
+
+// String returns machine-readable names of mutation kinds separated by commas, like "content_changed,truncated".
+func (k MutationKind) String() string {
+	names := make([]string, 0, len(mutationKindNames))
+	for i, name := range mutationKindNames {
+		if k&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// classifyMutation derives kinds of mutation from classes of checksums that differ between snapshots.
+func classifyMutation(originalSnapshot *ValueSnapshot, newSnapshot *ValueSnapshot) MutationKind {
+	var kinds MutationKind
+	switch {
+	case newSnapshot.contentDigest != originalSnapshot.contentDigest && !releasedOnly(originalSnapshot, newSnapshot):
+		// content of released values is missing, but it wasn't changed
+		kinds |= ContentChanged
+	case newSnapshot.nilReferences == originalSnapshot.nilReferences &&
+		(newSnapshot.stringIdentities != originalSnapshot.stringIdentities ||
+			!checksumEquals(newSnapshot.checksums, originalSnapshot.checksums)):
+		kinds |= PointerRetargeted
+	}
+	switch {
+	case newSnapshot.sequenceLengths < originalSnapshot.sequenceLengths:
+		kinds |= LengthChanged | Truncated
+	case newSnapshot.sequenceLengths > originalSnapshot.sequenceLengths:
+		kinds |= LengthChanged
+	}
+	switch {
+	case newSnapshot.entries > originalSnapshot.entries:
+		kinds |= EntryAdded
+	case newSnapshot.entries < originalSnapshot.entries:
+		kinds |= EntryRemoved
+	case newSnapshot.mapKeySet != originalSnapshot.mapKeySet:
+		// keys were replaced
+		kinds |= EntryAdded | EntryRemoved
+	}
+	if newSnapshot.nilReferences > originalSnapshot.nilReferences {
+		kinds |= Released
+	}
+	return kinds
+}
@@ -0,0 +1,85 @@
+package immcheck_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+func TestMutationKinds(t *testing.T) {
+	t.Parallel()
+	type inventory struct {
+		Items  []string
+		Counts map[string]int
+		Owner  *string
+	}
+	newInventory := func() *inventory {
+		owner := "gopher"
+		return &inventory{
+			Items:  []string{"a", "b", "c"},
+			Counts: map[string]int{"a": 1, "b": 2},
+			Owner:  &owner,
+		}
+	}
+	testCases := []struct {
+		name     string
+		mutate   func(value *inventory)
+		expected immcheck.MutationKind
+	}{
+		{
+			name:     "content",
+			mutate:   func(value *inventory) { value.Counts["a"] = 3 },
+			expected: immcheck.ContentChanged,
+		},
+		{
+			name: "retarget",
+			mutate: func(value *inventory) {
+				owner := *value.Owner
+				value.Owner = &owner
+			},
+			expected: immcheck.PointerRetargeted,
+		},
+		{
+			name:     "truncate",
+			mutate:   func(value *inventory) { value.Items = value.Items[:2] },
+			expected: immcheck.ContentChanged | immcheck.LengthChanged | immcheck.Truncated,
+		},
+		{
+			name:     "append",
+			mutate:   func(value *inventory) { value.Items = append(value.Items, "d") },
+			expected: immcheck.ContentChanged | immcheck.LengthChanged,
+		},
+		{
+			name:     "add entry",
+			mutate:   func(value *inventory) { value.Counts["c"] = 3 },
+			expected: immcheck.ContentChanged | immcheck.EntryAdded,
+		},
+		{
+			name:     "remove entry",
+			mutate:   func(value *inventory) { delete(value.Counts, "b") },
+			expected: immcheck.ContentChanged | immcheck.EntryRemoved,
+		},
+		{
+			name:     "release",
+			mutate:   func(value *inventory) { value.Owner = nil },
+			expected: immcheck.Released,
+		},
+	}
+	for _, testCase := range testCases {
+		value := newInventory()
+		verify := immcheck.EnsureImmutabilityErr(value, immcheck.Options{})
+		testCase.mutate(value)
+		var mutationErr *immcheck.MutationError
+		if err := verify(); !errors.As(err, &mutationErr) || mutationErr.Kinds != testCase.expected {
+			t.Fatalf("%v: unexpected classification %v of error: %v", testCase.name, mutationErr.Kinds, err)
+		}
+		if !strings.Contains(mutationErr.Error(), "mutation kinds: "+testCase.expected.String()) {
+			t.Fatalf("%v: unexpected error message: %v", testCase.name, mutationErr)
+		}
+	}
+	if kinds := immcheck.ContentChanged | immcheck.Truncated; kinds.String() != "content_changed,truncated" {
+		t.Fatalf("unexpected names of kinds: %v", kinds)
+	}
+}
@@ -0,0 +1,117 @@
+package immcheck
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Combine chains several checks into one, so functions guarding several inputs can use a single defer.
+// Combined check runs all checks even if some of them panic.
+// If only one check panicked its panic is re-raised as is,
+// if several checks panicked combined check panics with *immcheck.CombinedError.
+// Nil checks and immcheck.NoopCheck are skipped, if nothing is left immcheck.NoopCheck is returned.
+// Note that detection origin of combined checks points to immcheck internals, capture origins are preserved.
+func Combine(checks ...func()) func() {
+	activeChecks := make([]func(), 0, len(checks))
+	for _, check := range checks {
+		if check != nil && !IsNoopCheck(check) {
+			activeChecks = append(activeChecks, check)
+		}
+	}
+	if len(activeChecks) == 0 {
+		return NoopCheck
+	}
+	return func() {
+		var panics []interface{}
+		for _, check := range activeChecks {
+			if panicValue := runCheck(check); panicValue != nil {
+				panics = append(panics, panicValue)
+			}
+		}
+		switch len(panics) {
+		case 0:
+			return
+		case 1:
+			panic(panics[0])
+		}
+		combinedErr := &CombinedError{Errors: make([]error, 0, len(panics))}
+		for _, panicValue := range panics {
+			err, ok := panicValue.(error)
+			if !ok {
+				err = fmt.Errorf("check panicked: %v", panicValue)
+			}
+			combinedErr.Errors = append(combinedErr.Errors, err)
+		}
+		panic(combinedErr)
+	}
+}
+
+// CombineErr works the same way as immcheck.Combine for checks that return errors,
+// like ones created by immcheck.EnsureImmutabilityErr.
+// Combined check returns nil, the only error or *immcheck.CombinedError with all errors.
+func CombineErr(checks ...func() error) func() error {
+	return func() error {
+		var errs []error
+		for _, check := range checks {
+			if check == nil {
+				continue
+			}
+			if err := check(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		switch len(errs) {
+		case 0:
+			return nil
+		case 1:
+			return errs[0]
+		}
+		return &CombinedError{Errors: errs}
+	}
+}
+
+// CombinedError is reported by combined checks if several checks failed.
+// errors.Is and errors.As match any of combined errors.
+type CombinedError struct {
+	Errors []error
+}
+
+// Error provides human-readable description of all errors.
+func (c *CombinedError) Error() string {
+	buf := &strings.Builder{}
+	_, _ = fmt.Fprintf(buf, "%v checks failed", len(c.Errors))
+	for _, err := range c.Errors {
+		buf.WriteString("\n")
+		buf.WriteString(err.Error())
+	}
+	return buf.String()
+}
+
+// Is reports whether any of combined errors matches target.
+func (c *CombinedError) Is(target error) bool {
+	for _, err := range c.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first combined error that matches target.
+func (c *CombinedError) As(target interface{}) bool {
+	for _, err := range c.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func runCheck(check func()) (panicValue interface{}) {
+	defer func() {
+		panicValue = recover()
+	}()
+	check()
+	return nil
+}
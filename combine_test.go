@@ -0,0 +1,69 @@
+package immcheck_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+func TestCombine(t *testing.T) {
+	t.Parallel()
+	first, second := 1, "second"
+	if !immcheck.IsNoopCheck(immcheck.Combine(nil, immcheck.NoopCheck)) {
+		t.Fatal("combination of noop checks isn't noop")
+	}
+	immcheck.Combine(immcheck.EnsureImmutability(&first), immcheck.EnsureImmutability(&second))()
+
+	options := immcheck.Options{Flags: immcheck.SkipLoggingOnMutation}
+	expectMutationPanic(t, func() {
+		defer immcheck.Combine(
+			immcheck.EnsureImmutabilityWithOptions(&first, options),
+			immcheck.EnsureImmutabilityWithOptions(&second, options),
+		)()
+		second = "changed"
+	})
+
+	var actualPanic interface{}
+	func() {
+		defer func() { actualPanic = recover() }()
+		defer immcheck.Combine(
+			immcheck.EnsureImmutabilityWithOptions(&first, options),
+			immcheck.EnsureImmutabilityWithOptions(&second, options),
+		)()
+		first++
+		second = "changed again"
+	}()
+	var combinedErr *immcheck.CombinedError
+	if err, ok := actualPanic.(error); !ok || !errors.As(err, &combinedErr) || len(combinedErr.Errors) != 2 {
+		t.Fatalf("unexpected panic value: %T(%v)", actualPanic, actualPanic)
+	}
+	if !errors.Is(combinedErr, immcheck.MutationDetectedError) ||
+		!strings.HasPrefix(combinedErr.Error(), "2 checks failed\n") {
+		t.Fatalf("unexpected combined error: %v", combinedErr)
+	}
+}
+
+func TestCombineErr(t *testing.T) {
+	t.Parallel()
+	first, second := 1, 2
+	verify := immcheck.CombineErr(
+		immcheck.EnsureImmutabilityErr(&first, immcheck.Options{}),
+		nil,
+		immcheck.EnsureImmutabilityErr(&second, immcheck.Options{}),
+	)
+	if err := verify(); err != nil {
+		t.Fatalf("unexpected error happened: %v", err)
+	}
+	second++
+	var mutationErr *immcheck.MutationError
+	if err := verify(); !errors.As(err, &mutationErr) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	first++
+	var combinedErr *immcheck.CombinedError
+	if err := verify(); !errors.As(err, &combinedErr) || len(combinedErr.Errors) != 2 {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+package immcheck
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// DiffReport describes differences between two values found by immcheck.Compare.
+type DiffReport struct {
+	// Differences are ordered by the walk order: fields in declaration order, items by index, map entries by key.
+	Differences []Difference
+}
+
+// Difference describes a single difference between two compared values.
+type Difference struct {
+	// Path is Go-like path of the difference relative to compared values, like .Roles[0] or .Labels["env"].
+	// Pointers and interfaces are dereferenced transparently. Path of compared values themselves is empty.
+	Path string
+	// Kind classifies the difference: ContentChanged, EntryAdded, EntryRemoved or Released.
+	Kind MutationKind
+	// Old and New are values at Path formatted deterministically: strings as is, map entries sorted by keys,
+	// reference cycles as <cycle> and large values truncated. Missing value is empty.
+	Old string
+	New string
+}
+
+// Equal reports whether compared values have no differences.
+func (d *DiffReport) Equal() bool {
+	return len(d.Differences) == 0
+}
+
+// String provides human-readable description of differences, one difference per line.
+func (d *DiffReport) String() string {
+	buf := &bytes.Buffer{}
+	for _, difference := range d.Differences {
+		path := difference.Path
+		if path == "" {
+			path = "<root>"
+		}
+		_, _ = fmt.Fprintf(buf, "%v: %v: %v -> %v\n", path, difference.Kind, difference.Old, difference.New)
+	}
+	return buf.String()
+}
+
+// Compare walks a and b of the same type in lockstep and reports field-path-level differences between them,
+// so callers can find out what changed between two versions of the object.
+// Values are compared the same way snapshots are: floats are compared bitwise unless NormalizeFloats flag is set,
+// pointers aren't compared by identity, since the content they reference is compared instead.
+// Returns error wrapping immcheck.UnsupportedTypeError if a and b have different types.
+func Compare(a interface{}, b interface{}, options Options) (*DiffReport, error) {
+	if a == nil || b == nil {
+		panic(fmt.Errorf("%w. compared values can't be nil", UnsupportedTypeError))
+	}
+	if reflect.TypeOf(a) != reflect.TypeOf(b) {
+		return nil, fmt.Errorf(
+			"%w. compared values have different types: %T and %T", UnsupportedTypeError, a, b,
+		)
+	}
+	options = withDefaultOptions(options)
+	report := &DiffReport{}
+	walkPair(reflect.ValueOf(a), reflect.ValueOf(b), options, func(path string, a reflect.Value, b reflect.Value) bool {
+		return report.visit(path, a, b, options)
+	})
+	return report, nil
+}
+
+func (d *DiffReport) visit(path string, a reflect.Value, b reflect.Value, options Options) bool {
+	switch {
+	case !a.IsValid() && !b.IsValid():
+		return false
+	case !a.IsValid():
+		d.add(path, EntryAdded, a, b)
+		return false
+	case !b.IsValid():
+		d.add(path, EntryRemoved, a, b)
+		return false
+	case a.Type() != b.Type():
+		// dynamic types of interfaces are different
+		d.add(path, ContentChanged, a, b)
+		return false
+	}
+	//nolint:exhaustive
+	switch a.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map:
+		if a.IsNil() != b.IsNil() {
+			kind := ContentChanged
+			if b.IsNil() {
+				kind = Released
+			}
+			d.add(path, kind, a, b)
+			return false
+		}
+		if a.Kind() == reflect.Interface {
+			return !a.IsNil()
+		}
+		// the same reference has the same content
+		return !a.IsNil() && a.Pointer() != b.Pointer()
+	case reflect.Struct, reflect.Array, reflect.Slice:
+		return true
+	case reflect.UnsafePointer, reflect.Func, reflect.Chan:
+		if a.Pointer() != b.Pointer() {
+			d.add(path, ContentChanged, a, b)
+		}
+		return true
+	}
+	if !primitivesEqual(a, b, options) {
+		d.add(path, ContentChanged, a, b)
+	}
+	return false
+}
+
+func (d *DiffReport) add(path string, kind MutationKind, a reflect.Value, b reflect.Value) {
+	d.Differences = append(d.Differences, Difference{
+		Path: path,
+		Kind: kind,
+		Old:  formatDifferenceValue(a),
+		New:  formatDifferenceValue(b),
+	})
+}
+
+func formatDifferenceValue(value reflect.Value) string {
+	if !value.IsValid() {
+		return ""
+	}
+	if value.Kind() == reflect.String {
+		// strings are compared as is, like %v verb formats them
+		return value.String()
+	}
+	return formatValue(value)
+}
+
+func primitivesEqual(a reflect.Value, b reflect.Value, options Options) bool {
+	//nolint:exhaustive
+	switch a.Kind() {
+	case reflect.Bool:
+		return a.Bool() == b.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() == b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return a.Uint() == b.Uint()
+	case reflect.Float32, reflect.Float64:
+		return floatsEqual(a.Float(), b.Float(), options)
+	case reflect.Complex64, reflect.Complex128:
+		return floatsEqual(real(a.Complex()), real(b.Complex()), options) &&
+			floatsEqual(imag(a.Complex()), imag(b.Complex()), options)
+	case reflect.String:
+		return a.String() == b.String()
+	}
+	return true
+}
+
+func floatsEqual(a float64, b float64, options Options) bool {
+	aBits := math.Float64bits(a)
+	bBits := math.Float64bits(b)
+	if options.Flags&NormalizeFloats != 0 {
+		normalizeFloat64(&aBits)
+		normalizeFloat64(&bBits)
+	}
+	return aBits == bBits
+}
@@ -0,0 +1,230 @@
+package immcheck_test
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+type author struct {
+	name string
+	age  int
+}
+
+type chain struct {
+	value int
+	next  *chain
+}
+
+type document struct {
+	Title   string
+	Tags    []string
+	Labels  map[string]int
+	Score   float64
+	Author  *author
+	Payload interface{}
+}
+
+func TestCompare(t *testing.T) {
+	t.Parallel()
+	a := &document{
+		Title:   "title",
+		Tags:    []string{"a", "b"},
+		Labels:  map[string]int{"env": 1, "team": 2},
+		Score:   math.NaN(),
+		Author:  &author{name: "author", age: 30},
+		Payload: 1,
+	}
+	b := &document{
+		Title:   "title",
+		Tags:    []string{"a", "c", "d"},
+		Labels:  map[string]int{"env": 3, "owner": 4},
+		Score:   math.NaN(),
+		Author:  &author{name: "author", age: 31},
+		Payload: "1",
+	}
+	report, err := immcheck.Compare(a, b, immcheck.Options{Flags: immcheck.NormalizeFloats})
+	if err != nil {
+		t.Fatalf("unexpected error happened: %v", err)
+	}
+	t.Log(report)
+	expected := []immcheck.Difference{
+		{Path: ".Tags[1]", Kind: immcheck.ContentChanged, Old: "b", New: "c"},
+		{Path: ".Tags[2]", Kind: immcheck.EntryAdded, New: "d"},
+		{Path: `.Labels["env"]`, Kind: immcheck.ContentChanged, Old: "1", New: "3"},
+		{Path: `.Labels["owner"]`, Kind: immcheck.EntryAdded, New: "4"},
+		{Path: `.Labels["team"]`, Kind: immcheck.EntryRemoved, Old: "2"},
+		{Path: ".Author.age", Kind: immcheck.ContentChanged, Old: "30", New: "31"},
+		{Path: ".Payload", Kind: immcheck.ContentChanged, Old: "1", New: "1"},
+	}
+	if len(report.Differences) != len(expected) {
+		t.Fatalf("unexpected differences: %v", report)
+	}
+	for i := range expected {
+		if report.Differences[i] != expected[i] {
+			t.Fatalf("unexpected difference: %+v; expected: %+v", report.Differences[i], expected[i])
+		}
+	}
+
+	self, err := immcheck.Compare(a, a, immcheck.Options{Flags: immcheck.NormalizeFloats})
+	if err != nil || !self.Equal() {
+		t.Fatalf("value differs from itself: %v %v", self, err)
+	}
+	if _, err := immcheck.Compare(a, *b, immcheck.Options{}); !errors.Is(err, immcheck.UnsupportedTypeError) {
+		t.Fatalf("values of different types are compared: %v", err)
+	}
+}
+
+func TestCompareCycles(t *testing.T) {
+	t.Parallel()
+	a := &chain{value: 1}
+	a.next = a
+	b := &chain{value: 1}
+	b.next = &chain{value: 2, next: b}
+	report, err := immcheck.Compare(a, b, immcheck.Options{})
+	if err != nil {
+		t.Fatalf("unexpected error happened: %v", err)
+	}
+	if len(report.Differences) != 1 || report.Differences[0].Path != ".next.value" {
+		t.Fatalf("unexpected differences: %v", report)
+	}
+}
+
+func TestWalkPair(t *testing.T) {
+	t.Parallel()
+	type measurement struct {
+		Name   string
+		Values []float64
+		Tags   []string
+	}
+	a := &measurement{Name: "m", Values: []float64{1.0, 2.0}, Tags: []string{"x", "y"}}
+	b := &measurement{Name: "m", Values: []float64{1.0000001, 2.0}, Tags: []string{"y", "x"}}
+
+	var differentPaths []string
+	immcheck.WalkPair(a, b, func(path string, a reflect.Value, b reflect.Value) bool {
+		if !a.IsValid() || !b.IsValid() {
+			differentPaths = append(differentPaths, path)
+			return false
+		}
+		switch {
+		case a.Kind() == reflect.Float64:
+			if math.Abs(a.Float()-b.Float()) > 1e-6 {
+				differentPaths = append(differentPaths, path)
+			}
+			return false
+		case path == ".Tags":
+			// ordering of tags doesn't matter
+			if !sameStrings(a.Interface().([]string), b.Interface().([]string)) {
+				differentPaths = append(differentPaths, path)
+			}
+			return false
+		case a.Kind() == reflect.String:
+			if a.String() != b.String() {
+				differentPaths = append(differentPaths, path)
+			}
+		}
+		return true
+	}, immcheck.Options{})
+	if len(differentPaths) != 0 {
+		t.Fatalf("custom comparator rules aren't applied: %v", differentPaths)
+	}
+}
+
+func TestTraversalOrderIsDeterministic(t *testing.T) {
+	t.Parallel()
+	type entry struct {
+		Weight int
+		Rank   int
+	}
+	// small integers of different types can be boxed into the same memory
+	value := map[interface{}]interface{}{int(1): &entry{Weight: 1}, int64(1): &entry{Weight: 2}}
+	shared := &entry{Weight: 3, Rank: 4}
+	value["struct"] = shared
+	value["field"] = &shared.Weight
+	for i := 0; i < 4; i++ {
+		// pointers to equal values are formatted and encoded the same way
+		key := i
+		value[&key] = &entry{Weight: 10 + i}
+	}
+	traverse := func() (string, string, string) {
+		paths := &strings.Builder{}
+		immcheck.WalkPair(&value, &value, func(path string, a reflect.Value, _ reflect.Value) bool {
+			paths.WriteString(path + "\n")
+			if a.Kind() == reflect.Int {
+				paths.WriteString(strconv.Itoa(int(a.Int())) + "\n")
+			}
+			return true
+		}, immcheck.Options{})
+		encoding := immcheck.StableEncoding(&value, immcheck.Options{})
+		snapshot, err := immcheck.CaptureSnapshot(&value, immcheck.NewValueSnapshot()).MarshalBinary()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return paths.String(), string(encoding), string(snapshot)
+	}
+	expectedPaths, expectedEncoding, expectedSnapshot := traverse()
+	for i := 0; i < 32; i++ {
+		paths, encoding, snapshot := traverse()
+		if paths != expectedPaths {
+			t.Fatalf("walk order is different:\n%v\n%v", paths, expectedPaths)
+		}
+		if encoding != expectedEncoding {
+			t.Fatal("stable encoding is different")
+		}
+		if snapshot != expectedSnapshot {
+			t.Fatalf("snapshot is different:\n%x\n%x", snapshot, expectedSnapshot)
+		}
+	}
+}
+
+func sameStrings(a []string, b []string) bool {
+	counts := make(map[string]int, len(a))
+	for _, s := range a {
+		counts[s]++
+	}
+	for _, s := range b {
+		counts[s]--
+	}
+	for _, count := range counts {
+		if count != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCompareFormatsValuesDeterministically(t *testing.T) {
+	t.Parallel()
+	cyclic := &chain{value: 1}
+	cyclic.next = &chain{value: 2, next: cyclic}
+	labels := map[string]int{"c": 3, "a": 1, "b": 2}
+	for i := 0; i < 10; i++ {
+		report, err := immcheck.Compare(
+			&document{},
+			&document{Payload: []interface{}{cyclic, labels}},
+			immcheck.Options{},
+		)
+		if err != nil || len(report.Differences) != 1 {
+			t.Fatalf("unexpected report: %v; %v", report, err)
+		}
+		expected := `[]interface {}{&immcheck_test.chain{value: 1, next: &immcheck_test.chain{value: 2, next: <cycle>}}, ` +
+			`map[string]int{"a": 1, "b": 2, "c": 3}}`
+		if report.Differences[0].New != expected {
+			t.Fatalf("unexpected formatting: %v", report.Differences[0].New)
+		}
+	}
+
+	deep := &chain{}
+	for i := 0; i < 10; i++ {
+		deep = &chain{value: i, next: deep}
+	}
+	report, err := immcheck.Compare(&document{}, &document{Payload: deep}, immcheck.Options{})
+	if err != nil || !strings.HasSuffix(report.Differences[0].New, "{...}}}}}") {
+		t.Fatalf("depth isn't capped: %v; %v", report, err)
+	}
+}
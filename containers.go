@@ -0,0 +1,190 @@
+package immcheck
+
+import (
+	"bytes"
+	"container/list"
+	"container/ring"
+	"net/http"
+	"net/textproto"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// ContainerWalker enumerates logical elements of a container type.
+// containerPointer is a pointer to the container value (for example *list.List),
+// visit must be called for every element that has to be verified, usually with a pointer to the element value.
+// Registered walkers replace default field-by-field traversal of container internals,
+// so sentinel nodes and back-references of the container are not walked at all.
+type ContainerWalker func(containerPointer interface{}, visit func(element interface{}))
+
+// RegisterContainerWalker registers walker for the containerType.
+// Use it to teach immcheck how to traverse immutable/persistent collection libraries efficiently.
+// containerType has to be a struct type; later registrations for the same type replace previous ones.
+// container/list.List and container/ring.Ring are supported out of the box.
+// Types of standard library that are commonly stashed in caches have built-in walkers as well:
+// bytes.Buffer and strings.Builder are verified by their contents, so spare capacity, read bytes
+// and self-references used for copy detection don't cause reports;
+// time.Time is verified by its instant and location name, so lazy initialization of time.Local doesn't either.
+// http.Header and textproto.MIMEHeader are verified in canonical form: keys are canonicalized
+// the way textproto.CanonicalMIMEHeaderKey does, so re-canonicalized headers aren't reported,
+// while order of values of the same key is still verified. Other types like url.URL are walked field by field.
+func RegisterContainerWalker(containerType reflect.Type, walker ContainerWalker) {
+	if containerType == nil || containerType.Kind() != reflect.Struct {
+		panic("container walker can be registered only for struct types")
+	}
+	if walker == nil {
+		panic("container walker can't be nil")
+	}
+	containerWalkers.Store(containerType, walker)
+}
+
+//nolint:gochecknoglobals // containerWalkers is global so registration is visible to every capture
+var containerWalkers = newContainerWalkersRegistry()
+
+func newContainerWalkersRegistry() *sync.Map {
+	registry := &sync.Map{}
+	registry.Store(reflect.TypeOf(list.List{}), ContainerWalker(walkList))
+	registry.Store(reflect.TypeOf(ring.Ring{}), ContainerWalker(walkRing))
+	registry.Store(reflect.TypeOf(bytes.Buffer{}), ContainerWalker(walkBuffer))
+	registry.Store(reflect.TypeOf(strings.Builder{}), ContainerWalker(walkBuilder))
+	registry.Store(reflect.TypeOf(time.Time{}), ContainerWalker(walkTime))
+	registry.Store(reflect.TypeOf(http.Header{}), ContainerWalker(walkHeader))
+	registry.Store(reflect.TypeOf(textproto.MIMEHeader{}), ContainerWalker(walkHeader))
+	return registry
+}
+
+func walkList(containerPointer interface{}, visit func(element interface{})) {
+	l := containerPointer.(*list.List)
+	for e := l.Front(); e != nil; e = e.Next() {
+		visit(&e.Value)
+	}
+}
+
+func walkRing(containerPointer interface{}, visit func(element interface{})) {
+	r := containerPointer.(*ring.Ring)
+	visit(&r.Value)
+	for p := r.Next(); p != r; p = p.Next() {
+		visit(&p.Value)
+	}
+}
+
+// walkBuffer visits unread bytes of bytes.Buffer.
+// Slices are visited by value, so their content is captured without identity of the backing array.
+func walkBuffer(containerPointer interface{}, visit func(element interface{})) {
+	visit(containerPointer.(*bytes.Buffer).Bytes())
+}
+
+func walkBuilder(containerPointer interface{}, visit func(element interface{})) {
+	visit(containerPointer.(*strings.Builder).String())
+}
+
+func walkTime(containerPointer interface{}, visit func(element interface{})) {
+	t := containerPointer.(*time.Time)
+	visit(t.Unix())
+	visit(t.Nanosecond())
+	visit(t.Location().String())
+}
+
+// walkHeader visits canonical keys of http.Header or textproto.MIMEHeader in sorted order, each followed
+// by its values, so every key is bound to its values, see captureContainer.
+// Values of keys that are equal after canonicalization are merged in order of original keys.
+func walkHeader(containerPointer interface{}, visit func(element interface{})) {
+	var header map[string][]string
+	switch typedHeader := containerPointer.(type) {
+	case *http.Header:
+		header = *typedHeader
+	case *textproto.MIMEHeader:
+		header = *typedHeader
+	}
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		canonicalI, canonicalJ := textproto.CanonicalMIMEHeaderKey(keys[i]), textproto.CanonicalMIMEHeaderKey(keys[j])
+		if canonicalI != canonicalJ {
+			return canonicalI < canonicalJ
+		}
+		return keys[i] < keys[j]
+	})
+	for i := 0; i < len(keys); {
+		canonicalKey := textproto.CanonicalMIMEHeaderKey(keys[i])
+		values := header[keys[i]]
+		for i++; i < len(keys) && textproto.CanonicalMIMEHeaderKey(keys[i]) == canonicalKey; i++ {
+			values = append(values[:len(values):len(values)], header[keys[i]]...)
+		}
+		visit(canonicalKey)
+		visit(values)
+	}
+}
+
+func lookupContainerWalker(valueType reflect.Type) (ContainerWalker, bool) {
+	walker, ok := containerWalkers.Load(valueType)
+	if !ok {
+		return nil, false
+	}
+	return walker.(ContainerWalker), true
+}
+
+func captureContainer(
+	snapshot *ValueSnapshot,
+	value reflect.Value, walker ContainerWalker,
+	options Options,
+) *ValueSnapshot {
+	var valuePointer unsafe.Pointer
+	// pointer of non-addressable container is address of its temporary copy, so it can't identify the container,
+	// while map value is a pointer to the map header itself
+	if value.CanAddr() || value.Kind() == reflect.Map {
+		valuePointer = pointerOfValue(value, internalsOf(options))
+	}
+	containerKey := evalKey(uintptr(valuePointer), reflect.Struct)
+	if valuePointer != nil {
+		// detect ref loop and skip, ring elements can reference the container itself
+		if _, loopDetected := snapshot.checksums[containerKey]; loopDetected {
+			return snapshot
+		}
+		snapshot.checksums[containerKey] = 0
+	}
+
+	const fnvPrime32 = 16777619
+	elementsCount := uint32(0)
+	elementsOrderChecksum := uint32(0)
+	var containerPointer interface{}
+	if value.Kind() == reflect.Map {
+		// map value is a pointer to the map header, so walker gets pointer to its copy
+		mapCopy := reflect.New(value.Type())
+		mapCopy.Elem().Set(exportedMapValue(value, internalsOf(options)))
+		containerPointer = mapCopy.Interface()
+	} else if valuePointer == nil {
+		// data of boxed or read-only value isn't available, see reflectInternals, so walker gets pointer to its copy
+		containerPointer = copyOf(value).Interface()
+	} else {
+		containerPointer = reflect.NewAt(value.Type(), valuePointer).Interface()
+	}
+	walker(containerPointer, func(element interface{}) {
+		elementValue := reflect.ValueOf(element)
+		elementsCount++
+		contentBefore := snapshot.contentDigest
+		snapshot = captureChecksumMap(snapshot, elementValue, options)
+		if elementValue.Kind() == reflect.Ptr {
+			// elements re-ordering is a mutation as well, so we fold element pointers in visiting order
+			elementsOrderChecksum = (elementsOrderChecksum ^ uint32(elementValue.Pointer())) * fnvPrime32
+		}
+		// content of every element is folded in visiting order as well, so values swapped between elements
+		// aren't missed and elements visited one after another, like header keys and their values, stay bound
+		elementsOrderChecksum = (elementsOrderChecksum ^ (snapshot.contentDigest - contentBefore)) * fnvPrime32
+	})
+	if valuePointer == nil {
+		// identity of boxed value isn't available, see reflectInternals, so elements count is keyed by itself
+		containerKey = evalKey32(elementsCount*fnvPrime32, reflect.Struct)
+	}
+	snapshot.checksums[containerKey] = elementsCount
+	snapshot.entries += int(elementsCount)
+	snapshot.contentDigest += evalKey32(elementsCount*fnvPrime32, reflect.Struct)
+	snapshot.checksums[evalKey32(elementsOrderChecksum, reflect.Struct)] = elementsOrderChecksum
+	return snapshot
+}
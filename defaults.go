@@ -0,0 +1,100 @@
+package immcheck
+
+import (
+	"sync/atomic"
+)
+
+//nolint:gochecknoglobals // default options are process-wide
+var defaultOptions atomic.Value // Options
+
+// SetDefaultOptions sets options that all guards and captures of the process start from.
+// Options passed to calls are merged on top of defaults using immcheck.MergeOptions,
+// so the same configuration, like Reporter or LogWriter, doesn't have to be repeated at every call site.
+// Arena isn't safe for concurrent use, so it is never taken from defaults.
+// Stable digests and immcheck.DetectAliasing don't use defaults.
+// It is meant to be called once at startup.
+func SetDefaultOptions(options Options) {
+	options.Arena = nil
+	defaultOptions.Store(options)
+}
+
+// DefaultOptions returns options set by immcheck.SetDefaultOptions.
+func DefaultOptions() Options {
+	defaults, _ := defaultOptions.Load().(Options)
+	return defaults
+}
+
+// MergeOptions returns defaults overridden by overrides field-by-field: non-zero fields of overrides win.
+// Flags are combined as (defaults.Flags | overrides.Flags) &^ overrides.ClearFlags,
+// so call sites can both add flags to defaults and remove them.
+// SafeMode is combined the same way: it is inherited from defaults unless overrides.ClearSafeMode is set.
+// ClearFlags and ClearSafeMode are taken from overrides only.
+func MergeOptions(defaults Options, overrides Options) Options {
+	// every field is merged explicitly, so new fields aren't inherited from defaults by accident
+	result := Options{
+		LogWriter:           defaults.LogWriter,
+		Flags:               (defaults.Flags | overrides.Flags) &^ overrides.ClearFlags,
+		PanicValue:          defaults.PanicValue,
+		Arena:               defaults.Arena,
+		SampleEvery:         defaults.SampleEvery,
+		Aggregator:          defaults.Aggregator,
+		MaxReportsPerSecond: defaults.MaxReportsPerSecond,
+		ReportFormat:        defaults.ReportFormat,
+		Label:               defaults.Label,
+		Reporter:            defaults.Reporter,
+		Budget:              defaults.Budget,
+		ClearFlags:          overrides.ClearFlags,
+		IgnoredFields:       defaults.IgnoredFields,
+		SafeMode:            (defaults.SafeMode || overrides.SafeMode) && !overrides.ClearSafeMode,
+		ClearSafeMode:       overrides.ClearSafeMode,
+		internals:           defaults.internals,
+	}
+	if overrides.LogWriter != nil {
+		result.LogWriter = overrides.LogWriter
+	}
+	if overrides.PanicValue != nil {
+		result.PanicValue = overrides.PanicValue
+	}
+	if overrides.Arena != nil {
+		result.Arena = overrides.Arena
+	}
+	if overrides.SampleEvery != 0 {
+		result.SampleEvery = overrides.SampleEvery
+	}
+	if overrides.Aggregator != nil {
+		result.Aggregator = overrides.Aggregator
+	}
+	if overrides.MaxReportsPerSecond != 0 {
+		result.MaxReportsPerSecond = overrides.MaxReportsPerSecond
+	}
+	if overrides.ReportFormat != TextReportFormat {
+		result.ReportFormat = overrides.ReportFormat
+	}
+	if overrides.Label != "" {
+		result.Label = overrides.Label
+	}
+	if overrides.Reporter != nil {
+		result.Reporter = overrides.Reporter
+	}
+	if overrides.Budget != nil {
+		result.Budget = overrides.Budget
+	}
+	if len(overrides.IgnoredFields) != 0 {
+		result.IgnoredFields = overrides.IgnoredFields
+	}
+	if overrides.internals != nil {
+		result.internals = overrides.internals
+	}
+	return result
+}
+
+// withDefaultOptions merges options on top of process-wide defaults and applies runtime toggles. It is idempotent.
+func withDefaultOptions(options Options) Options {
+	defaults, ok := defaultOptions.Load().(Options)
+	if !ok {
+		options.Flags &^= options.ClearFlags
+		options.SafeMode = options.SafeMode && !options.ClearSafeMode
+		return withRuntimeToggles(options)
+	}
+	return withRuntimeToggles(MergeOptions(defaults, options))
+}
@@ -0,0 +1,148 @@
+package immcheck_test
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+type recordingReporter struct {
+	errs []error
+}
+
+func (r *recordingReporter) ReportMutation(err error) {
+	r.errs = append(r.errs, err)
+}
+
+func TestMergeOptions(t *testing.T) {
+	t.Parallel()
+	defaultWriter, callWriter := &bytes.Buffer{}, &bytes.Buffer{}
+	defaults := immcheck.Options{
+		Flags:       immcheck.SkipOriginCapturing | immcheck.SkipPanicOnDetectedMutation,
+		LogWriter:   defaultWriter,
+		SampleEvery: 10,
+		Label:       "default",
+	}
+	merged := immcheck.MergeOptions(defaults, immcheck.Options{
+		Flags:      immcheck.CaptureSliceCapacity,
+		ClearFlags: immcheck.SkipPanicOnDetectedMutation,
+		LogWriter:  callWriter,
+		Label:      "call",
+	})
+	expectedFlags := immcheck.SkipOriginCapturing | immcheck.CaptureSliceCapacity
+	if merged.Flags != expectedFlags {
+		t.Fatalf("unexpected flags: %b", merged.Flags)
+	}
+	if merged.LogWriter != callWriter || merged.Label != "call" {
+		t.Fatalf("call options don't override defaults: %+v", merged)
+	}
+	if merged.SampleEvery != 10 {
+		t.Fatalf("zero call options override defaults: %+v", merged)
+	}
+	if immcheck.MergeOptions(merged, merged).Flags != merged.Flags {
+		t.Fatalf("merge isn't idempotent: %+v", merged)
+	}
+}
+
+// TestMergeOptionsFields sets every exported field of Options on either side of immcheck.MergeOptions,
+// so new fields that aren't merged fail the test.
+func TestMergeOptionsFields(t *testing.T) {
+	t.Parallel()
+	optionsType := reflect.TypeOf(immcheck.Options{})
+	// fields that aren't inherited from defaults
+	callOnly := map[string]bool{"ClearFlags": true, "ClearSafeMode": true}
+	for i := 0; i < optionsType.NumField(); i++ {
+		field := optionsType.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		value := nonZeroOptionValue(t, field)
+
+		var defaults immcheck.Options
+		reflect.ValueOf(&defaults).Elem().Field(i).Set(value)
+		merged := reflect.ValueOf(immcheck.MergeOptions(defaults, immcheck.Options{})).Field(i)
+		if !callOnly[field.Name] && !sameOptionValue(merged, value) {
+			t.Fatalf("%v of defaults isn't kept", field.Name)
+		}
+
+		var overrides immcheck.Options
+		reflect.ValueOf(&overrides).Elem().Field(i).Set(value)
+		merged = reflect.ValueOf(immcheck.MergeOptions(immcheck.Options{}, overrides)).Field(i)
+		if !sameOptionValue(merged, value) {
+			t.Fatalf("%v of overrides isn't applied", field.Name)
+		}
+	}
+
+	merged := immcheck.MergeOptions(
+		immcheck.Options{SafeMode: true, IgnoredFields: []string{"a"}},
+		immcheck.Options{ClearSafeMode: true, IgnoredFields: []string{"b"}},
+	)
+	if merged.SafeMode || len(merged.IgnoredFields) != 1 || merged.IgnoredFields[0] != "b" {
+		t.Fatalf("overrides don't win: %+v", merged)
+	}
+}
+
+func nonZeroOptionValue(t *testing.T, field reflect.StructField) reflect.Value {
+	t.Helper()
+	//nolint:exhaustive
+	switch field.Type.Kind() {
+	case reflect.Bool:
+		return reflect.ValueOf(true)
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return reflect.ValueOf(uint64(1)).Convert(field.Type)
+	case reflect.Float64:
+		return reflect.ValueOf(1.5)
+	case reflect.String:
+		return reflect.ValueOf("value").Convert(field.Type)
+	case reflect.Slice:
+		return reflect.ValueOf([]string{"value"})
+	case reflect.Ptr:
+		return reflect.New(field.Type.Elem())
+	case reflect.Func:
+		return reflect.ValueOf(func(err *immcheck.MutationError) interface{} { return err })
+	case reflect.Interface:
+		for _, value := range []interface{}{&bytes.Buffer{}, &recordingReporter{}} {
+			if reflect.TypeOf(value).Implements(field.Type) {
+				return reflect.ValueOf(value)
+			}
+		}
+	}
+	t.Fatalf("no test value for %v of type %v", field.Name, field.Type)
+	return reflect.Value{}
+}
+
+func sameOptionValue(merged reflect.Value, expected reflect.Value) bool {
+	if merged.Kind() == reflect.Func {
+		return merged.Pointer() == expected.Pointer()
+	}
+	return reflect.DeepEqual(merged.Interface(), expected.Convert(merged.Type()).Interface())
+}
+
+func TestSetDefaultOptions(t *testing.T) {
+	// not parallel, because default options are process-wide
+	reporter := &recordingReporter{}
+	immcheck.SetDefaultOptions(immcheck.Options{Reporter: reporter, Flags: immcheck.SkipOriginCapturing})
+	defer immcheck.SetDefaultOptions(immcheck.Options{})
+
+	counter := 1
+	func() {
+		defer immcheck.EnsureImmutability(&counter)()
+		counter++
+	}()
+	var mutationErr *immcheck.MutationError
+	if len(reporter.errs) != 1 || !errors.As(reporter.errs[0], &mutationErr) {
+		t.Fatalf("mutation isn't reported to default reporter: %v", reporter.errs)
+	}
+	if mutationErr.CaptureOrigin != 0 {
+		t.Fatalf("default flags aren't applied: %v", mutationErr)
+	}
+
+	verify := immcheck.EnsureImmutabilityErr(&counter, immcheck.Options{ClearFlags: immcheck.SkipOriginCapturing})
+	counter++
+	if err := verify(); !errors.As(err, &mutationErr) || mutationErr.CaptureOrigin == 0 {
+		t.Fatalf("default flags aren't cleared: %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package immcheck
+
+import (
+	"reflect"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// CheckLevel is a level of the degradation ladder of checks, see immcheck.DegradationPolicy.
+type CheckLevel uint8
+
+const (
+	// FullCheck captures guarded values according to options of the check.
+	FullCheck CheckLevel = iota
+	// DigestOnlyCheck captures guarded values without diagnostics: origins aren't captured and diffs aren't rendered.
+	DigestOnlyCheck
+	// ShallowCheck captures only memory of guarded values themselves: pointers and interfaces at the root
+	// are dereferenced and elements of root slices and strings are captured, but references inside of them
+	// are captured only by their addresses. It implies DigestOnlyCheck.
+	ShallowCheck
+	// SkippedCheck doesn't capture guarded values, checks are immcheck.NoopCheck.
+	SkippedCheck
+)
+
+//nolint:gochecknoglobals // checkLevelNames is effectively a constant
+var checkLevelNames = [...]string{
+	FullCheck:       "full",
+	DigestOnlyCheck: "digest_only",
+	ShallowCheck:    "shallow",
+	SkippedCheck:    "skipped",
+}
+
+// String returns machine-readable name of the level, like "digest_only".
+func (l CheckLevel) String() string {
+	if int(l) < len(checkLevelNames) {
+		return checkLevelNames[l]
+	}
+	return "unknown"
+}
+
+// latencyWeightShift sets weight of the latest capture in average capture latency to 1/8.
+const latencyWeightShift = 3
+
+// DegradationPolicy downgrades checks of immcheck.EnsureImmutability and its variants under load,
+// so checks gracefully shed their cost instead of being switched on or off, see immcheck.SetDegradationPolicy.
+// The most degraded of levels selected by LatencyThresholds and LoadSignal is applied.
+type DegradationPolicy struct {
+	// LatencyThresholds are average latencies of recent baseline captures that downgrade checks to the next level:
+	// exceeding LatencyThresholds[0] downgrades checks to DigestOnlyCheck, LatencyThresholds[1] to ShallowCheck
+	// and LatencyThresholds[2] to SkippedCheck. Zero thresholds are ignored.
+	// Skipped checks are accounted as captures with zero latency, so checks recover once load goes away.
+	LatencyThresholds [3]time.Duration
+	// LoadSignal returns level of checks according to external load signal, like CPU utilization
+	// or length of request queues. It is called on every check, so it should be cheap. Can be nil.
+	LoadSignal func() CheckLevel
+}
+
+// degradationState is the installed policy together with average latency of recent captures.
+type degradationState struct {
+	policy DegradationPolicy
+	// averageLatency is an exponentially weighted moving average of capture latencies in nanoseconds,
+	// concurrent updates can be lost, which is fine for a load signal
+	averageLatency int64
+}
+
+//nolint:gochecknoglobals // degradation is a process-wide policy
+var degradation atomic.Value // *degradationState
+
+// SetDegradationPolicy installs process-wide policy that downgrades checks under load.
+// nil removes the policy, so all checks are FullCheck.
+func SetDegradationPolicy(policy *DegradationPolicy) {
+	if policy == nil {
+		degradation.Store((*degradationState)(nil))
+		return
+	}
+	degradation.Store(&degradationState{policy: *policy})
+}
+
+// CurrentCheckLevel returns level of checks selected by the installed immcheck.DegradationPolicy.
+func CurrentCheckLevel() CheckLevel {
+	state, _ := degradation.Load().(*degradationState)
+	return state.level()
+}
+
+func loadDegradationState() *degradationState {
+	state, _ := degradation.Load().(*degradationState)
+	return state
+}
+
+func (s *degradationState) level() CheckLevel {
+	if s == nil {
+		return FullCheck
+	}
+	level := FullCheck
+	averageLatency := time.Duration(atomic.LoadInt64(&s.averageLatency))
+	for i, threshold := range s.policy.LatencyThresholds {
+		if threshold != 0 && averageLatency > threshold {
+			level = CheckLevel(i + 1)
+		}
+	}
+	if s.policy.LoadSignal != nil {
+		if signalled := s.policy.LoadSignal(); signalled > level {
+			level = signalled
+		}
+	}
+	if level > SkippedCheck {
+		level = SkippedCheck
+	}
+	return level
+}
+
+// recordLatency accounts latency of a capture in average capture latency.
+func (s *degradationState) recordLatency(latency time.Duration) {
+	if s == nil {
+		return
+	}
+	averageLatency := atomic.LoadInt64(&s.averageLatency)
+	averageLatency += (int64(latency) - averageLatency) >> latencyWeightShift
+	atomic.StoreInt64(&s.averageLatency, averageLatency)
+}
+
+// withCheckLevel returns options and capture function that implement level.
+func withCheckLevel(
+	options Options, level CheckLevel,
+) (Options, func(snapshot *ValueSnapshot, value reflect.Value, options Options) *ValueSnapshot) {
+	if level == FullCheck {
+		return options, captureChecksumMap
+	}
+	options = withFlags(options, (options.Flags|SkipOriginCapturing)&^RenderDiffOnMutation)
+	if level == ShallowCheck {
+		return options, captureShallow
+	}
+	return options, captureChecksumMap
+}
+
+// captureShallow captures only memory of value itself, like ShallowCheck level describes.
+// References inside of value are captured by their addresses, since they are a part of its memory.
+func captureShallow(snapshot *ValueSnapshot, value reflect.Value, options Options) *ValueSnapshot {
+	if snapshot.rootType == nil && value.IsValid() {
+		snapshot = describeRoot(snapshot, value)
+	}
+	snapshot.nodes++
+	for (value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface) && !value.IsNil() {
+		value = value.Elem()
+	}
+	valueKind := value.Kind()
+	//nolint:exhaustive
+	switch valueKind {
+	case reflect.Ptr, reflect.Interface:
+		snapshot.nilReferences++
+		return capturePointer(snapshot, nil, valueKind)
+	case reflect.Map:
+		if value.IsNil() {
+			snapshot.nilReferences++
+		}
+		snapshot.checksums[evalKey(value.Pointer(), valueKind)] = uint32(value.Len())
+		return snapshot
+	case reflect.String:
+		return captureRawBytesLevelChecksum(snapshot, convertSliceBasedTypeToByteSlice(value, options), valueKind)
+	case reflect.Slice:
+		snapshot.sequenceLengths += value.Len()
+		snapshot = capturePointer(snapshot, unsafe.Pointer(value.Pointer()), valueKind)
+		valueBytes := convertSliceBasedTypeToByteSlice(value, options)
+		return captureValueBytesChecksum(snapshot, valueBytes, valueKind, value.Type().Elem(), value.Len(), options)
+	case reflect.Array, reflect.Struct, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		valueBytes := convertValueTypeToBytesSlice(value, options)
+		return captureValueBytesChecksum(snapshot, valueBytes, valueKind, value.Type(), 1, options)
+	}
+	// unsupported kinds are handled according to options
+	return captureChecksumMap(snapshot, value, options)
+}
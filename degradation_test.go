@@ -0,0 +1,79 @@
+package immcheck_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+type degradedValue struct {
+	counter  int
+	referred *int
+}
+
+//nolint:paralleltest // degradation policy is process-wide
+func TestDegradationPolicyLoadSignal(t *testing.T) {
+	level := immcheck.FullCheck
+	immcheck.SetDegradationPolicy(&immcheck.DegradationPolicy{LoadSignal: func() immcheck.CheckLevel { return level }})
+	defer immcheck.SetDegradationPolicy(nil)
+	reporter := &recordingReporter{}
+	options := immcheck.Options{Reporter: reporter, Flags: immcheck.RenderDiffOnMutation}
+	value := &degradedValue{referred: new(int)}
+
+	level = immcheck.DigestOnlyCheck
+	check := immcheck.EnsureImmutabilityWithOptions(value, options)
+	value.counter++
+	check()
+	var mutationErr *immcheck.MutationError
+	if len(reporter.errs) != 1 || !errors.As(reporter.errs[0], &mutationErr) {
+		t.Fatalf("mutation isn't detected: %v", reporter.errs)
+	}
+	if mutationErr.CaptureOrigin != 0 || mutationErr.Diff != "" {
+		t.Fatalf("diagnostics are captured: %v", mutationErr)
+	}
+
+	level = immcheck.ShallowCheck
+	check = immcheck.EnsureImmutabilityWithOptions(value, options)
+	*value.referred++
+	check()
+	if len(reporter.errs) != 1 {
+		t.Fatalf("referenced memory is captured: %v", reporter.errs[1:])
+	}
+	check = immcheck.EnsureImmutabilityWithOptions(value, options)
+	value.referred = new(int)
+	check()
+	if len(reporter.errs) != 2 {
+		t.Fatalf("retargeting isn't detected: %v", reporter.errs)
+	}
+
+	level = immcheck.SkippedCheck
+	if !immcheck.IsNoopCheck(immcheck.EnsureImmutabilityWithOptions(value, options)) {
+		t.Fatal("check isn't skipped")
+	}
+	if immcheck.CurrentCheckLevel() != immcheck.SkippedCheck || level.String() != "skipped" {
+		t.Fatalf("unexpected level: %v", immcheck.CurrentCheckLevel())
+	}
+}
+
+//nolint:paralleltest // degradation policy is process-wide
+func TestDegradationPolicyLatencyThresholds(t *testing.T) {
+	immcheck.SetDegradationPolicy(&immcheck.DegradationPolicy{
+		LatencyThresholds: [3]time.Duration{time.Nanosecond, time.Hour, time.Nanosecond},
+	})
+	defer immcheck.SetDegradationPolicy(nil)
+	value := make([]int, 1024)
+	immcheck.EnsureImmutability(&value)()
+	if level := immcheck.CurrentCheckLevel(); level != immcheck.SkippedCheck {
+		t.Fatalf("check isn't downgraded: %v", level)
+	}
+	for i := 0; i < 1000 && immcheck.CurrentCheckLevel() == immcheck.SkippedCheck; i++ {
+		if !immcheck.IsNoopCheck(immcheck.EnsureImmutability(&value)) {
+			t.Fatal("check isn't skipped")
+		}
+	}
+	if level := immcheck.CurrentCheckLevel(); level != immcheck.FullCheck {
+		t.Fatalf("check doesn't recover: %v", level)
+	}
+}
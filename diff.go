@@ -0,0 +1,97 @@
+package immcheck
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+)
+
+const (
+	// maxRenderedLines limits size of values rendered with RenderDiffOnMutation flag
+	maxRenderedLines = 64
+	// maxRenderedLineLength limits length of rendered lines, longer lines are truncated
+	maxRenderedLineLength = 120
+)
+
+// renderValueLines renders value line by line: one line per primitive, nil reference or empty container,
+// like ".Amount: 100". Map entries are rendered in order of formatted keys, references are rendered once.
+// Returns nil if value renders into more than maxRenderedLines lines.
+func renderValueLines(value reflect.Value, options Options) []string {
+	lines := make([]string, 0, maxRenderedLines)
+	tooLarge := false
+	// values of unsafe kinds are rendered as addresses
+	options.Flags |= AllowInherentlyUnsafeTypes
+	walkPair(value, value, options, func(path string, a reflect.Value, _ reflect.Value) bool {
+		if tooLarge || !a.IsValid() {
+			return false
+		}
+		//nolint:exhaustive
+		switch a.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+			if a.IsNil() {
+				break
+			}
+			if a.Kind() != reflect.Ptr && a.Kind() != reflect.Interface && a.Len() == 0 {
+				break
+			}
+			return true
+		case reflect.Struct, reflect.Array:
+			return true
+		}
+		if len(lines) == maxRenderedLines {
+			tooLarge = true
+			return false
+		}
+		if path == "" {
+			path = "value"
+		}
+		line := path + ": " + formatValue(a)
+		if len(line) > maxRenderedLineLength {
+			line = line[:maxRenderedLineLength] + "..."
+		}
+		lines = append(lines, line)
+		return false
+	})
+	if tooLarge {
+		return nil
+	}
+	return lines
+}
+
+// unifiedDiff returns lines removed from oldLines prefixed with "- " and lines added to newLines prefixed with "+ ",
+// in the order of the longest common subsequence of oldLines and newLines.
+func unifiedDiff(oldLines []string, newLines []string) string {
+	// common[i][j] is the length of the longest common subsequence of oldLines[i:] and newLines[j:]
+	common := make([][]int, len(oldLines)+1)
+	for i := range common {
+		common[i] = make([]int, len(newLines)+1)
+	}
+	for i := len(oldLines) - 1; i >= 0; i-- {
+		for j := len(newLines) - 1; j >= 0; j-- {
+			switch {
+			case oldLines[i] == newLines[j]:
+				common[i][j] = common[i+1][j+1] + 1
+			case common[i+1][j] >= common[i][j+1]:
+				common[i][j] = common[i+1][j]
+			default:
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+	buf := &bytes.Buffer{}
+	i, j := 0, 0
+	for i < len(oldLines) || j < len(newLines) {
+		switch {
+		case i < len(oldLines) && j < len(newLines) && oldLines[i] == newLines[j]:
+			i++
+			j++
+		case j == len(newLines) || (i < len(oldLines) && common[i+1][j] >= common[i][j+1]):
+			_, _ = fmt.Fprintf(buf, "- %v\n", oldLines[i])
+			i++
+		default:
+			_, _ = fmt.Fprintf(buf, "+ %v\n", newLines[j])
+			j++
+		}
+	}
+	return buf.String()
+}
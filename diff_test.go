@@ -0,0 +1,45 @@
+package immcheck_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+type diffedPayment struct {
+	Amount   int
+	Currency string
+	Tags     map[string]string
+}
+
+func TestRenderDiffOnMutation(t *testing.T) {
+	t.Parallel()
+	payment := &diffedPayment{Amount: 100, Currency: "EUR", Tags: map[string]string{"source": "web"}}
+	verify := immcheck.EnsureImmutabilityErr(payment, immcheck.Options{Flags: immcheck.RenderDiffOnMutation})
+	payment.Amount = 250
+	payment.Tags["retry"] = "1"
+	err := verify()
+	var mutationErr *immcheck.MutationError
+	if !errors.As(err, &mutationErr) {
+		t.Fatalf("mutation isn't detected: %v", err)
+	}
+	expectedDiff := "- .Amount: 100\n+ .Amount: 250\n+ .Tags[\"retry\"]: \"1\"\n"
+	if mutationErr.Diff != expectedDiff || !strings.Contains(err.Error(), "diff:\n"+expectedDiff) {
+		t.Fatalf("unexpected diff: %v", err)
+	}
+
+	verify = immcheck.EnsureImmutabilityErr(payment, immcheck.Options{})
+	payment.Amount = 300
+	if err := verify(); !errors.As(err, &mutationErr) || mutationErr.Diff != "" {
+		t.Fatalf("diff is rendered without flag: %v", err)
+	}
+
+	large := make([]int, 1000)
+	verify = immcheck.EnsureImmutabilityErr(&large, immcheck.Options{Flags: immcheck.RenderDiffOnMutation})
+	large[0] = 1
+	if err := verify(); !errors.As(err, &mutationErr) || mutationErr.Diff != "" {
+		t.Fatalf("diff of large value is rendered: %v", err)
+	}
+}
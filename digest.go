@@ -0,0 +1,266 @@
+package immcheck
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/zeebo/xxh3"
+)
+
+// StableDigestVersion is the version of the stable encoding implemented by immcheck.
+// Specification of the encoding can be found in STABLE_DIGEST.md.
+// Version is incremented on every change of the encoding that changes digests of the same values.
+const StableDigestVersion = 1
+
+// Tags of the stable encoding, see STABLE_DIGEST.md.
+const (
+	stableTagNil      byte = 0x00
+	stableTagBool     byte = 0x01
+	stableTagInt      byte = 0x02
+	stableTagUint     byte = 0x03
+	stableTagFloat    byte = 0x04
+	stableTagComplex  byte = 0x05
+	stableTagString   byte = 0x06
+	stableTagBytes    byte = 0x07
+	stableTagList     byte = 0x08
+	stableTagStruct   byte = 0x09
+	stableTagMap      byte = 0x0A
+	stableTagCycleRef byte = 0x0B
+	stableTagOpaque   byte = 0x0C
+)
+
+// StableDigest is a process-independent digest of a value.
+// Unlike ValueSnapshot, it doesn't depend on memory addresses, map iteration order or platform,
+// so it can be computed by a Go service and verified by a service written in other language.
+type StableDigest struct {
+	// Version is the version of the stable encoding used to compute Sum.
+	Version uint8
+	// Sum is XXH3-64 (seed 0) of the stable encoding of the value.
+	Sum uint64
+}
+
+// String provides string representation of StableDigest in immcheck-v<version>-xxh3:<hex sum> format.
+func (d StableDigest) String() string {
+	return fmt.Sprintf("immcheck-v%d-xxh3:%016x", d.Version, d.Sum)
+}
+
+// ParseStableDigest parses StableDigest from the string representation produced by StableDigest.String.
+func ParseStableDigest(s string) (StableDigest, error) {
+	var digest StableDigest
+	var sum string
+	if _, err := fmt.Sscanf(s, "immcheck-v%d-xxh3:%s", &digest.Version, &sum); err != nil || len(sum) != 16 {
+		return StableDigest{}, fmt.Errorf("%w. malformed stable digest: %q", IncompatibleSnapshotError, s)
+	}
+	parsedSum, err := strconv.ParseUint(sum, 16, 64)
+	if err != nil {
+		return StableDigest{}, fmt.Errorf("%w. malformed stable digest: %q", IncompatibleSnapshotError, s)
+	}
+	digest.Sum = parsedSum
+	return digest, nil
+}
+
+// ComputeStableDigest computes StableDigest of v according to settings specified in options.
+func ComputeStableDigest(v interface{}, options Options) StableDigest {
+	return StableDigest{
+		Version: StableDigestVersion,
+		Sum:     xxh3.Hash(StableEncoding(v, options)),
+	}
+}
+
+// StableEncoding returns canonical byte representation of v that is used to compute StableDigest.
+// It is exposed mainly to verify implementations of the specification in other languages.
+func StableEncoding(v interface{}, options Options) []byte {
+	if v == nil {
+		panic(fmt.Errorf("%w. target value can't be nil", UnsupportedTypeError))
+	}
+	encoder := &stableEncoder{
+		options:  options,
+		rootType: reflect.TypeOf(v),
+		path:     make(map[stablePathKey]int),
+	}
+	encoder.encode(&encoder.buf, reflect.ValueOf(v))
+	return encoder.buf.Bytes()
+}
+
+type stablePathKey struct {
+	pointer   uintptr
+	valueType reflect.Type
+}
+
+type stableEncoder struct {
+	options  Options
+	rootType reflect.Type
+	buf      bytes.Buffer
+	// path tracks references on the current traversal path to detect reference cycles
+	path  map[stablePathKey]int
+	depth int
+}
+
+func (e *stableEncoder) encode(dst *bytes.Buffer, value reflect.Value) {
+	valueKind := value.Kind()
+	switch valueKind {
+	case reflect.Invalid:
+		dst.WriteByte(stableTagNil)
+	case reflect.Bool:
+		dst.WriteByte(stableTagBool)
+		if value.Bool() {
+			dst.WriteByte(1)
+		} else {
+			dst.WriteByte(0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		dst.WriteByte(stableTagInt)
+		writeStableUint64(dst, uint64(value.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		dst.WriteByte(stableTagUint)
+		writeStableUint64(dst, value.Uint())
+	case reflect.Float32, reflect.Float64:
+		dst.WriteByte(stableTagFloat)
+		writeStableUint64(dst, math.Float64bits(value.Float()))
+	case reflect.Complex64, reflect.Complex128:
+		dst.WriteByte(stableTagComplex)
+		writeStableUint64(dst, math.Float64bits(real(value.Complex())))
+		writeStableUint64(dst, math.Float64bits(imag(value.Complex())))
+	case reflect.String:
+		dst.WriteByte(stableTagString)
+		writeStableString(dst, value.String())
+	case reflect.Array, reflect.Slice:
+		e.encodeList(dst, value)
+	case reflect.Struct:
+		e.encodeStruct(dst, value)
+	case reflect.Map:
+		e.encodeMap(dst, value)
+	case reflect.Ptr, reflect.Interface:
+		if value.IsNil() {
+			dst.WriteByte(stableTagNil)
+			return
+		}
+		if valueKind == reflect.Interface {
+			e.encode(dst, value.Elem())
+			return
+		}
+		e.enterReference(dst, value, func() {
+			e.encode(dst, value.Elem())
+		})
+	case reflect.UnsafePointer, reflect.Func, reflect.Chan:
+		if e.options.Flags&AllowInherentlyUnsafeTypes == 0 {
+			panic(unsupportedKindError(e.rootType, valueKind, false))
+		}
+		// addresses aren't stable between processes, so such values are opaque in stable encoding
+		dst.WriteByte(stableTagOpaque)
+	}
+}
+
+func (e *stableEncoder) encodeList(dst *bytes.Buffer, value reflect.Value) {
+	if value.Kind() == reflect.Slice && value.IsNil() {
+		dst.WriteByte(stableTagNil)
+		return
+	}
+	if value.Type().Elem().Kind() == reflect.Uint8 {
+		dst.WriteByte(stableTagBytes)
+		writeStableUint64(dst, uint64(value.Len()))
+		if value.Kind() == reflect.Slice || value.CanAddr() {
+			dst.Write(convertSliceBasedTypeToByteSlice(value, e.options))
+			return
+		}
+		for i := 0; i < value.Len(); i++ {
+			dst.WriteByte(byte(value.Index(i).Uint()))
+		}
+		return
+	}
+	encodeItems := func() {
+		dst.WriteByte(stableTagList)
+		itemsCount := value.Len()
+		writeStableUint64(dst, uint64(itemsCount))
+		for i := 0; i < itemsCount; i++ {
+			e.encode(dst, value.Index(i))
+		}
+	}
+	if value.Kind() == reflect.Slice && value.Len() != 0 {
+		// slices can reference themselves through interfaces
+		e.enterReference(dst, value, encodeItems)
+		return
+	}
+	encodeItems()
+}
+
+func (e *stableEncoder) encodeStruct(dst *bytes.Buffer, value reflect.Value) {
+	dst.WriteByte(stableTagStruct)
+	valueType := value.Type()
+	numField := value.NumField()
+	writeStableUint64(dst, uint64(numField))
+	for i := 0; i < numField; i++ {
+		writeStableString(dst, valueType.Field(i).Name)
+		e.encode(dst, value.Field(i))
+	}
+}
+
+func (e *stableEncoder) encodeMap(dst *bytes.Buffer, value reflect.Value) {
+	if value.IsNil() {
+		dst.WriteByte(stableTagNil)
+		return
+	}
+	e.enterReference(dst, value, func() {
+		entries := make([]stableMapEntry, 0, value.Len())
+		iterator := value.MapRange()
+		for iterator.Next() {
+			entry := stableMapEntry{}
+			e.encode(&entry.key, iterator.Key())
+			e.encode(&entry.value, iterator.Value())
+			entries = append(entries, entry)
+		}
+		// distinct keys can have equal encodings, like pointers to equal values,
+		// so such entries are ordered by encoded values to keep encoding independent of iteration order
+		sort.Slice(entries, func(i, j int) bool {
+			if order := bytes.Compare(entries[i].key.Bytes(), entries[j].key.Bytes()); order != 0 {
+				return order < 0
+			}
+			return bytes.Compare(entries[i].value.Bytes(), entries[j].value.Bytes()) < 0
+		})
+		dst.WriteByte(stableTagMap)
+		writeStableUint64(dst, uint64(len(entries)))
+		for i := range entries {
+			dst.Write(entries[i].key.Bytes())
+			dst.Write(entries[i].value.Bytes())
+		}
+	})
+}
+
+type stableMapEntry struct {
+	key   bytes.Buffer
+	value bytes.Buffer
+}
+
+// enterReference encodes reference cycles as distance to the referenced value on the current path,
+// shared but acyclic references are encoded in full every time, so encoding doesn't depend on visiting order.
+func (e *stableEncoder) enterReference(dst *bytes.Buffer, value reflect.Value, encodeReferencedValue func()) {
+	key := stablePathKey{pointer: uintptr(pointerOfValue(value, currentInternals())), valueType: value.Type()}
+	if depth, cycleDetected := e.path[key]; cycleDetected {
+		dst.WriteByte(stableTagCycleRef)
+		writeStableUint64(dst, uint64(e.depth-depth))
+		return
+	}
+	e.path[key] = e.depth
+	e.depth++
+	defer func() {
+		e.depth--
+		delete(e.path, key)
+	}()
+	encodeReferencedValue()
+}
+
+func writeStableUint64(dst *bytes.Buffer, value uint64) {
+	var encoded [8]byte
+	binary.LittleEndian.PutUint64(encoded[:], value)
+	dst.Write(encoded[:])
+}
+
+func writeStableString(dst *bytes.Buffer, value string) {
+	writeStableUint64(dst, uint64(len(value)))
+	dst.WriteString(value)
+}
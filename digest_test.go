@@ -0,0 +1,93 @@
+package immcheck_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strconv"
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+func TestStableEncodingSpecification(t *testing.T) {
+	t.Parallel()
+	type message struct {
+		ID    int16
+		Tags  map[string]bool
+		Data  []byte
+		Score float32
+	}
+	v := &message{
+		ID:    -2,
+		Tags:  map[string]bool{"b": false, "a": true},
+		Data:  []byte{0xCA, 0xFE},
+		Score: 0.5,
+	}
+	expectedEncoding := "" +
+		"09" + "0400000000000000" + // struct with 4 fields
+		"0200000000000000" + "4944" + "02" + "feffffffffffffff" + // ID: int -2
+		"0400000000000000" + "54616773" + "0a" + "0200000000000000" + // Tags: map with 2 entries
+		"06" + "0100000000000000" + "61" + "01" + "01" + // "a": true
+		"06" + "0100000000000000" + "62" + "01" + "00" + // "b": false
+		"0400000000000000" + "44617461" + "07" + "0200000000000000" + "cafe" + // Data: bytes
+		"0500000000000000" + "53636f7265" + "04" + "000000000000e03f" // Score: float 0.5
+	actualEncoding := hex.EncodeToString(immcheck.StableEncoding(v, immcheck.Options{}))
+	if actualEncoding != expectedEncoding {
+		t.Fatalf("unexpected encoding:\n%v\n%v", actualEncoding, expectedEncoding)
+	}
+
+	digest := immcheck.ComputeStableDigest(v, immcheck.Options{})
+	t.Log(digest)
+	if digest.Version != immcheck.StableDigestVersion || digest.String() != "immcheck-v1-xxh3:"+hexSum(digest.Sum) {
+		t.Fatalf("unexpected digest: %v", digest)
+	}
+}
+
+func TestStableDigestIsIndependentOfMapOrderAndAddresses(t *testing.T) {
+	t.Parallel()
+	first := make(map[string][]string)
+	second := make(map[string][]string)
+	for i := 0; i < 100; i++ {
+		first[strconv.Itoa(i)] = []string{strconv.Itoa(i * 2)}
+	}
+	for i := 99; i >= 0; i-- {
+		second[strconv.Itoa(i)] = []string{strconv.Itoa(i * 2)}
+	}
+	firstDigest := immcheck.ComputeStableDigest(&first, immcheck.Options{})
+	secondDigest := immcheck.ComputeStableDigest(&second, immcheck.Options{})
+	if firstDigest != secondDigest {
+		t.Fatalf("digests are different: %v != %v", firstDigest, secondDigest)
+	}
+
+	second["1"][0] = "changed"
+	if firstDigest == immcheck.ComputeStableDigest(&second, immcheck.Options{}) {
+		t.Fatal("mutation isn't reflected in digest")
+	}
+}
+
+func TestStableEncodingOfCycles(t *testing.T) {
+	t.Parallel()
+	type node struct {
+		Value int
+		Next  *node
+	}
+	self := &node{Value: 1}
+	self.Next = self
+	encoding := immcheck.StableEncoding(self, immcheck.Options{})
+	cycleRefToParent := []byte{0x0B, 0x01, 0, 0, 0, 0, 0, 0, 0}
+	if !bytes.HasSuffix(encoding, cycleRefToParent) {
+		t.Fatalf("unexpected encoding: %x", encoding)
+	}
+
+	data := []interface{}{1, nil}
+	data[1] = data
+	immcheck.ComputeStableDigest(&data, immcheck.Options{}) // self-referencing slice should be encoded fine
+}
+
+func hexSum(sum uint64) string {
+	encoded := strconv.FormatUint(sum, 16)
+	for len(encoded) < 16 {
+		encoded = "0" + encoded
+	}
+	return encoded
+}
@@ -0,0 +1,151 @@
+package immcheck
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// DigestStore persists baselines of guarded values under names, so baselines survive restarts
+// and can be shared between replicas of a service.
+// Baselines are stable digests: ValueSnapshot depends on memory addresses and is meaningful only within the process.
+// Implement DigestStore on top of a key-value storage, like bolt, pebble or Redis, to share baselines in a cluster.
+// Implementations must be safe for concurrent use.
+type DigestStore interface {
+	// LoadDigest returns digest stored under the name, ok is false if there is no digest stored under the name.
+	LoadDigest(ctx context.Context, name string) (digest StableDigest, ok bool, err error)
+	// StoreDigest stores digest under the name replacing previously stored one.
+	StoreDigest(ctx context.Context, name string, digest StableDigest) error
+}
+
+// VerifyStoredDigest computes StableDigest of v according to settings specified in options
+// and verifies it against the baseline stored under the name in store.
+// If there is no baseline yet, digest of v is stored as the baseline.
+// Returns *immcheck.MutationError with ContentChanged kind if digest of v differs from the baseline,
+// errors of the store are returned as is.
+func VerifyStoredDigest(ctx context.Context, store DigestStore, name string, v interface{}, options Options) error {
+	digest := ComputeStableDigest(v, withDefaultOptions(options))
+	baseline, ok, err := store.LoadDigest(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return store.StoreDigest(ctx, name, digest)
+	}
+	if baseline.Version != digest.Version {
+		return fmt.Errorf("%w. baseline %q was computed with stable encoding v%d, current version is v%d",
+			IncompatibleSnapshotError, name, baseline.Version, digest.Version)
+	}
+	if baseline != digest {
+		return &MutationError{
+			Kinds: ContentChanged,
+			Type:  fmt.Sprintf("%T", v),
+		}
+	}
+	return nil
+}
+
+// NewMemoryDigestStore returns DigestStore that keeps digests in memory of the process.
+func NewMemoryDigestStore() DigestStore {
+	return &memoryDigestStore{digests: make(map[string]StableDigest)}
+}
+
+type memoryDigestStore struct {
+	mutex   sync.RWMutex
+	digests map[string]StableDigest
+}
+
+func (s *memoryDigestStore) LoadDigest(_ context.Context, name string) (StableDigest, bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	digest, ok := s.digests[name]
+	return digest, ok, nil
+}
+
+func (s *memoryDigestStore) StoreDigest(_ context.Context, name string, digest StableDigest) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.digests[name] = digest
+	return nil
+}
+
+// NewFileDigestStore returns DigestStore that keeps digests in JSON file at path,
+// as an object that maps names to string representations of digests.
+// Missing file is an empty store. File is replaced atomically on every StoreDigest,
+// so readers in other processes never observe partially written file.
+func NewFileDigestStore(path string) DigestStore {
+	return &fileDigestStore{path: path}
+}
+
+type fileDigestStore struct {
+	path string
+	// mutex serializes read-modify-write cycles of the process, cross-process writers aren't coordinated
+	mutex sync.Mutex
+}
+
+func (s *fileDigestStore) LoadDigest(_ context.Context, name string) (StableDigest, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	digests, err := s.read()
+	if err != nil {
+		return StableDigest{}, false, err
+	}
+	encodedDigest, ok := digests[name]
+	if !ok {
+		return StableDigest{}, false, nil
+	}
+	digest, err := ParseStableDigest(encodedDigest)
+	if err != nil {
+		return StableDigest{}, false, fmt.Errorf("can't load digest %q from %v: %w", name, s.path, err)
+	}
+	return digest, true, nil
+}
+
+func (s *fileDigestStore) StoreDigest(_ context.Context, name string, digest StableDigest) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	digests, err := s.read()
+	if err != nil {
+		return err
+	}
+	digests[name] = digest.String()
+	encodedDigests, err := json.MarshalIndent(digests, "", "  ")
+	if err != nil {
+		return fmt.Errorf("can't encode digests: %w", err)
+	}
+	tempFile, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("can't store digest %q to %v: %w", name, s.path, err)
+	}
+	_, err = tempFile.Write(encodedDigests)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempFile.Name(), s.path)
+	}
+	if err != nil {
+		_ = os.Remove(tempFile.Name())
+		return fmt.Errorf("can't store digest %q to %v: %w", name, s.path, err)
+	}
+	return nil
+}
+
+func (s *fileDigestStore) read() (map[string]string, error) {
+	digests := make(map[string]string)
+	encodedDigests, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return digests, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't read digests from %v: %w", s.path, err)
+	}
+	if err := json.Unmarshal(encodedDigests, &digests); err != nil {
+		return nil, fmt.Errorf("can't decode digests from %v: %w", s.path, err)
+	}
+	return digests, nil
+}
@@ -0,0 +1,83 @@
+package immcheck_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+func TestParseStableDigest(t *testing.T) {
+	t.Parallel()
+	digest := immcheck.ComputeStableDigest(map[string]int{"replicas": 3}, immcheck.Options{})
+	parsedDigest, err := immcheck.ParseStableDigest(digest.String())
+	if err != nil || parsedDigest != digest {
+		t.Fatalf("digest isn't parsed back: %v; %v", parsedDigest, err)
+	}
+	malformedDigests := []string{"", "immcheck-v1-xxh3:", "immcheck-v1-xxh3:zz", "immcheck-v1-md5:0011223344556677"}
+	for _, malformed := range malformedDigests {
+		if _, err := immcheck.ParseStableDigest(malformed); !errors.Is(err, immcheck.IncompatibleSnapshotError) {
+			t.Fatalf("malformed digest %q is parsed: %v", malformed, err)
+		}
+	}
+}
+
+func TestVerifyStoredDigest(t *testing.T) {
+	t.Parallel()
+	stores := map[string]func(t *testing.T) immcheck.DigestStore{
+		"memory": func(t *testing.T) immcheck.DigestStore {
+			return immcheck.NewMemoryDigestStore()
+		},
+		"file": func(t *testing.T) immcheck.DigestStore {
+			return immcheck.NewFileDigestStore(filepath.Join(t.TempDir(), "digests.json"))
+		},
+	}
+	for name, newStore := range stores {
+		newStore := newStore
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			store := newStore(t)
+			config := map[string]string{"region": "eu", "tier": "gold"}
+			if err := immcheck.VerifyStoredDigest(ctx, store, "config", &config, immcheck.Options{}); err != nil {
+				t.Fatalf("baseline isn't stored: %v", err)
+			}
+			if _, ok, err := store.LoadDigest(ctx, "config"); !ok || err != nil {
+				t.Fatalf("baseline isn't found: %v %v", ok, err)
+			}
+			if err := immcheck.VerifyStoredDigest(ctx, store, "config", &config, immcheck.Options{}); err != nil {
+				t.Fatalf("unchanged value is reported: %v", err)
+			}
+			config["tier"] = "silver"
+			err := immcheck.VerifyStoredDigest(ctx, store, "config", &config, immcheck.Options{})
+			var mutationErr *immcheck.MutationError
+			if !errors.As(err, &mutationErr) || mutationErr.Kinds != immcheck.ContentChanged {
+				t.Fatalf("mutation isn't reported: %v", err)
+			}
+		})
+	}
+}
+
+func TestFileDigestStoreSurvivesRestart(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "digests.json")
+	digest := immcheck.ComputeStableDigest([]int{1, 2, 3}, immcheck.Options{})
+	if err := immcheck.NewFileDigestStore(path).StoreDigest(ctx, "numbers", digest); err != nil {
+		t.Fatal(err)
+	}
+	loadedDigest, ok, err := immcheck.NewFileDigestStore(path).LoadDigest(ctx, "numbers")
+	if err != nil || !ok || loadedDigest != digest {
+		t.Fatalf("digest isn't loaded: %v %v %v", loadedDigest, ok, err)
+	}
+
+	if err := os.WriteFile(path, []byte("not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := immcheck.NewFileDigestStore(path).LoadDigest(ctx, "numbers"); err == nil {
+		t.Fatal("corrupted file isn't reported")
+	}
+}
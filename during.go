@@ -0,0 +1,103 @@
+package immcheck
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// GuardDuring captures snapshot of v, runs operation and verifies that v wasn't mutated by it.
+// It is handy to catch encoders with custom MarshalJSON implementations, template methods or gob encoders
+// that mutate their receivers: immcheck.GuardDuring(&v, func() error { _, err := json.Marshal(&v); return err }).
+// Returns error of the operation, *immcheck.MutationError if v was mutated
+// or *immcheck.GuardedOperationError if both happened.
+func GuardDuring(v interface{}, operation func() error) error {
+	return guardDuring(v, operation, Options{})
+}
+
+// GuardDuringWithOptions works the same way as immcheck.GuardDuring
+// but captures snapshots according to settings specified in options.
+// Mutations are returned as errors, so options related to logging and panics are ignored.
+// If inline checks are switched off by immcheck.SetRuntimeToggles, only error of the operation is returned.
+func GuardDuringWithOptions(v interface{}, operation func() error, options Options) error {
+	return guardDuring(v, operation, options)
+}
+
+// GuardedOperationError is returned by immcheck.GuardDuring if guarded operation failed
+// and mutated guarded value at the same time.
+// errors.Is and errors.As match both the mutation and the operation error.
+type GuardedOperationError struct {
+	Mutation       *MutationError
+	OperationError error
+}
+
+// Error provides human-readable description of both errors.
+func (g *GuardedOperationError) Error() string {
+	return fmt.Sprintf("guarded operation failed: %v; %v", g.OperationError, g.Mutation)
+}
+
+// Is reports whether either the mutation or the operation error matches target.
+func (g *GuardedOperationError) Is(target error) bool {
+	return errors.Is(g.Mutation, target) || errors.Is(g.OperationError, target)
+}
+
+// As finds the first error in the mutation or the operation error chain that matches target.
+func (g *GuardedOperationError) As(target interface{}) bool {
+	return errors.As(g.Mutation, target) || errors.As(g.OperationError, target)
+}
+
+// Unwrap returns the operation error.
+func (g *GuardedOperationError) Unwrap() error {
+	return g.OperationError
+}
+
+func guardDuring(v interface{}, operation func() error, options Options) error {
+	if v == nil {
+		panic(fmt.Errorf("%w. target value can't be nil", UnsupportedTypeError))
+	}
+	if inlineChecksDisabled() {
+		return operation()
+	}
+	options = withDefaultOptions(options)
+	originalSnapshot := getTempSnapshot()
+	defer putTempSnapshot(originalSnapshot)
+	newSnapshot := getTempSnapshot()
+	defer putTempSnapshot(newSnapshot)
+
+	skipThreeFrames := 3
+	targetValue := reflect.ValueOf(v)
+	originalSnapshot = initValueSnapshot(originalSnapshot, options, skipThreeFrames)
+	originalSnapshot = captureChecksumMap(originalSnapshot, targetValue, options)
+
+	operationErr := operation()
+
+	newSnapshot = initValueSnapshot(newSnapshot, options, skipThreeFrames)
+	newSnapshot = captureChecksumMap(newSnapshot, targetValue, options)
+	checkErr := originalSnapshot.CheckImmutabilityAgainst(newSnapshot)
+	if checkErr == nil {
+		return operationErr
+	}
+	mutationErr, ok := checkErr.(*MutationError)
+	if operationErr == nil || !ok {
+		return checkErr
+	}
+	return &GuardedOperationError{Mutation: mutationErr, OperationError: operationErr}
+}
+
+// TemplateExecutor is implemented by both *text/template.Template and *html/template.Template.
+type TemplateExecutor interface {
+	Execute(wr io.Writer, data interface{}) error
+}
+
+// GuardedExecute executes tmpl with data and verifies that data wasn't mutated during rendering.
+// Templates calling methods with pointer receivers can silently mutate view models shared across requests,
+// GuardedExecute catches that. Errors are combined the same way as in immcheck.GuardDuring.
+func GuardedExecute(tmpl TemplateExecutor, wr io.Writer, data interface{}) error {
+	if data == nil {
+		return tmpl.Execute(wr, data)
+	}
+	return guardDuring(data, func() error {
+		return tmpl.Execute(wr, data)
+	}, Options{})
+}
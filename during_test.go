@@ -0,0 +1,125 @@
+package immcheck_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	htmltemplate "html/template"
+	"io"
+	"testing"
+	texttemplate "text/template"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+type normalizingPayload struct {
+	Tags []string
+}
+
+// MarshalJSON mutates its receiver, which is exactly the bug class immcheck.GuardDuring catches.
+func (p *normalizingPayload) MarshalJSON() ([]byte, error) {
+	for i := range p.Tags {
+		p.Tags[i] = "#" + p.Tags[i]
+	}
+	return json.Marshal(p.Tags)
+}
+
+func TestGuardDuring(t *testing.T) {
+	t.Parallel()
+	{
+		payload := &struct{ Tags []string }{Tags: []string{"a", "b"}}
+		err := immcheck.GuardDuring(payload, func() error {
+			return gob.NewEncoder(io.Discard).Encode(payload)
+		})
+		if err != nil {
+			t.Fatalf("unexpected error happened: %v", err)
+		}
+	}
+	{
+		payload := &normalizingPayload{Tags: []string{"a", "b"}}
+		err := immcheck.GuardDuring(payload, func() error {
+			_, err := json.Marshal(payload)
+			return err
+		})
+		var mutationErr *immcheck.MutationError
+		if !errors.As(err, &mutationErr) {
+			t.Fatalf("mutation isn't detected: %v", err)
+		}
+		checkMutationDetectionMessage(t, err.Error())
+	}
+}
+
+func TestGuardDuringCombinesErrors(t *testing.T) {
+	t.Parallel()
+	operationErr := errors.New("encoding failed")
+	{
+		payload := []int{1}
+		err := immcheck.GuardDuring(&payload, func() error {
+			return operationErr
+		})
+		var guardedErr *immcheck.GuardedOperationError
+		if !errors.Is(err, operationErr) || errors.As(err, &guardedErr) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	{
+		payload := []int{1}
+		err := immcheck.GuardDuringWithOptions(&payload, func() error {
+			payload[0] = 2
+			return operationErr
+		}, immcheck.Options{Flags: immcheck.SkipOriginCapturing})
+		var guardedErr *immcheck.GuardedOperationError
+		if !errors.As(err, &guardedErr) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !errors.Is(err, operationErr) || !errors.Is(err, immcheck.MutationDetectedError) {
+			t.Fatalf("combined error doesn't match its parts: %v", err)
+		}
+		var mutationErr *immcheck.MutationError
+		if !errors.As(err, &mutationErr) {
+			t.Fatalf("combined error doesn't match mutation: %v", err)
+		}
+		if !bytes.Contains([]byte(err.Error()), []byte("encoding failed")) {
+			t.Fatalf("unexpected error message: %v", err)
+		}
+	}
+}
+
+type viewModel struct {
+	Title string
+	Views int
+}
+
+// Visit has pointer receiver, so templates calling it mutate shared view model.
+func (v *viewModel) Visit() int {
+	v.Views++
+	return v.Views
+}
+
+func TestGuardedExecute(t *testing.T) {
+	t.Parallel()
+	{
+		tmpl := texttemplate.Must(texttemplate.New("title").Parse("{{.Title}}"))
+		model := &viewModel{Title: "title"}
+		output := &bytes.Buffer{}
+		if err := immcheck.GuardedExecute(tmpl, output, model); err != nil {
+			t.Fatalf("unexpected error happened: %v", err)
+		}
+		if output.String() != "title" {
+			t.Fatalf("unexpected output: %v", output)
+		}
+		if err := immcheck.GuardedExecute(tmpl, output, nil); err != nil {
+			t.Fatalf("unexpected error happened: %v", err)
+		}
+	}
+	{
+		tmpl := htmltemplate.Must(htmltemplate.New("views").Parse("{{.Title}} {{.Visit}}"))
+		model := &viewModel{Title: "title"}
+		err := immcheck.GuardedExecute(tmpl, io.Discard, model)
+		if !errors.Is(err, immcheck.MutationDetectedError) {
+			t.Fatalf("mutation isn't detected: %v", err)
+		}
+		checkMutationDetectionMessage(t, err.Error())
+	}
+}
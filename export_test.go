@@ -0,0 +1,9 @@
+package immcheck
+
+// ResetReportLimiters drops budgets of all check sites, so tests don't depend on reports of previous runs.
+func ResetReportLimiters() {
+	reportLimiters.Range(func(key, _ interface{}) bool {
+		reportLimiters.Delete(key)
+		return true
+	})
+}
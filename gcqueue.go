@@ -0,0 +1,109 @@
+package immcheck
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"sync"
+)
+
+//nolint:gochecknoglobals // gcChecks is global, since garbage collection cycles are process-wide
+var gcChecks = &gcCheckQueue{}
+
+// gcCheckQueue batches verifications until the next garbage collection cycle.
+// Garbage collection cycle is detected by finalizer of a sentinel object that is armed only while queue isn't empty.
+// Verifications are run by the finalizer worker pool, so the finalizer goroutine isn't blocked.
+type gcCheckQueue struct {
+	m      sync.Mutex
+	checks []func()
+	armed  bool
+}
+
+// gcSentinel holds a pointer, so it isn't batched by the tiny allocator and its finalizer runs on the first collection.
+type gcSentinel struct {
+	_ *byte
+}
+
+// EnsureImmutabilityOnNextGC captures checksum of v according to settings specified in options
+// and returns function that enrolls verification of v into the queue that is verified on the next garbage
+// collection cycle. It trades immediacy of detection for near-zero impact on foreground latency:
+// returned function only records the place it was called at.
+// Detected mutations are reported according to options by the finalizer worker pool,
+// so by default detected mutation crashes the program like mutations detected on finalization.
+// Returned function can be called multiple times.
+func EnsureImmutabilityOnNextGC(v interface{}, options Options) func() {
+	if v == nil {
+		panic(fmt.Errorf("%w. target value can't be nil", UnsupportedTypeError))
+	}
+	checkArenaConfined(options, "checks verified on garbage collection")
+	if inlineChecksDisabled() {
+		return NoopCheck
+	}
+	options = withDefaultOptions(options)
+	// snapshot is owned by returned function, since it can be called multiple times
+	originalSnapshot := newValueSnapshot()
+	skipTwoFrames := 2
+	originalSnapshot = initValueSnapshot(originalSnapshot, options, skipTwoFrames)
+	targetValue := reflect.ValueOf(v)
+	originalSnapshot = captureChecksumMap(originalSnapshot, targetValue, options)
+	verificationOptions := withFlags(options, options.Flags|SkipOriginCapturing)
+
+	return func() {
+		var detectionOrigin OriginID
+		if options.Flags&SkipOriginCapturing == 0 {
+			thisFuncWillBeInvokedByClientCodeSoSkipOneFrame := 1
+			detectionOrigin = origins.captureOrigin(thisFuncWillBeInvokedByClientCodeSoSkipOneFrame)
+		}
+		gcChecks.enqueue(func() {
+			newSnapshot := getTempSnapshot()
+			defer putTempSnapshot(newSnapshot)
+
+			newSnapshot = initValueSnapshot(newSnapshot, verificationOptions, 0)
+			newSnapshot.captureOrigin = detectionOrigin
+			newSnapshot = captureChecksumMap(newSnapshot, targetValue, verificationOptions)
+			if checkErr := originalSnapshot.CheckImmutabilityAgainst(newSnapshot); checkErr != nil {
+				reportError(checkErr, options)
+			}
+		})
+	}
+}
+
+// PendingGCChecks returns the number of verifications enrolled by immcheck.EnsureImmutabilityOnNextGC
+// that wait for the next garbage collection cycle.
+func PendingGCChecks() int {
+	return gcChecks.pending()
+}
+
+func (q *gcCheckQueue) enqueue(check func()) {
+	q.m.Lock()
+	q.checks = append(q.checks, check)
+	arm := !q.armed
+	q.armed = true
+	q.m.Unlock()
+	if arm {
+		q.arm()
+	}
+}
+
+func (q *gcCheckQueue) arm() {
+	runtime.SetFinalizer(&gcSentinel{}, func(*gcSentinel) {
+		q.onGC()
+	})
+}
+
+func (q *gcCheckQueue) onGC() {
+	q.m.Lock()
+	checks := q.checks
+	q.checks = nil
+	q.armed = false
+	q.m.Unlock()
+	for _, check := range checks {
+		runInPool(check)
+	}
+}
+
+func (q *gcCheckQueue) pending() int {
+	q.m.Lock()
+	defer q.m.Unlock()
+	return len(q.checks)
+}
@@ -0,0 +1,44 @@
+package immcheck_test
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+func TestEnsureImmutabilityOnNextGC(t *testing.T) {
+	t.Parallel()
+	logBuffer := &lockedWriterBuffer{buf: &bytes.Buffer{}}
+	options := immcheck.Options{
+		Flags:     immcheck.SkipPanicOnDetectedMutation,
+		LogWriter: logBuffer,
+	}
+	counter := 1
+	verifyUnchanged := immcheck.EnsureImmutabilityOnNextGC(&counter, options)
+	verifyUnchanged()
+
+	slice := []int{1, 2, 3}
+	verifyMutated := immcheck.EnsureImmutabilityOnNextGC(&slice, options)
+	slice[0] = 4
+	verifyMutated()
+	if logBuffer.String() != "" {
+		t.Fatalf("verification isn't deferred till the next GC: %v", logBuffer.String())
+	}
+
+	for i := 0; i < 10 && !strings.Contains(logBuffer.String(), "[ERROR]"); i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	resultingLog := logBuffer.String()
+	if strings.Count(resultingLog, "[ERROR] runtime mutation detected; ") != 1 {
+		t.Fatalf("unnexpected log on GC: `%v`", resultingLog)
+	}
+	if !strings.Contains(resultingLog, "mutation was detected here ") ||
+		strings.Count(resultingLog, "gcqueue_test.go:") != 2 {
+		t.Fatalf("origins aren't reported: `%v`", resultingLog)
+	}
+}
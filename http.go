@@ -0,0 +1,158 @@
+package immcheck
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// GuardResponses wraps next handler, so response objects registered with immcheck.GuardResponse
+// are verified after the whole handler chain wrapped by this middleware completes.
+// It catches middlewares that mutate response structs after they've been (partially) written.
+// Detected mutations are reported according to options.
+func GuardResponses(next http.Handler, options Options) http.Handler {
+	options = withDefaultOptions(options)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		guards := &responseGuards{options: options}
+		// verification is deferred, so snapshots return to the pool even if handler panics
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				// mutation is reported without panicking, so net/http logs the original cause of the panic
+				guards.verify(withFlags(options, options.Flags|SkipPanicOnDetectedMutation))
+				panic(recovered)
+			}
+			guards.verify(options)
+		}()
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), responseGuardsKey{}, guards)))
+	})
+}
+
+// GuardResponse captures snapshot of response object v right before it is serialized.
+// v will be verified after the handler chain wrapped by immcheck.GuardResponses completes.
+// Returns false if request context doesn't belong to immcheck.GuardResponses middleware, so v isn't guarded.
+func GuardResponse(ctx context.Context, v interface{}) bool {
+	if v == nil {
+		panic(fmt.Errorf("%w. target value can't be nil", UnsupportedTypeError))
+	}
+	guards, ok := ctx.Value(responseGuardsKey{}).(*responseGuards)
+	if !ok {
+		return false
+	}
+	guards.m.Lock()
+	defer guards.m.Unlock()
+	if guards.verified {
+		return false
+	}
+
+	skipTwoFrames := 2
+	snapshot := getTempSnapshot() // verify returns this snapshot to the pool
+	snapshot = initValueSnapshot(snapshot, guards.options, skipTwoFrames)
+	target := reflect.ValueOf(v)
+	snapshot = captureChecksumMap(snapshot, target, guards.options)
+	guards.entries = append(guards.entries, responseGuard{target: target, snapshot: snapshot})
+	return true
+}
+
+type responseGuardsKey struct{}
+
+type responseGuards struct {
+	options Options
+
+	m        sync.Mutex
+	entries  []responseGuard
+	verified bool
+}
+
+type responseGuard struct {
+	target   reflect.Value
+	snapshot *ValueSnapshot
+}
+
+// verify checks guarded responses and reports detected mutation according to options.
+func (g *responseGuards) verify(options Options) {
+	g.m.Lock()
+	entries := g.entries
+	g.entries = nil
+	g.verified = true
+	g.m.Unlock()
+
+	newSnapshot := getTempSnapshot()
+	defer putTempSnapshot(newSnapshot)
+	// detection always happens in the middleware, so only capture origin is interesting
+	verificationOptions := withFlags(options, options.Flags|SkipOriginCapturing)
+	var checkErr error
+	for _, entry := range entries {
+		newSnapshot = initValueSnapshot(newSnapshot, verificationOptions, 0)
+		newSnapshot = captureChecksumMap(newSnapshot, entry.target, verificationOptions)
+		if err := entry.snapshot.CheckImmutabilityAgainst(newSnapshot); err != nil && checkErr == nil {
+			checkErr = err
+		}
+		putTempSnapshot(entry.snapshot)
+	}
+	if checkErr != nil {
+		reportError(checkErr, options)
+	}
+}
+
+// ETag returns strong HTTP entity tag of v computed from immcheck.StableDigest of v,
+// so the same content produces the same ETag in every process serving it.
+func ETag(v interface{}, options Options) string {
+	return `"` + ComputeStableDigest(v, withDefaultOptions(options)).String() + `"`
+}
+
+// ETaggedResponse is a cached response object together with its HTTP entity tag.
+// It verifies on every request served from the cache that response object backing ETag wasn't mutated,
+// since mutated object would be served to clients that already hold stale representation under the same ETag.
+// ETaggedResponse is safe for concurrent use.
+type ETaggedResponse struct {
+	etag  string
+	value interface{}
+	guard *accessGuard
+}
+
+// GuardETag computes ETag of cached response object v using immcheck.ETag and captures snapshot of v.
+// Detected mutations are reported according to options.
+// If inline checks are switched off by immcheck.SetRuntimeToggles, v isn't captured and is never verified.
+func GuardETag(v interface{}, options Options) *ETaggedResponse {
+	skipThreeFrames := 3
+	guard := newAccessGuard(v, options, skipThreeFrames)
+	return &ETaggedResponse{
+		etag:  ETag(v, options),
+		value: v,
+		guard: guard,
+	}
+}
+
+// ETag returns entity tag computed when response object was cached.
+func (e *ETaggedResponse) ETag() string {
+	return e.etag
+}
+
+// Value verifies that response object wasn't mutated since its ETag was computed and returns it.
+func (e *ETaggedResponse) Value() interface{} {
+	skipThreeFrames := 3
+	e.guard.onRead(skipThreeFrames)
+	return e.value
+}
+
+// NotModified verifies that response object wasn't mutated since its ETag was computed
+// and reports whether If-None-Match header of r matches the ETag, so handler can respond with 304 Not Modified.
+func (e *ETaggedResponse) NotModified(r *http.Request) bool {
+	skipThreeFrames := 3
+	e.guard.onRead(skipThreeFrames)
+	return etagMatches(r.Header.Get("If-None-Match"), e.etag)
+}
+
+// etagMatches implements weak comparison of If-None-Match header against etag as RFC 7232 requires.
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
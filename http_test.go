@@ -0,0 +1,134 @@
+package immcheck_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+type userResponse struct {
+	Name  string
+	Roles []string
+}
+
+func TestGuardResponses(t *testing.T) {
+	t.Parallel()
+	var lastResponse *userResponse
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := &userResponse{Name: "user", Roles: []string{"reader"}}
+		lastResponse = response
+		immcheck.GuardResponse(r.Context(), response)
+		_ = json.NewEncoder(w).Encode(response)
+	})
+	auditMiddleware := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r)
+			if r.URL.Query().Get("redact") != "" {
+				lastResponse.Roles[0] = "redacted" // mutation after response was written
+			}
+		})
+	}
+	logBuffer := &lockedWriterBuffer{buf: &bytes.Buffer{}}
+	server := httptest.NewServer(immcheck.GuardResponses(
+		auditMiddleware(handler),
+		immcheck.Options{Flags: immcheck.SkipPanicOnDetectedMutation, LogWriter: logBuffer},
+	))
+	defer server.Close()
+
+	for _, path := range []string{"/", "/?redact=1"} {
+		response, err := server.Client().Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("unexpected error happened: %v", err)
+		}
+		_ = response.Body.Close()
+	}
+	resultingLog := logBuffer.String()
+	t.Log(resultingLog)
+	if strings.Count(resultingLog, "mutation of immutable value detected") != 1 {
+		t.Fatalf("unexpected log: %v", resultingLog)
+	}
+	if !strings.Contains(resultingLog, "immutable snapshot was captured here ") {
+		t.Fatalf("capture origin is missing: %v", resultingLog)
+	}
+}
+
+func TestGuardResponsesWithPanickingHandler(t *testing.T) {
+	t.Parallel()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := &userResponse{Name: "user", Roles: []string{"reader"}}
+		immcheck.GuardResponse(r.Context(), response)
+		response.Roles[0] = "redacted"
+		panic(http.ErrAbortHandler)
+	})
+	reporter := &recordingReporter{}
+	guarded := immcheck.GuardResponses(handler, immcheck.Options{Reporter: reporter})
+	expectPanic(t, func() {
+		guarded.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}, http.ErrAbortHandler)
+	if len(reporter.errs) != 1 {
+		t.Fatalf("responses guarded by panicking handler aren't verified: %v", reporter.errs)
+	}
+}
+
+func TestGuardResponsesKeepHandlerPanic(t *testing.T) {
+	t.Parallel()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := &userResponse{Name: "user", Roles: []string{"reader"}}
+		immcheck.GuardResponse(r.Context(), response)
+		response.Roles[0] = "redacted"
+		panic(http.ErrAbortHandler)
+	})
+	logBuffer := &lockedWriterBuffer{buf: &bytes.Buffer{}}
+	guarded := immcheck.GuardResponses(handler, immcheck.Options{LogWriter: logBuffer})
+	// mutation is logged, but doesn't replace the panic of the handler
+	expectPanic(t, func() {
+		guarded.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}, http.ErrAbortHandler)
+	if !strings.Contains(logBuffer.String(), "mutation of immutable value detected") {
+		t.Fatalf("mutation isn't reported: %v", logBuffer.String())
+	}
+}
+
+func TestGuardResponseWithoutMiddleware(t *testing.T) {
+	t.Parallel()
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	if immcheck.GuardResponse(request.Context(), &userResponse{}) {
+		t.Fatal("response can't be guarded without middleware")
+	}
+}
+
+func TestGuardETag(t *testing.T) {
+	t.Parallel()
+	cached := &userResponse{Name: "user", Roles: []string{"reader"}}
+	logBuffer := &lockedWriterBuffer{buf: &bytes.Buffer{}}
+	tagged := immcheck.GuardETag(cached, immcheck.Options{
+		Flags:     immcheck.SkipPanicOnDetectedMutation,
+		LogWriter: logBuffer,
+	})
+	if tagged.ETag() != immcheck.ETag(&userResponse{Name: "user", Roles: []string{"reader"}}, immcheck.Options{}) {
+		t.Fatalf("ETag isn't computed from content: %v", tagged.ETag())
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	if tagged.NotModified(request) {
+		t.Fatal("request without If-None-Match can't be not modified")
+	}
+	request.Header.Set("If-None-Match", `"other", W/`+tagged.ETag())
+	if !tagged.NotModified(request) {
+		t.Fatal("If-None-Match isn't matched")
+	}
+	if logBuffer.String() != "" {
+		t.Fatalf("unexpected log: %v", logBuffer.String())
+	}
+
+	tagged.Value().(*userResponse).Roles[0] = "admin"
+	tagged.NotModified(request)
+	if !strings.Contains(logBuffer.String(), "mutation of immutable value detected") {
+		t.Fatalf("mutation of cached response isn't detected: %v", logBuffer.String())
+	}
+}
@@ -7,8 +7,8 @@ import (
 	"os"
 	"reflect"
 	"runtime"
-	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unsafe"
 
@@ -19,9 +19,11 @@ const (
 	MutationDetectedError     mutationDetectionError = "mutation of immutable value detected"
 	InvalidSnapshotStateError mutationDetectionError = "invalid snapshot state"
 	UnsupportedTypeError      mutationDetectionError = "unsupported type for immutability check"
+	IncompatibleSnapshotError mutationDetectionError = "snapshots are incompatible"
+	MalformedTogglesError     mutationDetectionError = "malformed runtime toggles"
 )
 
-type immutabilityCheckFlag uint8
+type immutabilityCheckFlag uint16
 
 const (
 	// SkipOriginCapturing forces immcheck to not capture caller information to report snapshot origin.
@@ -36,6 +38,67 @@ const (
 	// SkipLoggingOnMutation forces immcheck to not log details of found mutation
 	// in immcheck.EnsureImmutability and immcheck.CheckImmutabilityOnFinalization methods.
 	SkipLoggingOnMutation
+	// CaptureSliceCapacity forces immcheck to capture slices up to their capacity instead of length
+	// together with slice data pointer, length and capacity.
+	// It detects mutations made through other slices that share the backing array beyond length of guarded slice.
+	CaptureSliceCapacity
+	// CaptureStringIdentity forces immcheck to capture data pointers of strings in addition to their content.
+	// String header repointed to different but equal bytes is reported as mutation
+	// with MutationError.StringDataRepointed set.
+	CaptureStringIdentity
+	// AllowReleaseByNil forces immcheck to not report mutations where pointers, interfaces or maps
+	// that were set at capture time became nil, because guarded value graph was legitimately torn down.
+	// Mutations are still reported if anything else was changed too, or if released references were held
+	// by slots that aren't addressable, like map values.
+	// Such mutations are classified with MutationError.Released regardless of this flag.
+	// The flag applies to checks that return errors and to ValueSnapshot.CheckImmutabilityAgainst of snapshots
+	// captured with it as well.
+	AllowReleaseByNil
+	// NormalizeFloats forces immcheck to hash floats and complex numbers in canonical form:
+	// all NaNs are hashed as the same quiet NaN and -0.0 is hashed as +0.0.
+	// Use it if guarded values legally regenerate NaNs with different payloads or flip sign of zeros.
+	NormalizeFloats
+	// CompareReferencesByContent forces immcheck to identify pointers and interfaces by content they reference
+	// instead of their addresses. Re-assigning them to new allocations holding equal content
+	// isn't reported as mutation. Interfaces are still identified by their dynamic types.
+	// Content stays bound to where it is referenced from, so references swapped between fields are reported.
+	// By default identities of all references are captured and such mutations are classified
+	// with MutationError.PointerRetargeted.
+	CompareReferencesByContent
+	// ReportNeverVerifiedChecks forces immcheck to log a warning when function returned by
+	// immcheck.EnsureImmutability is garbage collected without being called.
+	// Baseline snapshots of such checks are reclaimed regardless of this flag.
+	ReportNeverVerifiedChecks
+	// AlsoCheckOnFinalization forces immcheck.EnsureImmutability to also verify target value on its finalization
+	// against the same baseline snapshot, like immcheck.CheckImmutabilityOnFinalization does.
+	// Target value should be a pointer without finalizer.
+	AlsoCheckOnFinalization
+	// SkipUnsupportedTypes forces immcheck to record reflect.UnsafePointer, reflect.Func and reflect.Chan
+	// values met during capture as unverified nodes instead of panicking, see ValueSnapshot.UnverifiedNodes.
+	// Unlike AllowInherentlyUnsafeTypes, it doesn't pretend such values are verified, so gradual adoption
+	// in legacy code bases can track how much of guarded values isn't protected.
+	SkipUnsupportedTypes
+	// AllowUnexportedAccess forces immcheck to read values that are neither addressable nor interfaceable,
+	// like values of unexported fields of structs passed by value, using unsafe.Pointer arithmetic
+	// over internals of reflect.Value. Frameworks can pass such values as reflect.Value targets.
+	// Values of unexported fields passed to immcheck.WalkPair visitors are made interfaceable,
+	// so custom comparators can compare them like reflect.DeepEqual does.
+	// Without this flag capture of such values panics with immcheck.UnsupportedTypeError.
+	// Layout of reflect.Value is an implementation detail of Go runtime, so this flag relies on it
+	// the same way as other unsafe code does.
+	AllowUnexportedAccess
+	// RenderDiffOnMutation forces immcheck to render small guarded values at capture time,
+	// so reports of detected mutations include unified diff of old and new values, see MutationError.Diff.
+	// Values that render into too many lines aren't rendered. Rendering is slow, so use it for debugging.
+	RenderDiffOnMutation
+	// CompareByValue forces immcheck to follow logical value semantics, so replacing guarded value
+	// with a field-for-field equal copy isn't reported as mutation. It implies CompareReferencesByContent,
+	// and strings and slices are identified by their lengths and content instead of their data pointers
+	// and capacities. Use it when guarded values are legitimately copied, like values passed through channels.
+	// Maps are identified by their entries folded in order of their digests instead of their addresses,
+	// so snapshots don't depend on iteration order of maps.
+	// It contradicts CaptureStringIdentity and CaptureSliceCapacity.
+	CompareByValue
 	// doNotDetectRefLoop can be used only internally to skip one cycle of detection and allow reuse of memory values
 	// in map entries capture look at immcheck.perEntrySnapshot.
 	doNotDetectRefLoop
@@ -48,6 +111,56 @@ type Options struct {
 	// Bitmask of ImmutabilityCheckFlags.
 	// You can specify it like that: SkipOriginCapturing | SkipLoggingOnMutation | AllowInherentlyUnsafeTypes
 	Flags immutabilityCheckFlag
+	// PanicValue produces custom value to panic with when mutation is detected. Can be nil.
+	// immcheck panics with *immcheck.MutationError by default.
+	PanicValue func(err *MutationError) interface{}
+	// Arena specifies scratch space for temporary objects used during capture. Can be nil.
+	// immcheck uses global pools by default. Arena can't be used by checks that capture values
+	// on other goroutines, see immcheck.Arena.
+	Arena *Arena
+	// SampleEvery makes accessor-based guards, like immcheck.ImmutableSlice, verify only every N-th read
+	// and immcheck.EnsureImmutabilityWithOptions capture only every N-th value.
+	// 0 and 1 mean that everything is verified.
+	SampleEvery uint32
+	// Aggregator aggregates repeated mutation reports instead of logging each of them to LogWriter. Can be nil.
+	Aggregator *ReportAggregator
+	// MaxReportsPerSecond limits number of logged mutation reports, excessive reports are dropped.
+	// Checks of the same site, identified by capture origin, share the same budget. 0 means no limit.
+	// It doesn't affect panics.
+	MaxReportsPerSecond float64
+	// ReportFormat specifies format of reports logged to LogWriter. immcheck uses TextReportFormat by default.
+	ReportFormat ReportFormat
+	// Label is included into logged reports to identify guarded value. Can be empty.
+	Label string
+	// Reporter receives detected mutations instead of default logging and panicking. Can be nil.
+	Reporter Reporter
+	// Budget is shared by guards of one request to limit amount of captured memory, see immcheck.Budget. Can be nil.
+	// It is honoured by immcheck.EnsureImmutabilityWithOptions.
+	Budget *Budget
+	// ClearFlags is a bitmask of ImmutabilityCheckFlags that are removed from default options,
+	// see immcheck.SetDefaultOptions.
+	ClearFlags immutabilityCheckFlag
+	// IgnoredFields are names of fields excluded from snapshots as if they were tagged with `immcheck:"ignore"`.
+	// It is honoured only by immcheck.SetTypeDefaults, where it applies to fields of the registered struct type.
+	IgnoredFields []string
+	// SafeMode makes immcheck capture values using only reflect API and pointers obtained from it,
+	// instead of relying on memory layouts of Go runtime internals, so captures stay memory-safe
+	// under checkptr and sanitizers. It is slower, since values that are neither addressable nor references
+	// are copied, and re-boxing of equal value into interface isn't reported as a mutation.
+	// Toggle internals=reflect enables it for the whole process, see immcheck.SetRuntimeToggles.
+	SafeMode bool
+	// ClearSafeMode switches off SafeMode set by default options, see immcheck.SetDefaultOptions.
+	ClearSafeMode bool
+
+	// internals are resolved from internals toggle once options are resolved, see withRuntimeToggles,
+	// so guards verify values using the same internals as their baselines were captured with.
+	internals runtimeInternals
+}
+
+// Reporter receives errors of detected mutations.
+// Use it to integrate immcheck with test frameworks or error trackers.
+type Reporter interface {
+	ReportMutation(err error)
 }
 
 // ValueSnapshot is a re-usable object of snapshot value that works similar to bytes.Buffer.
@@ -57,10 +170,62 @@ type Options struct {
 // Then you can re-use snapshots by calling ValueSnapshot.Reset.
 // This approach can help you to avoid extra allocations.
 type ValueSnapshot struct {
-	captureOriginFile *bytes.Buffer
-	captureOriginLine int
+	captureOrigin OriginID
+	// hashAlgorithm, checksumMode and internals identify how checksums were computed,
+	// snapshots can be compared only if they are the same
+	hashAlgorithm hashAlgorithmID
+	checksumMode  immutabilityCheckFlag
+	internals     internalsID
 
 	checksums map[uint32]uint32
+	// stringIdentities is an order independent fold of strings data pointers and lengths,
+	// it is captured only with CaptureStringIdentity flag
+	stringIdentities uint32
+	// contentDigest is an order independent fold of checksums of captured content that don't depend on addresses,
+	// it is used to distinguish retargeted references from content changes
+	contentDigest uint32
+	// mapKeySet is an order independent fold of identities of all map keys, see captureMapKeyIdentity
+	mapKeySet uint32
+	// rootType, rootElements and capturedBytes describe guarded root to make reports groupable,
+	// they aren't part of binary format
+	rootType      reflect.Type
+	rootElements  int
+	capturedBytes int
+	// nilReferences is the number of nil pointers, interfaces and maps met during capture
+	nilReferences int
+	// sequenceLengths is the total length of captured slices
+	sequenceLengths int
+	// entries is the total number of entries of captured maps and containers
+	entries int
+	// nodes is the number of values visited during capture, it isn't part of binary format
+	nodes int
+	// unverifiedNodes is the number of values skipped with SkipUnsupportedTypes flag,
+	// ignoredFields and ignoredBytes are the number and inline size of fields excluded with ignore tag,
+	// they aren't part of binary format
+	unverifiedNodes int
+	ignoredFields   int
+	ignoredBytes    int
+	// visitedReferences is used only with CompareReferencesByContent flag to detect ref loops,
+	// since addresses of references aren't captured into checksums in this mode.
+	// It maps references to content digests of their values, see bindContent
+	visitedReferences map[visitedReference]uint32
+	// inheritedReferences are references visited by snapshots of enclosing maps when this snapshot captures
+	// one of their entries with CompareByValue flag, see captureSortedMap
+	inheritedReferences []map[visitedReference]uint32
+	// contentPosition is position of the next content captured by content, see bindContent
+	contentPosition uint32
+	// slotContents are content digests of values referenced from addressable slots and nilSlots are addresses
+	// of slots that hold nil, so pure releases can be told apart from other mutations, see captureReleasable
+	slotContents []slotContent
+	nilSlots     []uintptr
+	// releaseAllowed is true if the snapshot was captured with AllowReleaseByNil flag
+	releaseAllowed bool
+	// writeSequence is the sequence of the first write to Tracked fields made after the snapshot was captured
+	writeSequence uint64
+	// rendering holds lines of guarded value rendered with RenderDiffOnMutation flag, nil if it wasn't rendered
+	rendering []string
+	// memoryRegions is set only by immcheck.DetectAliasing to collect memory regions covered by the snapshot
+	memoryRegions *[]memoryRegion
 }
 
 // NewValueSnapshot creates new re-usable object of snapshot object.
@@ -68,24 +233,98 @@ func NewValueSnapshot() *ValueSnapshot {
 	return newValueSnapshot()
 }
 
+// OriginID returns interned origin of the snapshot.
+// Use immcheck.LookupOrigin to resolve it. Returns zero OriginID if origin wasn't captured.
+func (v *ValueSnapshot) OriginID() OriginID {
+	return v.captureOrigin
+}
+
+// UnverifiedNodes returns the number of UnsafePointer, Func and Chan values that were skipped during capture
+// because of SkipUnsupportedTypes flag. Their content isn't verified by the snapshot.
+// Values embedded into structs or arrays are still verified as raw memory, but what they reference isn't.
+func (v *ValueSnapshot) UnverifiedNodes() int {
+	return v.unverifiedNodes
+}
+
+// Coverage quantifies how much of the captured value is protected by the snapshot
+// after ignore tags and SkipUnsupportedTypes flag are applied.
+// totalBytes is the number of bytes met during capture, verifiedBytes excludes inline memory of ignored fields.
+// skippedNodes is the number of ignored fields and unverified nodes, memory they reference isn't counted,
+// since it isn't walked. Coverage is approximate: memory reachable through several paths is counted several times.
+// Restored snapshots report zero coverage.
+func (v *ValueSnapshot) Coverage() (verifiedBytes int, totalBytes int, skippedNodes int) {
+	return v.capturedBytes - v.ignoredBytes, v.capturedBytes, v.unverifiedNodes + v.ignoredFields
+}
+
 // Reset clear internal state of ValueSnapshot, so it can be re-used.
 func (v *ValueSnapshot) Reset() {
-	v.captureOriginFile.Reset()
-	v.captureOriginLine = 0
+	v.captureOrigin = 0
+	v.hashAlgorithm = currentHashAlgorithm
+	v.checksumMode = 0
+	v.internals = layoutInternalsID
+	v.stringIdentities = 0
+	v.mapKeySet = 0
+	v.contentDigest = 0
+	v.rootType = nil
+	v.rootElements = 0
+	v.capturedBytes = 0
+	v.nilReferences = 0
+	v.sequenceLengths = 0
+	v.entries = 0
+	v.nodes = 0
+	v.unverifiedNodes = 0
+	v.ignoredFields = 0
+	v.ignoredBytes = 0
+	v.writeSequence = 0
+	v.rendering = nil
+	for key := range v.visitedReferences {
+		delete(v.visitedReferences, key)
+	}
+	v.inheritedReferences = nil
+	v.contentPosition = 0
+	v.slotContents = v.slotContents[:0]
+	v.nilSlots = v.nilSlots[:0]
+	v.releaseAllowed = false
 	for key := range v.checksums {
 		delete(v.checksums, key)
 	}
 }
 
+// copyFrom makes v a copy of src that doesn't share maps with it, so src can be returned to the pool
+// while v is kept, and the other way around.
+func (v *ValueSnapshot) copyFrom(src *ValueSnapshot) {
+	v.Reset()
+	checksums, visitedReferences, slotContents, nilSlots := v.checksums, v.visitedReferences, v.slotContents, v.nilSlots
+	*v = *src
+	v.checksums = copyInto(checksums, src.checksums)
+	v.slotContents = append(slotContents, src.slotContents...)
+	v.nilSlots = append(nilSlots, src.nilSlots...)
+	// references visited during capture aren't needed to compare snapshots
+	v.visitedReferences = visitedReferences
+	v.inheritedReferences = nil
+}
+
+// copyInto copies entries of src into empty dst allocating it if needed.
+func copyInto[K comparable, V any](dst map[K]V, src map[K]V) map[K]V {
+	if len(src) == 0 {
+		return dst
+	}
+	if dst == nil {
+		dst = make(map[K]V, len(src))
+	}
+	for key, value := range src {
+		dst[key] = value
+	}
+	return dst
+}
+
 // String provides string representation of ValueSnapshot.
 func (v *ValueSnapshot) String() string {
 	buf := &bytes.Buffer{}
 	buf.WriteString("ValueSnapshot{")
-	if v.captureOriginFile.Len() != 0 && v.captureOriginLine != 0 {
+	if origin, ok := LookupOrigin(v.captureOrigin); ok {
 		buf.WriteString("origin: ")
-		buf.Write(v.captureOriginFile.Bytes())
-		buf.WriteByte(':')
-		buf.WriteString(strconv.Itoa(v.captureOriginLine))
+		buf.WriteString(origin.String())
 		buf.WriteString("; ")
 	}
 	buf.WriteString("checksumSize: ")
@@ -95,54 +334,97 @@ func (v *ValueSnapshot) String() string {
 }
 
 // CheckImmutabilityAgainst verifies that otherSnapshot is exactly the same as this one.
-// Returns immcheck.MutationDetectedError if snapshots are different.
+// Returns *immcheck.MutationError that wraps immcheck.MutationDetectedError if snapshots are different.
+// Returns immcheck.IncompatibleSnapshotError if snapshots were captured with different hashing algorithms
+// or with options that change checksums.
+// Panics with immcheck.InvalidSnapshotStateError if otherSnapshot is this snapshot.
 func (v *ValueSnapshot) CheckImmutabilityAgainst(otherSnapshot *ValueSnapshot) error {
 	if len(v.checksums) == 0 || len(otherSnapshot.checksums) == 0 {
 		panic(fmt.Errorf("%w snapshot is empty", InvalidSnapshotStateError))
 	}
+	if v == otherSnapshot {
+		panic(fmt.Errorf(
+			"%w snapshot is compared against itself, which always passes. "+
+				"Capture value into separate ValueSnapshot or use ValueSnapshot.Check",
+			InvalidSnapshotStateError,
+		))
+	}
 	originalSnapshot := v
 	newSnapshot := otherSnapshot
-	if checksumEquals(newSnapshot.checksums, originalSnapshot.checksums) {
+	if err := checkSnapshotsCompatibility(originalSnapshot, newSnapshot); err != nil {
+		return err
+	}
+	stringDataRepointed := newSnapshot.stringIdentities != originalSnapshot.stringIdentities
+	keySetChanged := newSnapshot.mapKeySet != originalSnapshot.mapKeySet
+	if !stringDataRepointed && !keySetChanged && checksumEquals(newSnapshot.checksums, originalSnapshot.checksums) {
 		return nil
 	}
 
-	originalSnapshotOrigin := ""
-	if originalSnapshot.captureOriginFile.Len() != 0 && originalSnapshot.captureOriginLine != 0 {
-		originalSnapshotOrigin = fmt.Sprintf(
-			"immutable snapshot was captured here %v:%v\n",
-			originalSnapshot.captureOriginFile, originalSnapshot.captureOriginLine,
-		)
+	describedSnapshot := originalSnapshot
+	if describedSnapshot.rootType == nil {
+		// restored snapshots don't carry root description
+		describedSnapshot = newSnapshot
 	}
-	newSnapshotOrigin := ""
-	if newSnapshot.captureOriginFile.Len() != 0 && newSnapshot.captureOriginLine != 0 {
-		newSnapshotOrigin = fmt.Sprintf(
-			"mutation was detected here %v:%v\n",
-			newSnapshot.captureOriginFile, newSnapshot.captureOriginLine,
-		)
+	kinds := classifyMutation(originalSnapshot, newSnapshot)
+	if originalSnapshot.releaseAllowed && kinds.Has(Released) && releasedOnly(originalSnapshot, newSnapshot) {
+		return nil
+	}
+	mutationErr := &MutationError{
+		CaptureOrigin:       originalSnapshot.captureOrigin,
+		DetectionOrigin:     newSnapshot.captureOrigin,
+		Kinds:               kinds,
+		StringDataRepointed: stringDataRepointed,
+		Released:            kinds.Has(Released),
+		KeySetChanged:       keySetChanged,
+		PointerRetargeted: kinds.Has(PointerRetargeted) &&
+			!checksumEquals(newSnapshot.checksums, originalSnapshot.checksums),
+		Elements:        describedSnapshot.rootElements,
+		ApproximateSize: describedSnapshot.capturedBytes,
+		LastWriters:     trackedWrites.since(originalSnapshot.writeSequence),
+		UnverifiedNodes: newSnapshot.unverifiedNodes,
+	}
+	if describedSnapshot.rootType != nil {
+		mutationErr.Type = describedSnapshot.rootType.String()
 	}
+	if originalSnapshot.rendering != nil && newSnapshot.rendering != nil {
+		mutationErr.Diff = unifiedDiff(originalSnapshot.rendering, newSnapshot.rendering)
+	}
+	return mutationErr
+}
 
-	return fmt.Errorf(
-		"%w\n%v%v",
-		MutationDetectedError, originalSnapshotOrigin, newSnapshotOrigin,
-	)
+// Check captures v according to settings specified in options into pooled scratch snapshot
+// and verifies it against this snapshot. It spares callers from managing the second ValueSnapshot.
+// Returns the same errors as ValueSnapshot.CheckImmutabilityAgainst.
+// options should change checksums the same way as options this snapshot was captured with.
+func (v *ValueSnapshot) Check(value interface{}, options Options) error {
+	options = withDefaultOptions(options)
+	newSnapshot := getTempSnapshot()
+	defer putTempSnapshot(newSnapshot)
+
+	skipTwoFrames := 2
+	newSnapshot = initValueSnapshot(newSnapshot, options, skipTwoFrames)
+	newSnapshot = captureChecksumMap(newSnapshot, targetValueOf(value), options)
+	return v.CheckImmutabilityAgainst(newSnapshot)
 }
 
 // CaptureSnapshot creates lightweight checksum representation of v and stores if into dst.
 // Returns modified dst object.
 func CaptureSnapshot(v interface{}, dst *ValueSnapshot) *ValueSnapshot {
+	options := withDefaultOptions(Options{})
 	skipTwoFrames := 2
-	snapshot := initValueSnapshot(dst, Options{}, skipTwoFrames)
-	targetValue := reflect.ValueOf(v)
-	snapshot = captureChecksumMap(snapshot, targetValue, Options{})
+	snapshot := initValueSnapshot(dst, options, skipTwoFrames)
+	targetValue := targetValueOf(v)
+	snapshot = captureChecksumMap(snapshot, targetValue, options)
 	return snapshot
 }
 
 // CaptureSnapshotWithOptions creates lightweight checksum according to settings specified in options,
 // representation of v and stores if into dst. Returns modified dst object.
 func CaptureSnapshotWithOptions(v interface{}, dst *ValueSnapshot, options Options) *ValueSnapshot {
+	options = withDefaultOptions(options)
 	skipTwoFrames := 2
 	snapshot := initValueSnapshot(dst, options, skipTwoFrames)
-	targetValue := reflect.ValueOf(v)
+	targetValue := targetValueOf(v)
 	snapshot = captureChecksumMap(snapshot, targetValue, options)
 	return snapshot
 }
@@ -179,32 +461,44 @@ func CheckImmutabilityOnFinalizationWithOptions(v interface{}, options Options)
 	checkImmutabilityOnFinalization(v, options)
 }
 
-//nolint:gochecknoglobals // tempSnapshotsPool is global to maximise snapshot objects re-use
-var tempSnapshotsPool = &sync.Pool{
-	New: func() interface{} {
-		return newValueSnapshot()
-	},
-}
-
 func checkImmutabilityOnFinalization(v interface{}, options Options) {
 	if v == nil {
 		panic(fmt.Errorf("%w. target value can't be nil", UnsupportedTypeError))
 	}
-	originalSnapshot := tempSnapshotsPool.Get().(*ValueSnapshot) // finalizer returns this snapshot to the pool
+	checkArenaConfined(options, "finalizer checks")
+	if finalizerChecksDisabled() {
+		return
+	}
+	options = withDefaultOptions(options)
+	originalSnapshot := getTempSnapshot() // finalizer returns this snapshot to the pool
 	skipThreeFrames := 3
 	originalSnapshot = initValueSnapshot(originalSnapshot, options, skipThreeFrames)
 	originalSnapshot = captureChecksumMap(originalSnapshot, reflect.ValueOf(v), options)
 
+	lifecycle := newGuardLifecycle(originalSnapshot, options)
+	setFinalizationCheck(
+		v, originalSnapshot, func() { putTempSnapshot(originalSnapshot) }, captureChecksumMap, lifecycle, options,
+	)
+}
+
+// setFinalizationCheck sets finalizer on v that verifies v against originalSnapshot and calls release afterwards.
+// capture must be the function that captured originalSnapshot.
+func setFinalizationCheck(
+	v interface{}, originalSnapshot *ValueSnapshot, release func(),
+	capture func(snapshot *ValueSnapshot, value reflect.Value, options Options) *ValueSnapshot,
+	lifecycle guardLifecycle, options Options,
+) {
 	runtime.SetFinalizer(v, func(v interface{}) {
 		runInPool(func() {
-			newSnapshot := tempSnapshotsPool.Get().(*ValueSnapshot)
-			defer tempSnapshotsPool.Put(newSnapshot)
-			defer tempSnapshotsPool.Put(originalSnapshot)
+			newSnapshot := getTempSnapshot()
+			defer putTempSnapshot(newSnapshot)
+			defer release()
 
 			funcWillBeInvokedByAsyncPoolSoSkipOneFrame := 1
 			newSnapshot = initValueSnapshot(newSnapshot, options, funcWillBeInvokedByAsyncPoolSoSkipOneFrame)
-			newSnapshot = captureChecksumMap(newSnapshot, reflect.ValueOf(v), options)
+			newSnapshot = capture(newSnapshot, reflect.ValueOf(v), options)
 			checkErr := originalSnapshot.CheckImmutabilityAgainst(newSnapshot)
+			lifecycle.verified(checkErr)
 			if checkErr != nil {
 				reportError(checkErr, options)
 			}
@@ -212,25 +506,169 @@ func checkImmutabilityOnFinalization(v interface{}, options Options) {
 	})
 }
 
+// EnsureImmutabilityErr captures checksum of v according to settings specified in options
+// and returns function that can be called to verify that v was not mutated.
+// Instead of logging and panicking returned function returns *immcheck.MutationError,
+// so callers can decide themselves whether to fail a request, log or retry.
+// Options related to logging and panics are ignored. Returned function can be called multiple times.
+func EnsureImmutabilityErr(v interface{}, options Options) func() error {
+	if v == nil {
+		panic(fmt.Errorf("%w. target value can't be nil", UnsupportedTypeError))
+	}
+	if inlineChecksDisabled() {
+		return func() error { return nil }
+	}
+	options = withDefaultOptions(options)
+	// snapshot is owned by returned function, since it can be called multiple times
+	originalSnapshot := newValueSnapshot()
+	skipTwoFrames := 2
+	originalSnapshot = initValueSnapshot(originalSnapshot, options, skipTwoFrames)
+	targetValue := targetValueOf(v)
+	originalSnapshot = captureChecksumMap(originalSnapshot, targetValue, options)
+
+	return func() error {
+		newSnapshot := getTempSnapshot()
+		defer putTempSnapshot(newSnapshot)
+
+		thisFuncWillBeInvokedByClientCodeSoSkipOnlyTwoFrames := 2
+		newSnapshot = initValueSnapshot(newSnapshot, options, thisFuncWillBeInvokedByClientCodeSoSkipOnlyTwoFrames)
+		newSnapshot = captureChecksumMap(newSnapshot, targetValue, options)
+		return originalSnapshot.CheckImmutabilityAgainst(newSnapshot)
+	}
+}
+
+// EnsureImmutabilityAsync works the same way as immcheck.EnsureImmutabilityErr,
+// but returned function schedules verification on the internal worker pool and returns channel
+// that receives the result of verification: nil or *immcheck.MutationError.
+// So request handlers can kick off verification at scope exit without blocking the response path.
+// Guarded value shouldn't be legitimately mutated until the result is received.
+func EnsureImmutabilityAsync(v interface{}, options Options) func() <-chan error {
+	if v == nil {
+		panic(fmt.Errorf("%w. target value can't be nil", UnsupportedTypeError))
+	}
+	checkArenaConfined(options, "asynchronous checks")
+	if inlineChecksDisabled() {
+		return closedErrorChannel
+	}
+	options = withDefaultOptions(options)
+	// snapshot is owned by returned function, since it can be called multiple times
+	originalSnapshot := newValueSnapshot()
+	skipTwoFrames := 2
+	originalSnapshot = initValueSnapshot(originalSnapshot, options, skipTwoFrames)
+	targetValue := targetValueOf(v)
+	originalSnapshot = captureChecksumMap(originalSnapshot, targetValue, options)
+	// detection origin is captured on the calling goroutine, since the pool goroutine has no client code on stack
+	verificationOptions := withFlags(options, options.Flags|SkipOriginCapturing)
+
+	return func() <-chan error {
+		var detectionOrigin OriginID
+		if options.Flags&SkipOriginCapturing == 0 {
+			thisFuncWillBeInvokedByClientCodeSoSkipOneFrame := 1
+			detectionOrigin = origins.captureOrigin(thisFuncWillBeInvokedByClientCodeSoSkipOneFrame)
+		}
+		result := make(chan error, 1)
+		runInPool(func() {
+			newSnapshot := getTempSnapshot()
+			defer putTempSnapshot(newSnapshot)
+
+			newSnapshot = initValueSnapshot(newSnapshot, verificationOptions, 0)
+			newSnapshot.captureOrigin = detectionOrigin
+			newSnapshot = captureChecksumMap(newSnapshot, targetValue, verificationOptions)
+			result <- originalSnapshot.CheckImmutabilityAgainst(newSnapshot)
+		})
+		return result
+	}
+}
+
+// closedErrorChannel is returned by immcheck.EnsureImmutabilityAsync switched off by runtime toggles,
+// receiving from closed channel yields nil error immediately.
+func closedErrorChannel() <-chan error {
+	result := make(chan error)
+	close(result)
+	return result
+}
+
+// NoopCheck is the check returned by every disabled path:
+// race-off builds of immcheck.RaceEnsureImmutability, checks skipped by Options.SampleEvery
+// and checks switched off by immcheck.SetRuntimeToggles.
+// Use immcheck.IsNoopCheck to avoid deferring useless work.
+func NoopCheck() {}
+
+// IsNoopCheck reports whether check is immcheck.NoopCheck.
+func IsNoopCheck(check func()) bool {
+	return check != nil && reflect.ValueOf(check).Pointer() == noopCheckPointer
+}
+
+//nolint:gochecknoglobals // noopCheckPointer is effectively a constant
+var noopCheckPointer = reflect.ValueOf(NoopCheck).Pointer()
+
+//nolint:gochecknoglobals // ensureImmutabilityCalls is global to sample checks configured with Options.SampleEvery
+var ensureImmutabilityCalls uint32
+
 func ensureImmutability(v interface{}, options Options) func() {
 	if v == nil {
 		panic(fmt.Errorf("%w. target value can't be nil", UnsupportedTypeError))
 	}
-	originalSnapshot := tempSnapshotsPool.Get().(*ValueSnapshot) // callback returns this snapshot to the pool
+	if options.Flags&AlsoCheckOnFinalization != 0 {
+		checkArenaConfined(options, "finalizer checks")
+	}
+	if inlineChecksDisabled() {
+		return NoopCheck
+	}
+	options = withDefaultOptions(options)
+	if options.SampleEvery > 1 && atomic.AddUint32(&ensureImmutabilityCalls, 1)%options.SampleEvery != 0 {
+		return NoopCheck
+	}
+	budgetExceeded := options.Budget != nil && options.Budget.Exceeded()
+	if budgetExceeded && !options.Budget.sampled() {
+		return NoopCheck
+	}
+	degradationState := loadDegradationState()
+	level := degradationState.level()
+	if level == SkippedCheck {
+		degradationState.recordLatency(0)
+		return NoopCheck
+	}
+	options, capture := withCheckLevel(options, level)
+	var captureStart time.Time
+	if degradationState != nil {
+		captureStart = time.Now()
+	}
+	originalSnapshot := getTempSnapshot() // callback returns this snapshot to the pool
 	skipThreeFrames := 3
 	originalSnapshot = initValueSnapshot(originalSnapshot, options, skipThreeFrames)
-	targetValue := reflect.ValueOf(v)
-	originalSnapshot = captureChecksumMap(originalSnapshot, targetValue, options)
+	targetValue := targetValueOf(v)
+	originalSnapshot = capture(originalSnapshot, targetValue, options)
+	if degradationState != nil {
+		degradationState.recordLatency(time.Since(captureStart))
+	}
+	if options.Budget != nil {
+		options.Budget.charge(originalSnapshot)
+	}
+	lifecycle := newGuardLifecycle(originalSnapshot, options)
+	// baseline is reclaimed even if returned function is never called
+	baseline := newPendingBaseline(originalSnapshot, lifecycle, options)
+	checkOnFinalization := options.Flags&AlsoCheckOnFinalization != 0 && !finalizerChecksDisabled()
+	if checkOnFinalization {
+		// finalization check shares baseline with returned function and releases it
+		setFinalizationCheck(v, originalSnapshot, func() { baseline.release() }, capture, lifecycle, options)
+	}
 
 	return func() {
-		newSnapshot := tempSnapshotsPool.Get().(*ValueSnapshot)
-		defer tempSnapshotsPool.Put(newSnapshot)
-		defer tempSnapshotsPool.Put(originalSnapshot)
+		newSnapshot := getTempSnapshot()
+		defer putTempSnapshot(newSnapshot)
+		if !checkOnFinalization {
+			defer baseline.release()
+		}
 
 		thisFuncWillBeInvokedByClientCodeSoSkipOnlyTwoFrames := 2
 		newSnapshot = initValueSnapshot(newSnapshot, options, thisFuncWillBeInvokedByClientCodeSoSkipOnlyTwoFrames)
-		newSnapshot = captureChecksumMap(newSnapshot, targetValue, options)
-		checkErr := originalSnapshot.CheckImmutabilityAgainst(newSnapshot)
+		newSnapshot = capture(newSnapshot, targetValue, options)
+		checkErr := baseline.snapshot.CheckImmutabilityAgainst(newSnapshot)
+		if mutationErr, ok := checkErr.(*MutationError); ok {
+			mutationErr.BudgetExceeded = budgetExceeded
+		}
+		lifecycle.verified(checkErr)
 		if checkErr != nil {
 			reportError(checkErr, options)
 		}
@@ -238,28 +676,57 @@ func ensureImmutability(v interface{}, options Options) func() {
 }
 
 func reportError(checkErr error, options Options) {
-	if options.Flags&SkipLoggingOnMutation == 0 {
-		var logDestination io.Writer = os.Stderr
-		if options.LogWriter != nil {
-			logDestination = options.LogWriter
-		}
-		_, _ = fmt.Fprintf(
-			logDestination,
-			"[ERROR] runtime mutation detected; error: %v\n",
-			checkErr,
-		)
+	if suppressReport() {
+		return
+	}
+	if options.Reporter != nil {
+		options.Reporter.ReportMutation(checkErr)
+		return
+	}
+	if options.Flags&SkipLoggingOnMutation == 0 && allowReport(checkErr, options) {
+		logError(checkErr, options)
 	}
 	if options.Flags&SkipPanicOnDetectedMutation == 0 {
-		panic(checkErr)
+		panic(panicValue(checkErr, options))
+	}
+}
+
+func logError(checkErr error, options Options) {
+	if options.Aggregator != nil {
+		options.Aggregator.add(checkErr, options)
+		return
+	}
+	var logDestination io.Writer = os.Stderr
+	if options.LogWriter != nil {
+		logDestination = options.LogWriter
+	}
+	writeReport(logDestination, checkErr, 0, options)
+}
+
+// writeReport logs checkErr in options.ReportFormat.
+// detections is the number of detections summarized by ReportAggregator, 0 for a single detection.
+func writeReport(logDestination io.Writer, checkErr error, detections int, options Options) {
+	if options.ReportFormat == JSONReportFormat {
+		writeJSONReport(logDestination, checkErr, detections, options)
+		return
 	}
+	summary := "runtime mutation detected"
+	if detections != 0 {
+		summary += fmt.Sprintf(" %v times", detections)
+	}
+	if options.Label != "" {
+		summary += "; label: " + options.Label
+	}
+	_, _ = fmt.Fprintf(logDestination, "[ERROR] %v; error: %v\n", summary, checkErr)
 }
 
 func newValueSnapshot() *ValueSnapshot {
 	oneBucketCapacity := 16
 	return &ValueSnapshot{
-		captureOriginFile: &bytes.Buffer{},
-		captureOriginLine: 0,
-		checksums:         make(map[uint32]uint32, oneBucketCapacity),
+		captureOrigin: 0,
+		hashAlgorithm: currentHashAlgorithm,
+		checksumMode:  0,
+		checksums:     make(map[uint32]uint32, oneBucketCapacity),
 	}
 }
 
@@ -268,81 +735,168 @@ func initValueSnapshot(
 	options Options, framesToSkip int,
 ) *ValueSnapshot {
 	dst.Reset()
+	dst.checksumMode = options.Flags & checksumAffectingFlags
+	dst.releaseAllowed = options.Flags&AllowReleaseByNil != 0
+	dst.internals = internalsIDOf(internalsOf(options))
+	dst.writeSequence = trackedWrites.currentSequence()
 	if options.Flags&SkipOriginCapturing == 0 {
 		skipCallerFramesAndShowOnlyUsersCode := framesToSkip
-		_, file, line, ok := runtime.Caller(skipCallerFramesAndShowOnlyUsersCode)
-		if !ok {
-			panic("can't capture stack trace")
-		}
-		dst.captureOriginFile.WriteString(file)
-		dst.captureOriginLine = line
+		dst.captureOrigin = origins.captureOrigin(skipCallerFramesAndShowOnlyUsersCode)
 	}
 	return dst
 }
 
 func captureChecksumMap(snapshot *ValueSnapshot, value reflect.Value, options Options) *ValueSnapshot {
+	if snapshot.rootType == nil && value.IsValid() {
+		snapshot = describeRoot(snapshot, value)
+		if options.Flags&RenderDiffOnMutation != 0 {
+			snapshot.rendering = renderValueLines(value, options)
+		}
+	}
+	snapshot.nodes++
+	if captureStatsEnabled() {
+		atomic.AddUint64(&nodesVisited, 1)
+	}
+	options = withTypeDefaults(options, value)
+	if options.Flags&AllowUnexportedAccess != 0 {
+		value = accessibleValue(value, internalsOf(options))
+	}
 	valueKind := value.Kind()
 	switch valueKind {
 	case reflect.UnsafePointer, reflect.Func, reflect.Chan:
-		if options.Flags&AllowInherentlyUnsafeTypes == 0 {
-			panic(fmt.Errorf("%w. UnsafePointer, Func, and Chan types are not supported, "+
-				"since there is no way for us to fully verify immutability for these types. "+
-				"If you still want to proceed and ignore fields of such type "+
-				"use Flags.AllowInherentlyUnsafeTypes option. "+
-				"Unsupported type kind: %v", UnsupportedTypeError, valueKind.String()))
-		}
-		return capturePointer(snapshot, unsafe.Pointer(value.Pointer()), valueKind)
-	case reflect.Ptr, reflect.Interface:
-		valuePointer := pointerOfValue(value)
-		if value.IsNil() {
-			return capturePointer(snapshot, valuePointer, valueKind)
+		if options.Flags&AllowInherentlyUnsafeTypes != 0 {
+			return capturePointer(snapshot, unsafe.Pointer(value.Pointer()), valueKind)
 		}
-		// detect ref loop and skip
-		if options.Flags&doNotDetectRefLoop == 0 {
-			if _, loopDetected := snapshot.checksums[evalKey(uintptr(valuePointer), valueKind)]; loopDetected {
-				return snapshot
-			}
-			snapshot = capturePointer(snapshot, valuePointer, valueKind)
+		if options.Flags&SkipUnsupportedTypes == 0 {
+			panic(unsupportedKindError(snapshot.rootType, valueKind, true))
 		}
-		options.Flags &= ^doNotDetectRefLoop
-		snapshot = captureChecksumMap(snapshot, value.Elem(), options)
+		snapshot.unverifiedNodes++
+		snapshot.checksums[evalKey32(unverifiedNodeMarker, valueKind)] = unverifiedNodeMarker
 		return snapshot
+	case reflect.Ptr, reflect.Interface:
+		if value.CanAddr() {
+			return captureReleasable(snapshot, value, options, captureReference)
+		}
+		return captureReference(snapshot, value, options)
 	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
 		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
 		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
-		valueBytes := convertValueTypeToBytesSlice(value)
-		snapshot = captureRawBytesLevelChecksum(snapshot, valueBytes, valueKind)
+		valueBytes := convertValueTypeToBytesSlice(value, options)
+		snapshot = captureValueBytesChecksum(snapshot, valueBytes, valueKind, value.Type(), 1, options)
 		return snapshot
 	case reflect.Struct:
-		valueBytes := convertValueTypeToBytesSlice(value)
-		snapshot = captureRawBytesLevelChecksum(snapshot, valueBytes, valueKind)
+		if walker, ok := lookupContainerWalker(value.Type()); ok {
+			return captureContainer(snapshot, value, walker, options)
+		}
+		valueBytes := convertValueTypeToBytesSlice(value, options)
+		snapshot = captureValueBytesChecksum(snapshot, valueBytes, valueKind, value.Type(), 1, options)
 		snapshot = perFieldSnapshot(snapshot, value, options)
 		return snapshot
 	case reflect.Array, reflect.Slice, reflect.String:
-		valueBytes := convertSliceBasedTypeToByteSlice(value)
-		snapshot = captureRawBytesLevelChecksum(snapshot, valueBytes, valueKind)
+		contentBefore := snapshot.contentDigest
+		if valueKind == reflect.Slice {
+			snapshot.sequenceLengths += value.Len()
+		}
+		if valueKind == reflect.Slice && options.Flags&CaptureSliceCapacity != 0 {
+			snapshot = captureSliceHeader(snapshot, value)
+			value = value.Slice(0, value.Cap())
+		}
+		valueBytes := convertSliceBasedTypeToByteSlice(value, options)
+		if valueKind == reflect.String {
+			snapshot = captureRawBytesLevelChecksum(snapshot, valueBytes, valueKind)
+		} else {
+			snapshot = captureValueBytesChecksum(snapshot, valueBytes, valueKind, value.Type().Elem(), value.Len(), options)
+		}
+		if valueKind == reflect.String && options.Flags&CaptureStringIdentity != 0 {
+			snapshot = captureStringIdentity(snapshot, value)
+		}
 		snapshot = perItemSnapshot(snapshot, value, options)
+		if valueKind != reflect.Array && options.Flags&CompareByValue != 0 {
+			// data pointers of strings and slices aren't captured, so their content is bound to their position
+			snapshot = snapshot.bindContent(snapshot.contentDigest-contentBefore, valueKind)
+		}
 		return snapshot
 	case reflect.Map:
-		valuePointer := pointerOfValue(value)
-		if value.IsNil() || value.IsZero() {
-			return capturePointer(snapshot, valuePointer, valueKind)
-		}
-		// detect ref loop and skip
-		if options.Flags&doNotDetectRefLoop == 0 {
-			if _, loopDetected := snapshot.checksums[evalKey(uintptr(valuePointer), valueKind)]; loopDetected {
-				return snapshot
-			}
+		if value.CanAddr() {
+			return captureReleasable(snapshot, value, options, captureMap)
 		}
-		snapshot.checksums[evalKey(uintptr(valuePointer), valueKind)] = uint32(value.Len())
-		snapshot = perEntrySnapshot(snapshot, value, options)
-		return snapshot
+		return captureMap(snapshot, value, options)
 	case reflect.Invalid:
 		panic(fmt.Errorf("%w, unsupported type kind: %v", UnsupportedTypeError, valueKind.String()))
 	}
 	return snapshot
 }
 
+// captureReference captures pointer or interface together with value it references.
+func captureReference(snapshot *ValueSnapshot, value reflect.Value, options Options) *ValueSnapshot {
+	valueKind := value.Kind()
+	internals := internalsOf(options)
+	valuePointer := referencedPointer(value, internals)
+	if value.IsNil() {
+		snapshot.nilReferences++
+		return capturePointer(snapshot, valuePointer, valueKind)
+	}
+	if valueKind == reflect.Interface {
+		snapshot = captureDynamicType(snapshot, value.Elem().Type(), internals)
+	}
+	if valuePointer == nil {
+		// identity of boxed value isn't available, see reflectInternals, but boxed value isn't a reference either
+		options.Flags &= ^doNotDetectRefLoop
+		return captureChecksumMap(snapshot, value.Elem(), options)
+	}
+	if options.Flags&referencesByContentFlags != 0 {
+		return captureReferenceByContent(snapshot, value, valuePointer, options)
+	}
+	// references to the same memory are references to the same value only if types of referenced values
+	// are the same, like they aren't for pointers to a struct and to its first field,
+	// otherwise the value captured first would hide the other one depending on traversal order
+	referenceKey := evalKey(uintptr(valuePointer)^internals.typeIdentity(value.Elem().Type()), valueKind)
+	// detect ref loop and skip
+	if options.Flags&doNotDetectRefLoop == 0 {
+		if _, loopDetected := snapshot.checksums[referenceKey]; loopDetected {
+			return snapshot
+		}
+	}
+	// pointer identity is recorded for every reference, so retargeting to equal content is a mutation
+	snapshot.checksums[referenceKey] = uint32(uintptr(valuePointer))
+	options.Flags &= ^doNotDetectRefLoop
+	snapshot = captureChecksumMap(snapshot, value.Elem(), options)
+	return snapshot
+}
+
+// captureMap captures map together with its entries.
+func captureMap(snapshot *ValueSnapshot, value reflect.Value, options Options) *ValueSnapshot {
+	valueKind := value.Kind()
+	valuePointer := unsafe.Pointer(value.Pointer())
+	if value.IsNil() || value.IsZero() {
+		snapshot.nilReferences++
+		return capturePointer(snapshot, valuePointer, valueKind)
+	}
+	if walker, ok := lookupContainerWalker(value.Type()); ok {
+		return captureContainer(snapshot, value, walker, options)
+	}
+	if options.Flags&CompareByValue != 0 {
+		return captureSortedMap(snapshot, value, valuePointer, options)
+	}
+	// detect ref loop and skip
+	if options.Flags&doNotDetectRefLoop == 0 {
+		if _, loopDetected := snapshot.checksums[evalKey(uintptr(valuePointer), valueKind)]; loopDetected {
+			return snapshot
+		}
+	}
+	snapshot.checksums[evalKey(uintptr(valuePointer), valueKind)] = uint32(value.Len())
+	snapshot.entries += value.Len()
+	const fnvPrime32 = 16777619
+	snapshot.contentDigest += evalKey32(uint32(value.Len())*fnvPrime32, valueKind)
+	snapshot = recordMemoryRegion(snapshot, uintptr(valuePointer), 1, valueKind)
+	snapshot = perEntrySnapshot(snapshot, value, options)
+	return snapshot
+}
+
+// unverifiedNodeMarker is recorded into checksums for values skipped with SkipUnsupportedTypes flag,
+// so snapshots of values that consist only of such values aren't empty.
+const unverifiedNodeMarker = 0x756e7672 // "unvr"
+
 func evalKey32(valuePointer uint32, kind reflect.Kind) uint32 {
 	return valuePointer ^ uint32(kind)
 }
@@ -352,20 +906,33 @@ func evalKey(valuePointer uintptr, kind reflect.Kind) uint32 {
 }
 
 func valueIsPrimitive(v reflect.Value) bool {
-	switch v.Kind() {
+	return typeIsPrimitive(v.Type())
+}
+
+func typeIsPrimitive(t reflect.Type) bool {
+	switch t.Kind() {
 	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
 		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
 		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
 		return true
 	case reflect.Struct:
-		// TODO: introduce per type cache
-		numField := v.NumField()
-		for i := 0; i < numField; i++ {
-			if !valueIsPrimitive(v.Field(i)) {
-				return false
-			}
+		if plan, ok := loadTypePlan(t); ok {
+			return plan.primitive
 		}
-		return true
+		if primitive, ok := primitiveTypesCache.load(t); ok {
+			return primitive.(bool)
+		}
+		// fields that are captured separately have to be captured one by one
+		primitive := true
+		for _, rule := range typeFieldRules(t) {
+			primitive = primitive && !rule.capturedSeparately()
+		}
+		numField := t.NumField()
+		for i := 0; i < numField && primitive; i++ {
+			primitive = typeIsPrimitive(t.Field(i).Type)
+		}
+		primitiveTypesCache.store(t, primitive)
+		return primitive
 	case reflect.Array, reflect.Chan, reflect.Func, reflect.Interface, reflect.Invalid, reflect.Map,
 		reflect.Ptr, reflect.Slice, reflect.String, reflect.UnsafePointer:
 		return false
@@ -381,12 +948,35 @@ const maxPoolCacheSizePerGoroutine = 1024
 //nolint:gochecknoglobals // reflectValuePoolCache is global to maximise pools re-use
 var reflectValuePoolCache = newPCache(maxPoolCacheSizePerGoroutine)
 
+//nolint:gochecknoglobals // primitiveTypesCache is global to share primitive-ness of struct types between captures
+var primitiveTypesCache = newPCache(maxPoolCacheSizePerGoroutine)
+
+// SetTypeCacheSizePerGoroutine tunes eviction of internal per-goroutine caches of type information
+// and memory pools used during capture. Caches evict random items once they grow bigger than maxSizePerGoroutine.
+// Zero size effectively disables caching. Default size is 1024.
+func SetTypeCacheSizePerGoroutine(maxSizePerGoroutine uint) {
+	reflectValuePoolCache.setMaxSize(maxSizePerGoroutine)
+	primitiveTypesCache.setMaxSize(maxSizePerGoroutine)
+	inlineContentCache.setMaxSize(maxSizePerGoroutine)
+	fieldRulesCache.setMaxSize(maxSizePerGoroutine)
+}
+
+// perEntrySnapshot captures entries of map in iteration order of the map, which is random.
+// Checksums of entries are folded into snapshot independently of their order, so the same map
+// is always captured into the same snapshot.
 func perEntrySnapshot(snapshot *ValueSnapshot, value reflect.Value, options Options) *ValueSnapshot {
+	if options.Arena != nil {
+		return perEntrySnapshotInArena(snapshot, value, options)
+	}
 	iterator := mapIterPool.Get().(*reflect.MapIter)
 	defer func() {
 		iterator.Reset(reflect.Value{})
 		mapIterPool.Put(iterator)
 	}()
+	value = exportedMapValue(value, internalsOf(options))
+	if !value.CanInterface() {
+		return perEntrySnapshotReadOnly(snapshot, value, options)
+	}
 	iterator.Reset(value)
 
 	mapType := value.Type()
@@ -421,25 +1011,59 @@ func perEntrySnapshot(snapshot *ValueSnapshot, value reflect.Value, options Opti
 	v := valuePool.Get().(*reflect.Value)
 	defer valuePool.Put(v)
 
+	scope := snapshot.contentPosition
 	for iterator.Next() {
 		k.SetIterKey(iterator)
 		v.SetIterValue(iterator)
-		snapshot = captureChecksumMap(snapshot, *k, options) // map cannot be a key in map
+		snapshot = captureMapKey(snapshot, *k, scope, options)
 		snapshot = captureChecksumMap(
 			snapshot, *v,
 			// map can reference itself in value, so we set doNotDetectRefLoop
-			Options{LogWriter: options.LogWriter, Flags: options.Flags | doNotDetectRefLoop},
+			withFlags(options, options.Flags|doNotDetectRefLoop),
 		)
 	}
+	snapshot.contentPosition = scope + 1
 	return snapshot
 }
 
+// perEntrySnapshotReadOnly captures entries of map that can't be viewed as exported, see reflectInternals.
+func perEntrySnapshotReadOnly(snapshot *ValueSnapshot, value reflect.Value, options Options) *ValueSnapshot {
+	// entries of exported view of map are exported, so entries of read-only map are made accessible
+	options = withFlags(options, options.Flags|AllowUnexportedAccess)
+	iterator := value.MapRange()
+	scope := snapshot.contentPosition
+	for iterator.Next() {
+		snapshot = captureMapKey(snapshot, iterator.Key(), scope, options)
+		// map can reference itself in value, so we set doNotDetectRefLoop
+		snapshot = captureChecksumMap(snapshot, iterator.Value(), withFlags(options, options.Flags|doNotDetectRefLoop))
+	}
+	snapshot.contentPosition = scope + 1
+	return snapshot
+}
+
+// exportedMapValue returns view of map value that can be used with Value.SetIterKey
+// even if map was obtained using unexported field.
+func exportedMapValue(value reflect.Value, internals runtimeInternals) reflect.Value {
+	if value.CanInterface() {
+		return value
+	}
+	return internals.mapValueAt(value, new(unsafe.Pointer))
+}
+
 func perFieldSnapshot(snapshot *ValueSnapshot, value reflect.Value, options Options) *ValueSnapshot {
 	if valueIsPrimitive(value) {
 		return snapshot
 	}
+	rules := typeFieldRules(value.Type())
 	numField := value.NumField()
 	for i := 0; i < numField; i++ {
+		if rule, ok := fieldRuleOf(rules, i); ok {
+			// other fields with rules are already captured within raw bytes of the struct
+			if rule.capturedSeparately() {
+				snapshot = captureFieldByRule(snapshot, value.Field(i), rule, options)
+			}
+			continue
+		}
 		if !valueIsPrimitive(value.Field(i)) {
 			snapshot = captureChecksumMap(snapshot, value.Field(i), options)
 		}
@@ -463,71 +1087,99 @@ func capturePointer(snapshot *ValueSnapshot, valuePointer unsafe.Pointer, valueK
 	return snapshot
 }
 
+// describeRoot records type and number of elements of the guarded root, pointers and interfaces are dereferenced.
+func describeRoot(snapshot *ValueSnapshot, value reflect.Value) *ValueSnapshot {
+	snapshot.rootType = value.Type()
+	for (value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface) && !value.IsNil() {
+		value = value.Elem()
+	}
+	//nolint:exhaustive
+	switch value.Kind() {
+	case reflect.Array, reflect.Slice, reflect.String, reflect.Map:
+		snapshot.rootElements = value.Len()
+	case reflect.Struct:
+		snapshot.rootElements = value.NumField()
+	}
+	return snapshot
+}
+
+func captureSliceHeader(snapshot *ValueSnapshot, value reflect.Value) *ValueSnapshot {
+	dataPointer := value.Pointer()
+	header := [2]uint64{uint64(value.Len()), uint64(value.Cap())}
+	headerBytes := (*[unsafe.Sizeof(header)]byte)(unsafe.Pointer(&header))[:]
+	headerChecksum := uint32(xxh3.Hash(headerBytes))
+	snapshot.checksums[evalKey(dataPointer, reflect.Slice)] = headerChecksum
+	snapshot.contentDigest += headerChecksum
+	return snapshot
+}
+
+func captureStringIdentity(snapshot *ValueSnapshot, value reflect.Value) *ValueSnapshot {
+	identity := [2]uint64{uint64(uintptr(stringData(value.String()))), uint64(value.Len())}
+	identityBytes := (*[unsafe.Sizeof(identity)]byte)(unsafe.Pointer(&identity))[:]
+	snapshot.stringIdentities += uint32(xxh3.Hash(identityBytes))
+	return snapshot
+}
+
 func captureRawBytesLevelChecksum(
 	snapshot *ValueSnapshot,
 	valueBytes []byte, valueKind reflect.Kind,
 ) *ValueSnapshot {
 	hashSum := uint32(xxh3.Hash(valueBytes))
+	snapshot.contentDigest += hashSum
+	return recordRawBytesChecksum(snapshot, valueBytes, hashSum, valueKind)
+}
+
+// recordRawBytesChecksum records hashSum of valueBytes without folding it into content digest.
+func recordRawBytesChecksum(
+	snapshot *ValueSnapshot,
+	valueBytes []byte, hashSum uint32, valueKind reflect.Kind,
+) *ValueSnapshot {
+	snapshot.capturedBytes += len(valueBytes)
+	if captureStatsEnabled() {
+		atomic.AddUint64(&bytesHashed, uint64(len(valueBytes)))
+	}
 	snapshot.checksums[evalKey32(hashSum, valueKind)] = hashSum
+	if snapshot.memoryRegions != nil && len(valueBytes) != 0 {
+		snapshot = recordMemoryRegion(snapshot, uintptr(unsafe.Pointer(&valueBytes[0])), uintptr(len(valueBytes)), valueKind)
+	}
 	return snapshot
 }
 
-func convertValueTypeToBytesSlice(value reflect.Value) []byte {
-	var result []byte
-	targetByteSliceHeader := (*reflect.SliceHeader)(unsafe.Pointer(&result))
-
-	valuePointer := pointerOfValue(value)
-	valueSizeInBytes := int(value.Type().Size())
-
-	targetByteSliceHeader.Data = uintptr(valuePointer)
-	targetByteSliceHeader.Len = valueSizeInBytes
-	targetByteSliceHeader.Cap = valueSizeInBytes
-	return result
+func convertValueTypeToBytesSlice(value reflect.Value, options Options) []byte {
+	return internalsOf(options).valueBytes(value)
 }
 
-func convertSliceBasedTypeToByteSlice(value reflect.Value) []byte {
-	var result []byte
-	targetByteSliceHeader := (*reflect.SliceHeader)(unsafe.Pointer(&result))
-
-	valuePointer := pointerOfValue(value)
-	arrayLen := value.Len()
-	valueSizeInBytes := 0
-	if arrayLen != 0 {
-		valueSizeInBytes = int(value.Index(0).Type().Size())
-	}
-
-	targetByteSliceHeader.Data = uintptr(valuePointer)
-	targetByteSliceHeader.Len = arrayLen * valueSizeInBytes
-	targetByteSliceHeader.Cap = arrayLen * valueSizeInBytes
-	return result
+func convertSliceBasedTypeToByteSlice(value reflect.Value, options Options) []byte {
+	return internalsOf(options).sequenceBytes(value)
 }
 
-func pointerOfValue(value reflect.Value) unsafe.Pointer {
+func pointerOfValue(value reflect.Value, internals runtimeInternals) unsafe.Pointer {
 	//nolint:exhaustive
 	switch value.Kind() {
 	case reflect.Chan, reflect.Func, reflect.Map, reflect.Ptr, reflect.Slice, reflect.UnsafePointer:
 		return unsafe.Pointer(value.Pointer())
 	case reflect.String:
-		return fetchDataPointerFromString(value)
+		return stringData(value.String())
 	}
 	if value.CanAddr() {
 		return unsafe.Pointer(value.Addr().Pointer())
 	}
 	if value.CanInterface() {
-		return fetchPointerFromValueInterface(value)
+		return internals.boxedData(value)
 	}
-	panic(fmt.Sprintf("can't get pointer to value. kind: %#v; value: %#v", value.Kind().String(), value))
+	panic(unaddressableValueError(value))
 }
 
-func fetchDataPointerFromString(value reflect.Value) unsafe.Pointer {
-	stringValue := value.String()
-	return unsafe.Pointer(((*reflect.StringHeader)(unsafe.Pointer(&stringValue))).Data)
+func unaddressableValueError(value reflect.Value) error {
+	return fmt.Errorf(
+		"%w. can't get pointer to value of unexported field, use Flags.AllowUnexportedAccess option. kind: %v; type: %v",
+		UnsupportedTypeError, value.Kind(), value.Type(),
+	)
 }
 
-//go:nocheckptr
-func fetchPointerFromValueInterface(value reflect.Value) unsafe.Pointer {
-	vI := value.Interface()
-	return unsafe.Pointer((*[2]uintptr)(unsafe.Pointer(&vI))[1])
+func withFlags(options Options, flags immutabilityCheckFlag) Options {
+	options.Flags = flags
+	return options
 }
 
 type mutationDetectionError string
@@ -551,32 +1203,3 @@ func checksumEquals(newChecksum map[uint32]uint32, originalChecksum map[uint32]u
 	}
 	return true
 }
-
-//nolint:gochecknoglobals // taskQueue is global to maximise goroutine pool utilization
-var taskQueue = make(chan func())
-
-func runInPool(task func()) {
-	select {
-	case taskQueue <- task:
-		// submitted, everything is ok
-	default:
-		go func() {
-			// do the given task
-			task()
-
-			const cleanupDuration = 10 * time.Second
-			cleanupTicker := time.NewTicker(cleanupDuration)
-			defer cleanupTicker.Stop()
-
-			for {
-				select {
-				case t := <-taskQueue:
-					t()
-					cleanupTicker.Reset(cleanupDuration)
-				case <-cleanupTicker.C:
-					return
-				}
-			}
-		}()
-	}
-}
@@ -85,13 +85,7 @@ func BenchmarkImmcheckTransactions(b *testing.B) {
 					localRand := rand.New(rand.NewSource(rand.Int63()))
 					count = 0
 
-					targetObjects := make([][]*Transaction, b.N)
-					for i := 0; i < b.N; i++ {
-						targetObjects[i] = make([]*Transaction, txCnt)
-						for j := 0; j < txCnt; j++ {
-							targetObjects[i][j] = GenerateTransaction(localRand, ctxSize)
-						}
-					}
+					targetObjects := generateTransactionObjects(localRand, b.N, txCnt, ctxSize)
 
 					runTransactionsBenchmark(
 						b, targetObjects,
@@ -104,6 +98,142 @@ func BenchmarkImmcheckTransactions(b *testing.B) {
 	}
 }
 
+func BenchmarkImmcheckArena(b *testing.B) {
+	arenas := []*immcheck.Arena{nil, immcheck.NewArena()}
+	for _, arena := range arenas {
+		benchName := fmt.Sprintf("arena(%v)", arena != nil)
+		b.Run(benchName, func(b *testing.B) {
+			localRand := rand.New(rand.NewSource(rand.Int63()))
+			count = 0
+
+			targetObjects := generateTransactionObjects(localRand, b.N, countOfTransactions[0], sizeOfTxContext[0])
+
+			runTransactionsBenchmark(
+				b, targetObjects,
+				immcheck.Options{
+					Flags: immcheck.SkipOriginCapturing | immcheck.SkipLoggingOnMutation,
+					Arena: arena,
+				},
+				0,
+			)
+		})
+	}
+}
+
+func BenchmarkImmcheckTypeCache(b *testing.B) {
+	cacheSizes := []uint{0, 1024}
+	defer immcheck.SetTypeCacheSizePerGoroutine(1024)
+	for _, cacheSize := range cacheSizes {
+		benchName := fmt.Sprintf("cacheSize(%v)", cacheSize)
+		b.Run(benchName, func(b *testing.B) {
+			immcheck.SetTypeCacheSizePerGoroutine(cacheSize)
+			localRand := rand.New(rand.NewSource(rand.Int63()))
+			count = 0
+
+			targetObjects := generateTransactionObjects(localRand, b.N, countOfTransactions[0], sizeOfTxContext[0])
+
+			runTransactionsBenchmark(
+				b, targetObjects,
+				immcheck.Options{Flags: immcheck.SkipOriginCapturing | immcheck.SkipLoggingOnMutation},
+				0,
+			)
+		})
+	}
+}
+
+func BenchmarkCheckImmutabilityAgainst(b *testing.B) {
+	for _, txContextSize := range sizeOfTxContext {
+		benchName := fmt.Sprintf("[%v]txs(%v)", countOfTransactions[0], txContextSize)
+		b.Run(benchName, func(b *testing.B) {
+			localRand := rand.New(rand.NewSource(rand.Int63()))
+			targetObject := generateTransactionObjects(localRand, 1, countOfTransactions[0], txContextSize)[0]
+			options := immcheck.Options{Flags: immcheck.SkipOriginCapturing | immcheck.SkipLoggingOnMutation}
+			snapshot := immcheck.CaptureSnapshotWithOptions(&targetObject, immcheck.NewValueSnapshot(), options)
+			otherSnapshot := immcheck.CaptureSnapshotWithOptions(&targetObject, immcheck.NewValueSnapshot(), options)
+
+			b.ResetTimer()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := snapshot.CheckImmutabilityAgainst(otherSnapshot); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+var sizeOfMap = []int{
+	16, 1024,
+}
+
+func BenchmarkImmcheckMapEntries(b *testing.B) {
+	modes := []struct {
+		name    string
+		options immcheck.Options
+	}{
+		{name: "unordered", options: immcheck.Options{}},
+		{name: "sorted", options: immcheck.Options{Flags: immcheck.CompareByValue}},
+	}
+	for _, mapSize := range sizeOfMap {
+		for _, mode := range modes {
+			benchName := fmt.Sprintf("map[%v]%v", mapSize, mode.name)
+			b.Run(benchName, func(b *testing.B) {
+				localRand := rand.New(rand.NewSource(rand.Int63()))
+				targetObject := make(map[string]*Account, mapSize)
+				for i := 0; i < mapSize; i++ {
+					account := &Account{Type: AccountType(localRand.Intn(2))}
+					localRand.Read(account.Address[:])
+					targetObject[fmt.Sprint(i)] = account
+				}
+				options := mode.options
+				options.Flags |= immcheck.SkipOriginCapturing | immcheck.SkipLoggingOnMutation
+				snapshot := immcheck.NewValueSnapshot()
+
+				b.ResetTimer()
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					immcheck.CaptureSnapshotWithOptions(&targetObject, snapshot, options)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkImmcheckPrecompiled(b *testing.B) {
+	// plans are never evicted, so the benchmark is declared after other benchmarks of the same types
+	// and types are benchmarked without plans first
+	for _, precompiled := range []bool{false, true} {
+		benchName := fmt.Sprintf("precompiled(%v)", precompiled)
+		b.Run(benchName, func(b *testing.B) {
+			if precompiled {
+				immcheck.Precompile[[]*Transaction]()
+			}
+			localRand := rand.New(rand.NewSource(rand.Int63()))
+			count = 0
+
+			targetObjects := generateTransactionObjects(localRand, b.N, countOfTransactions[0], sizeOfTxContext[0])
+
+			runTransactionsBenchmark(
+				b, targetObjects,
+				immcheck.Options{Flags: immcheck.SkipOriginCapturing | immcheck.SkipLoggingOnMutation},
+				0,
+			)
+		})
+	}
+}
+
+// generateTransactionObjects generates objectsCount target objects of txCount transactions each.
+func generateTransactionObjects(localRand *rand.Rand, objectsCount int, txCount int, contextSize int) [][]*Transaction {
+	targetObjects := make([][]*Transaction, objectsCount)
+	for i := range targetObjects {
+		targetObjects[i] = make([]*Transaction, txCount)
+		for j := range targetObjects[i] {
+			targetObjects[i][j] = GenerateTransaction(localRand, contextSize)
+		}
+	}
+	return targetObjects
+}
+
 func runTransactionsBenchmark(
 	b *testing.B,
 	targetObjects [][]*Transaction,
@@ -1,31 +1,20 @@
-//go:build !race && !immcheck
-// +build !race,!immcheck
+//go:build !race && !immcheck && !immcheck_inline
+// +build !race,!immcheck,!immcheck_inline
 
 package immcheck
 
-// ImmcheckRaceEnabled can be used in test to verify if mutability should be detected or not.
-const ImmcheckRaceEnabled = false
-
-func noop() {}
+// RaceInlineChecksEnabled reports whether immcheck.RaceEnsureImmutability and its variants capture values.
+// They are enabled under `race`, `immcheck` or `immcheck_inline` build flags.
+const RaceInlineChecksEnabled = false
 
 // RaceEnsureImmutability same as immcheck.EnsureImmutability
-// but works only under `race` or `immcheck` build flags.
+// but works only under `race`, `immcheck` or `immcheck_inline` build flags.
 func RaceEnsureImmutability(v interface{}) func() {
-	return noop
+	return NoopCheck
 }
 
 // RaceEnsureImmutabilityWithOptions same as immcheck.EnsureImmutabilityWithOptions
-// but works only under `race` or `immcheck` build flags.
+// but works only under `race`, `immcheck` or `immcheck_inline` build flags.
 func RaceEnsureImmutabilityWithOptions(v interface{}, options Options) func() {
-	return noop
-}
-
-// RaceCheckImmutabilityOnFinalization same as immcheck.CheckImmutabilityOnFinalization
-// but works only under `race` or `immcheck` build flags.
-func RaceCheckImmutabilityOnFinalization(v interface{}) {
-}
-
-// RaceCheckImmutabilityOnFinalizationWithOptions same as immcheck.CheckImmutabilityOnFinalizationWithOptions
-// but works only under `race` or `immcheck` build flags.
-func RaceCheckImmutabilityOnFinalizationWithOptions(v interface{}, options Options) {
+	return NoopCheck
 }
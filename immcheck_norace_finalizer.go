@@ -0,0 +1,18 @@
+//go:build !race && !immcheck && !immcheck_finalizer
+// +build !race,!immcheck,!immcheck_finalizer
+
+package immcheck
+
+// RaceFinalizerChecksEnabled reports whether immcheck.RaceCheckImmutabilityOnFinalization and its variants
+// capture values. They are enabled under `race`, `immcheck` or `immcheck_finalizer` build flags.
+const RaceFinalizerChecksEnabled = false
+
+// RaceCheckImmutabilityOnFinalization same as immcheck.CheckImmutabilityOnFinalization
+// but works only under `race`, `immcheck` or `immcheck_finalizer` build flags.
+func RaceCheckImmutabilityOnFinalization(v interface{}) {
+}
+
+// RaceCheckImmutabilityOnFinalizationWithOptions same as immcheck.CheckImmutabilityOnFinalizationWithOptions
+// but works only under `race`, `immcheck` or `immcheck_finalizer` build flags.
+func RaceCheckImmutabilityOnFinalizationWithOptions(v interface{}, options Options) {
+}
@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"math"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -15,7 +17,7 @@ import (
 )
 
 func TestRaceConditionalFunctionsEnabled(t *testing.T) {
-	if !immcheck.ImmcheckRaceEnabled {
+	if !immcheck.RaceInlineChecksEnabled || !immcheck.RaceFinalizerChecksEnabled {
 		t.SkipNow()
 	}
 	t.Parallel()
@@ -86,7 +88,7 @@ func TestRaceConditionalFunctionsEnabled(t *testing.T) {
 }
 
 func TestRaceConditionalFunctionsDisabled(t *testing.T) {
-	if immcheck.ImmcheckRaceEnabled {
+	if immcheck.RaceInlineChecksEnabled || immcheck.RaceFinalizerChecksEnabled {
 		t.SkipNow()
 	}
 	t.Parallel()
@@ -150,6 +152,48 @@ func TestRaceConditionalFunctionsDisabled(t *testing.T) {
 	}
 }
 
+func TestRaceConditionalFunctionsSplit(t *testing.T) {
+	// only one of immcheck_inline and immcheck_finalizer build flags is set
+	if immcheck.RaceInlineChecksEnabled == immcheck.RaceFinalizerChecksEnabled {
+		t.SkipNow()
+	}
+	t.Parallel()
+	{
+		ints := []int{1}
+		logBuffer := &lockedWriterBuffer{buf: &bytes.Buffer{}}
+		check := immcheck.RaceEnsureImmutabilityWithOptions(&ints, immcheck.Options{
+			Flags:     immcheck.SkipPanicOnDetectedMutation,
+			LogWriter: logBuffer,
+		})
+		ints[0] = 2
+		check()
+		if immcheck.IsNoopCheck(check) == immcheck.RaceInlineChecksEnabled {
+			t.Fatalf("inline check doesn't follow build flags: %v", immcheck.RaceInlineChecksEnabled)
+		}
+		if (logBuffer.String() != "") != immcheck.RaceInlineChecksEnabled {
+			t.Fatalf("unexpected inline check log: %q", logBuffer.String())
+		}
+	}
+	{
+		m := map[string]string{
+			"k1": "v1",
+		}
+		logBuffer := &lockedWriterBuffer{buf: &bytes.Buffer{}}
+		immcheck.RaceCheckImmutabilityOnFinalizationWithOptions(&m, immcheck.Options{
+			Flags:     immcheck.SkipPanicOnDetectedMutation,
+			LogWriter: logBuffer,
+		})
+		m["j1"] = "b1"
+
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+		resultingLog := logBuffer.String()
+		if strings.Contains(resultingLog, "mutation of immutable value detected") != immcheck.RaceFinalizerChecksEnabled {
+			t.Fatalf("unexpected finalizer check log: %q", resultingLog)
+		}
+	}
+}
+
 func TestExample(t *testing.T) {
 	m := map[string]string{
 		"k1": "v1",
@@ -229,6 +273,34 @@ func TestCheckImmutabilityWithOptionsOnFinalization(t *testing.T) {
 	}
 }
 
+func TestEnsureImmutabilityAlsoOnFinalization(t *testing.T) {
+	t.Parallel()
+	m := map[string]string{
+		"k1": "v1",
+	}
+	logBuffer := &lockedWriterBuffer{buf: &bytes.Buffer{}}
+	options := immcheck.Options{
+		Flags:     immcheck.AlsoCheckOnFinalization | immcheck.SkipPanicOnDetectedMutation,
+		LogWriter: logBuffer,
+	}
+	func() {
+		defer immcheck.EnsureImmutabilityWithOptions(&m, options)()
+	}()
+	if logBuffer.String() != "" {
+		t.Fatalf("unnexpected log on scope exit: %v", logBuffer.String())
+	}
+	m["j1"] = "b1" // mutation after scope exit is detected on finalization
+
+	for i := 0; i < 10 && logBuffer.String() == ""; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	resultingLog := logBuffer.String()
+	if !strings.Contains(resultingLog, "[ERROR] runtime mutation detected; ") {
+		t.Fatalf("unnexpected log on finalization: `%v`", resultingLog)
+	}
+}
+
 func TestSimpleCounter(t *testing.T) {
 	t.Parallel()
 	uintCounter := uint64(35)
@@ -271,6 +343,10 @@ func TestSimpleCounterManualCheck(t *testing.T) {
 		otherSnapshot := immcheck.NewValueSnapshot()
 		_ = snapshot.CheckImmutabilityAgainst(otherSnapshot)
 	}, immcheck.InvalidSnapshotStateError)
+	expectPanic(t, func() {
+		snapshot := immcheck.CaptureSnapshot(&uintCounter, immcheck.NewValueSnapshot())
+		_ = snapshot.CheckImmutabilityAgainst(immcheck.CaptureSnapshot(&uintCounter, snapshot))
+	}, immcheck.InvalidSnapshotStateError)
 
 	{
 		// check that no mutation is fine
@@ -302,6 +378,30 @@ func TestSimpleCounterManualCheck(t *testing.T) {
 	}
 }
 
+func TestSnapshotCheck(t *testing.T) {
+	t.Parallel()
+	names := []string{"a", "b"}
+	options := immcheck.Options{Flags: immcheck.CaptureSliceCapacity}
+	snapshot := immcheck.CaptureSnapshotWithOptions(&names, immcheck.NewValueSnapshot(), options)
+	if err := snapshot.Check(&names, options); err != nil {
+		t.Fatalf("unexpected error happened: %v", err)
+	}
+	if err := snapshot.Check(&names, immcheck.Options{}); !errors.Is(err, immcheck.IncompatibleSnapshotError) {
+		t.Fatalf("incompatible options aren't reported: %v", err)
+	}
+
+	names[1] = "c"
+	err := snapshot.Check(&names, options)
+	var mutationErr *immcheck.MutationError
+	if !errors.As(err, &mutationErr) {
+		t.Fatalf("mutation isn't detected: %v", err)
+	}
+	origin, ok := immcheck.LookupOrigin(mutationErr.DetectionOrigin)
+	if !ok || !strings.Contains(origin.File, "immcheck_test.go") {
+		t.Fatalf("unexpected detection origin: %v", origin)
+	}
+}
+
 func TestSimpleCounterWithOptions(t *testing.T) {
 	t.Parallel()
 	uintCounter := uint64(35)
@@ -318,6 +418,61 @@ func TestSimpleCounterWithOptions(t *testing.T) {
 	checkMutationDetectionMessage(t, panicMessage)
 }
 
+func TestSkipUnsupportedTypes(t *testing.T) {
+	t.Parallel()
+	type legacyJob struct {
+		Name     string
+		Done     chan struct{}
+		Callback func()
+		Steps    []func()
+	}
+	job := &legacyJob{Name: "sync", Done: make(chan struct{}), Callback: func() {}, Steps: []func(){func() {}, nil}}
+	options := immcheck.Options{Flags: immcheck.SkipUnsupportedTypes}
+	snapshot := immcheck.CaptureSnapshotWithOptions(job, immcheck.NewValueSnapshot(), options)
+	if snapshot.UnverifiedNodes() != 4 {
+		t.Fatalf("unexpected number of unverified nodes: %v", snapshot.UnverifiedNodes())
+	}
+	if err := snapshot.Check(job, options); err != nil {
+		t.Fatalf("unexpected mutation: %v", err)
+	}
+	job.Name = "async"
+	err := snapshot.Check(job, options)
+	var mutationErr *immcheck.MutationError
+	if !errors.As(err, &mutationErr) || mutationErr.UnverifiedNodes != 4 {
+		t.Fatalf("unverified nodes aren't reported: %v", err)
+	}
+
+	function := func() {}
+	functionSnapshot := immcheck.CaptureSnapshotWithOptions(function, immcheck.NewValueSnapshot(), options)
+	if functionSnapshot.UnverifiedNodes() != 1 || functionSnapshot.Check(function, options) != nil {
+		t.Fatalf("unexpected snapshot of function: %v", functionSnapshot)
+	}
+}
+
+func TestSnapshotCoverage(t *testing.T) {
+	t.Parallel()
+	type legacyCache struct {
+		Size    int64
+		Buckets [4]int64 `immcheck:"ignore"`
+		Evict   func()
+	}
+	cache := &legacyCache{Size: 1, Evict: func() {}}
+	snapshot := immcheck.CaptureSnapshotWithOptions(cache, immcheck.NewValueSnapshot(), immcheck.Options{
+		Flags: immcheck.SkipUnsupportedTypes,
+	})
+	verifiedBytes, totalBytes, skippedNodes := snapshot.Coverage()
+	t.Log(verifiedBytes, totalBytes, skippedNodes)
+	if totalBytes < int(unsafe.Sizeof(*cache)) || totalBytes-verifiedBytes != 32 || skippedNodes != 2 {
+		t.Fatalf("unexpected coverage: %v/%v bytes, %v skipped nodes", verifiedBytes, totalBytes, skippedNodes)
+	}
+
+	counter := 1
+	verifiedBytes, totalBytes, skippedNodes = immcheck.CaptureSnapshot(&counter, immcheck.NewValueSnapshot()).Coverage()
+	if verifiedBytes != totalBytes || totalBytes == 0 || skippedNodes != 0 {
+		t.Fatalf("unexpected coverage: %v/%v bytes, %v skipped nodes", verifiedBytes, totalBytes, skippedNodes)
+	}
+}
+
 func TestUnsafeWithNotAllowedUnsafeOption(t *testing.T) {
 	t.Parallel()
 	function := func() {}
@@ -368,6 +523,42 @@ func TestSliceOfFloats(t *testing.T) {
 	checkMutationDetectionMessage(t, panicMessage)
 }
 
+func TestNormalizeFloats(t *testing.T) {
+	t.Parallel()
+	type measurement struct {
+		id    int
+		value float64
+		shift complex64
+	}
+	measurements := []measurement{
+		{id: 1, value: math.Float64frombits(0x7FF8000000000001), shift: complex(0, 1)},
+		{id: 2, value: 0, shift: complex(float32(math.NaN()), 0)},
+	}
+	regenerate := func() {
+		measurements[0].value = math.Float64frombits(0x7FF8000000000002)
+		measurements[1].value = math.Copysign(0, -1)
+		measurements[1].shift = complex(math.Float32frombits(0x7FC00001), float32(math.Copysign(0, -1)))
+	}
+	options := immcheck.Options{Flags: immcheck.NormalizeFloats}
+	func() {
+		defer immcheck.EnsureImmutabilityWithOptions(&measurements, options)()
+		regenerate()
+	}()
+
+	panicMessage := expectMutationPanic(t, func() {
+		defer immcheck.EnsureImmutabilityWithOptions(&measurements, options)()
+		measurements[1].value = 1
+	})
+	checkMutationDetectionMessage(t, panicMessage)
+
+	measurements[0].value = math.Float64frombits(0x7FF8000000000001)
+	panicMessage = expectMutationPanic(t, func() {
+		defer immcheck.EnsureImmutability(&measurements)()
+		regenerate()
+	})
+	checkMutationDetectionMessage(t, panicMessage)
+}
+
 func TestPrimitiveStruct(t *testing.T) {
 	t.Parallel()
 	type person struct {
@@ -404,6 +595,38 @@ func TestSliceOfPrimitiveStructs(t *testing.T) {
 	checkMutationDetectionMessage(t, panicMessage)
 }
 
+func TestStructPaddingIsIgnored(t *testing.T) {
+	t.Parallel()
+	type record struct {
+		flag  bool
+		count int64
+		kind  uint8
+	}
+	records := []record{{flag: true, count: 3, kind: 1}, {count: 7}}
+	fillPadding := func(garbage byte) {
+		for i := range records {
+			raw := (*[unsafe.Sizeof(record{})]byte)(unsafe.Pointer(&records[i]))
+			for offset := unsafe.Sizeof(true); offset < unsafe.Offsetof(records[i].count); offset++ {
+				raw[offset] = garbage
+			}
+			for offset := unsafe.Offsetof(records[i].kind) + 1; offset < uintptr(len(raw)); offset++ {
+				raw[offset] = garbage
+			}
+		}
+	}
+	func() {
+		defer immcheck.EnsureImmutability(&records)()
+		fillPadding(0xAB)
+	}()
+
+	panicMessage := expectMutationPanic(t, func() {
+		defer immcheck.EnsureImmutability(&records)()
+		fillPadding(0xCD)
+		records[1].kind = 2
+	})
+	checkMutationDetectionMessage(t, panicMessage)
+}
+
 func TestSliceOfNonPrimitiveStructs(t *testing.T) {
 	t.Parallel()
 	type person struct {
@@ -506,6 +729,43 @@ func TestMutationOfUnsafeStringPropertyOfNestedNonPrimitiveStruct(t *testing.T)
 		grandParentNameBytes[0] = byte('g')
 	})
 	checkMutationDetectionMessage(t, panicMessage)
+	if strings.Contains(panicMessage, "string data pointers were changed") {
+		t.Fatalf("content mutation is reported as repointing: %v", panicMessage)
+	}
+}
+
+func TestRepointedString(t *testing.T) {
+	t.Parallel()
+	nameBytes := []byte("name")
+	name := *((*string)(unsafe.Pointer(&nameBytes)))
+
+	// without the option only content is guarded
+	func() {
+		defer immcheck.EnsureImmutability(&name)()
+		name = string(nameBytes)
+	}()
+
+	options := immcheck.Options{Flags: immcheck.CaptureStringIdentity}
+	immcheck.EnsureImmutabilityWithOptions(&name, options)() // check that no mutation is fine
+	panicMessage := expectMutationPanic(t, func() {
+		defer immcheck.EnsureImmutabilityWithOptions(&name, options)()
+		name = string(nameBytes)
+	})
+	checkMutationDetectionMessage(t, panicMessage)
+	if !strings.Contains(panicMessage, "string data pointers were changed") {
+		t.Fatalf("repointing isn't reported: %v", panicMessage)
+	}
+
+	name = *((*string)(unsafe.Pointer(&nameBytes)))
+	snapshot := immcheck.CaptureSnapshotWithOptions(&name, immcheck.NewValueSnapshot(), options)
+	nameBytes[0] = 'N'
+	err := snapshot.CheckImmutabilityAgainst(
+		immcheck.CaptureSnapshotWithOptions(&name, immcheck.NewValueSnapshot(), options),
+	)
+	var mutationErr *immcheck.MutationError
+	if !errors.As(err, &mutationErr) || mutationErr.StringDataRepointed {
+		t.Fatalf("content mutation isn't distinguished from repointing: %v", err)
+	}
 }
 
 func TestLinkedList(t *testing.T) {
@@ -670,6 +930,212 @@ func TestChannel(t *testing.T) {
 	checkMutationDetectionMessage(t, panicMessage)
 }
 
+func TestCompareReferencesByContent(t *testing.T) {
+	t.Parallel()
+	type celsius int
+	type fahrenheit int
+	type node struct {
+		Value interface{}
+		Next  *node
+	}
+	head := &node{Value: celsius(20), Next: &node{Value: "tail"}}
+	head.Next.Next = head
+	options := immcheck.Options{Flags: immcheck.CompareReferencesByContent}
+	func() {
+		defer immcheck.EnsureImmutabilityWithOptions(head, options)()
+		head.Value = celsius(20)
+		head.Next = &node{Value: "tail", Next: head}
+	}()
+
+	panicMessage := expectMutationPanic(t, func() {
+		defer immcheck.EnsureImmutabilityWithOptions(head, options)()
+		head.Value = fahrenheit(20)
+	})
+	checkMutationDetectionMessage(t, panicMessage)
+	panicMessage = expectMutationPanic(t, func() {
+		defer immcheck.EnsureImmutabilityWithOptions(head, options)()
+		head.Next = &node{Value: "new tail", Next: head}
+	})
+	checkMutationDetectionMessage(t, panicMessage)
+	panicMessage = expectMutationPanic(t, func() {
+		defer immcheck.EnsureImmutability(head)()
+		head.Next = &node{Value: "new tail", Next: head}
+	})
+	checkMutationDetectionMessage(t, panicMessage)
+}
+
+func TestCompareByValue(t *testing.T) {
+	t.Parallel()
+	type payload struct {
+		Weight float64
+	}
+	type message struct {
+		Topic   string
+		Tags    []string
+		Payload *payload
+	}
+	newMessage := func(topic string) message {
+		tags := make([]string, 1, 4)
+		tags[0] = strings.Repeat("x", 2)
+		return message{Topic: strings.Repeat(topic, 1), Tags: tags, Payload: &payload{Weight: 1.5}}
+	}
+	msg := newMessage("orders")
+	options := immcheck.Options{Flags: immcheck.CompareByValue}
+	func() {
+		defer immcheck.EnsureImmutabilityWithOptions(&msg, options)()
+		msg = newMessage("orders")
+	}()
+
+	panicMessage := expectMutationPanic(t, func() {
+		defer immcheck.EnsureImmutabilityWithOptions(&msg, options)()
+		msg = newMessage("events")
+	})
+	checkMutationDetectionMessage(t, panicMessage)
+	panicMessage = expectMutationPanic(t, func() {
+		defer immcheck.EnsureImmutabilityWithOptions(&msg, options)()
+		msg.Tags = append(msg.Tags, "y")
+	})
+	checkMutationDetectionMessage(t, panicMessage)
+	panicMessage = expectMutationPanic(t, func() {
+		defer immcheck.EnsureImmutability(&msg)()
+		msg = newMessage("orders")
+	})
+	checkMutationDetectionMessage(t, panicMessage)
+}
+
+func TestCompareByContentDetectsSwaps(t *testing.T) {
+	t.Parallel()
+	type pair struct {
+		X, Y int
+	}
+	type holder struct {
+		P, Q   *pair
+		A, B   string
+		Items  []*pair
+		Lookup map[string]*pair
+	}
+	newHolder := func() *holder {
+		lookup := make(map[string]*pair)
+		for i := 0; i < 32; i++ {
+			lookup[strconv.Itoa(i)] = &pair{i, i}
+		}
+		return &holder{
+			P: &pair{1, 2}, Q: &pair{3, 4}, A: "a", B: "b",
+			Items: []*pair{{5, 6}, {7, 8}}, Lookup: lookup,
+		}
+	}
+	for _, flags := range []immcheck.Options{
+		{Flags: immcheck.CompareReferencesByContent},
+		{Flags: immcheck.CompareByValue},
+	} {
+		for name, swap := range map[string]func(h *holder){
+			"pointers": func(h *holder) { h.P, h.Q = h.Q, h.P },
+			"strings":  func(h *holder) { h.A, h.B = h.B, h.A },
+			"items":    func(h *holder) { h.Items[0], h.Items[1] = h.Items[1], h.Items[0] },
+			"entries":  func(h *holder) { h.Lookup["0"], h.Lookup["1"] = h.Lookup["1"], h.Lookup["0"] },
+		} {
+			h := newHolder()
+			verify := immcheck.EnsureImmutabilityErr(h, flags)
+			for i := 0; i < 8; i++ {
+				if err := verify(); err != nil {
+					t.Fatalf("unchanged value is reported with %v: %v", flags.Flags, err)
+				}
+			}
+			swap(h)
+			if err := verify(); err == nil {
+				t.Fatalf("swapped %v aren't reported with %v", name, flags.Flags)
+			}
+		}
+	}
+}
+
+func TestCompareByValueMaps(t *testing.T) {
+	t.Parallel()
+	type order struct {
+		Items map[string][]int
+		Notes map[float64]string
+	}
+	newOrder := func(itemsCount int) *order {
+		o := &order{Items: make(map[string][]int), Notes: make(map[float64]string)}
+		for i := 0; i < itemsCount; i++ {
+			o.Items[strconv.Itoa(i)] = []int{i, i * 2}
+		}
+		// entries with NaN keys are equal, so they have equal digests
+		o.Notes[math.NaN()] = "nan"
+		o.Notes[math.NaN()] = "nan"
+		return o
+	}
+	o := newOrder(64)
+	options := immcheck.Options{Flags: immcheck.CompareByValue | immcheck.SkipOriginCapturing}
+	func() {
+		defer immcheck.EnsureImmutabilityWithOptions(o, options)()
+		*o = *newOrder(64)
+	}()
+	snapshot, _ := immcheck.CaptureSnapshotWithOptions(o, immcheck.NewValueSnapshot(), options).MarshalBinary()
+	for i := 0; i < 16; i++ {
+		copySnapshot, _ := immcheck.CaptureSnapshotWithOptions(
+			newOrder(64), immcheck.NewValueSnapshot(), options,
+		).MarshalBinary()
+		if !bytes.Equal(snapshot, copySnapshot) {
+			t.Fatal("snapshots of equal maps are different")
+		}
+	}
+
+	panicMessage := expectMutationPanic(t, func() {
+		defer immcheck.EnsureImmutabilityWithOptions(o, options)()
+		o.Items["1"][1] = 3
+	})
+	checkMutationDetectionMessage(t, panicMessage)
+	panicMessage = expectMutationPanic(t, func() {
+		defer immcheck.EnsureImmutabilityWithOptions(o, options)()
+		o.Notes[math.NaN()] = "nan"
+	})
+	checkMutationDetectionMessage(t, panicMessage)
+	panicMessage = expectMutationPanic(t, func() {
+		defer immcheck.EnsureImmutability(o)()
+		*o = *newOrder(64)
+	})
+	checkMutationDetectionMessage(t, panicMessage)
+}
+
+func TestPointerRetargeting(t *testing.T) {
+	t.Parallel()
+	type profile struct {
+		name  string
+		score *int
+		tags  map[string]interface{}
+	}
+	score, level := 10, 3
+	current := &profile{name: "gopher", score: &score, tags: map[string]interface{}{"level": &level}}
+	verify := immcheck.EnsureImmutabilityErr(current, immcheck.Options{})
+
+	copiedScore := score
+	current.score = &copiedScore
+	var mutationErr *immcheck.MutationError
+	if err := verify(); !errors.As(err, &mutationErr) || !mutationErr.PointerRetargeted {
+		t.Fatalf("retargeting isn't classified: %v", err)
+	}
+	if !strings.Contains(mutationErr.Error(), "references were retargeted") {
+		t.Fatalf("unexpected error message: %v", mutationErr)
+	}
+	current.score = &score
+
+	copiedLevel := level
+	current.tags["level"] = &copiedLevel
+	if err := verify(); !errors.As(err, &mutationErr) || !mutationErr.PointerRetargeted {
+		t.Fatalf("retargeting of map value isn't classified: %v", err)
+	}
+	current.tags["level"] = &level
+	if err := verify(); err != nil {
+		t.Fatalf("unexpected error happened: %v", err)
+	}
+
+	score = 11
+	if err := verify(); !errors.As(err, &mutationErr) || mutationErr.PointerRetargeted {
+		t.Fatalf("content change is classified as retargeting: %v", err)
+	}
+}
+
 func TestPrimitiveStructBehindInterface(t *testing.T) {
 	t.Parallel()
 	type person struct {
@@ -719,6 +1185,38 @@ func TestPointerToSubslice(t *testing.T) {
 	checkMutationDetectionMessage(t, panicMessage)
 }
 
+func TestRetainedSubslice(t *testing.T) {
+	t.Parallel()
+	backingArray := make([]*int, 4)
+	guarded := backingArray[:2]
+	retained := backingArray[1:4]
+
+	// without the option len..cap region of the backing array isn't guarded
+	immcheck.EnsureImmutability(&guarded)()
+	func() {
+		defer immcheck.EnsureImmutability(&guarded)()
+		retained[2] = new(int)
+	}()
+
+	options := immcheck.Options{Flags: immcheck.CaptureSliceCapacity}
+	immcheck.EnsureImmutabilityWithOptions(&guarded, options)() // check that no mutation is fine
+	panicMessage := expectMutationPanic(t, func() {
+		defer immcheck.EnsureImmutabilityWithOptions(&guarded, options)()
+		retained[1] = new(int)
+	})
+	checkMutationDetectionMessage(t, panicMessage)
+	panicMessage = expectMutationPanic(t, func() {
+		defer immcheck.EnsureImmutabilityWithOptions(&guarded, options)()
+		*retained[2]++ // pointees beyond len are guarded too
+	})
+	checkMutationDetectionMessage(t, panicMessage)
+	panicMessage = expectMutationPanic(t, func() {
+		defer immcheck.EnsureImmutabilityWithOptions(&guarded, options)()
+		guarded = guarded[:1:2]
+	})
+	checkMutationDetectionMessage(t, panicMessage)
+}
+
 func TestSimpleMap(t *testing.T) {
 	t.Parallel()
 	allowUnsafe := immcheck.Options{Flags: immcheck.AllowInherentlyUnsafeTypes}
@@ -774,7 +1272,7 @@ func checkMutationDetectionMessage(t *testing.T, panicMessage string) {
 		t.Fatal("unexpected panic message: " + panicMessage)
 	}
 	if strings.Contains(panicMessage, "immutable snapshot was captured here") {
-		if strings.Count(panicMessage, "immcheck_test.go:") != 2 {
+		if strings.Count(panicMessage, "_test.go:") != 2 {
 			t.Fatal("snapshot origin capturing is broken ")
 		}
 	}
@@ -790,9 +1288,9 @@ func checkUnsupportedTypeMessage(t *testing.T, panicMessage string, expectedType
 			"If you still want to proceed and ignore fields of such type "+
 			"use Flags.AllowInherentlyUnsafeTypes option. Unsupported type kind: ",
 	)
-	sufixIsCorrect := strings.HasSuffix(panicMessage, expectedTypeStringInErrorMessage)
+	kindIsCorrect := strings.Contains(panicMessage, "Unsupported type kind: "+expectedTypeStringInErrorMessage)
 	t.Log(panicMessage)
-	if !prefixIsCorrect || !sufixIsCorrect {
+	if !prefixIsCorrect || !kindIsCorrect {
 		t.Fatal("unexpected panic message: " + panicMessage)
 	}
 }
@@ -847,3 +1345,289 @@ func (l *lockedWriterBuffer) Write(p []byte) (n int, err error) {
 	defer l.m.Unlock()
 	return l.buf.Write(p)
 }
+
+func TestMutationErrorPanicValue(t *testing.T) {
+	t.Parallel()
+	counter := 1
+	{
+		var actualPanic interface{}
+		func() {
+			defer func() { actualPanic = recover() }()
+			defer immcheck.EnsureImmutability(&counter)()
+			counter++
+		}()
+		var mutationErr *immcheck.MutationError
+		if err, ok := actualPanic.(error); !ok || !errors.As(err, &mutationErr) {
+			t.Fatalf("unexpected panic value: %T(%v)", actualPanic, actualPanic)
+		}
+		if _, ok := immcheck.LookupOrigin(mutationErr.CaptureOrigin); !ok {
+			t.Fatal("capture origin is missing")
+		}
+		if _, ok := immcheck.LookupOrigin(mutationErr.DetectionOrigin); !ok {
+			t.Fatal("detection origin is missing")
+		}
+	}
+	{
+		type customPanic struct {
+			err *immcheck.MutationError
+		}
+		var actualPanic interface{}
+		func() {
+			defer func() { actualPanic = recover() }()
+			defer immcheck.EnsureImmutabilityWithOptions(&counter, immcheck.Options{
+				Flags: immcheck.SkipLoggingOnMutation,
+				PanicValue: func(err *immcheck.MutationError) interface{} {
+					return customPanic{err: err}
+				},
+			})()
+			counter++
+		}()
+		custom, ok := actualPanic.(customPanic)
+		if !ok {
+			t.Fatalf("unexpected panic value: %T(%v)", actualPanic, actualPanic)
+		}
+		checkMutationDetectionMessage(t, custom.err.Error())
+	}
+}
+
+func TestMutationErrorDescribesGuardedValue(t *testing.T) {
+	t.Parallel()
+	type user struct {
+		Name string
+		Tags []string
+	}
+	users := []user{{Name: "first", Tags: []string{"a"}}, {Name: "second"}}
+	snapshot := immcheck.CaptureSnapshot(&users, immcheck.NewValueSnapshot())
+	users[1].Tags = []string{"b"}
+	err := snapshot.CheckImmutabilityAgainst(immcheck.CaptureSnapshot(&users, immcheck.NewValueSnapshot()))
+	var mutationErr *immcheck.MutationError
+	if !errors.As(err, &mutationErr) {
+		t.Fatalf("mutation isn't detected: %v", err)
+	}
+	if mutationErr.Type != fmt.Sprintf("%T", &users) || mutationErr.Elements != 2 {
+		t.Fatalf("unexpected guarded value description: %v %v", mutationErr.Type, mutationErr.Elements)
+	}
+	if mutationErr.ApproximateSize < int(2*unsafe.Sizeof(user{})) {
+		t.Fatalf("unexpected approximate size: %v", mutationErr.ApproximateSize)
+	}
+	if !strings.Contains(err.Error(), "guarded value type: *[]immcheck_test.user; elements: 2; approximate size: ") {
+		t.Fatalf("unexpected error message: %v", err)
+	}
+}
+
+func TestEnsureImmutabilityErr(t *testing.T) {
+	t.Parallel()
+	counter := 1
+	verify := immcheck.EnsureImmutabilityErr(&counter, immcheck.Options{})
+	if err := verify(); err != nil {
+		t.Fatalf("unexpected error happened: %v", err)
+	}
+	counter++
+	for i := 0; i < 2; i++ {
+		err := verify()
+		var mutationErr *immcheck.MutationError
+		if !errors.As(err, &mutationErr) {
+			t.Fatalf("mutation isn't detected: %v", err)
+		}
+		checkMutationDetectionMessage(t, err.Error())
+	}
+	expectPanic(t, func() {
+		immcheck.EnsureImmutabilityErr(nil, immcheck.Options{})
+	}, immcheck.UnsupportedTypeError)
+}
+
+func TestEnsureImmutabilityAsync(t *testing.T) {
+	t.Parallel()
+	counter := 1
+	verify := immcheck.EnsureImmutabilityAsync(&counter, immcheck.Options{})
+	if err := <-verify(); err != nil {
+		t.Fatalf("unexpected error happened: %v", err)
+	}
+	counter++
+	err := <-verify()
+	var mutationErr *immcheck.MutationError
+	if !errors.As(err, &mutationErr) {
+		t.Fatalf("mutation isn't detected: %v", err)
+	}
+	checkMutationDetectionMessage(t, err.Error())
+	expectPanic(t, func() {
+		immcheck.EnsureImmutabilityAsync(nil, immcheck.Options{})
+	}, immcheck.UnsupportedTypeError)
+}
+
+func TestNoopCheck(t *testing.T) {
+	counter := 1
+	if immcheck.IsNoopCheck(immcheck.EnsureImmutability(&counter)) || immcheck.IsNoopCheck(nil) {
+		t.Fatal("enabled check is reported as noop")
+	}
+	if immcheck.IsNoopCheck(immcheck.RaceEnsureImmutability(&counter)) == immcheck.RaceInlineChecksEnabled {
+		t.Fatal("race check isn't noop in race-off builds")
+	}
+
+	options := immcheck.Options{SampleEvery: 1 << 30}
+	skipped := 0
+	for i := 0; i < 10; i++ {
+		if immcheck.IsNoopCheck(immcheck.EnsureImmutabilityWithOptions(&counter, options)) {
+			skipped++
+		}
+	}
+	if skipped < 9 {
+		t.Fatalf("checks aren't sampled: %v", skipped)
+	}
+	if !immcheck.RaceInlineChecksEnabled {
+		allocs := testing.AllocsPerRun(100, func() {
+			immcheck.RaceEnsureImmutability(&counter)()
+		})
+		if allocs != 0 {
+			t.Fatalf("disabled path allocates: %v", allocs)
+		}
+	}
+}
+
+func TestReleaseByNil(t *testing.T) {
+	t.Parallel()
+	type session struct {
+		user  *string
+		cache map[string]int
+	}
+	newSession := func() *session {
+		name := "user"
+		return &session{user: &name, cache: map[string]int{"a": 1}}
+	}
+	{
+		current := newSession()
+		verify := immcheck.EnsureImmutabilityErr(&current, immcheck.Options{})
+		current.user = nil
+		current.cache = nil
+		var mutationErr *immcheck.MutationError
+		if err := verify(); !errors.As(err, &mutationErr) || !mutationErr.Released {
+			t.Fatalf("release isn't classified: %v", err)
+		}
+		if !strings.Contains(mutationErr.Error(), "guarded value was released") {
+			t.Fatalf("unexpected error message: %v", mutationErr)
+		}
+	}
+	{
+		current := newSession()
+		verify := immcheck.EnsureImmutabilityErr(&current, immcheck.Options{})
+		*current.user = "changed"
+		var mutationErr *immcheck.MutationError
+		if err := verify(); !errors.As(err, &mutationErr) || mutationErr.Released {
+			t.Fatalf("mutation is classified as release: %v", err)
+		}
+	}
+	{
+		options := immcheck.Options{Flags: immcheck.AllowReleaseByNil}
+		current := newSession()
+		func() {
+			defer immcheck.EnsureImmutabilityWithOptions(&current, options)()
+			current = nil // teardown isn't reported
+		}()
+		current = newSession()
+		expectMutationPanic(t, func() {
+			defer immcheck.EnsureImmutabilityWithOptions(&current, options)()
+			current.cache["a"] = 2
+		})
+		func() {
+			defer immcheck.EnsureImmutabilityWithOptions(&current, options)()
+			current.user = nil // partial teardown isn't reported either
+		}()
+	}
+	{
+		// releases are allowed by checks that return errors as well
+		options := immcheck.Options{Flags: immcheck.AllowReleaseByNil}
+		current := newSession()
+		verify := immcheck.EnsureImmutabilityErr(&current, options)
+		verifyAsync := immcheck.EnsureImmutabilityAsync(&current, options)
+		snapshot := immcheck.CaptureSnapshotWithOptions(&current, immcheck.NewValueSnapshot(), options)
+		partial := immcheck.EnsureImmutabilityPartial(&current, options)
+		current.user = nil
+		if err := verify(); err != nil {
+			t.Fatalf("release is reported: %v", err)
+		}
+		if err := <-verifyAsync(); err != nil {
+			t.Fatalf("release is reported asynchronously: %v", err)
+		}
+		if err := snapshot.Check(&current, options); err != nil {
+			t.Fatalf("release is reported by snapshot: %v", err)
+		}
+		if done, err := partial.VerifyNext(partial.Units()); !done || err != nil {
+			t.Fatalf("release is reported by partial verification: %v %v", done, err)
+		}
+		current = nil
+		if done, err := partial.VerifyNext(partial.Units()); !done || err != nil {
+			t.Fatalf("release of guarded reference is reported by partial verification: %v %v", done, err)
+		}
+	}
+	{
+		type account struct {
+			Balance int
+			Owner   *string
+		}
+		options := immcheck.Options{Flags: immcheck.AllowReleaseByNil}
+		owner := "owner"
+		current := &account{Balance: 1, Owner: &owner}
+		// write made together with release is still reported
+		panicMessage := expectMutationPanic(t, func() {
+			defer immcheck.EnsureImmutabilityWithOptions(current, options)()
+			current.Balance = 42
+			current.Owner = nil
+		})
+		checkMutationDetectionMessage(t, panicMessage)
+		if !strings.Contains(panicMessage, "guarded value was released") {
+			t.Fatalf("release isn't classified: %v", panicMessage)
+		}
+	}
+}
+
+func TestMapKeysSemantics(t *testing.T) {
+	t.Parallel()
+	type key struct {
+		name  string
+		items *[]int
+	}
+	firstItems, secondItems := []int{1}, []int{2}
+	index := map[key]string{
+		{name: "first", items: &firstItems}:   "a",
+		{name: "second", items: &secondItems}: "b",
+	}
+	verify := immcheck.EnsureImmutabilityErr(&index, immcheck.Options{})
+	if err := verify(); err != nil {
+		t.Fatalf("unexpected error happened: %v", err)
+	}
+
+	// mutation through pointer held by key is content change
+	firstItems[0] = 3
+	var mutationErr *immcheck.MutationError
+	if err := verify(); !errors.As(err, &mutationErr) || mutationErr.KeySetChanged {
+		t.Fatalf("mutation through key isn't reported as content change: %v", err)
+	}
+	firstItems[0] = 1
+	if err := verify(); err != nil {
+		t.Fatalf("unexpected error happened: %v", err)
+	}
+
+	// replacing key with equal content, but different pointer is key set change
+	copiedItems := []int{2}
+	delete(index, key{name: "second", items: &secondItems})
+	index[key{name: "second", items: &copiedItems}] = "b"
+	if err := verify(); !errors.As(err, &mutationErr) || !mutationErr.KeySetChanged {
+		t.Fatalf("key replacement isn't reported as key set change: %v", err)
+	}
+	if !strings.Contains(mutationErr.Error(), "map key set was changed") {
+		t.Fatalf("unexpected error message: %v", mutationErr)
+	}
+
+	// string and interface keys are identified by content
+	names := map[interface{}]int{"a": 1, 2: 2}
+	verify = immcheck.EnsureImmutabilityErr(&names, immcheck.Options{})
+	delete(names, "a")
+	names[string([]byte("a"))] = 1
+	if err := verify(); err != nil {
+		t.Fatalf("re-inserted equal key is reported: %v", err)
+	}
+	names[3] = 3
+	if err := verify(); !errors.As(err, &mutationErr) || !mutationErr.KeySetChanged {
+		t.Fatalf("added key isn't reported as key set change: %v", err)
+	}
+}
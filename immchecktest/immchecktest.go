@@ -0,0 +1,44 @@
+// Package immchecktest integrates immcheck with the testing package.
+package immchecktest
+
+import (
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+// Reporter returns immcheck.Reporter that reports detected mutations using t.Errorf instead of panicking,
+// so detections fail the (sub)test that observed them and the test keeps running.
+func Reporter(t testing.TB) immcheck.Reporter {
+	return tbReporter{t: t}
+}
+
+// Options returns immcheck.Options that report detected mutations to t.
+func Options(t testing.TB) immcheck.Options {
+	return immcheck.Options{Reporter: Reporter(t)}
+}
+
+type tbReporter struct {
+	t testing.TB
+}
+
+func (r tbReporter) ReportMutation(err error) {
+	r.t.Helper()
+	r.t.Errorf("immcheck: %v", err)
+}
+
+// ReportCaptureMetrics starts collection of immcheck capture stats and returns function
+// that reports them as b.ReportMetric per-op metrics: hashed-B/op and nodes/op.
+// Use it like that: defer immchecktest.ReportCaptureMetrics(b)().
+// Stats are process-wide, so don't run unrelated captures in parallel with the benchmark.
+func ReportCaptureMetrics(b *testing.B) func() {
+	stop := immcheck.StartCaptureStats()
+	return func() {
+		stats := stop()
+		if b.N == 0 {
+			return
+		}
+		b.ReportMetric(float64(stats.BytesHashed)/float64(b.N), "hashed-B/op")
+		b.ReportMetric(float64(stats.NodesVisited)/float64(b.N), "nodes/op")
+	}
+}
@@ -0,0 +1,60 @@
+package immchecktest_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+	"github.com/goodbadreviewer/immcheck/immchecktest"
+)
+
+type recordingTB struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recordingTB) Helper() {}
+
+func (r *recordingTB) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestReporter(t *testing.T) {
+	t.Parallel()
+	tb := &recordingTB{TB: t}
+	counter := 0
+	func() {
+		defer immcheck.EnsureImmutabilityWithOptions(&counter, immchecktest.Options(tb))()
+		counter++
+	}()
+	immcheck.EnsureImmutabilityWithOptions(&counter, immchecktest.Options(tb))()
+	if len(tb.errors) != 1 {
+		t.Fatalf("unexpected reported errors: %v", tb.errors)
+	}
+	if !strings.HasPrefix(tb.errors[0], "immcheck: mutation of immutable value detected\n") ||
+		!strings.Contains(tb.errors[0], "immchecktest_test.go:") {
+		t.Fatalf("unexpected reported error: %v", tb.errors[0])
+	}
+}
+
+func BenchmarkReportCaptureMetrics(b *testing.B) {
+	defer immchecktest.ReportCaptureMetrics(b)()
+	value := map[string][]int{"a": {1, 2, 3}}
+	snapshot := immcheck.NewValueSnapshot()
+	for i := 0; i < b.N; i++ {
+		snapshot = immcheck.CaptureSnapshotWithOptions(
+			&value, snapshot, immcheck.Options{Flags: immcheck.SkipOriginCapturing},
+		)
+	}
+}
+
+func TestSoak(t *testing.T) {
+	result, err := immchecktest.Soak(immchecktest.SoakConfig{Guards: 10_000, GCCycles: 3})
+	if err != nil {
+		t.Fatalf("soak failed: %v; %+v", err, result)
+	}
+	if result.Guards != 10_000 || result.ReportedMutations != 0 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+}
@@ -0,0 +1,156 @@
+package immchecktest
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+// SoakConfig configures immchecktest.Soak.
+type SoakConfig struct {
+	// Guards is the number of finalization guards to create.
+	Guards int
+	// Goroutines is the number of goroutines that create guards. runtime.GOMAXPROCS(0) is used by default.
+	Goroutines int
+	// GCCycles is the number of forced GC cycles after all guards are created. 10 is used by default.
+	GCCycles int
+	// MaxGoroutineGrowth is the allowed growth of goroutines count, for example, to start finalizer workers.
+	// 8 is used by default.
+	MaxGoroutineGrowth int
+	// MaxHeapGrowth is the allowed growth of live heap in bytes after all guards are finalized.
+	// 64 MiB is used by default.
+	MaxHeapGrowth uint64
+	// DrainTimeout limits how long Soak waits for finalizer checks to drain. 1 minute is used by default.
+	DrainTimeout time.Duration
+}
+
+// SoakResult describes resources observed by immchecktest.Soak.
+type SoakResult struct {
+	Guards            int
+	Duration          time.Duration
+	MaxPendingChecks  int
+	GoroutinesBefore  int
+	GoroutinesAfter   int
+	HeapBytesBefore   uint64
+	HeapBytesAfter    uint64
+	ReportedMutations int
+}
+
+// Soak creates config.Guards finalization guards across goroutines, forces GC repeatedly
+// and verifies that finalizer path doesn't leak goroutines, that its queue is drained
+// and that memory stays bounded. Guarded values are never mutated, so any report is an error as well.
+func Soak(config SoakConfig) (SoakResult, error) {
+	config = withSoakDefaults(config)
+	result := SoakResult{Guards: config.Guards}
+	reports := &countingWriter{}
+	options := immcheck.Options{
+		Flags:     immcheck.SkipPanicOnDetectedMutation | immcheck.SkipOriginCapturing,
+		LogWriter: reports,
+	}
+	type payload struct {
+		id   int
+		data []byte
+	}
+
+	collectGarbage(config.GCCycles)
+	result.GoroutinesBefore = runtime.NumGoroutine()
+	result.HeapBytesBefore = liveHeap()
+	started := time.Now()
+
+	wg := &sync.WaitGroup{}
+	for g := 0; g < config.Goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := g; i < config.Guards; i += config.Goroutines {
+				immcheck.CheckImmutabilityOnFinalizationWithOptions(&payload{id: i, data: []byte("data")}, options)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	deadline := time.Now().Add(config.DrainTimeout)
+	for cycle := 0; cycle < config.GCCycles || immcheck.PendingFinalizerChecks() != 0; cycle++ {
+		if time.Now().After(deadline) {
+			return result, fmt.Errorf("finalizer checks aren't drained in %v: %v pending",
+				config.DrainTimeout, immcheck.PendingFinalizerChecks())
+		}
+		runtime.GC()
+		if pending := immcheck.PendingFinalizerChecks(); pending > result.MaxPendingChecks {
+			result.MaxPendingChecks = pending
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	result.Duration = time.Since(started)
+	collectGarbage(config.GCCycles)
+	result.GoroutinesAfter = runtime.NumGoroutine()
+	result.HeapBytesAfter = liveHeap()
+	result.ReportedMutations = reports.count()
+
+	if result.ReportedMutations != 0 {
+		return result, fmt.Errorf("unexpected mutation reports: %v", result.ReportedMutations)
+	}
+	if result.GoroutinesAfter-result.GoroutinesBefore > config.MaxGoroutineGrowth {
+		return result, fmt.Errorf("goroutines leaked: %v before; %v after",
+			result.GoroutinesBefore, result.GoroutinesAfter)
+	}
+	if result.HeapBytesAfter > result.HeapBytesBefore &&
+		result.HeapBytesAfter-result.HeapBytesBefore > config.MaxHeapGrowth {
+		return result, fmt.Errorf("memory isn't bounded: %v bytes before; %v bytes after",
+			result.HeapBytesBefore, result.HeapBytesAfter)
+	}
+	return result, nil
+}
+
+func withSoakDefaults(config SoakConfig) SoakConfig {
+	if config.Goroutines <= 0 {
+		config.Goroutines = runtime.GOMAXPROCS(0)
+	}
+	if config.GCCycles <= 0 {
+		config.GCCycles = 10
+	}
+	if config.MaxGoroutineGrowth <= 0 {
+		config.MaxGoroutineGrowth = 8
+	}
+	if config.MaxHeapGrowth == 0 {
+		config.MaxHeapGrowth = 64 << 20
+	}
+	if config.DrainTimeout <= 0 {
+		config.DrainTimeout = time.Minute
+	}
+	return config
+}
+
+func collectGarbage(cycles int) {
+	for i := 0; i < cycles; i++ {
+		runtime.GC()
+	}
+}
+
+func liveHeap() uint64 {
+	stats := &runtime.MemStats{}
+	runtime.ReadMemStats(stats)
+	return stats.HeapAlloc
+}
+
+// countingWriter counts written mutation reports.
+type countingWriter struct {
+	m       sync.Mutex
+	reports int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.reports++
+	return len(p), nil
+}
+
+func (c *countingWriter) count() int {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.reports
+}
@@ -0,0 +1,20 @@
+//go:build soak
+// +build soak
+
+package immchecktest_test
+
+import (
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck/immchecktest"
+)
+
+func TestSoakFinalizerGuards(t *testing.T) {
+	for _, guards := range []int{1_000_000, 5_000_000} {
+		result, err := immchecktest.Soak(immchecktest.SoakConfig{Guards: guards})
+		t.Logf("%+v", result)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package immcheck
+
+import (
+	"reflect"
+	"sync/atomic"
+	"unsafe"
+)
+
+// runtimeInternals isolates parts of immcheck that depend on memory layouts of Go runtime and reflect,
+// like layouts of interfaces, maps and reflect.Value. layoutInternals relies on these layouts and is fast,
+// reflectInternals uses only reflect API and is slower, but a new Go release can't make it corrupt captures.
+// Layouts are verified for Go versions known at the time of release, see layoutsKnown,
+// on other versions they are probed at init and immcheck falls back to reflectInternals if probing fails.
+// Implementation can be selected at runtime using internals toggle, see immcheck.SetRuntimeToggles.
+type runtimeInternals interface {
+	// valueBytes returns view of memory of value.
+	valueBytes(value reflect.Value) []byte
+	// sequenceBytes returns view of memory of items of array, slice or string.
+	sequenceBytes(value reflect.Value) []byte
+	// boxedData returns pointer to data of value that is neither addressable nor a reference,
+	// or nil if it isn't available.
+	boxedData(value reflect.Value) unsafe.Pointer
+	// interfaceData returns pointer to data referenced by non-nil interface value, or nil if it isn't available.
+	interfaceData(value reflect.Value) unsafe.Pointer
+	// typeIdentity returns number that identifies t within the process.
+	typeIdentity(t reflect.Type) uintptr
+	// accessibleValue returns view of value of unexported field, see AllowUnexportedAccess flag.
+	accessibleValue(value reflect.Value) reflect.Value
+	// mapValueAt returns view of map value that can be used with Value.SetIterKey,
+	// slot is a storage for the view that has to outlive it.
+	mapValueAt(value reflect.Value, slot *unsafe.Pointer) reflect.Value
+}
+
+// internalsHolder allows to store runtimeInternals of different types in atomic.Value.
+type internalsHolder struct {
+	internals runtimeInternals
+}
+
+//nolint:gochecknoglobals // internals are selected once at init, see runtimeInternals
+var defaultInternals runtimeInternals = layoutInternals{}
+
+//nolint:gochecknoglobals // activeInternals overrides defaultInternals, see immcheck.SetRuntimeToggles
+var activeInternals atomic.Value // internalsHolder
+
+//nolint:gochecknoinits // layouts are probed once at startup
+func init() {
+	defaultInternals = selectInternals()
+}
+
+func selectInternals() runtimeInternals {
+	if !layoutsKnown && !layoutsMatch() {
+		return reflectInternals{}
+	}
+	return layoutInternals{}
+}
+
+// internalsOf returns runtimeInternals used to capture values according to options.
+func internalsOf(options Options) runtimeInternals {
+	internals := options.internals
+	if internals == nil {
+		internals = currentInternals()
+	}
+	if options.SafeMode {
+		internals = reflectInternals{}
+	}
+	if reflectMode, ok := internals.(reflectInternals); ok && options.Flags&AllowUnexportedAccess != 0 {
+		reflectMode.copyReadOnly = true
+		return reflectMode
+	}
+	return internals
+}
+
+func currentInternals() runtimeInternals {
+	if holder, _ := activeInternals.Load().(internalsHolder); holder.internals != nil {
+		return holder.internals
+	}
+	return defaultInternals
+}
+
+// parseInternalsToggle returns runtimeInternals selected by value of internals toggle,
+// nil means internals selected at init.
+func parseInternalsToggle(value string) (runtimeInternals, bool) {
+	switch value {
+	case "", "auto":
+		return nil, true
+	case "layout":
+		return layoutInternals{}, true
+	case "reflect":
+		return reflectInternals{}, true
+	}
+	return nil, false
+}
+
+func internalsName(internals runtimeInternals) string {
+	if _, ok := internals.(reflectInternals); ok {
+		return "reflect"
+	}
+	return "layout"
+}
+
+// internalsID identifies runtimeInternals used to capture a snapshot.
+// Checksums of references and boxed values depend on internals, so snapshots captured using
+// different internals can't be compared.
+type internalsID uint8
+
+const (
+	layoutInternalsID internalsID = iota
+	reflectInternalsID
+)
+
+func (id internalsID) String() string {
+	if id == reflectInternalsID {
+		return "reflect"
+	}
+	return "layout"
+}
+
+func internalsIDOf(internals runtimeInternals) internalsID {
+	if _, ok := internals.(reflectInternals); ok {
+		return reflectInternalsID
+	}
+	return layoutInternalsID
+}
+
+// layoutsMatch probes layouts that layoutInternals relies on using values with known content.
+func layoutsMatch() (matched bool) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			matched = false
+		}
+	}()
+	type probe struct {
+		number  int
+		pointer *int
+		values  map[string]int
+	}
+	number := 42
+	var boxed interface{} = &number
+	probes := [1]probe{{number: number, pointer: &number, values: map[string]int{"key": number}}}
+	// fields of array items of non-addressable array are neither addressable nor interfaceable
+	probeValue := reflect.ValueOf(probes).Index(0)
+	layout := layoutInternals{}
+	numberBytes := layout.valueBytes(reflect.ValueOf(&number).Elem())
+	probeBytes := layout.sequenceBytes(reflect.ValueOf("probe"))
+	boxedProbe := (*probe)(layout.boxedData(probeValue))
+	return uintptr(unsafe.Pointer(&numberBytes[0])) == uintptr(unsafe.Pointer(&number)) &&
+		len(numberBytes) == int(unsafe.Sizeof(number)) &&
+		string(probeBytes) == "probe" &&
+		boxedProbe.number == number && boxedProbe.pointer == &number &&
+		layout.interfaceData(reflect.ValueOf(&boxed).Elem()) == unsafe.Pointer(&number) &&
+		layout.typeIdentity(reflect.TypeOf(number)) == layout.typeIdentity(reflect.TypeOf(0)) &&
+		layout.typeIdentity(reflect.TypeOf(number)) != layout.typeIdentity(reflect.TypeOf("")) &&
+		layout.accessibleValue(probeValue.Field(0)).Interface() == number &&
+		layout.accessibleValue(probeValue.Field(1)).Interface() == &number &&
+		layout.mapValueAt(probeValue.Field(2), new(unsafe.Pointer)).MapIndex(reflect.ValueOf("key")).Interface() == number
+}
+
+// bytesAt returns view of size bytes of memory starting at pointer.
+func bytesAt(pointer unsafe.Pointer, size uintptr) []byte {
+	if size == 0 {
+		return nil
+	}
+	return unsafe.Slice((*byte)(pointer), size)
+}
@@ -0,0 +1,17 @@
+//go:build !go1.20
+// +build !go1.20
+
+package immcheck
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// goVersionShim names the Go version shim immcheck is built with, see immcheck.BuildInfo.
+const goVersionShim = "go1.18"
+
+// stringData returns pointer to bytes of s.
+func stringData(s string) unsafe.Pointer {
+	return unsafe.Pointer((*reflect.StringHeader)(unsafe.Pointer(&s)).Data)
+}
@@ -0,0 +1,7 @@
+//go:build !go1.28
+// +build !go1.28
+
+package immcheck
+
+// layoutsKnown reports whether layouts that layoutInternals relies on are verified for the Go version.
+const layoutsKnown = true
@@ -0,0 +1,74 @@
+package immcheck
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// layoutInternals implements runtimeInternals using memory layouts of Go runtime and reflect.
+type layoutInternals struct{}
+
+// reflectValueHeader mirrors memory layout of reflect.Value.
+type reflectValueHeader struct {
+	typ  unsafe.Pointer
+	ptr  unsafe.Pointer
+	flag uintptr
+}
+
+// reflectFlagIndir mirrors reflect.flagIndir: ptr of reflect.Value holds pointer to the data instead of the data.
+const reflectFlagIndir = 1 << 7
+
+func (layoutInternals) valueBytes(value reflect.Value) []byte {
+	return bytesAt(pointerOfValue(value, layoutInternals{}), value.Type().Size())
+}
+
+func (layoutInternals) sequenceBytes(value reflect.Value) []byte {
+	valueSizeInBytes := uintptr(0)
+	if value.Len() != 0 {
+		valueSizeInBytes = value.Index(0).Type().Size()
+	}
+	return bytesAt(pointerOfValue(value, layoutInternals{}), uintptr(value.Len())*valueSizeInBytes)
+}
+
+//go:nocheckptr
+func (layoutInternals) boxedData(value reflect.Value) unsafe.Pointer {
+	vI := value.Interface()
+	return (*[2]unsafe.Pointer)(unsafe.Pointer(&vI))[1]
+}
+
+func (l layoutInternals) interfaceData(value reflect.Value) unsafe.Pointer {
+	if value.CanAddr() {
+		return (*[2]unsafe.Pointer)(unsafe.Pointer(value.UnsafeAddr()))[1]
+	}
+	if value.CanInterface() {
+		return l.boxedData(value)
+	}
+	return pointerOfValue(value, l)
+}
+
+func (layoutInternals) typeIdentity(t reflect.Type) uintptr {
+	return uintptr((*[2]unsafe.Pointer)(unsafe.Pointer(&t))[1])
+}
+
+// accessibleValue views addressable values through their addresses,
+// other values are viewed through data pointers of reflect.Value found using its layout.
+func (layoutInternals) accessibleValue(value reflect.Value) reflect.Value {
+	if value.CanAddr() {
+		return reflect.NewAt(value.Type(), unsafe.Pointer(value.UnsafeAddr())).Elem()
+	}
+	header := (*reflectValueHeader)(unsafe.Pointer(&value))
+	dataPointer := header.ptr
+	if header.flag&reflectFlagIndir == 0 {
+		// pointer-shaped value is stored in reflect.Value itself, so it is copied
+		copied := new(unsafe.Pointer)
+		*copied = header.ptr
+		dataPointer = unsafe.Pointer(copied)
+	}
+	return reflect.NewAt(value.Type(), dataPointer).Elem()
+}
+
+func (layoutInternals) mapValueAt(value reflect.Value, slot *unsafe.Pointer) reflect.Value {
+	// map value is just a pointer to the map header, so we can re-create it from the pointer
+	*slot = unsafe.Pointer(value.Pointer())
+	return reflect.NewAt(value.Type(), unsafe.Pointer(slot)).Elem()
+}
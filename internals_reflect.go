@@ -0,0 +1,159 @@
+package immcheck
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// reflectInternals implements runtimeInternals using only reflect API and pointers obtained from it.
+// Values that are neither addressable nor references are copied, so capture is slower,
+// and boxed values of interfaces have no identity, so re-boxing of equal value into interface isn't a mutation.
+// Values that are neither addressable nor interfaceable are copied field by field if copyReadOnly is set,
+// see AllowUnexportedAccess flag, maps, channels and functions of such values can't be copied.
+// Maps that are neither addressable nor interfaceable, like maps of unexported fields of structs passed by value,
+// can be captured only using AllowUnexportedAccess flag, since their entries are such values as well.
+type reflectInternals struct {
+	copyReadOnly bool
+}
+
+//nolint:gochecknoglobals // typeIdentities are global to keep identities of types stable within the process
+var typeIdentities = &sync.Map{} // reflect.Type -> uintptr
+
+//nolint:gochecknoglobals // lastTypeIdentity is global to keep identities of types unique within the process
+var lastTypeIdentity uintptr
+
+func (r reflectInternals) valueBytes(value reflect.Value) []byte {
+	return bytesAt(r.addressOf(value), value.Type().Size())
+}
+
+func (r reflectInternals) sequenceBytes(value reflect.Value) []byte {
+	if value.Kind() == reflect.String {
+		return bytesAt(stringData(value.String()), uintptr(value.Len()))
+	}
+	itemsSize := uintptr(value.Len()) * value.Type().Elem().Size()
+	if value.Kind() == reflect.Slice {
+		return bytesAt(unsafe.Pointer(value.Pointer()), itemsSize)
+	}
+	return bytesAt(r.addressOf(value), itemsSize)
+}
+
+func (reflectInternals) boxedData(value reflect.Value) unsafe.Pointer {
+	return nil
+}
+
+func (reflectInternals) interfaceData(value reflect.Value) unsafe.Pointer {
+	if value.IsNil() {
+		return nil
+	}
+	if elem := value.Elem(); isReferenceKind(elem.Kind()) {
+		return unsafe.Pointer(elem.Pointer())
+	}
+	return nil
+}
+
+// isReferenceKind reports whether values of kind are pointers, so interfaces hold them as is.
+func isReferenceKind(kind reflect.Kind) bool {
+	//nolint:exhaustive
+	switch kind {
+	case reflect.Chan, reflect.Func, reflect.Map, reflect.Ptr, reflect.UnsafePointer:
+		return true
+	}
+	return false
+}
+
+func (reflectInternals) typeIdentity(t reflect.Type) uintptr {
+	if identity, ok := typeIdentities.Load(t); ok {
+		return identity.(uintptr)
+	}
+	identity, _ := typeIdentities.LoadOrStore(t, atomic.AddUintptr(&lastTypeIdentity, 1))
+	return identity.(uintptr)
+}
+
+func (reflectInternals) accessibleValue(value reflect.Value) reflect.Value {
+	if value.CanAddr() {
+		return reflect.NewAt(value.Type(), unsafe.Pointer(value.UnsafeAddr())).Elem()
+	}
+	return value
+}
+
+func (reflectInternals) mapValueAt(value reflect.Value, _ *unsafe.Pointer) reflect.Value {
+	if value.CanAddr() {
+		return reflect.NewAt(value.Type(), unsafe.Pointer(value.UnsafeAddr())).Elem()
+	}
+	// entries of read-only map are captured without viewing it as exported, see perEntrySnapshot
+	return value
+}
+
+// addressOf returns address of value, values that aren't addressable are copied.
+func (r reflectInternals) addressOf(value reflect.Value) unsafe.Pointer {
+	if value.CanAddr() {
+		return unsafe.Pointer(value.UnsafeAddr())
+	}
+	if !value.CanInterface() && !r.copyReadOnly {
+		panic(unaddressableValueError(value))
+	}
+	return unsafe.Pointer(copyOf(value).Pointer())
+}
+
+// copyOf returns pointer to copy of value.
+func copyOf(value reflect.Value) reflect.Value {
+	copied := reflect.New(value.Type())
+	if value.CanInterface() {
+		copied.Elem().Set(value)
+	} else {
+		copyReadOnly(copied.Elem(), value)
+	}
+	return copied
+}
+
+// copyReadOnly copies src that can't be used with Value.Set into addressable dst.
+func copyReadOnly(dst reflect.Value, src reflect.Value) {
+	// unexported parts of addressable dst are settable through their addresses
+	dst = reflect.NewAt(dst.Type(), unsafe.Pointer(dst.UnsafeAddr())).Elem()
+	switch src.Kind() {
+	case reflect.Bool:
+		dst.SetBool(src.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		dst.SetInt(src.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		dst.SetUint(src.Uint())
+	case reflect.Float32, reflect.Float64:
+		dst.SetFloat(src.Float())
+	case reflect.Complex64, reflect.Complex128:
+		dst.SetComplex(src.Complex())
+	case reflect.String:
+		dst.SetString(src.String())
+	case reflect.UnsafePointer:
+		dst.SetPointer(unsafe.Pointer(src.Pointer()))
+	case reflect.Ptr:
+		if !src.IsNil() {
+			dst.Set(reflect.NewAt(src.Type().Elem(), unsafe.Pointer(src.Pointer())))
+		}
+	case reflect.Slice:
+		if !src.IsNil() {
+			backingArray := reflect.NewAt(reflect.ArrayOf(src.Cap(), src.Type().Elem()), unsafe.Pointer(src.Pointer()))
+			dst.Set(backingArray.Elem().Slice3(0, src.Len(), src.Cap()))
+		}
+	case reflect.Interface:
+		// boxed values can't be shared without layouts, so interfaces of copies are left nil
+		// unless they hold references, contents of interfaces are captured separately anyway
+		if !src.IsNil() && isReferenceKind(src.Elem().Kind()) {
+			elem := reflect.New(src.Elem().Type()).Elem()
+			copyReadOnly(elem, src.Elem())
+			dst.Set(elem)
+		}
+	case reflect.Struct:
+		numField := src.NumField()
+		for i := 0; i < numField; i++ {
+			copyReadOnly(dst.Field(i), src.Field(i))
+		}
+	case reflect.Array:
+		for i := 0; i < src.Len(); i++ {
+			copyReadOnly(dst.Index(i), src.Index(i))
+		}
+	case reflect.Map, reflect.Chan, reflect.Func, reflect.Invalid:
+		panic(unaddressableValueError(src))
+	}
+}
@@ -0,0 +1,142 @@
+package immcheck_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+type reflectInternalsTarget struct {
+	name    string
+	items   []int
+	boxed   interface{}
+	lookup  map[string]*int
+	pointer *reflectInternalsTarget
+}
+
+func TestReflectInternalsToggle(t *testing.T) {
+	// toggles are process-wide, so the test isn't parallel
+	defer func() {
+		if err := immcheck.SetRuntimeToggles(""); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	if report := immcheck.SelfTest(); report.Internals != "layout" {
+		t.Fatalf("layouts aren't used by default:\n%v", report)
+	}
+
+	if err := immcheck.SetRuntimeToggles("internals=reflect"); err != nil {
+		t.Fatal(err)
+	}
+	report := immcheck.SelfTest()
+	if !report.Passed() || !strings.Contains(report.String(), "using reflect internals") {
+		t.Fatalf("self-test failed:\n%v", report)
+	}
+	counter := 1
+	target := reflectInternalsTarget{
+		name: "target", items: []int{1, 2}, boxed: [2]int{3, 4}, lookup: map[string]*int{"counter": &counter},
+	}
+	target.pointer = &target
+	// values boxed into unexported fields are copied field by field
+	options := immcheck.Options{Flags: immcheck.AllowUnexportedAccess | immcheck.SkipLoggingOnMutation}
+	immcheck.EnsureImmutabilityWithOptions(target, options)()
+	immcheck.EnsureImmutabilityWithOptions(&target, options)()
+	expectMutationPanic(t, func() {
+		defer immcheck.EnsureImmutabilityWithOptions(target, options)()
+		target.items[1] = 3
+	})
+	expectMutationPanic(t, func() {
+		defer immcheck.EnsureImmutabilityWithOptions(&target, options)()
+		counter = 2
+	})
+	expectPanic(t, func() {
+		immcheck.EnsureImmutability(&target)
+	}, immcheck.UnsupportedTypeError)
+
+	err := immcheck.SetRuntimeToggles("internals=unsafe")
+	if !errors.Is(err, immcheck.MalformedTogglesError) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestInternalsToggleDuringGuard(t *testing.T) {
+	// toggles are process-wide, so the test isn't parallel
+	defer func() {
+		if err := immcheck.SetRuntimeToggles(""); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	counter := 1
+	target := &reflectInternalsTarget{
+		name: "target", items: []int{1, 2}, boxed: [2]int{3, 4}, lookup: map[string]*int{"counter": &counter},
+	}
+	options := immcheck.Options{Flags: immcheck.AllowUnexportedAccess}
+	for _, toggle := range []string{"internals=reflect", "internals=layout", "internals=auto"} {
+		// guards armed before toggle is changed are verified using internals of their baselines
+		check := immcheck.EnsureImmutabilityWithOptions(target, options)
+		if err := immcheck.SetRuntimeToggles(toggle); err != nil {
+			t.Fatal(err)
+		}
+		check()
+	}
+	expectMutationPanic(t, func() {
+		defer immcheck.EnsureImmutabilityWithOptions(target, options)()
+		if err := immcheck.SetRuntimeToggles("internals=reflect"); err != nil {
+			t.Fatal(err)
+		}
+		counter = 2
+	})
+}
+
+func TestSafeMode(t *testing.T) {
+	t.Parallel()
+	counter := 1
+	target := &reflectInternalsTarget{
+		name: "target", items: []int{1, 2}, boxed: [2]int{3, 4}, lookup: map[string]*int{"counter": &counter},
+	}
+	target.pointer = target
+	options := immcheck.Options{Flags: immcheck.AllowUnexportedAccess | immcheck.SkipLoggingOnMutation, SafeMode: true}
+	immcheck.EnsureImmutabilityWithOptions(target, options)()
+	expectMutationPanic(t, func() {
+		defer immcheck.EnsureImmutabilityWithOptions(target, options)()
+		target.boxed = [2]int{3, 5}
+	})
+	expectMutationPanic(t, func() {
+		defer immcheck.EnsureImmutabilityWithOptions(target, options)()
+		counter = 2
+	})
+
+	// safe captures agree with captures that rely on layouts about values that don't re-box interfaces
+	safeSnapshot := immcheck.NewValueSnapshot()
+	immcheck.CaptureSnapshotWithOptions(target, safeSnapshot, options)
+	options.SafeMode = false
+	layoutSnapshot := immcheck.NewValueSnapshot()
+	immcheck.CaptureSnapshotWithOptions(target, layoutSnapshot, options)
+	safeVerified, safeTotal, _ := safeSnapshot.Coverage()
+	layoutVerified, layoutTotal, _ := layoutSnapshot.Coverage()
+	if safeVerified != layoutVerified || safeTotal != layoutTotal {
+		t.Fatalf("coverage differs: %v/%v != %v/%v", safeVerified, safeTotal, layoutVerified, layoutTotal)
+	}
+	// checksums of references depend on internals, so such snapshots can't be compared even after a round trip
+	if err := safeSnapshot.CheckImmutabilityAgainst(layoutSnapshot); !errors.Is(err, immcheck.IncompatibleSnapshotError) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	safeData, err := safeSnapshot.MarshalBinary()
+	if err != nil {
+		t.Fatalf("unexpected error happened: %v", err)
+	}
+	restoredSnapshot := immcheck.NewValueSnapshot()
+	if err := restoredSnapshot.UnmarshalBinary(safeData); err != nil {
+		t.Fatalf("unexpected error happened: %v", err)
+	}
+	err = restoredSnapshot.CheckImmutabilityAgainst(layoutSnapshot)
+	if !errors.Is(err, immcheck.IncompatibleSnapshotError) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if merged := immcheck.MergeOptions(immcheck.Options{SafeMode: true}, immcheck.Options{}); !merged.SafeMode {
+		t.Fatal("safe mode of defaults isn't kept")
+	}
+}
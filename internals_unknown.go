@@ -0,0 +1,8 @@
+//go:build go1.28
+// +build go1.28
+
+package immcheck
+
+// layoutsKnown reports whether layouts that layoutInternals relies on are verified for the Go version.
+// Layouts of Go versions released after immcheck are probed at init, see layoutsMatch.
+const layoutsKnown = false
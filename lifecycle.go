@@ -0,0 +1,106 @@
+package immcheck
+
+import "sync/atomic"
+
+// GuardEvent is a lifecycle event of a guard created by immcheck.EnsureImmutability,
+// immcheck.CheckImmutabilityOnFinalization or their variants.
+type GuardEvent uint8
+
+const (
+	// GuardCreated means that baseline snapshot of guarded value was captured.
+	GuardCreated GuardEvent = iota + 1
+	// GuardVerified means that guarded value was verified and no mutation was found.
+	GuardVerified
+	// GuardMutationDetected means that guarded value was verified and mutation was found.
+	GuardMutationDetected
+	// GuardCancelled means that guard was garbage collected without being verified.
+	GuardCancelled
+)
+
+//nolint:gochecknoglobals // guardEventNames is effectively a constant
+var guardEventNames = [...]string{
+	GuardCreated:          "created",
+	GuardVerified:         "verified",
+	GuardMutationDetected: "mutation_detected",
+	GuardCancelled:        "cancelled",
+}
+
+// String returns machine-readable name of the event, like "mutation_detected".
+func (e GuardEvent) String() string {
+	if int(e) < len(guardEventNames) && guardEventNames[e] != "" {
+		return guardEventNames[e]
+	}
+	return "unknown"
+}
+
+// GuardLifecycleEvent describes lifecycle event of a single guard.
+type GuardLifecycleEvent struct {
+	Event GuardEvent
+	// GuardID identifies guard within the process, all events of the same guard have the same GuardID.
+	GuardID uint64
+	// Label is Options.Label of the guard.
+	Label string
+	// Origin is origin of baseline snapshot of the guard. It is zero with SkipOriginCapturing flag.
+	Origin OriginID
+	// Err is the detected mutation, it is set only for GuardMutationDetected events.
+	Err error
+}
+
+// LifecycleReporter is a Reporter that also receives lifecycle events of guards configured with it,
+// so debug UIs or logs can render a timeline of guard activity, like guards of a single request.
+// Options.Reporter receives lifecycle events only if it implements LifecycleReporter.
+// Detected mutations are passed to ReportMutation as usual after GuardMutationDetected event.
+// Events are emitted on goroutines that verify guards, including finalizer goroutines,
+// so implementations should be safe for concurrent use.
+type LifecycleReporter interface {
+	Reporter
+	ReportLifecycle(event GuardLifecycleEvent)
+}
+
+//nolint:gochecknoglobals // lastGuardID is global to identify guards within the process
+var lastGuardID uint64
+
+// guardLifecycle emits lifecycle events of one guard, it is no-op unless Options.Reporter is LifecycleReporter.
+type guardLifecycle struct {
+	reporter LifecycleReporter
+	guardID  uint64
+	label    string
+	origin   OriginID
+}
+
+func newGuardLifecycle(snapshot *ValueSnapshot, options Options) guardLifecycle {
+	reporter, ok := options.Reporter.(LifecycleReporter)
+	if !ok {
+		return guardLifecycle{}
+	}
+	lifecycle := guardLifecycle{
+		reporter: reporter,
+		guardID:  atomic.AddUint64(&lastGuardID, 1),
+		label:    options.Label,
+		origin:   snapshot.captureOrigin,
+	}
+	lifecycle.emit(GuardCreated, nil)
+	return lifecycle
+}
+
+// verified emits GuardVerified or GuardMutationDetected event depending on checkErr.
+func (l guardLifecycle) verified(checkErr error) {
+	if checkErr != nil {
+		l.emit(GuardMutationDetected, checkErr)
+		return
+	}
+	l.emit(GuardVerified, nil)
+}
+
+func (l guardLifecycle) emit(event GuardEvent, err error) {
+	if l.reporter == nil {
+		return
+	}
+	l.reporter.ReportLifecycle(GuardLifecycleEvent{
+		Event:   event,
+		GuardID: l.guardID,
+		Label:   l.label,
+		Origin:  l.origin,
+		Err:     err,
+	})
+}
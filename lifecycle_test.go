@@ -0,0 +1,88 @@
+package immcheck_test
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+type lifecycleRecorder struct {
+	mutex  sync.Mutex
+	events []immcheck.GuardLifecycleEvent
+	errs   []error
+}
+
+func (r *lifecycleRecorder) ReportMutation(err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.errs = append(r.errs, err)
+}
+
+func (r *lifecycleRecorder) ReportLifecycle(event immcheck.GuardLifecycleEvent) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *lifecycleRecorder) eventNames() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	names := make([]string, 0, len(r.events))
+	for _, event := range r.events {
+		names = append(names, event.Event.String())
+	}
+	return names
+}
+
+func TestGuardLifecycleEvents(t *testing.T) {
+	t.Parallel()
+	recorder := &lifecycleRecorder{}
+	options := immcheck.Options{Reporter: recorder, Label: "request"}
+	counter := 1
+	immcheck.EnsureImmutabilityWithOptions(&counter, options)()
+	func() {
+		defer immcheck.EnsureImmutabilityWithOptions(&counter, options)()
+		counter++
+	}()
+
+	expectEvents(t, recorder.eventNames(), "created", "verified", "created", "mutation_detected")
+	if recorder.events[0].GuardID == recorder.events[2].GuardID ||
+		recorder.events[2].GuardID != recorder.events[3].GuardID {
+		t.Fatalf("unexpected guard ids: %+v", recorder.events)
+	}
+	if recorder.events[0].Label != "request" || recorder.events[0].Origin == 0 {
+		t.Fatalf("guard isn't described: %+v", recorder.events[0])
+	}
+	var mutationErr *immcheck.MutationError
+	if !errors.As(recorder.events[3].Err, &mutationErr) || len(recorder.errs) != 1 {
+		t.Fatalf("mutation isn't reported: %+v, %v", recorder.events[3], recorder.errs)
+	}
+}
+
+func TestGuardLifecycleCancelledEvent(t *testing.T) {
+	t.Parallel()
+	recorder := &lifecycleRecorder{}
+	value := []int{1, 2, 3}
+	_ = immcheck.EnsureImmutabilityWithOptions(&value, immcheck.Options{Reporter: recorder})
+	for i := 0; i < 10 && len(recorder.eventNames()) < 2; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	expectEvents(t, recorder.eventNames(), "created", "cancelled")
+}
+
+func expectEvents(t *testing.T, actual []string, expected ...string) {
+	t.Helper()
+	if len(actual) != len(expected) {
+		t.Fatalf("unexpected events: %v, expected: %v", actual, expected)
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Fatalf("unexpected events: %v, expected: %v", actual, expected)
+		}
+	}
+}
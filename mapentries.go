@@ -0,0 +1,128 @@
+package immcheck
+
+import (
+	"encoding/binary"
+	"reflect"
+	"sort"
+	"unsafe"
+
+	"github.com/zeebo/xxh3"
+)
+
+// captureSortedMap captures map with CompareByValue flag.
+// Every entry is captured into a scratch snapshot and reduced to a 64-bit digest, digests are sorted and folded
+// into a single checksum of the map, so snapshot doesn't depend on iteration order of the map or on its address.
+// Unlike insertion of checksums of entries into snapshot checksums, where of two colliding checksums
+// the one inserted last wins, entries with equal digests are folded as many times as they occur.
+// Entries see only references visited before the map, so references shared between entries
+// are captured within every entry that reaches them.
+func captureSortedMap(
+	snapshot *ValueSnapshot,
+	value reflect.Value, valuePointer unsafe.Pointer,
+	options Options,
+) *ValueSnapshot {
+	valueKind := value.Kind()
+	contentBefore := snapshot.contentDigest
+	// detect ref loop and skip
+	detectRefLoop := options.Flags&doNotDetectRefLoop == 0
+	reference := visitedReference{pointer: uintptr(valuePointer), kind: valueKind, valueType: value.Type()}
+	if detectRefLoop {
+		if content, entered := snapshot.enterReference(reference); !entered {
+			return snapshot.bindContent(content, valueKind)
+		}
+	}
+	snapshot.entries += value.Len()
+	const fnvPrime32 = 16777619
+	snapshot.contentDigest += evalKey32(uint32(value.Len())*fnvPrime32, valueKind)
+
+	inherited := snapshot.inheritedReferences
+	if len(snapshot.visitedReferences) != 0 {
+		inherited = append(inherited[:len(inherited):len(inherited)], snapshot.visitedReferences)
+	}
+	entry := newValueSnapshot()
+	visitedByEntries := make(map[visitedReference]uint32)
+	digests := make([]uint64, 0, value.Len())
+	buffers := &entryDigestBuffers{}
+	// map can reference itself in value, so we set doNotDetectRefLoop
+	entryOptions := withFlags(options, options.Flags|doNotDetectRefLoop)
+	iterator := exportedMapValue(value, internalsOf(options)).MapRange()
+	for iterator.Next() {
+		entry.Reset()
+		// entry describes the same root, so it doesn't render it again
+		entry.rootType = snapshot.rootType
+		entry.inheritedReferences = inherited
+		entry.memoryRegions = snapshot.memoryRegions
+		entry = captureMapKey(entry, iterator.Key(), 0, options)
+		entry = captureChecksumMap(entry, iterator.Value(), entryOptions)
+		digests = append(digests, entryDigest(entry, buffers))
+		snapshot = mergeEntrySnapshot(snapshot, entry)
+		for reference, content := range entry.visitedReferences {
+			visitedByEntries[reference] = content
+		}
+	}
+	for reference, content := range visitedByEntries {
+		if _, entered := snapshot.enterReference(reference); entered {
+			snapshot.visitedReferences[reference] = content
+		}
+	}
+
+	sort.Slice(digests, func(i, j int) bool {
+		return digests[i] < digests[j]
+	})
+	hasher := xxh3.New()
+	var digestBytes [8]byte
+	for _, digest := range digests {
+		binary.LittleEndian.PutUint64(digestBytes[:], digest)
+		_, _ = hasher.Write(digestBytes[:])
+	}
+	mapChecksum := hasher.Sum64()
+	snapshot.checksums[evalKey32(uint32(mapChecksum), valueKind)] = uint32(mapChecksum >> 32)
+	snapshot.contentDigest += uint32(mapChecksum)
+	content := snapshot.contentDigest - contentBefore
+	if detectRefLoop {
+		snapshot.visitedReferences[reference] = content
+	}
+	return snapshot.bindContent(content, valueKind)
+}
+
+// entryDigestBuffers are re-used by entryDigest for all entries of the same map.
+type entryDigestBuffers struct {
+	keys   []uint32
+	digest []byte
+}
+
+// entryDigest reduces snapshot of map entry to 64-bit digest that doesn't depend on order of its checksums.
+func entryDigest(entry *ValueSnapshot, buffers *entryDigestBuffers) uint64 {
+	keys := buffers.keys[:0]
+	for key := range entry.checksums {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	digest := buffers.digest[:0]
+	digest = appendUint32(digest, entry.mapKeySet)
+	digest = appendUint32(digest, entry.stringIdentities)
+	digest = appendUint32(digest, uint32(entry.nilReferences))
+	digest = appendUint32(digest, uint32(entry.sequenceLengths))
+	for _, key := range keys {
+		digest = appendUint32(digest, key)
+		digest = appendUint32(digest, entry.checksums[key])
+	}
+	buffers.keys, buffers.digest = keys, digest
+	return xxh3.Hash(digest)
+}
+
+// mergeEntrySnapshot adds order independent folds and counters of entry snapshot to snapshot of the map.
+func mergeEntrySnapshot(snapshot *ValueSnapshot, entry *ValueSnapshot) *ValueSnapshot {
+	snapshot.stringIdentities += entry.stringIdentities
+	snapshot.contentDigest += entry.contentDigest
+	snapshot.mapKeySet += entry.mapKeySet
+	snapshot.capturedBytes += entry.capturedBytes
+	snapshot.nilReferences += entry.nilReferences
+	snapshot.sequenceLengths += entry.sequenceLengths
+	snapshot.entries += entry.entries
+	snapshot.nodes += entry.nodes
+	snapshot.unverifiedNodes += entry.unverifiedNodes
+	snapshot.ignoredFields += entry.ignoredFields
+	snapshot.ignoredBytes += entry.ignoredBytes
+	return snapshot
+}
@@ -0,0 +1,73 @@
+package immcheck
+
+import (
+	"reflect"
+
+	"github.com/zeebo/xxh3"
+)
+
+// Semantics of map keys:
+// map keys are identified the same way as Go compares them with ==, so strings are identified by content,
+// pointers by address and interfaces by dynamic type and value.
+// Adding, removing or replacing keys is reported as key set change (MutationError.KeySetChanged),
+// while mutation of data reachable through pointer keys doesn't change key identity
+// and is reported as regular content change.
+
+// captureMapKey captures identity of map key into the snapshot key set and content of the key into checksums.
+// Key identity is fully described by the key set, so references inside keys are captured by content,
+// otherwise equal keys re-boxed into interfaces on re-insertion would be reported as content change.
+// Entries are captured in iteration order of the map, which is random, so positions of content captured
+// within the entry are derived from scope, the position of the map, and the key, see bindContent.
+func captureMapKey(snapshot *ValueSnapshot, key reflect.Value, scope uint32, options Options) *ValueSnapshot {
+	identity := uint32(mapKeyIdentity(key, options))
+	snapshot.mapKeySet += identity
+	const fnvPrime32 = 16777619
+	snapshot.contentPosition = scope ^ identity*fnvPrime32
+	// map cannot be a key in map
+	return captureChecksumMap(snapshot, key, withFlags(options, options.Flags|CompareReferencesByContent))
+}
+
+// mapKeyIdentity hashes key consistently with == operator.
+func mapKeyIdentity(key reflect.Value, options Options) uint64 {
+	const prime = 1099511628211
+	//nolint:exhaustive
+	switch key.Kind() {
+	case reflect.String:
+		return xxh3.HashString(key.String()) ^ uint64(reflect.String)
+	case reflect.Ptr, reflect.Chan, reflect.UnsafePointer:
+		return uint64(key.Pointer())*prime ^ uint64(key.Kind())
+	case reflect.Interface:
+		if key.IsNil() {
+			return uint64(reflect.Interface)
+		}
+		elem := key.Elem()
+		typeIdentity := internalsOf(options).typeIdentity(elem.Type())
+		return (uint64(typeIdentity)*prime ^ mapKeyIdentity(elem, options)) * prime
+	case reflect.Struct:
+		result := uint64(reflect.Struct)
+		numField := key.NumField()
+		for i := 0; i < numField; i++ {
+			result = (result ^ mapKeyIdentity(key.Field(i), options)) * prime
+		}
+		return result
+	case reflect.Array:
+		result := uint64(reflect.Array)
+		arrayLen := key.Len()
+		for i := 0; i < arrayLen; i++ {
+			result = (result ^ mapKeyIdentity(key.Index(i), options)) * prime
+		}
+		return result
+	default:
+		return xxh3.Hash(convertValueTypeToBytesSlice(key, options)) ^ uint64(key.Kind())
+	}
+}
+
+// mapKeyLess orders keys of the same map by their formatted representations.
+// Distinct keys formatted the same way, like pointers to equal values, are ordered by their identities,
+// so walks over the same map visit its entries in the same order.
+func mapKeyLess(a reflect.Value, formattedA string, b reflect.Value, formattedB string, options Options) bool {
+	if formattedA != formattedB {
+		return formattedA < formattedB
+	}
+	return mapKeyIdentity(a, options) < mapKeyIdentity(b, options)
+}
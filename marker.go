@@ -0,0 +1,156 @@
+package immcheck
+
+import (
+	"reflect"
+	"sync"
+	"unsafe"
+)
+
+// Immutable is a zero-size marker that type authors embed into their struct types to declare them immutable,
+// so values of such types are guarded by immcheck.GuardMarked wherever they are used:
+//
+//	type Config struct {
+//		immcheck.Immutable
+//		Endpoints []string
+//	}
+//
+// Embed it as the first field: zero-size field at the end of a struct makes Go add padding.
+type Immutable struct{}
+
+//nolint:gochecknoglobals // immutableMarkerType is effectively a constant
+var immutableMarkerType = reflect.TypeOf(Immutable{})
+
+// GuardMarked scans v for addressable values of struct types that embed immcheck.Immutable,
+// reachable through pointers, interfaces, fields, slices, arrays and map values,
+// and captures them according to settings specified in options.
+// Returned function verifies that none of marked values was mutated, v itself and its other parts may be mutable.
+// Values are scanned only once, so marked values added to v later aren't guarded.
+// Marked values that are reachable only from other marked values are guarded as part of them.
+// Returns immcheck.NoopCheck if v holds no marked values.
+func GuardMarked(v interface{}, options Options) func() {
+	if v == nil {
+		return NoopCheck
+	}
+	scanner := &markerScanner{visited: make(map[visitedReference]struct{})}
+	scanner.scan(reflect.ValueOf(v))
+	if len(scanner.marked) == 0 {
+		return NoopCheck
+	}
+	// marked values are captured as a slice of pointers, so they are verified together
+	return ensureImmutability(scanner.marked, options)
+}
+
+// markerScanner collects pointers to marked values.
+type markerScanner struct {
+	visited map[visitedReference]struct{}
+	marked  []interface{}
+}
+
+func (s *markerScanner) scan(value reflect.Value) {
+	if !value.IsValid() || !typeMayContainMarker(value.Type()) {
+		return
+	}
+	//nolint:exhaustive
+	switch value.Kind() {
+	case reflect.Ptr:
+		if value.IsNil() || !s.enter(value) {
+			return
+		}
+		s.scan(value.Elem())
+	case reflect.Interface:
+		if !value.IsNil() {
+			s.scan(value.Elem())
+		}
+	case reflect.Struct:
+		if typeIsMarked(value.Type()) {
+			if value.CanAddr() {
+				marked := reflect.NewAt(value.Type(), unsafe.Pointer(value.UnsafeAddr()))
+				s.marked = append(s.marked, marked.Interface())
+			}
+			return
+		}
+		numField := value.NumField()
+		for i := 0; i < numField; i++ {
+			s.scan(value.Field(i))
+		}
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && (value.Len() == 0 || !s.enter(value)) {
+			return
+		}
+		for i := 0; i < value.Len(); i++ {
+			s.scan(value.Index(i))
+		}
+	case reflect.Map:
+		if value.IsNil() || !s.enter(value) {
+			return
+		}
+		// map values aren't addressable, so only marked values referenced by pointers are found
+		iterator := value.MapRange()
+		for iterator.Next() {
+			s.scan(iterator.Value())
+		}
+	}
+}
+
+// enter reports whether reference is visited for the first time.
+func (s *markerScanner) enter(value reflect.Value) bool {
+	key := visitedReference{pointer: uintptr(pointerOfValue(value, currentInternals())), kind: value.Kind()}
+	if _, visited := s.visited[key]; visited {
+		return false
+	}
+	s.visited[key] = struct{}{}
+	return true
+}
+
+// typeIsMarked reports whether struct type t embeds immcheck.Immutable.
+func typeIsMarked(t reflect.Type) bool {
+	numField := t.NumField()
+	for i := 0; i < numField; i++ {
+		if field := t.Field(i); field.Anonymous && field.Type == immutableMarkerType {
+			return true
+		}
+	}
+	return false
+}
+
+//nolint:gochecknoglobals // markerTypesCache is global to share results of type analysis between scans
+var markerTypesCache = &sync.Map{} // reflect.Type -> bool
+
+// typeMayContainMarker reports whether values of type t can reach marked values.
+func typeMayContainMarker(t reflect.Type) bool {
+	if mayContain, ok := markerTypesCache.Load(t); ok {
+		return mayContain.(bool)
+	}
+	mayContain := typeReachesMarker(t, make(map[reflect.Type]struct{}))
+	markerTypesCache.Store(t, mayContain)
+	return mayContain
+}
+
+func typeReachesMarker(t reflect.Type, visiting map[reflect.Type]struct{}) bool {
+	if _, ok := visiting[t]; ok {
+		// recursive type reaches marker only through its other parts
+		return false
+	}
+	visiting[t] = struct{}{}
+	defer delete(visiting, t)
+	//nolint:exhaustive
+	switch t.Kind() {
+	case reflect.Interface:
+		return true
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return typeReachesMarker(t.Elem(), visiting)
+	case reflect.Map:
+		return typeReachesMarker(t.Elem(), visiting)
+	case reflect.Struct:
+		if typeIsMarked(t) {
+			return true
+		}
+		numField := t.NumField()
+		for i := 0; i < numField; i++ {
+			if typeReachesMarker(t.Field(i).Type, visiting) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package immcheck_test
+
+import (
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+type markedConfig struct {
+	immcheck.Immutable
+	Endpoints []string
+}
+
+type markedService struct {
+	Name     string
+	Config   markedConfig
+	Shared   *markedConfig
+	Replicas []markedConfig
+	Lookup   map[string]*markedConfig
+	Any      interface{}
+}
+
+func TestGuardMarked(t *testing.T) {
+	t.Parallel()
+	if !immcheck.IsNoopCheck(immcheck.GuardMarked(&struct{ Name string }{"plain"}, immcheck.Options{})) {
+		t.Fatal("value without markers isn't skipped")
+	}
+
+	newService := func() *markedService {
+		shared := &markedConfig{Endpoints: []string{"shared"}}
+		return &markedService{
+			Name:     "service",
+			Config:   markedConfig{Endpoints: []string{"a", "b"}},
+			Shared:   shared,
+			Replicas: []markedConfig{{Endpoints: []string{"r1"}}},
+			Lookup:   map[string]*markedConfig{"shared": shared, "other": {Endpoints: []string{"o"}}},
+			Any:      &markedConfig{Endpoints: []string{"any"}},
+		}
+	}
+
+	options := immcheck.Options{Flags: immcheck.SkipLoggingOnMutation}
+	service := newService()
+	check := immcheck.GuardMarked(service, options)
+	service.Name = "renamed"
+	service.Replicas = append(service.Replicas, markedConfig{})
+	check()
+
+	mutations := map[string]func(service *markedService){
+		"field":     func(service *markedService) { service.Config.Endpoints[1] = "c" },
+		"pointer":   func(service *markedService) { service.Shared.Endpoints = nil },
+		"slice":     func(service *markedService) { service.Replicas[0].Endpoints[0] = "r2" },
+		"map value": func(service *markedService) { service.Lookup["other"].Endpoints[0] = "p" },
+		"interface": func(service *markedService) { service.Any.(*markedConfig).Endpoints[0] = "all" },
+	}
+	for name, mutate := range mutations {
+		mutate := mutate
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			service := newService()
+			expectMutationPanic(t, func() {
+				defer immcheck.GuardMarked(service, options)()
+				mutate(service)
+			})
+		})
+	}
+}
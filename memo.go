@@ -0,0 +1,69 @@
+package immcheck
+
+import (
+	"sync"
+)
+
+// Memo is a memoization cache that captures snapshot of every computed value
+// and verifies it on every hit, so callers that mutate shared cached results are caught.
+// Memo is safe for concurrent use.
+type Memo[K comparable, V any] struct {
+	compute func(key K) (V, error)
+	options Options
+
+	m       sync.RWMutex
+	entries map[K]*memoEntry[V]
+}
+
+type memoEntry[V any] struct {
+	value V
+	guard *accessGuard
+}
+
+// NewMemo creates Memo that uses compute to produce values for missing keys.
+// Detected mutations are reported according to options.
+// Values computed while inline checks are switched off by immcheck.SetRuntimeToggles are never verified.
+func NewMemo[K comparable, V any](compute func(key K) (V, error), options Options) *Memo[K, V] {
+	return &Memo[K, V]{
+		compute: compute,
+		options: options,
+		entries: make(map[K]*memoEntry[V]),
+	}
+}
+
+// Get returns cached value for key verifying that it wasn't mutated since it was computed.
+// Missing values are computed and cached. Errors aren't cached.
+// Concurrent misses for the same key may compute value several times, only the first stored value is kept.
+func (m *Memo[K, V]) Get(key K) (V, error) {
+	m.m.RLock()
+	entry, ok := m.entries[key]
+	m.m.RUnlock()
+	if ok {
+		skipThreeFrames := 3
+		entry.guard.onRead(skipThreeFrames)
+		return entry.value, nil
+	}
+
+	value, err := m.compute(key)
+	if err != nil {
+		return value, err
+	}
+	entry = &memoEntry[V]{value: value}
+	skipThreeFrames := 3
+	entry.guard = newAccessGuard(&entry.value, m.options, skipThreeFrames)
+
+	m.m.Lock()
+	defer m.m.Unlock()
+	if existing, ok := m.entries[key]; ok {
+		return existing.value, nil
+	}
+	m.entries[key] = entry
+	return entry.value, nil
+}
+
+// Forget removes cached value for key, so the next Get computes it again.
+func (m *Memo[K, V]) Forget(key K) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	delete(m.entries, key)
+}
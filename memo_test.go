@@ -0,0 +1,49 @@
+package immcheck_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+func TestMemo(t *testing.T) {
+	t.Parallel()
+	computations := 0
+	failure := errors.New("compute failed")
+	memo := immcheck.NewMemo(func(key string) ([]string, error) {
+		computations++
+		if key == "" {
+			return nil, failure
+		}
+		return strings.Split(key, ","), nil
+	}, immcheck.Options{})
+
+	first, err := memo.Get("a,b")
+	if err != nil || len(first) != 2 {
+		t.Fatalf("unexpected result: %v %v", first, err)
+	}
+	second, err := memo.Get("a,b")
+	if err != nil || &second[0] != &first[0] || computations != 1 {
+		t.Fatalf("value isn't memoized: %v %v", second, err)
+	}
+	if _, err := memo.Get(""); !errors.Is(err, failure) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := memo.Get(""); !errors.Is(err, failure) || computations != 3 {
+		t.Fatalf("error is memoized: %v", err)
+	}
+
+	panicMessage := expectMutationPanic(t, func() {
+		first[0] = "mutated by previous caller"
+		_, _ = memo.Get("a,b")
+	})
+	checkMutationDetectionMessage(t, panicMessage)
+
+	memo.Forget("a,b")
+	recomputed, err := memo.Get("a,b")
+	if err != nil || recomputed[0] != "a" || computations != 4 {
+		t.Fatalf("value isn't recomputed: %v %v", recomputed, err)
+	}
+}
@@ -0,0 +1,139 @@
+package immcheck
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// MutationError describes detected mutation.
+// CheckImmutabilityAgainst returns it and immcheck panics with it by default,
+// so recover()-based frameworks can distinguish immcheck panics using errors.As
+// without string matching. errors.Is(err, immcheck.MutationDetectedError) is true for MutationError.
+type MutationError struct {
+	// CaptureOrigin is the place where immutable snapshot was captured. Zero if origin wasn't captured.
+	CaptureOrigin OriginID
+	// DetectionOrigin is the place where mutation was detected. Zero if origin wasn't captured.
+	DetectionOrigin OriginID
+	// Kinds classifies detected mutation. See MutationKind.
+	Kinds MutationKind
+	// StringDataRepointed is true if data pointers of guarded strings were changed.
+	// It is tracked only with CaptureStringIdentity flag.
+	StringDataRepointed bool
+	// Released is true if pointers, interfaces or maps that were set at capture time became nil,
+	// which usually means that guarded value was torn down. See AllowReleaseByNil flag.
+	Released bool
+	// KeySetChanged is true if keys of guarded maps were added, removed or replaced.
+	// Mutation of data reachable through pointer keys doesn't change keys identity and is reported as content change.
+	KeySetChanged bool
+	// PointerRetargeted is true if pointers or interfaces were set to different objects,
+	// but content reachable from guarded value remained equal. See CompareReferencesByContent flag.
+	PointerRetargeted bool
+	// Type is the type of guarded root value, like %T verb prints it. Empty if it is unknown.
+	Type string
+	// Elements is the number of elements of guarded root value:
+	// length of arrays, slices, strings and maps or number of fields of structs.
+	// Pointers and interfaces are dereferenced.
+	Elements int
+	// ApproximateSize is the number of bytes that were hashed to capture snapshot of guarded value.
+	ApproximateSize int
+	// LastWriters are the most recent writes to immcheck.Tracked fields made after immutable snapshot was captured,
+	// the most recent first. Writes aren't attributed to guarded values, so they may include writes to other values.
+	LastWriters []TrackedWrite
+	// UnverifiedNodes is the number of values skipped with SkipUnsupportedTypes flag, see ValueSnapshot.UnverifiedNodes.
+	UnverifiedNodes int
+	// Checkpoint is the number of checkpoints of immcheck.PausableGuard passed before the mutation was made,
+	// see PausableGuard.Checkpoint. Zero if mutation was made before the first checkpoint or guard has no checkpoints.
+	Checkpoint int
+	// Phase is the name of the phase of immcheck.PausableGuard during which the mutation was made,
+	// see PausableGuard.Phase. Empty if the phase isn't named.
+	Phase string
+	// CgoCall is the name of the cgo call of immcheck.CgoGuard during which the mutation was made,
+	// see CgoGuard.Call. Empty if the mutation was made by Go code between calls.
+	CgoCall string
+	// BudgetExceeded is true if the guard was created after Options.Budget was exceeded,
+	// so only some guards of the same request verify their values and other mutations may be missed.
+	BudgetExceeded bool
+	// Diff is unified diff of old and new values rendered line by line, like "- .Amount: 100" and "+ .Amount: 250".
+	// It is rendered only with RenderDiffOnMutation flag for small values, empty otherwise.
+	Diff string
+}
+
+// Error provides human-readable description of detected mutation.
+func (m *MutationError) Error() string {
+	buf := &bytes.Buffer{}
+	buf.WriteString(MutationDetectedError.Error())
+	buf.WriteByte('\n')
+	if origin, ok := LookupOrigin(m.CaptureOrigin); ok {
+		buf.WriteString("immutable snapshot was captured here ")
+		buf.WriteString(origin.String())
+		buf.WriteByte('\n')
+	}
+	if origin, ok := LookupOrigin(m.DetectionOrigin); ok {
+		buf.WriteString("mutation was detected here ")
+		buf.WriteString(origin.String())
+		buf.WriteByte('\n')
+	}
+	if m.Type != "" {
+		_, _ = fmt.Fprintf(buf, "guarded value type: %v; elements: %v; approximate size: %v bytes\n",
+			m.Type, m.Elements, m.ApproximateSize)
+	}
+	if m.Kinds != 0 {
+		buf.WriteString("mutation kinds: ")
+		buf.WriteString(m.Kinds.String())
+		buf.WriteByte('\n')
+	}
+	if m.KeySetChanged {
+		buf.WriteString("map key set was changed\n")
+	}
+	if m.PointerRetargeted {
+		buf.WriteString("references were retargeted to objects with equal content\n")
+	}
+	if m.Released {
+		buf.WriteString("guarded value was released: references became nil\n")
+	}
+	if m.StringDataRepointed {
+		buf.WriteString("string data pointers were changed\n")
+	}
+	if m.UnverifiedNodes != 0 {
+		_, _ = fmt.Fprintf(buf, "unverified nodes: %v\n", m.UnverifiedNodes)
+	}
+	if m.Checkpoint != 0 {
+		_, _ = fmt.Fprintf(buf, "mutation occurred after checkpoint %v\n", m.Checkpoint)
+	}
+	if m.Phase != "" {
+		_, _ = fmt.Fprintf(buf, "mutation occurred during phase '%v'\n", m.Phase)
+	}
+	if m.CgoCall != "" {
+		_, _ = fmt.Fprintf(buf, "mutation occurred during cgo call '%v'\n", m.CgoCall)
+	}
+	if m.BudgetExceeded {
+		buf.WriteString("guard budget was exceeded: guards were downgraded to sampled mode\n")
+	}
+	if m.Diff != "" {
+		buf.WriteString("diff:\n")
+		buf.WriteString(m.Diff)
+	}
+	for _, write := range m.LastWriters {
+		buf.WriteString("last writer: ")
+		buf.WriteString(write.String())
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
+
+// Unwrap returns immcheck.MutationDetectedError.
+func (m *MutationError) Unwrap() error {
+	return MutationDetectedError
+}
+
+// panicValue returns value that immcheck should panic with according to options.
+func panicValue(checkErr error, options Options) interface{} {
+	if options.PanicValue == nil {
+		return checkErr
+	}
+	mutationErr, ok := checkErr.(*MutationError)
+	if !ok {
+		return checkErr
+	}
+	return options.PanicValue(mutationErr)
+}
@@ -0,0 +1,266 @@
+package immcheck
+
+import (
+	"math"
+	"reflect"
+	"sync"
+	"unsafe"
+
+	"github.com/zeebo/xxh3"
+)
+
+const (
+	canonicalNaN64 = 0x7FF8000000000000
+	canonicalNaN32 = 0x7FC00000
+)
+
+// normalizationFlags are flags that make immcheck hash normalized copy of value bytes instead of raw memory.
+const normalizationFlags = NormalizeFloats | CompareReferencesByContent | CompareByValue
+
+// referencesByContentFlags are flags that make immcheck identify pointers and interfaces by content they reference.
+const referencesByContentFlags = CompareReferencesByContent | CompareByValue
+
+type inlineContent uint8
+
+const (
+	inlineFloats inlineContent = 1 << iota
+	inlineReferences
+	// inlineTaggedFields is set for types that hold fields with capture rules, see tagName
+	inlineTaggedFields
+	// inlinePadding is set for types that hold structs with padding bytes, contents of padding are unspecified
+	// and aren't preserved when values are copied by assignment, so padding is always zeroed before hashing
+	inlinePadding
+	// inlineHeaders is set for types that hold string or slice headers or map pointers inline
+	inlineHeaders
+)
+
+//nolint:gochecknoglobals // inlineContentCache is global to share inline content of types between captures
+var inlineContentCache = newPCache(maxPoolCacheSizePerGoroutine)
+
+//nolint:gochecknoglobals // normalizedBytesPool is global to re-use normalization buffers
+var normalizedBytesPool = &sync.Pool{New: func() interface{} { return new([]byte) }}
+
+// captureValueBytesChecksum captures checksum of valueBytes that hold count values of elemType.
+// Value bytes are normalized before hashing according to normalizationFlags.
+// Inline references are always excluded from content digest, so retargeting isn't a content change.
+func captureValueBytesChecksum(
+	snapshot *ValueSnapshot,
+	valueBytes []byte, valueKind reflect.Kind,
+	elemType reflect.Type, count int,
+	options Options,
+) *ValueSnapshot {
+	flags := options.Flags & normalizationFlags
+	normalized, buffer := normalizeValueBytes(valueBytes, elemType, count, flags)
+	defer releaseNormalizedBytes(buffer)
+	if flags&referencesByContentFlags != 0 || typeInlineContent(elemType)&inlineReferences == 0 {
+		// checksum doesn't depend on addresses, so it describes content as is
+		return captureRawBytesLevelChecksum(snapshot, normalized, valueKind)
+	}
+	snapshot = recordRawBytesChecksum(snapshot, normalized, uint32(xxh3.Hash(normalized)), valueKind)
+
+	content, contentBuffer := normalizeValueBytes(valueBytes, elemType, count, flags|CompareReferencesByContent)
+	defer releaseNormalizedBytes(contentBuffer)
+	snapshot.contentDigest += uint32(xxh3.Hash(content))
+	return snapshot
+}
+
+// normalizeValueBytes returns normalized copy of valueBytes that hold count values of elemType:
+// padding bytes of structs are zeroed, with NormalizeFloats flag canonical NaNs are set and -0.0 is folded into +0.0,
+// with CompareReferencesByContent flag inline pointers and interfaces are zeroed, since their content is captured
+// separately, with CompareByValue flag data pointers of strings, slices and maps and capacities of slices
+// are zeroed too.
+// If there is nothing to normalize, valueBytes are returned as is.
+// Returned buffer should be released using releaseNormalizedBytes.
+func normalizeValueBytes(
+	valueBytes []byte, elemType reflect.Type, count int,
+	flags immutabilityCheckFlag,
+) ([]byte, *[]byte) {
+	content := normalizedContent(elemType, flags)
+	if len(valueBytes) == 0 || content == 0 {
+		return valueBytes, nil
+	}
+	buffer := normalizedBytesPool.Get().(*[]byte)
+	normalized := append((*buffer)[:0], valueBytes...)
+	elemSize := elemType.Size()
+	for i := 0; i < count; i++ {
+		normalizeAt(normalized, elemType, uintptr(i)*elemSize, content)
+	}
+	*buffer = normalized
+	return normalized, buffer
+}
+
+func releaseNormalizedBytes(buffer *[]byte) {
+	if buffer != nil {
+		normalizedBytesPool.Put(buffer)
+	}
+}
+
+// normalizedContent returns inline content of t that should be normalized according to flags.
+// Fields with capture rules are always normalized according to their rules, padding is always zeroed.
+func normalizedContent(t reflect.Type, flags immutabilityCheckFlag) inlineContent {
+	requested := inlineTaggedFields | inlinePadding
+	if flags&NormalizeFloats != 0 {
+		requested |= inlineFloats
+	}
+	if flags&referencesByContentFlags != 0 {
+		requested |= inlineReferences
+	}
+	if flags&CompareByValue != 0 {
+		requested |= inlineHeaders
+	}
+	return typeInlineContent(t) & requested
+}
+
+func normalizeAt(buf []byte, t reflect.Type, offset uintptr, content inlineContent) {
+	//nolint:exhaustive
+	switch t.Kind() {
+	case reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		if content&inlineFloats != 0 {
+			normalizeFloatsAt(buf, t.Kind(), offset)
+		}
+	case reflect.Ptr, reflect.Interface:
+		if content&inlineReferences != 0 {
+			zeroBytes(buf[offset : offset+t.Size()])
+		}
+	case reflect.String, reflect.Slice, reflect.Map:
+		if content&inlineHeaders != 0 {
+			normalizeHeaderAt(buf, t.Kind(), offset)
+		}
+	case reflect.Struct:
+		typeContent := typeInlineContent(t)
+		if typeContent&content == 0 {
+			return
+		}
+		var rules []fieldRule
+		if typeContent&content&inlineTaggedFields != 0 {
+			rules = typeFieldRules(t)
+		}
+		padded := content&inlinePadding != 0
+		paddingStart := uintptr(0)
+		numField := t.NumField()
+		for i := 0; i < numField; i++ {
+			field := t.Field(i)
+			if padded {
+				zeroBytes(buf[offset+paddingStart : offset+field.Offset])
+				paddingStart = field.Offset + field.Type.Size()
+			}
+			if rule, ok := fieldRuleOf(rules, i); ok {
+				switch {
+				case rule.capturedSeparately():
+					zeroBytes(buf[offset+field.Offset : offset+field.Offset+field.Type.Size()])
+				case field.Type.Kind() == reflect.String:
+					normalizeStringAt(buf, offset+field.Offset, rule)
+				default:
+					quantizeFloatAt(buf, field.Type.Kind(), offset+field.Offset, rule)
+				}
+				continue
+			}
+			normalizeAt(buf, field.Type, offset+field.Offset, content)
+		}
+		if padded {
+			zeroBytes(buf[offset+paddingStart : offset+t.Size()])
+		}
+	case reflect.Array:
+		if typeInlineContent(t)&content == 0 {
+			return
+		}
+		elemType := t.Elem()
+		elemSize := elemType.Size()
+		arrayLen := t.Len()
+		for i := 0; i < arrayLen; i++ {
+			normalizeAt(buf, elemType, offset+uintptr(i)*elemSize, content)
+		}
+	}
+}
+
+func zeroBytes(buf []byte) {
+	for i := range buf {
+		buf[i] = 0
+	}
+}
+
+// normalizeHeaderAt zeroes data pointer of string or slice header or map pointer at offset of buf
+// and capacity of slice header, so only length of header is hashed inline.
+func normalizeHeaderAt(buf []byte, kind reflect.Kind, offset uintptr) {
+	const wordSize = unsafe.Sizeof(uintptr(0))
+	zeroBytes(buf[offset : offset+wordSize])
+	if kind == reflect.Slice {
+		zeroBytes(buf[offset+2*wordSize : offset+3*wordSize])
+	}
+}
+
+func normalizeFloatsAt(buf []byte, kind reflect.Kind, offset uintptr) {
+	//nolint:exhaustive
+	switch kind {
+	case reflect.Float32:
+		normalizeFloat32((*uint32)(unsafe.Pointer(&buf[offset])))
+	case reflect.Float64:
+		normalizeFloat64((*uint64)(unsafe.Pointer(&buf[offset])))
+	case reflect.Complex64:
+		normalizeFloat32((*uint32)(unsafe.Pointer(&buf[offset])))
+		normalizeFloat32((*uint32)(unsafe.Pointer(&buf[offset+4])))
+	case reflect.Complex128:
+		normalizeFloat64((*uint64)(unsafe.Pointer(&buf[offset])))
+		normalizeFloat64((*uint64)(unsafe.Pointer(&buf[offset+8])))
+	}
+}
+
+func normalizeFloat32(bits *uint32) {
+	value := math.Float32frombits(*bits)
+	switch {
+	case math.IsNaN(float64(value)):
+		*bits = canonicalNaN32
+	case value == 0:
+		*bits = 0
+	}
+}
+
+func normalizeFloat64(bits *uint64) {
+	value := math.Float64frombits(*bits)
+	switch {
+	case math.IsNaN(value):
+		*bits = canonicalNaN64
+	case value == 0:
+		*bits = 0
+	}
+}
+
+// typeInlineContent reports whether t holds floats, references, headers, fields with capture rules or padding inline,
+// without following references.
+func typeInlineContent(t reflect.Type) inlineContent {
+	//nolint:exhaustive
+	switch t.Kind() {
+	case reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return inlineFloats
+	case reflect.Ptr, reflect.Interface:
+		return inlineReferences
+	case reflect.String, reflect.Slice, reflect.Map:
+		return inlineHeaders
+	case reflect.Array:
+		return typeInlineContent(t.Elem())
+	case reflect.Struct:
+		if plan, ok := loadTypePlan(t); ok {
+			return plan.inlineContent
+		}
+		if content, ok := inlineContentCache.load(t); ok {
+			return content.(inlineContent)
+		}
+		var content inlineContent
+		if len(typeFieldRules(t)) != 0 {
+			content |= inlineTaggedFields
+		}
+		fieldsSize := uintptr(0)
+		numField := t.NumField()
+		for i := 0; i < numField; i++ {
+			fieldType := t.Field(i).Type
+			content |= typeInlineContent(fieldType)
+			fieldsSize += fieldType.Size()
+		}
+		if fieldsSize != t.Size() {
+			content |= inlinePadding
+		}
+		inlineContentCache.store(t, content)
+		return content
+	}
+	return 0
+}
@@ -0,0 +1,100 @@
+package immcheck
+
+import (
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// OriginID is a small identifier of interned snapshot origin.
+// Zero OriginID means that origin wasn't captured.
+type OriginID uint32
+
+// Origin is a source code location where snapshot was captured.
+type Origin struct {
+	File string
+	Line int
+}
+
+// String provides string representation of Origin in file:line format.
+func (o Origin) String() string {
+	return o.File + ":" + strconv.Itoa(o.Line)
+}
+
+// LookupOrigin resolves OriginID into Origin using global table of interned origins.
+// Returns false if id is unknown or zero.
+func LookupOrigin(id OriginID) (Origin, bool) {
+	return origins.lookup(id)
+}
+
+// Origins returns copy of global table of interned origins, where index of the origin is its OriginID.
+// First item of the table is always empty Origin, since zero OriginID means that origin wasn't captured.
+func Origins() []Origin {
+	return origins.list()
+}
+
+//nolint:gochecknoglobals // origins is global to share interned origins between all snapshots
+var origins = newOriginTable()
+
+type originTable struct {
+	byPC sync.Map // uintptr -> OriginID
+
+	m          sync.RWMutex
+	byLocation map[Origin]OriginID
+	table      []Origin
+}
+
+func newOriginTable() *originTable {
+	return &originTable{
+		byLocation: make(map[Origin]OriginID),
+		table:      []Origin{{}},
+	}
+}
+
+// captureOrigin interns origin of the caller framesToSkip frames above captureOrigin's caller.
+func (o *originTable) captureOrigin(framesToSkip int) OriginID {
+	pcs := [1]uintptr{}
+	skipRuntimeCallersAndCaptureOriginFrames := 2
+	if runtime.Callers(framesToSkip+skipRuntimeCallersAndCaptureOriginFrames, pcs[:]) == 0 {
+		panic("can't capture stack trace")
+	}
+	if id, ok := o.byPC.Load(pcs[0]); ok {
+		return id.(OriginID)
+	}
+	frame, _ := runtime.CallersFrames(pcs[:]).Next()
+	id := o.intern(Origin{File: frame.File, Line: frame.Line})
+	o.byPC.Store(pcs[0], id)
+	return id
+}
+
+func (o *originTable) intern(origin Origin) OriginID {
+	o.m.Lock()
+	defer o.m.Unlock()
+	if id, ok := o.byLocation[origin]; ok {
+		return id
+	}
+	id := OriginID(len(o.table))
+	o.table = append(o.table, origin)
+	o.byLocation[origin] = id
+	return id
+}
+
+func (o *originTable) lookup(id OriginID) (Origin, bool) {
+	if id == 0 {
+		return Origin{}, false
+	}
+	o.m.RLock()
+	defer o.m.RUnlock()
+	if int(id) >= len(o.table) {
+		return Origin{}, false
+	}
+	return o.table[id], true
+}
+
+func (o *originTable) list() []Origin {
+	o.m.RLock()
+	defer o.m.RUnlock()
+	result := make([]Origin, len(o.table))
+	copy(result, o.table)
+	return result
+}
@@ -0,0 +1,48 @@
+package immcheck_test
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+func TestSnapshotOriginInterning(t *testing.T) {
+	t.Parallel()
+	value := 1
+	snapshots := make([]*immcheck.ValueSnapshot, 3)
+	_, _, expectedLine, _ := runtime.Caller(0)
+	for i := range snapshots {
+		snapshots[i] = immcheck.CaptureSnapshot(&value, immcheck.NewValueSnapshot()) // same origin
+	}
+	expectedLine += 2
+
+	id := snapshots[0].OriginID()
+	for _, snapshot := range snapshots {
+		if snapshot.OriginID() != id {
+			t.Fatalf("origin isn't interned: %v != %v", snapshot.OriginID(), id)
+		}
+	}
+	origin, ok := immcheck.LookupOrigin(id)
+	if !ok {
+		t.Fatal("origin is not found")
+	}
+	if !strings.HasSuffix(origin.File, "origin_test.go") || origin.Line != expectedLine {
+		t.Fatalf("unexpected origin: %v", origin)
+	}
+	if immcheck.Origins()[id] != origin {
+		t.Fatalf("unexpected origins table: %v", immcheck.Origins())
+	}
+
+	snapshots[0].Reset()
+	if snapshots[0].OriginID() != 0 {
+		t.Fatal("reset didn't clear origin")
+	}
+	withoutOrigin := immcheck.CaptureSnapshotWithOptions(
+		&value, immcheck.NewValueSnapshot(), immcheck.Options{Flags: immcheck.SkipOriginCapturing},
+	)
+	if _, ok := immcheck.LookupOrigin(withoutOrigin.OriginID()); ok {
+		t.Fatal("origin is captured despite SkipOriginCapturing")
+	}
+}
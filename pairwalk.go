@@ -0,0 +1,159 @@
+package immcheck
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// PairVisitor is called by immcheck.WalkPair for every pair of values met at the same path of two walked values
+// before the walker descends into them. path is Go-like path relative to walked values, like .Roles[0]
+// or .Labels["env"], pointers and interfaces are dereferenced transparently.
+// Missing counterparts, like extra slice items or map entries present only in one value,
+// are passed as invalid reflect.Value. Return false to skip descending into a and b,
+// for example, if visitor compared them itself.
+type PairVisitor func(path string, a reflect.Value, b reflect.Value) (descend bool)
+
+// WalkPair walks a and b in lockstep and calls visitor for every pair of values met at the same path,
+// so custom comparators with their own tolerance rules can be built on top of cycle-aware traversal of immcheck.
+// Walker descends only into pairs of valid values of the same type.
+// Every pair of references is descended only once, so reference cycles and shared references are walked once.
+// Map entries are walked in order of formatted keys, distinct keys formatted the same way are walked
+// in order of their identities, so walks of the same values visit the same paths in the same order.
+// UnsafePointer, Func and Chan values are visited only with AllowInherentlyUnsafeTypes flag set in options.
+func WalkPair(a interface{}, b interface{}, visitor PairVisitor, options Options) {
+	if visitor == nil {
+		panic("pair visitor can't be nil")
+	}
+	walkPair(targetValueOf(a), targetValueOf(b), withDefaultOptions(options), visitor)
+}
+
+// pairWalker implements lockstep traversal of immcheck.WalkPair.
+type pairWalker struct {
+	options  Options
+	rootType reflect.Type
+	visit    PairVisitor
+	visited  map[pairReference]struct{}
+}
+
+type pairReference struct {
+	a, b      uintptr
+	valueType reflect.Type
+}
+
+func walkPair(a reflect.Value, b reflect.Value, options Options, visit PairVisitor) {
+	walker := &pairWalker{
+		options: options,
+		visit:   visit,
+		visited: make(map[pairReference]struct{}),
+	}
+	if a.IsValid() {
+		walker.rootType = a.Type()
+	}
+	walker.walk("", a, b)
+}
+
+func (w *pairWalker) walk(path string, a reflect.Value, b reflect.Value) {
+	if w.options.Flags&AllowUnexportedAccess != 0 {
+		a, b = accessibleValue(a, internalsOf(w.options)), accessibleValue(b, internalsOf(w.options))
+	}
+	if !w.visit(path, a, b) {
+		return
+	}
+	if !a.IsValid() || !b.IsValid() || a.Type() != b.Type() {
+		return
+	}
+	valueKind := a.Kind()
+	switch valueKind {
+	case reflect.UnsafePointer, reflect.Func, reflect.Chan:
+		if w.options.Flags&AllowInherentlyUnsafeTypes == 0 {
+			panic(unsupportedKindError(w.rootType, valueKind, false))
+		}
+	case reflect.Ptr:
+		if a.IsNil() || b.IsNil() || !w.enter(a, b) {
+			return
+		}
+		w.walk(path, a.Elem(), b.Elem())
+	case reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return
+		}
+		w.walk(path, a.Elem(), b.Elem())
+	case reflect.Struct:
+		valueType := a.Type()
+		numField := a.NumField()
+		for i := 0; i < numField; i++ {
+			w.walk(path+"."+valueType.Field(i).Name, a.Field(i), b.Field(i))
+		}
+	case reflect.Slice, reflect.Array:
+		// non-empty slices can reference themselves through interfaces
+		if valueKind == reflect.Slice && a.Len() != 0 && b.Len() != 0 && !w.enter(a, b) {
+			return
+		}
+		w.walkItems(path, a, b)
+	case reflect.Map:
+		if a.IsNil() || b.IsNil() || !w.enter(a, b) {
+			return
+		}
+		w.walkEntries(path, a, b)
+	}
+}
+
+// enter reports whether the pair of references a and b is visited for the first time.
+func (w *pairWalker) enter(a reflect.Value, b reflect.Value) bool {
+	key := pairReference{
+		a:         uintptr(pointerOfValue(a, currentInternals())),
+		b:         uintptr(pointerOfValue(b, currentInternals())),
+		valueType: a.Type(),
+	}
+	if _, visited := w.visited[key]; visited {
+		return false
+	}
+	w.visited[key] = struct{}{}
+	return true
+}
+
+func (w *pairWalker) walkItems(path string, a reflect.Value, b reflect.Value) {
+	itemsCount := a.Len()
+	if b.Len() > itemsCount {
+		itemsCount = b.Len()
+	}
+	for i := 0; i < itemsCount; i++ {
+		var aItem, bItem reflect.Value
+		if i < a.Len() {
+			aItem = a.Index(i)
+		}
+		if i < b.Len() {
+			bItem = b.Index(i)
+		}
+		w.walk(fmt.Sprintf("%v[%v]", path, i), aItem, bItem)
+	}
+}
+
+func (w *pairWalker) walkEntries(path string, a reflect.Value, b reflect.Value) {
+	entries := make([]pairEntry, 0, a.Len()+b.Len())
+	for _, key := range a.MapKeys() {
+		entries = append(entries, pairEntry{key: key, formattedKey: formatMapKey(key)})
+	}
+	for _, key := range b.MapKeys() {
+		if !a.MapIndex(key).IsValid() {
+			entries = append(entries, pairEntry{key: key, formattedKey: formatMapKey(key)})
+		}
+	}
+	// map iteration order is random, so entries are walked in order of formatted keys to make walks repeatable
+	sort.Slice(entries, func(i, j int) bool {
+		return mapKeyLess(entries[i].key, entries[i].formattedKey, entries[j].key, entries[j].formattedKey, w.options)
+	})
+	for _, entry := range entries {
+		w.walk(path+entry.formattedKey, a.MapIndex(entry.key), b.MapIndex(entry.key))
+	}
+}
+
+type pairEntry struct {
+	key          reflect.Value
+	formattedKey string
+}
+
+func formatMapKey(key reflect.Value) string {
+	return "[" + formatValue(key) + "]"
+}
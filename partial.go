@@ -0,0 +1,180 @@
+package immcheck
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// partialVerificationUnitBytes is the amount of inline memory of slice or array elements verified as one unit.
+const partialVerificationUnitBytes = 16 * 1024
+
+// PartialVerification verifies value guarded by immcheck.EnsureImmutabilityPartial in small steps,
+// so latency-sensitive callers can spread verification of a huge value across multiple scheduling points
+// instead of one long stop.
+// Elements of guarded slices and arrays are split into units of roughly 16KiB of inline memory each,
+// values of other kinds are verified as a single unit. Pointers and interfaces are dereferenced.
+//
+// PartialVerification isn't safe for concurrent use.
+type PartialVerification struct {
+	options Options
+	target  reflect.Value
+
+	captureOrigin OriginID
+	rootType      reflect.Type
+	kind          reflect.Kind
+	split         bool
+	length        int
+	unitLen       int
+
+	units       []*ValueSnapshot
+	next        int
+	newSnapshot *ValueSnapshot
+}
+
+// EnsureImmutabilityPartial captures checksum of v according to settings specified in options
+// and returns PartialVerification that verifies v unit by unit using PartialVerification.VerifyNext.
+// Options related to logging and panics are ignored, mutations are returned as *immcheck.MutationError.
+// If inline checks are switched off by immcheck.SetRuntimeToggles, returned PartialVerification has no units.
+func EnsureImmutabilityPartial(v interface{}, options Options) *PartialVerification {
+	if v == nil {
+		panic(fmt.Errorf("%w. target value can't be nil", UnsupportedTypeError))
+	}
+	if inlineChecksDisabled() {
+		// verification without units is done on every call without errors
+		return &PartialVerification{}
+	}
+	options = withDefaultOptions(options)
+	partial := &PartialVerification{
+		options:     withFlags(options, options.Flags|SkipOriginCapturing),
+		target:      reflect.ValueOf(v),
+		rootType:    reflect.TypeOf(v),
+		newSnapshot: newValueSnapshot(),
+	}
+	if options.Flags&SkipOriginCapturing == 0 {
+		skipOneFrame := 1
+		partial.captureOrigin = origins.captureOrigin(skipOneFrame)
+	}
+
+	container := partial.container()
+	partial.kind = container.Kind()
+	partial.unitLen = 1
+	unitsCount := 1
+	if partial.kind == reflect.Slice || partial.kind == reflect.Array {
+		partial.length = container.Len()
+		// only addressable arrays can be sliced into units
+		partial.split = partial.length > 0 && (partial.kind == reflect.Slice || container.CanAddr())
+	}
+	if partial.split {
+		if elemSize := int(container.Type().Elem().Size()); elemSize > 0 && elemSize < partialVerificationUnitBytes {
+			partial.unitLen = partialVerificationUnitBytes / elemSize
+		}
+		unitsCount = (partial.length + partial.unitLen - 1) / partial.unitLen
+	}
+	partial.units = make([]*ValueSnapshot, unitsCount)
+	for i := range partial.units {
+		partial.units[i] = partial.captureUnit(newValueSnapshot(), container, i, partial.captureOrigin)
+	}
+	return partial
+}
+
+// Units returns number of units guarded value is split into. Every verification pass checks all of them.
+func (p *PartialVerification) Units() int {
+	return len(p.units)
+}
+
+// VerifyNext verifies next n units of guarded value. done is true if the last unit was verified,
+// so the current verification pass is complete and the next call starts a new pass from the first unit.
+// Returns *immcheck.MutationError of the first mutated unit if mutation is detected. All mutated units are re-armed,
+// so the same mutation isn't reported twice. If length of guarded slice changes
+// or guarded reference becomes nil, error is returned on every call.
+// With AllowReleaseByNil flag, guarded reference that became nil has nothing left to verify, so every call is done.
+func (p *PartialVerification) VerifyNext(n int) (done bool, err error) {
+	var detectionOrigin OriginID
+	if p.captureOrigin != 0 {
+		skipOneFrame := 1
+		detectionOrigin = origins.captureOrigin(skipOneFrame)
+	}
+	container := p.container()
+	sequence := p.kind == reflect.Slice || p.kind == reflect.Array
+	if container.Kind() != p.kind || (sequence && container.Len() != p.length) {
+		checkErr := p.structuralMutation(container, detectionOrigin)
+		return checkErr == nil, checkErr
+	}
+
+	for ; n > 0 && p.next < len(p.units); n-- {
+		p.newSnapshot = p.captureUnit(p.newSnapshot, container, p.next, detectionOrigin)
+		if checkErr := p.units[p.next].CheckImmutabilityAgainst(p.newSnapshot); checkErr != nil {
+			if err == nil {
+				err = p.describe(checkErr)
+			}
+			// re-arm every mutated unit, so the same mutation isn't reported twice
+			p.units[p.next], p.newSnapshot = p.newSnapshot, p.units[p.next]
+			p.units[p.next].captureOrigin = p.captureOrigin
+		}
+		p.next++
+	}
+	if p.next == len(p.units) {
+		p.next = 0
+		return true, err
+	}
+	return false, err
+}
+
+// container returns guarded value with pointers and interfaces dereferenced.
+func (p *PartialVerification) container() reflect.Value {
+	value := p.target
+	for (value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface) && !value.IsNil() {
+		value = value.Elem()
+	}
+	return value
+}
+
+func (p *PartialVerification) captureUnit(
+	dst *ValueSnapshot, container reflect.Value, unit int, origin OriginID,
+) *ValueSnapshot {
+	dst = initValueSnapshot(dst, p.options, 0)
+	dst.captureOrigin = origin
+	if !p.split {
+		return captureChecksumMap(dst, p.target, p.options)
+	}
+	from := unit * p.unitLen
+	to := from + p.unitLen
+	if to > p.length {
+		to = p.length
+	}
+	return captureChecksumMap(dst, container.Slice(from, to), p.options)
+}
+
+// describe replaces description of verified unit with description of the whole guarded value.
+func (p *PartialVerification) describe(checkErr error) error {
+	mutationErr, ok := checkErr.(*MutationError)
+	if !ok || !p.split {
+		return checkErr
+	}
+	mutationErr.Type = p.rootType.String()
+	mutationErr.Elements = p.length
+	return mutationErr
+}
+
+func (p *PartialVerification) structuralMutation(container reflect.Value, detectionOrigin OriginID) error {
+	var kinds MutationKind
+	switch {
+	case container.Kind() == reflect.Ptr || container.Kind() == reflect.Interface:
+		if p.options.Flags&AllowReleaseByNil != 0 {
+			return nil
+		}
+		kinds = Released
+	case container.Kind() == p.kind:
+		kinds = LengthChanged
+	default:
+		kinds = ContentChanged
+	}
+	return &MutationError{
+		CaptureOrigin:   p.captureOrigin,
+		DetectionOrigin: detectionOrigin,
+		Kinds:           kinds,
+		Released:        kinds == Released,
+		Type:            p.rootType.String(),
+		Elements:        p.length,
+	}
+}
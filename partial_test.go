@@ -0,0 +1,80 @@
+package immcheck_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+func TestPartialVerification(t *testing.T) {
+	t.Parallel()
+	values := make([]int64, 10_000)
+	partial := immcheck.EnsureImmutabilityPartial(&values, immcheck.Options{})
+	if partial.Units() < 2 {
+		t.Fatalf("value isn't split into units: %v", partial.Units())
+	}
+	verifyPass(t, partial, nil)
+
+	values[len(values)-1]++
+	var mutationErr *immcheck.MutationError
+	verifyPass(t, partial, &mutationErr)
+	if mutationErr.Type != "*[]int64" || mutationErr.Elements != len(values) {
+		t.Fatalf("unexpected mutation description: %v", mutationErr)
+	}
+	// mutated unit is re-armed
+	verifyPass(t, partial, nil)
+
+	values[0]++
+	values[len(values)-1]++
+	if done, err := partial.VerifyNext(partial.Units()); !done || !errors.As(err, &mutationErr) {
+		t.Fatalf("mutations aren't detected in a single step: %v %v", done, err)
+	}
+	// all mutated units verified by the same step are re-armed
+	verifyPass(t, partial, nil)
+
+	values = append(values, 1)
+	if _, err := partial.VerifyNext(1); !errors.As(err, &mutationErr) || !mutationErr.Kinds.Has(immcheck.LengthChanged) {
+		t.Fatalf("length change isn't detected: %v", err)
+	}
+}
+
+func TestPartialVerificationOfSingleUnit(t *testing.T) {
+	t.Parallel()
+	value := &struct{ Name string }{Name: "name"}
+	partial := immcheck.EnsureImmutabilityPartial(value, immcheck.Options{})
+	if partial.Units() != 1 {
+		t.Fatalf("struct should be verified as a single unit: %v", partial.Units())
+	}
+	value.Name = "other"
+	done, err := partial.VerifyNext(1)
+	if !done || !errors.Is(err, immcheck.MutationDetectedError) {
+		t.Fatalf("mutation isn't detected: %v %v", done, err)
+	}
+}
+
+func verifyPass(t *testing.T, partial *immcheck.PartialVerification, target **immcheck.MutationError) {
+	t.Helper()
+	var passErr error
+	for steps := 0; ; steps++ {
+		if steps > partial.Units() {
+			t.Fatalf("verification pass isn't complete after %v steps", steps)
+		}
+		done, err := partial.VerifyNext(1)
+		if err != nil && passErr == nil {
+			passErr = err
+		}
+		if done {
+			break
+		}
+	}
+	if target == nil {
+		if passErr != nil {
+			t.Fatalf("unexpected error: %v", passErr)
+		}
+		return
+	}
+	if !errors.As(passErr, target) {
+		t.Fatalf("mutation isn't detected: %v", passErr)
+	}
+}
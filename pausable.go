@@ -0,0 +1,165 @@
+package immcheck
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// PausableGuard is a long-lived guard that can be suspended around known mutation windows,
+// like re-indexing, with PausableGuard.Pause and PausableGuard.Resume.
+// Unlike recreating a guard, the guard keeps its snapshot buffers, so resuming only refreshes the baseline.
+//
+// PausableGuard is safe for concurrent use, but the value itself must not be mutated while the guard is active.
+type PausableGuard struct {
+	mutex   sync.Mutex
+	options Options
+	target  reflect.Value
+	// baseline is nil if the guard is switched off by immcheck.SetRuntimeToggles
+	baseline    *ValueSnapshot
+	newSnapshot *ValueSnapshot
+	// pauses is the number of Pause calls not matched by Resume yet
+	pauses int
+	// checkpoints is the number of Checkpoint and Phase calls
+	checkpoints int
+	// phase is the name of the current phase
+	phase string
+}
+
+// GuardPausable captures snapshot of v according to settings specified in options and returns PausableGuard for it.
+// If inline checks are switched off by immcheck.SetRuntimeToggles, returned guard never verifies v.
+func GuardPausable(v interface{}, options Options) *PausableGuard {
+	if v == nil {
+		panic(fmt.Errorf("%w. target value can't be nil", UnsupportedTypeError))
+	}
+	if inlineChecksDisabled() {
+		return &PausableGuard{target: reflect.ValueOf(v)}
+	}
+	options = withDefaultOptions(options)
+	guard := &PausableGuard{
+		options:     options,
+		target:      reflect.ValueOf(v),
+		baseline:    newValueSnapshot(),
+		newSnapshot: newValueSnapshot(),
+	}
+	skipThreeFrames := 3
+	guard.rearm(skipThreeFrames)
+	return guard
+}
+
+// Check verifies that value wasn't mutated since the guard was created or last resumed.
+// Does nothing while the guard is paused.
+// If mutation is detected Check will panic, unless options specify otherwise.
+func (g *PausableGuard) Check() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.pauses > 0 {
+		return
+	}
+	skipThreeFrames := 3
+	g.verify(skipThreeFrames, false)
+}
+
+// Checkpoint verifies the value against the current baseline and advances the baseline,
+// so one guard can bracket multiple phases of a pipeline.
+// Detected mutation is attributed to the window between the previous checkpoint and this one,
+// see MutationError.Checkpoint, and the baseline is advanced regardless, so it isn't reported again.
+// Returns the number of the checkpoint, counting from one. While the guard is paused,
+// checkpoints are counted, but the value isn't verified.
+func (g *PausableGuard) Checkpoint() int {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	skipFourFrames := 4
+	return g.checkpoint(skipFourFrames)
+}
+
+// Phase is a checkpoint that ends the current phase of a pipeline and starts the phase with the name,
+// like guard.Phase("decode") and then guard.Phase("enrich"), so reports name the phase in which
+// the mutation was made, see MutationError.Phase. Mutations detected by PausableGuard.Check
+// are attributed to the current phase.
+func (g *PausableGuard) Phase(name string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	// the phase starts even if mutation made during the previous one panics
+	defer func() { g.phase = name }()
+	skipFourFrames := 4
+	g.checkpoint(skipFourFrames)
+}
+
+func (g *PausableGuard) checkpoint(framesToSkip int) int {
+	g.checkpoints++
+	if g.pauses == 0 {
+		g.verify(framesToSkip, true)
+	}
+	return g.checkpoints
+}
+
+// Pause verifies the value, so mutations made before the window are still reported, and suspends the guard.
+// If mutation is detected Pause will panic without pausing the guard, unless options specify otherwise.
+// Pauses nest: the guard is active again after the matching number of PausableGuard.Resume calls.
+func (g *PausableGuard) Pause() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.pauses == 0 {
+		skipThreeFrames := 3
+		g.verify(skipThreeFrames, false)
+	}
+	g.pauses++
+}
+
+// Resume ends the window opened by PausableGuard.Pause.
+// When the last window ends, the baseline is captured again, so mutations made within windows aren't reported.
+// Panics with immcheck.UnsupportedTypeError if the guard isn't paused.
+func (g *PausableGuard) Resume() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.pauses == 0 {
+		panic(fmt.Errorf("%w. guard of %v isn't paused", UnsupportedTypeError, g.target.Type()))
+	}
+	g.pauses--
+	if g.pauses == 0 {
+		skipThreeFrames := 3
+		g.rearm(skipThreeFrames)
+	}
+}
+
+// Paused reports whether the guard is paused.
+func (g *PausableGuard) Paused() bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.pauses > 0
+}
+
+func (g *PausableGuard) rearm(framesToSkip int) {
+	if g.baseline == nil {
+		return
+	}
+	g.baseline = initValueSnapshot(g.baseline, g.options, framesToSkip)
+	g.baseline = captureChecksumMap(g.baseline, g.target, g.options)
+}
+
+// verify checks the value against the baseline, advance makes the new snapshot the baseline even without mutations.
+func (g *PausableGuard) verify(framesToSkip int, advance bool) {
+	if g.baseline == nil {
+		return
+	}
+	g.newSnapshot = initValueSnapshot(g.newSnapshot, g.options, framesToSkip)
+	g.newSnapshot = captureChecksumMap(g.newSnapshot, g.target, g.options)
+	checkErr := g.baseline.CheckImmutabilityAgainst(g.newSnapshot)
+	if checkErr != nil || advance {
+		// re-arm, so the same mutation isn't reported twice
+		g.baseline, g.newSnapshot = g.newSnapshot, g.baseline
+	}
+	if checkErr == nil {
+		return
+	}
+	if mutationErr, ok := checkErr.(*MutationError); ok {
+		mutationErr.Checkpoint = g.checkpoints
+		mutationErr.Phase = g.phase
+		if advance {
+			// the mutation was made before this checkpoint
+			mutationErr.Checkpoint--
+		}
+	}
+	reportError(checkErr, g.options)
+}
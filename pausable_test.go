@@ -0,0 +1,100 @@
+package immcheck_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+func TestPausableGuard(t *testing.T) {
+	t.Parallel()
+	index := map[string][]int{"a": {1}, "b": {2}}
+	guard := immcheck.GuardPausable(&index, immcheck.Options{Flags: immcheck.SkipLoggingOnMutation})
+	guard.Check()
+
+	guard.Pause()
+	guard.Pause()
+	index["c"] = []int{3}
+	guard.Check()
+	guard.Resume()
+	if !guard.Paused() {
+		t.Fatal("nested pause is ended by the first resume")
+	}
+	index["a"] = append(index["a"], 4)
+	guard.Resume()
+	if guard.Paused() {
+		t.Fatal("guard isn't resumed")
+	}
+	guard.Check()
+
+	index["b"][0] = 5
+	expectMutationPanic(t, guard.Check)
+	guard.Check()
+
+	index["a"][0] = 6
+	expectMutationPanic(t, guard.Pause)
+	if guard.Paused() {
+		t.Fatal("guard is paused despite reported mutation")
+	}
+	expectPanic(t, guard.Resume, immcheck.UnsupportedTypeError)
+}
+
+func TestPausableGuardCheckpoints(t *testing.T) {
+	t.Parallel()
+	record := map[string]string{"id": "1"}
+	reporter := &recordingReporter{}
+	guard := immcheck.GuardPausable(&record, immcheck.Options{Reporter: reporter})
+	if checkpoint := guard.Checkpoint(); checkpoint != 1 {
+		t.Fatalf("unexpected checkpoint number: %v", checkpoint)
+	}
+	guard.Checkpoint()
+	record["id"] = "2"
+	guard.Checkpoint()
+	guard.Check()
+	record["name"] = "enriched"
+	guard.Check()
+	if len(reporter.errs) != 2 {
+		t.Fatalf("unexpected number of reported mutations: %v", reporter.errs)
+	}
+	reported := make([]*immcheck.MutationError, len(reporter.errs))
+	for i, err := range reporter.errs {
+		if !errors.As(err, &reported[i]) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if reported[0].Checkpoint != 2 || !strings.Contains(reported[0].Error(), "mutation occurred after checkpoint 2") {
+		t.Fatalf("mutation is attributed to wrong window: %v", reported[0])
+	}
+	if reported[1].Checkpoint != 3 {
+		t.Fatalf("mutation is attributed to wrong window: %v", reported[1])
+	}
+}
+
+func TestPausableGuardPhases(t *testing.T) {
+	t.Parallel()
+	order := &struct {
+		Amount int
+		Notes  []string
+	}{Amount: 100}
+	reporter := &recordingReporter{}
+	guard := immcheck.GuardPausable(order, immcheck.Options{Reporter: reporter})
+	guard.Phase("decode")
+	guard.Phase("enrich")
+	order.Amount = 250
+	guard.Phase("encode")
+	order.Notes = append(order.Notes, "encoded")
+	guard.Check()
+	if len(reporter.errs) != 2 {
+		t.Fatalf("unexpected number of reported mutations: %v", reporter.errs)
+	}
+	expectedPhases := []string{"enrich", "encode"}
+	for i, err := range reporter.errs {
+		var mutationErr *immcheck.MutationError
+		if !errors.As(err, &mutationErr) || mutationErr.Phase != expectedPhases[i] ||
+			!strings.Contains(err.Error(), "mutation occurred during phase '"+expectedPhases[i]+"'") {
+			t.Fatalf("mutation is attributed to wrong phase: %v", err)
+		}
+	}
+}
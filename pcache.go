@@ -3,6 +3,7 @@ package immcheck
 import (
 	"reflect"
 	"sync"
+	"sync/atomic"
 )
 
 type cache map[reflect.Type]interface{}
@@ -30,14 +31,14 @@ type cacheStripe struct {
 //
 // The zero PCache is invalid. Use NewPCache method to create PCache.
 type pCache struct {
-	maxSize int
+	maxSize int64
 	pool    *sync.Pool
 }
 
 // newPCache creates PCache with maxSizePerGoroutine.
 func newPCache(maxSizePerGoroutine uint) *pCache {
 	return &pCache{
-		maxSize: int(maxSizePerGoroutine),
+		maxSize: int64(maxSizePerGoroutine),
 		pool: &sync.Pool{
 			New: func() interface{} {
 				return &cacheStripe{
@@ -62,11 +63,16 @@ func (p *pCache) store(key reflect.Type, value interface{}) {
 	defer p.pool.Put(stripe)
 
 	stripe.cache[key] = value
-	if len(stripe.cache) <= p.maxSize {
-		return
-	}
+	maxSize := int(atomic.LoadInt64(&p.maxSize))
 	for k := range stripe.cache {
+		if len(stripe.cache) <= maxSize {
+			return
+		}
 		delete(stripe.cache, k)
-		break
 	}
 }
+
+// setMaxSize changes maxSizePerGoroutine. Bigger stripes will shrink on the next store.
+func (p *pCache) setMaxSize(maxSizePerGoroutine uint) {
+	atomic.StoreInt64(&p.maxSize, int64(maxSizePerGoroutine))
+}
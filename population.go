@@ -0,0 +1,107 @@
+package immcheck
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Scanner is implemented by *sql.Rows, *sql.Row and similar database APIs.
+type Scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// PopulationGuard enforces "populate once, then freeze" pattern.
+// Destination value can be written only within population windows: PopulationGuard.Populate or PopulationGuard.Scan.
+// After population, the value is expected to be immutable, for example, because it is handed to caches.
+//
+// PopulationGuard isn't safe for concurrent use.
+type PopulationGuard struct {
+	options Options
+	target  reflect.Value
+	// baseline is nil if the guard is switched off by immcheck.SetRuntimeToggles
+	baseline    *ValueSnapshot
+	newSnapshot *ValueSnapshot
+}
+
+// GuardPopulation creates PopulationGuard for dst. dst should be a pointer to destination struct.
+// If inline checks are switched off by immcheck.SetRuntimeToggles, returned guard never verifies dst.
+func GuardPopulation(dst interface{}) *PopulationGuard {
+	return guardPopulation(dst, Options{})
+}
+
+// GuardPopulationWithOptions creates PopulationGuard for dst
+// that verifies dst according to settings specified in options.
+func GuardPopulationWithOptions(dst interface{}, options Options) *PopulationGuard {
+	return guardPopulation(dst, options)
+}
+
+// Populate verifies that destination wasn't written since the previous population window,
+// runs populate that is allowed to write destination and re-arms guard with populated value.
+// Returns error of populate.
+func (g *PopulationGuard) Populate(populate func() error) error {
+	skipFourFrames := 4
+	return g.populate(populate, skipFourFrames)
+}
+
+// Scan works the same way as PopulationGuard.Populate, but uses scanner.Scan(dest...) to populate destination.
+func (g *PopulationGuard) Scan(scanner Scanner, dest ...interface{}) error {
+	skipFourFrames := 4
+	return g.populate(func() error {
+		return scanner.Scan(dest...)
+	}, skipFourFrames)
+}
+
+// Verify checks that destination wasn't written outside of population windows.
+// If mutation is detected Verify will panic, unless options specify otherwise.
+func (g *PopulationGuard) Verify() {
+	skipThreeFrames := 3
+	g.verify(skipThreeFrames)
+}
+
+func guardPopulation(dst interface{}, options Options) *PopulationGuard {
+	if dst == nil {
+		panic(fmt.Errorf("%w. target value can't be nil", UnsupportedTypeError))
+	}
+	if inlineChecksDisabled() {
+		return &PopulationGuard{target: reflect.ValueOf(dst)}
+	}
+	options = withDefaultOptions(options)
+	guard := &PopulationGuard{
+		options:     options,
+		target:      reflect.ValueOf(dst),
+		baseline:    newValueSnapshot(),
+		newSnapshot: newValueSnapshot(),
+	}
+	skipFourFrames := 4
+	guard.rearm(skipFourFrames)
+	return guard
+}
+
+func (g *PopulationGuard) populate(populate func() error, framesToSkip int) error {
+	g.verify(framesToSkip)
+	// writes made before populate panicked belong to the population window as well
+	defer g.rearm(framesToSkip)
+	return populate()
+}
+
+func (g *PopulationGuard) rearm(framesToSkip int) {
+	if g.baseline == nil {
+		return
+	}
+	g.baseline = initValueSnapshot(g.baseline, g.options, framesToSkip)
+	g.baseline = captureChecksumMap(g.baseline, g.target, g.options)
+}
+
+func (g *PopulationGuard) verify(framesToSkip int) {
+	if g.baseline == nil {
+		return
+	}
+	g.newSnapshot = initValueSnapshot(g.newSnapshot, g.options, framesToSkip)
+	g.newSnapshot = captureChecksumMap(g.newSnapshot, g.target, g.options)
+	checkErr := g.baseline.CheckImmutabilityAgainst(g.newSnapshot)
+	if checkErr != nil {
+		// re-arm, so the same mutation isn't reported twice
+		g.baseline, g.newSnapshot = g.newSnapshot, g.baseline
+		reportError(checkErr, g.options)
+	}
+}
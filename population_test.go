@@ -0,0 +1,71 @@
+package immcheck_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+type fakeRow struct {
+	id   int64
+	name string
+	err  error
+}
+
+func (r *fakeRow) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	*dest[0].(*int64) = r.id
+	*dest[1].(*string) = r.name
+	return nil
+}
+
+func TestPopulationGuard(t *testing.T) {
+	t.Parallel()
+	type user struct {
+		ID   int64
+		Name string
+	}
+	cached := &user{}
+	guard := immcheck.GuardPopulation(cached)
+	if err := guard.Scan(&fakeRow{id: 1, name: "first"}, &cached.ID, &cached.Name); err != nil {
+		t.Fatalf("unexpected error happened: %v", err)
+	}
+	guard.Verify() // populated value is fine
+	if err := guard.Scan(&fakeRow{id: 2, name: "second"}, &cached.ID, &cached.Name); err != nil {
+		t.Fatalf("unexpected error happened: %v", err)
+	}
+	scanErr := errors.New("scan failed")
+	if err := guard.Scan(&fakeRow{err: scanErr}, &cached.ID, &cached.Name); !errors.Is(err, scanErr) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	guard.Verify()
+
+	panicMessage := expectMutationPanic(t, func() {
+		cached.Name = "changed outside of population window"
+		guard.Verify()
+	})
+	checkMutationDetectionMessage(t, panicMessage)
+	guard.Verify() // guard is re-armed after reported mutation
+
+	panicMessage = expectMutationPanic(t, func() {
+		cached.ID = 42
+		_ = guard.Populate(func() error {
+			cached.ID = 3
+			return nil
+		})
+	})
+	checkMutationDetectionMessage(t, panicMessage)
+
+	// guard is re-armed even if population panics
+	func() {
+		defer func() { _ = recover() }()
+		_ = guard.Populate(func() error {
+			cached.ID = 4
+			panic("population failed")
+		})
+	}()
+	guard.Verify()
+}
@@ -0,0 +1,156 @@
+package immcheck
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+const (
+	// maxFormattedDepth limits nesting of values formatted by formatValue, deeper values are formatted as ...
+	maxFormattedDepth = 4
+	// maxFormattedItems limits the number of formatted items of slices, arrays and maps and fields of structs
+	maxFormattedItems = 16
+)
+
+// formatValue formats value deterministically for logs and reports, unlike %#v verb:
+// map entries are sorted by formatted keys, references that lead back to values being formatted
+// are formatted as <cycle>, nesting is capped by maxFormattedDepth and size by maxFormattedItems.
+// Unexported fields are formatted as well.
+func formatValue(value reflect.Value) string {
+	formatter := &valueFormatter{formatting: make(map[visitedReference]struct{})}
+	formatter.format(value, 0)
+	return formatter.buf.String()
+}
+
+type valueFormatter struct {
+	buf bytes.Buffer
+	// formatting holds references on the current formatting path to detect cycles
+	formatting map[visitedReference]struct{}
+}
+
+func (f *valueFormatter) format(value reflect.Value, depth int) {
+	valueKind := value.Kind()
+	switch valueKind {
+	case reflect.Bool:
+		f.buf.WriteString(strconv.FormatBool(value.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f.buf.WriteString(strconv.FormatInt(value.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		f.buf.WriteString(strconv.FormatUint(value.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		f.buf.WriteString(strconv.FormatFloat(value.Float(), 'g', -1, value.Type().Bits()))
+	case reflect.Complex64, reflect.Complex128:
+		f.buf.WriteString(strconv.FormatComplex(value.Complex(), 'g', -1, value.Type().Bits()))
+	case reflect.String:
+		f.buf.WriteString(strconv.Quote(value.String()))
+	case reflect.UnsafePointer, reflect.Func, reflect.Chan:
+		if value.IsNil() {
+			_, _ = fmt.Fprintf(&f.buf, "%v(nil)", value.Type())
+			return
+		}
+		_, _ = fmt.Fprintf(&f.buf, "%v(%#x)", value.Type(), value.Pointer())
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		if value.IsNil() {
+			_, _ = fmt.Fprintf(&f.buf, "%v(nil)", value.Type())
+			return
+		}
+		if valueKind == reflect.Interface {
+			f.format(value.Elem(), depth)
+			return
+		}
+		key := visitedReference{pointer: value.Pointer(), kind: valueKind}
+		if _, cycle := f.formatting[key]; cycle {
+			f.buf.WriteString("<cycle>")
+			return
+		}
+		f.formatting[key] = struct{}{}
+		defer delete(f.formatting, key)
+		if valueKind == reflect.Ptr {
+			f.buf.WriteByte('&')
+			f.format(value.Elem(), depth)
+			return
+		}
+		f.formatComposite(value, depth)
+	case reflect.Struct, reflect.Array:
+		f.formatComposite(value, depth)
+	case reflect.Invalid:
+		f.buf.WriteString("nil")
+	}
+}
+
+// formatComposite formats struct, array, slice or map as a composite literal.
+func (f *valueFormatter) formatComposite(value reflect.Value, depth int) {
+	f.buf.WriteString(value.Type().String())
+	f.buf.WriteByte('{')
+	defer f.buf.WriteByte('}')
+	if depth == maxFormattedDepth {
+		f.buf.WriteString("...")
+		return
+	}
+	var items int
+	if value.Kind() == reflect.Struct {
+		items = value.NumField()
+	} else {
+		items = value.Len()
+	}
+	formattedItems := items
+	if formattedItems > maxFormattedItems {
+		formattedItems = maxFormattedItems
+	}
+	//nolint:exhaustive
+	switch value.Kind() {
+	case reflect.Struct:
+		for i := 0; i < formattedItems; i++ {
+			f.separate(i)
+			f.buf.WriteString(value.Type().Field(i).Name)
+			f.buf.WriteString(": ")
+			f.format(value.Field(i), depth+1)
+		}
+	case reflect.Map:
+		f.formatEntries(value, formattedItems, depth)
+	default:
+		for i := 0; i < formattedItems; i++ {
+			f.separate(i)
+			f.format(value.Index(i), depth+1)
+		}
+	}
+	if items > formattedItems {
+		f.buf.WriteString(", ...")
+	}
+}
+
+// formatEntries formats first count entries of map sorted by formatted keys.
+func (f *valueFormatter) formatEntries(value reflect.Value, count int, depth int) {
+	type formattedEntry struct {
+		key       reflect.Value
+		formatted string
+		value     reflect.Value
+	}
+	entries := make([]formattedEntry, 0, value.Len())
+	iterator := exportedMapValue(value, currentInternals()).MapRange()
+	for iterator.Next() {
+		keyFormatter := &valueFormatter{formatting: f.formatting}
+		keyFormatter.format(iterator.Key(), depth+1)
+		entries = append(entries, formattedEntry{
+			key: iterator.Key(), formatted: keyFormatter.buf.String(), value: iterator.Value(),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return mapKeyLess(entries[i].key, entries[i].formatted, entries[j].key, entries[j].formatted, Options{})
+	})
+	for i := 0; i < count; i++ {
+		f.separate(i)
+		f.buf.WriteString(entries[i].formatted)
+		f.buf.WriteString(": ")
+		f.format(entries[i].value, depth+1)
+	}
+}
+
+func (f *valueFormatter) separate(item int) {
+	if item != 0 {
+		f.buf.WriteString(", ")
+	}
+}
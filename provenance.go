@@ -0,0 +1,131 @@
+package immcheck
+
+import (
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// trackedWritesCapacity is the number of the most recent writes to Tracked fields kept for provenance.
+	trackedWritesCapacity = 64
+	// trackedWriteStackDepth is the number of frames of writer's call stack recorded for every write.
+	trackedWriteStackDepth = 4
+	// maxReportedWriters is the number of the most recent writes attached to MutationError.
+	maxReportedWriters = 8
+)
+
+// Tracked is a write barrier for designated hot fields: it records call stack of every Set
+// into a global ring buffer of the most recent writes, so when immcheck detects a mutation,
+// MutationError carries "last writers" provenance that checksums alone can't provide.
+// Tracked[T] has the same memory layout as T, so it doesn't change snapshots of values that contain it.
+// The zero Tracked holds zero T.
+type Tracked[T any] struct {
+	value T
+}
+
+// Get returns value of the field.
+func (t *Tracked[T]) Get() T {
+	return t.value
+}
+
+// Set assigns value to the field and records call stack of the caller as the last writer.
+func (t *Tracked[T]) Set(value T) {
+	skipOneFrame := 1
+	trackedWrites.record(reflect.TypeOf(&t.value).Elem(), skipOneFrame)
+	t.value = value
+}
+
+// TrackedWrite describes write to immcheck.Tracked field.
+type TrackedWrite struct {
+	// Type is the type of written value, like %T verb prints it.
+	Type string
+	// Stack is the call stack of the writer, the innermost frame first.
+	Stack []Origin
+}
+
+// String provides string representation of TrackedWrite: type and call stack of the writer.
+func (w TrackedWrite) String() string {
+	result := w.Type + " written at"
+	for i, origin := range w.Stack {
+		if i > 0 {
+			result += " <-"
+		}
+		result += " " + origin.String()
+	}
+	return result
+}
+
+//nolint:gochecknoglobals // trackedWrites is global, since writes aren't bound to particular guard
+var trackedWrites = &trackedWriteLog{}
+
+// trackedWriteLog is a ring buffer of the most recent writes to Tracked fields.
+type trackedWriteLog struct {
+	// sequence is the number of writes recorded so far, it is read by every capture, so it isn't guarded by mutex
+	sequence uint64
+	mutex    sync.Mutex
+	writes   [trackedWritesCapacity]trackedWriteRecord
+}
+
+type trackedWriteRecord struct {
+	valueType reflect.Type
+	stack     [trackedWriteStackDepth]uintptr
+}
+
+func (l *trackedWriteLog) record(valueType reflect.Type, framesToSkip int) {
+	record := trackedWriteRecord{valueType: valueType}
+	skipRuntimeCallersAndRecordFrames := 2
+	runtime.Callers(framesToSkip+skipRuntimeCallersAndRecordFrames, record.stack[:])
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	sequence := atomic.LoadUint64(&l.sequence)
+	l.writes[sequence%trackedWritesCapacity] = record
+	atomic.StoreUint64(&l.sequence, sequence+1)
+}
+
+// currentSequence returns sequence of the next write, writes recorded before the call have smaller sequences.
+func (l *trackedWriteLog) currentSequence() uint64 {
+	return atomic.LoadUint64(&l.sequence)
+}
+
+// since returns up to maxReportedWriters writes with sequence not smaller than the given one, the most recent first.
+func (l *trackedWriteLog) since(sequence uint64) []TrackedWrite {
+	if l.currentSequence() <= sequence {
+		return nil
+	}
+	l.mutex.Lock()
+	last := atomic.LoadUint64(&l.sequence)
+	first := sequence
+	if last-first > maxReportedWriters {
+		first = last - maxReportedWriters
+	}
+	records := make([]trackedWriteRecord, 0, last-first)
+	for i := last; i > first; i-- {
+		records = append(records, l.writes[(i-1)%trackedWritesCapacity])
+	}
+	l.mutex.Unlock()
+
+	writes := make([]TrackedWrite, 0, len(records))
+	for _, record := range records {
+		writes = append(writes, TrackedWrite{
+			Type:  record.valueType.String(),
+			Stack: resolveStack(record.stack[:]),
+		})
+	}
+	return writes
+}
+
+func resolveStack(pcs []uintptr) []Origin {
+	var stack []Origin
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		if frame.PC != 0 {
+			stack = append(stack, Origin{File: frame.File, Line: frame.Line})
+		}
+		if !more {
+			return stack
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package immcheck_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+type trackedSettings struct {
+	Name    string
+	Retries immcheck.Tracked[int]
+}
+
+func TestTrackedWritesAreAttachedToMutationError(t *testing.T) {
+	t.Parallel()
+	settings := &trackedSettings{Name: "default"}
+	settings.Retries.Set(3)
+	snapshot := immcheck.NewValueSnapshot()
+	snapshot = immcheck.CaptureSnapshot(settings, snapshot)
+	if settings.Retries.Get() != 3 {
+		t.Fatalf("unexpected value: %v", settings.Retries.Get())
+	}
+	settings.Retries.Set(5)
+
+	err := snapshot.Check(settings, immcheck.Options{})
+	var mutationErr *immcheck.MutationError
+	if !errors.As(err, &mutationErr) {
+		t.Fatalf("mutation isn't detected: %v", err)
+	}
+	t.Log(mutationErr)
+	// write made before capture isn't reported
+	if len(mutationErr.LastWriters) != 1 {
+		t.Fatalf("unexpected last writers: %v", mutationErr.LastWriters)
+	}
+	lastWriter := mutationErr.LastWriters[0]
+	if lastWriter.Type != "int" || len(lastWriter.Stack) == 0 ||
+		!strings.HasSuffix(lastWriter.Stack[0].File, "provenance_test.go") ||
+		!strings.Contains(mutationErr.Error(), "last writer: int written at ") {
+		t.Fatalf("last writer isn't reported: %v", mutationErr)
+	}
+}
@@ -0,0 +1,85 @@
+package immcheck
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+)
+
+// SubscriberMutationError is returned by immcheck.Publish for every subscriber that mutated published value.
+// errors.Is and errors.As match the mutation.
+type SubscriberMutationError struct {
+	// Subscriber is the index of the subscriber in arguments of immcheck.Publish.
+	Subscriber int
+	// SubscriberName is the name of the subscriber function, like package.(*Type).Method.
+	SubscriberName string
+	Mutation       *MutationError
+}
+
+// Error provides human-readable description of the mutation together with the subscriber that made it.
+func (s *SubscriberMutationError) Error() string {
+	return fmt.Sprintf("subscriber #%v (%v) mutated published value: %v", s.Subscriber, s.SubscriberName, s.Mutation)
+}
+
+// Unwrap returns the mutation.
+func (s *SubscriberMutationError) Unwrap() error {
+	return s.Mutation
+}
+
+// Publish hands the same v to subscribers of fan-out one by one and verifies that none of them mutated it.
+// v is captured once according to settings specified in options and verified after every subscriber returns,
+// so a mutation is attributed to the subscriber whose callback window contains it.
+// Every subscriber is called even if previous ones mutated v.
+// Returns nil, *immcheck.SubscriberMutationError or *immcheck.CombinedError if several subscribers mutated v.
+// Mutations are returned as errors, so options related to logging and panics are ignored.
+// If inline checks are switched off by immcheck.SetRuntimeToggles, subscribers are called without verification.
+func Publish[T any](v T, options Options, subscribers ...func(T)) error {
+	target := reflect.ValueOf(&v).Elem()
+	if !target.IsValid() || (target.Kind() == reflect.Interface && target.IsNil()) {
+		panic(fmt.Errorf("%w. published value can't be nil", UnsupportedTypeError))
+	}
+	if inlineChecksDisabled() {
+		for _, subscriber := range subscribers {
+			subscriber(v)
+		}
+		return nil
+	}
+	options = withDefaultOptions(options)
+	baseline := getTempSnapshot()
+	defer func() { putTempSnapshot(baseline) }()
+	newSnapshot := getTempSnapshot()
+	defer func() { putTempSnapshot(newSnapshot) }()
+
+	skipTwoFrames := 2
+	baseline = initValueSnapshot(baseline, options, skipTwoFrames)
+	baseline = captureChecksumMap(baseline, target, options)
+	var errs []error
+	for i, subscriber := range subscribers {
+		subscriber(v)
+		newSnapshot = initValueSnapshot(newSnapshot, options, skipTwoFrames)
+		newSnapshot = captureChecksumMap(newSnapshot, target, options)
+		checkErr := baseline.CheckImmutabilityAgainst(newSnapshot)
+		if checkErr == nil {
+			continue
+		}
+		// re-arm, so mutation isn't attributed to next subscribers
+		baseline, newSnapshot = newSnapshot, baseline
+		mutationErr, ok := checkErr.(*MutationError)
+		if !ok {
+			errs = append(errs, checkErr)
+			continue
+		}
+		errs = append(errs, &SubscriberMutationError{
+			Subscriber:     i,
+			SubscriberName: runtime.FuncForPC(reflect.ValueOf(subscriber).Pointer()).Name(),
+			Mutation:       mutationErr,
+		})
+	}
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return &CombinedError{Errors: errs}
+}
@@ -0,0 +1,53 @@
+package immcheck_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+type publishedEvent struct {
+	Kind   string
+	Labels map[string]string
+}
+
+func auditSubscriber(event *publishedEvent) {
+	_ = event.Kind
+}
+
+func enrichingSubscriber(event *publishedEvent) {
+	event.Labels["enriched"] = "true"
+}
+
+func TestPublish(t *testing.T) {
+	t.Parallel()
+	event := &publishedEvent{Kind: "created", Labels: map[string]string{"env": "prod"}}
+	if err := immcheck.Publish(event, immcheck.Options{}, auditSubscriber, auditSubscriber); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err := immcheck.Publish(event, immcheck.Options{}, auditSubscriber, enrichingSubscriber, auditSubscriber)
+	var subscriberErr *immcheck.SubscriberMutationError
+	if !errors.As(err, &subscriberErr) || !errors.Is(err, immcheck.MutationDetectedError) {
+		t.Fatalf("mutation isn't reported: %v", err)
+	}
+	if subscriberErr.Subscriber != 1 || !strings.HasSuffix(subscriberErr.SubscriberName, ".enrichingSubscriber") {
+		t.Fatalf("mutation is attributed to wrong subscriber: %v", err)
+	}
+
+	delete(event.Labels, "enriched")
+	err = immcheck.Publish(event, immcheck.Options{},
+		enrichingSubscriber,
+		auditSubscriber,
+		func(event *publishedEvent) { event.Kind = "updated" },
+	)
+	var combinedErr *immcheck.CombinedError
+	if !errors.As(err, &combinedErr) || len(combinedErr.Errors) != 2 {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !errors.As(combinedErr.Errors[1], &subscriberErr) || subscriberErr.Subscriber != 2 {
+		t.Fatalf("mutation is attributed to wrong subscriber: %v", err)
+	}
+}
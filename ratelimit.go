@@ -0,0 +1,76 @@
+package immcheck
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// reportLimiters keeps one token bucket per configured rate and capture origin,
+// so reports of the same check site share the budget, while unrelated check sites don't throttle each other.
+//
+//nolint:gochecknoglobals // reportLimiters is global to share reports budget between checks of the same site
+var reportLimiters = &sync.Map{}
+
+type reportLimiterKey struct {
+	rate          float64
+	captureOrigin OriginID
+}
+
+// allowReport reports whether report of checkErr can be logged according to options.MaxReportsPerSecond.
+// Reports without capture origin, like reports of checks with SkipOriginCapturing flag, share the budget of the rate.
+func allowReport(checkErr error, options Options) bool {
+	if options.MaxReportsPerSecond <= 0 {
+		return true
+	}
+	key := reportLimiterKey{rate: options.MaxReportsPerSecond}
+	var mutationErr *MutationError
+	if errors.As(checkErr, &mutationErr) {
+		key.captureOrigin = mutationErr.CaptureOrigin
+	}
+	limiter, ok := reportLimiters.Load(key)
+	if !ok {
+		limiter, _ = reportLimiters.LoadOrStore(key, newTokenBucket(options.MaxReportsPerSecond))
+	}
+	return limiter.(*tokenBucket).take(time.Now())
+}
+
+// tokenBucket allows rate events per second with bursts of up to max(rate, 1) events.
+type tokenBucket struct {
+	rate     float64
+	capacity float64
+
+	m          sync.Mutex
+	tokens     float64
+	lastRefill time.Time
+}
+
+func newTokenBucket(rate float64) *tokenBucket {
+	capacity := rate
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &tokenBucket{
+		rate:       rate,
+		capacity:   capacity,
+		tokens:     capacity,
+		lastRefill: time.Now(),
+	}
+}
+
+func (b *tokenBucket) take(now time.Time) bool {
+	b.m.Lock()
+	defer b.m.Unlock()
+	if elapsed := now.Sub(b.lastRefill); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.rate
+		if b.tokens > b.capacity {
+			b.tokens = b.capacity
+		}
+		b.lastRefill = now
+	}
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
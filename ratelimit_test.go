@@ -0,0 +1,44 @@
+package immcheck_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+func TestMaxReportsPerSecond(t *testing.T) {
+	t.Parallel()
+	// budgets of check sites outlive the test, so repeated runs start with fresh budgets
+	immcheck.ResetReportLimiters()
+	logBuffer := &lockedWriterBuffer{buf: &bytes.Buffer{}}
+	options := immcheck.Options{
+		LogWriter:           logBuffer,
+		Flags:               immcheck.SkipPanicOnDetectedMutation,
+		MaxReportsPerSecond: 0.001,
+	}
+	counter := 0
+	for i := 0; i < 100; i++ {
+		check := immcheck.EnsureImmutabilityWithOptions(&counter, options)
+		counter++
+		check()
+	}
+	if reports := strings.Count(logBuffer.String(), "[ERROR] runtime mutation detected"); reports != 1 {
+		t.Fatalf("reports aren't limited: %v", reports)
+	}
+	// other check site with the same limit has its own budget
+	check := immcheck.EnsureImmutabilityWithOptions(&counter, options)
+	counter++
+	check()
+	if reports := strings.Count(logBuffer.String(), "[ERROR] runtime mutation detected"); reports != 2 {
+		t.Fatalf("reports of unrelated check sites are limited together: %v", reports)
+	}
+
+	expectMutationPanic(t, func() {
+		options := options
+		options.Flags = 0
+		defer immcheck.EnsureImmutabilityWithOptions(&counter, options)()
+		counter++
+	})
+}
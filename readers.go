@@ -0,0 +1,72 @@
+package immcheck
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"unsafe"
+)
+
+// GuardBytesReader captures bytes of r that aren't read yet, without copying them,
+// and returns function that verifies that they weren't mutated, like immcheck.EnsureImmutabilityWithOptions does.
+// Use it to assert that input of stream processing code isn't mutated by concurrent producers.
+// Reading from r doesn't change its bytes, so it isn't a mutation.
+func GuardBytesReader(r *bytes.Reader, options Options) func() {
+	source := readerBytes(r, "s")
+	return ensureImmutability(source[len(source)-r.Len():], options)
+}
+
+// GuardSectionReader captures bytes of r that aren't read yet, without copying them,
+// and returns function that verifies that they weren't mutated, like immcheck.GuardBytesReader does.
+// Only sections of *bytes.Reader can be guarded without copying, for sections of other readers
+// GuardSectionReader panics with immcheck.UnsupportedTypeError.
+func GuardSectionReader(r *io.SectionReader, options Options) func() {
+	underlying, ok := readerField(r, "r").Interface().(*bytes.Reader)
+	if !ok {
+		panic(fmt.Errorf("%w. section of %T can't be guarded without copying", UnsupportedTypeError, underlying))
+	}
+	source := readerBytes(underlying, "s")
+	// offsets of section are offsets within the underlying reader
+	start, end := readerField(r, "off").Int(), readerField(r, "limit").Int()
+	if end > int64(len(source)) {
+		end = int64(len(source))
+	}
+	if start > end {
+		start = end
+	}
+	return ensureImmutability(source[start:end], options)
+}
+
+// GuardBufferedReader captures bytes buffered by r, without copying them, and returns function
+// that verifies that they weren't mutated, like immcheck.GuardBytesReader does.
+// Buffered bytes are the window returned by Peek, so use it to assert that the window stays intact
+// while it is processed: the next read that fills the buffer of r again reuses its memory, so it is a mutation.
+func GuardBufferedReader(r *bufio.Reader, options Options) func() {
+	start := int(readerField(r, "r").Int())
+	return ensureImmutability(readerBytes(r, "buf")[start:start+r.Buffered()], options)
+}
+
+// readerField returns accessible view of unexported field of standard library reader.
+// Panics with immcheck.UnsupportedTypeError if the reader has no such field.
+func readerField(reader interface{}, name string) reflect.Value {
+	value := reflect.ValueOf(reader)
+	if value.IsNil() {
+		panic(fmt.Errorf("%w. target value can't be nil", UnsupportedTypeError))
+	}
+	field := value.Elem().FieldByName(name)
+	if !field.IsValid() {
+		panic(fmt.Errorf("%w. %v has no field %v", UnsupportedTypeError, value.Type(), name))
+	}
+	return reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem()
+}
+
+// readerBytes returns byte slice held by unexported field of standard library reader.
+func readerBytes(reader interface{}, name string) []byte {
+	buffer, ok := readerField(reader, name).Interface().([]byte)
+	if !ok {
+		panic(fmt.Errorf("%w. field %v of %T isn't a byte slice", UnsupportedTypeError, name, reader))
+	}
+	return buffer
+}
@@ -0,0 +1,57 @@
+package immcheck_test
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+func TestGuardReaders(t *testing.T) {
+	t.Parallel()
+	options := immcheck.Options{Flags: immcheck.SkipLoggingOnMutation}
+	input := []byte("header;payload;trailer")
+	reader := bytes.NewReader(input)
+	_, _ = reader.Read(make([]byte, 7))
+	check := immcheck.GuardBytesReader(reader, options)
+	// bytes that are already read aren't guarded, reading doesn't mutate bytes
+	input[0] = 'H'
+	_, _ = reader.Read(make([]byte, 3))
+	check()
+	expectMutationPanic(t, func() {
+		defer immcheck.GuardBytesReader(reader, options)()
+		input[len(input)-1] = 'R'
+	})
+
+	section := io.NewSectionReader(bytes.NewReader(input), 7, 7)
+	_, _ = section.Read(make([]byte, 2))
+	check = immcheck.GuardSectionReader(section, options)
+	input[7] = 'P'
+	input[14] = ','
+	check()
+	expectMutationPanic(t, func() {
+		defer immcheck.GuardSectionReader(section, options)()
+		input[10] = 'L'
+	})
+	expectPanic(t, func() {
+		immcheck.GuardSectionReader(io.NewSectionReader(strings.NewReader("text"), 0, 4), options)
+	}, immcheck.UnsupportedTypeError)
+
+	buffered := bufio.NewReaderSize(strings.NewReader(strings.Repeat("record;", 10)), 16)
+	window, _ := buffered.Peek(7)
+	check = immcheck.GuardBufferedReader(buffered, options)
+	_, _ = buffered.Discard(7)
+	check()
+	expectMutationPanic(t, func() {
+		defer immcheck.GuardBufferedReader(buffered, options)()
+		// the next fill reuses memory of processed windows
+		_, _ = buffered.Discard(buffered.Buffered())
+		_, _ = buffered.Peek(7)
+	})
+	if string(window) == "record;" {
+		t.Fatal("window is expected to be overwritten by the next fill")
+	}
+}
@@ -0,0 +1,97 @@
+package immcheck
+
+import (
+	"reflect"
+	"unsafe"
+
+	"github.com/zeebo/xxh3"
+)
+
+type visitedReference struct {
+	pointer uintptr
+	kind    reflect.Kind
+	// valueType is type of referenced value, it is set only where references to the same memory
+	// can reference values of different types, see captureReferenceByContent
+	valueType reflect.Type
+}
+
+// captureReferenceByContent captures non-nil pointer or interface without its address,
+// so equal content re-boxed into a new allocation produces the same checksums.
+// Content is bound to position of the reference, so references swapped between fields are still detected.
+func captureReferenceByContent(
+	snapshot *ValueSnapshot,
+	value reflect.Value, valuePointer unsafe.Pointer,
+	options Options,
+) *ValueSnapshot {
+	valueKind := value.Kind()
+	contentBefore := snapshot.contentDigest
+	if options.Flags&doNotDetectRefLoop != 0 {
+		options.Flags &= ^doNotDetectRefLoop
+		snapshot = captureChecksumMap(snapshot, value.Elem(), options)
+		return snapshot.bindContent(snapshot.contentDigest-contentBefore, valueKind)
+	}
+	// detect ref loop and skip
+	reference := visitedReference{pointer: uintptr(valuePointer), kind: valueKind, valueType: value.Elem().Type()}
+	if content, entered := snapshot.enterReference(reference); !entered {
+		return snapshot.bindContent(content, valueKind)
+	}
+	snapshot = captureChecksumMap(snapshot, value.Elem(), options)
+	content := snapshot.contentDigest - contentBefore
+	snapshot.visitedReferences[reference] = content
+	return snapshot.bindContent(content, valueKind)
+}
+
+// enterReference records reference as visited and reports whether it wasn't visited before,
+// references visited by snapshots that entries of sorted maps are captured from are taken into account,
+// see captureSortedMap. For visited references it returns content digest of their values,
+// which is zero while the value is still being captured.
+func (v *ValueSnapshot) enterReference(reference visitedReference) (uint32, bool) {
+	if content, visited := v.visitedReferences[reference]; visited {
+		return content, false
+	}
+	for _, inherited := range v.inheritedReferences {
+		if content, visited := inherited[reference]; visited {
+			return content, false
+		}
+	}
+	if v.visitedReferences == nil {
+		v.visitedReferences = make(map[visitedReference]uint32)
+	}
+	v.visitedReferences[reference] = 0
+	return 0, true
+}
+
+// bindContent binds content digest of a value captured by content to its position in traversal order.
+// Checksums of values captured by content don't depend on where they are referenced from,
+// so without positions equal values swapped between fields or items would produce the same snapshot.
+// Positions are advanced in traversal order, which is deterministic everywhere except entries of maps
+// and items captured as multisets, their positions are derived from keys or shared, see captureMapKey.
+func (v *ValueSnapshot) bindContent(content uint32, valueKind reflect.Kind) *ValueSnapshot {
+	binding := [2]uint32{v.contentPosition, content}
+	bindingBytes := (*[unsafe.Sizeof(binding)]byte)(unsafe.Pointer(&binding))[:]
+	bindingChecksum := uint32(xxh3.Hash(bindingBytes))
+	v.checksums[evalKey32(bindingChecksum, valueKind)] = bindingChecksum
+	v.contentPosition++
+	return v
+}
+
+// captureDynamicType captures identity of dynamic type of interface,
+// so values of different types with the same memory representation aren't considered equal.
+func captureDynamicType(snapshot *ValueSnapshot, dynamicType reflect.Type, internals runtimeInternals) *ValueSnapshot {
+	typePointer := internals.typeIdentity(dynamicType)
+	// reflect.Invalid kind separates types from references, which are keyed by reflect.Interface kind
+	snapshot.checksums[evalKey(typePointer, reflect.Invalid)] = uint32(typePointer)
+	snapshot.contentDigest += uint32(typePointer)
+	return snapshot
+}
+
+// referencedPointer returns pointer to data referenced by pointer or interface.
+// Unlike pointerOfValue, it doesn't return address of interface itself,
+// which can be re-used for different values, like pooled map keys and values.
+// Returns nil for nil references and for interfaces whose data pointer isn't available, see runtimeInternals.
+func referencedPointer(value reflect.Value, internals runtimeInternals) unsafe.Pointer {
+	if value.Kind() != reflect.Interface {
+		return pointerOfValue(value, internals)
+	}
+	return internals.interfaceData(value)
+}
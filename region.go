@@ -0,0 +1,43 @@
+package immcheck
+
+import (
+	"fmt"
+	"reflect"
+	"unsafe"
+
+	"github.com/zeebo/xxh3"
+)
+
+// regionChunkBytes is the amount of memory of a region hashed as one checksum, see immcheck.CaptureRegionUnsafe.
+const regionChunkBytes = partialVerificationUnitBytes
+
+// CaptureRegionUnsafe creates lightweight checksum representation of n bytes of memory starting at ptr
+// and stores it into dst. Returns modified dst object.
+// It is meant for memory that isn't reachable through typed Go values, like memory mapped with mmap
+// or allocated by C code, and it is unsafe: caller guarantees that the whole region is readable during the call.
+// The region is hashed in chunks of 16KiB, every chunk is hashed together with its offset,
+// so moving content within the region is a mutation, but address of the region isn't captured.
+// Panics with immcheck.UnsupportedTypeError if n is negative or ptr is nil while n isn't zero.
+func CaptureRegionUnsafe(ptr unsafe.Pointer, n int, dst *ValueSnapshot) *ValueSnapshot {
+	if n < 0 || (ptr == nil && n != 0) {
+		panic(fmt.Errorf("%w. invalid memory region of %v bytes at %p", UnsupportedTypeError, n, ptr))
+	}
+	options := withDefaultOptions(Options{})
+	skipTwoFrames := 2
+	snapshot := initValueSnapshot(dst, options, skipTwoFrames)
+	snapshot.rootType = reflect.TypeOf(ptr)
+	snapshot.rootElements = n
+	snapshot.sequenceLengths += n
+	region := bytesAt(ptr, uintptr(n))
+	for offset := 0; offset < n; offset += regionChunkBytes {
+		end := offset + regionChunkBytes
+		if end > n {
+			end = n
+		}
+		chunk := region[offset:end]
+		hashSum := uint32(xxh3.HashSeed(chunk, uint64(offset)))
+		snapshot.contentDigest += hashSum
+		snapshot = recordRawBytesChecksum(snapshot, chunk, hashSum, reflect.UnsafePointer)
+	}
+	return snapshot
+}
@@ -0,0 +1,55 @@
+package immcheck_test
+
+import (
+	"errors"
+	"testing"
+	"unsafe"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+func TestCaptureRegionUnsafe(t *testing.T) {
+	t.Parallel()
+	// memory that isn't reachable through typed values, like mmap-ed memory, is emulated by Go array
+	const chunk = 16 * 1024
+	region := make([]byte, 3*chunk+100)
+	for i := range region {
+		region[i] = byte(i % 7)
+	}
+	pointer := unsafe.Pointer(&region[0])
+	original := immcheck.CaptureRegionUnsafe(pointer, len(region), immcheck.NewValueSnapshot())
+	capture := func() error {
+		current := immcheck.CaptureRegionUnsafe(pointer, len(region), immcheck.NewValueSnapshot())
+		return original.CheckImmutabilityAgainst(current)
+	}
+	if err := capture(); err != nil {
+		t.Fatalf("unexpected error happened: %v", err)
+	}
+
+	region[chunk+5]++
+	if err := capture(); !errors.Is(err, immcheck.MutationDetectedError) {
+		t.Fatalf("mutation isn't detected: %v", err)
+	}
+	region[chunk+5]--
+
+	// chunks with equal content are swapped
+	zeroChunks := make([]byte, 2*chunk)
+	zeroChunks[3] = 1
+	zeroPointer := unsafe.Pointer(&zeroChunks[0])
+	original = immcheck.CaptureRegionUnsafe(zeroPointer, len(zeroChunks), immcheck.NewValueSnapshot())
+	zeroChunks[3], zeroChunks[chunk+3] = 0, 1
+	current := immcheck.CaptureRegionUnsafe(zeroPointer, len(zeroChunks), immcheck.NewValueSnapshot())
+	if err := original.CheckImmutabilityAgainst(current); !errors.Is(err, immcheck.MutationDetectedError) {
+		t.Fatalf("moved content isn't detected: %v", err)
+	}
+
+	original = immcheck.CaptureRegionUnsafe(pointer, len(region), immcheck.NewValueSnapshot())
+	current = immcheck.CaptureRegionUnsafe(pointer, len(region)-1, immcheck.NewValueSnapshot())
+	if err := original.CheckImmutabilityAgainst(current); !errors.Is(err, immcheck.MutationDetectedError) {
+		t.Fatalf("shrunk region isn't detected: %v", err)
+	}
+	immcheck.CaptureRegionUnsafe(nil, 0, immcheck.NewValueSnapshot())
+	expectPanic(t, func() {
+		immcheck.CaptureRegionUnsafe(nil, 1, immcheck.NewValueSnapshot())
+	}, immcheck.UnsupportedTypeError)
+}
@@ -0,0 +1,56 @@
+package immcheck
+
+import (
+	"reflect"
+)
+
+// slotContent is content digest of value referenced from an addressable slot.
+type slotContent struct {
+	slot    uintptr
+	content uint32
+}
+
+// captureReleasable captures pointer, interface or map held in addressable slot.
+// Content digests of values referenced from slots and slots that hold nil are recorded by addresses of slots,
+// so mutation that only releases references can be told apart from writes made together with it,
+// see releasedOnly. Records are appended to slices re-used by pooled snapshots, so capture doesn't allocate.
+func captureReleasable(
+	snapshot *ValueSnapshot,
+	value reflect.Value, options Options,
+	capture func(snapshot *ValueSnapshot, value reflect.Value, options Options) *ValueSnapshot,
+) *ValueSnapshot {
+	slot := value.UnsafeAddr()
+	if value.IsNil() {
+		snapshot.nilSlots = append(snapshot.nilSlots, slot)
+		return capture(snapshot, value, options)
+	}
+	contentBefore := snapshot.contentDigest
+	snapshot = capture(snapshot, value, options)
+	// the same slot can be visited several times, records of all visits are summed up by releasedOnly
+	snapshot.slotContents = append(snapshot.slotContents, slotContent{
+		slot:    slot,
+		content: snapshot.contentDigest - contentBefore,
+	})
+	return snapshot
+}
+
+// releasedOnly reports whether the only content missing from newSnapshot is content of values
+// referenced from slots that became nil.
+// Slots that aren't addressable, like map values, aren't tracked, so their releases are never pure.
+// Restored snapshots don't carry slots either.
+func releasedOnly(originalSnapshot *ValueSnapshot, newSnapshot *ValueSnapshot) bool {
+	if newSnapshot.nilReferences <= originalSnapshot.nilReferences || len(newSnapshot.nilSlots) == 0 {
+		return false
+	}
+	nilSlots := make(map[uintptr]struct{}, len(newSnapshot.nilSlots))
+	for _, slot := range newSnapshot.nilSlots {
+		nilSlots[slot] = struct{}{}
+	}
+	expectedContent := originalSnapshot.contentDigest
+	for _, slotContent := range originalSnapshot.slotContents {
+		if _, released := nilSlots[slotContent.slot]; released {
+			expectedContent -= slotContent.content
+		}
+	}
+	return expectedContent == newSnapshot.contentDigest
+}
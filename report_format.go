@@ -0,0 +1,85 @@
+package immcheck
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+)
+
+// ReportFormat specifies format of logged mutation reports.
+type ReportFormat uint8
+
+const (
+	// TextReportFormat logs multi-line human-readable reports. It is the default format.
+	TextReportFormat ReportFormat = iota
+	// JSONReportFormat logs one JSON object per line per report, so logs can be ingested without custom parsing.
+	JSONReportFormat
+)
+
+// jsonReport is a single line of JSONReportFormat.
+// Error is the same description as TextReportFormat logs, other fields break it down for ingestion.
+// Detections is set only for reports summarized by ReportAggregator.
+type jsonReport struct {
+	Time                string   `json:"time"`
+	Error               string   `json:"error"`
+	Label               string   `json:"label,omitempty"`
+	Detections          int      `json:"detections,omitempty"`
+	CaptureOrigin       string   `json:"capture_origin,omitempty"`
+	DetectionOrigin     string   `json:"detection_origin,omitempty"`
+	Type                string   `json:"type,omitempty"`
+	Elements            int      `json:"elements,omitempty"`
+	ApproximateSize     int      `json:"approximate_size,omitempty"`
+	Kinds               string   `json:"kinds,omitempty"`
+	StringDataRepointed bool     `json:"string_data_repointed,omitempty"`
+	Released            bool     `json:"released,omitempty"`
+	KeySetChanged       bool     `json:"key_set_changed,omitempty"`
+	PointerRetargeted   bool     `json:"pointer_retargeted,omitempty"`
+	UnverifiedNodes     int      `json:"unverified_nodes,omitempty"`
+	Checkpoint          int      `json:"checkpoint,omitempty"`
+	Phase               string   `json:"phase,omitempty"`
+	CgoCall             string   `json:"cgo_call,omitempty"`
+	BudgetExceeded      bool     `json:"budget_exceeded,omitempty"`
+	Diff                string   `json:"diff,omitempty"`
+	LastWriters         []string `json:"last_writers,omitempty"`
+}
+
+func writeJSONReport(logDestination io.Writer, checkErr error, detections int, options Options) {
+	report := jsonReport{
+		Time:       time.Now().UTC().Format(time.RFC3339Nano),
+		Error:      checkErr.Error(),
+		Label:      options.Label,
+		Detections: detections,
+	}
+	var mutationErr *MutationError
+	if errors.As(checkErr, &mutationErr) {
+		if origin, ok := LookupOrigin(mutationErr.CaptureOrigin); ok {
+			report.CaptureOrigin = origin.String()
+		}
+		if origin, ok := LookupOrigin(mutationErr.DetectionOrigin); ok {
+			report.DetectionOrigin = origin.String()
+		}
+		report.Type = mutationErr.Type
+		report.Elements = mutationErr.Elements
+		report.ApproximateSize = mutationErr.ApproximateSize
+		report.Kinds = mutationErr.Kinds.String()
+		report.StringDataRepointed = mutationErr.StringDataRepointed
+		report.Released = mutationErr.Released
+		report.KeySetChanged = mutationErr.KeySetChanged
+		report.PointerRetargeted = mutationErr.PointerRetargeted
+		report.UnverifiedNodes = mutationErr.UnverifiedNodes
+		report.Checkpoint = mutationErr.Checkpoint
+		report.Phase = mutationErr.Phase
+		report.CgoCall = mutationErr.CgoCall
+		report.BudgetExceeded = mutationErr.BudgetExceeded
+		report.Diff = mutationErr.Diff
+		for _, write := range mutationErr.LastWriters {
+			report.LastWriters = append(report.LastWriters, write.String())
+		}
+	}
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		return
+	}
+	_, _ = logDestination.Write(append(reportJSON, '\n'))
+}
@@ -0,0 +1,115 @@
+package immcheck_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+func TestJSONReportFormat(t *testing.T) {
+	t.Parallel()
+	logBuffer := &lockedWriterBuffer{buf: &bytes.Buffer{}}
+	options := immcheck.Options{
+		LogWriter:    logBuffer,
+		Flags:        immcheck.SkipPanicOnDetectedMutation,
+		ReportFormat: immcheck.JSONReportFormat,
+		Label:        "users cache",
+	}
+	users := []string{"first", "second"}
+	for i := 0; i < 2; i++ {
+		func() {
+			defer immcheck.EnsureImmutabilityWithOptions(&users, options)()
+			users[i] = "changed"
+		}()
+	}
+
+	lines := strings.Split(strings.TrimSuffix(logBuffer.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("unexpected number of reports: %v", logBuffer.String())
+	}
+	var report struct {
+		Time            string `json:"time"`
+		Error           string `json:"error"`
+		Label           string `json:"label"`
+		CaptureOrigin   string `json:"capture_origin"`
+		DetectionOrigin string `json:"detection_origin"`
+		Type            string `json:"type"`
+		Elements        int    `json:"elements"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &report); err != nil {
+		t.Fatalf("report isn't valid JSON: %v; %v", err, lines[0])
+	}
+	if !strings.HasPrefix(report.Error, immcheck.MutationDetectedError.Error()) ||
+		!strings.Contains(report.Error, "mutation kinds: ") || report.Label != "users cache" ||
+		report.Type != "*[]string" || report.Elements != 2 || report.Time == "" {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if !strings.Contains(report.CaptureOrigin, "report_format_test.go:") ||
+		!strings.Contains(report.DetectionOrigin, "report_format_test.go:") {
+		t.Fatalf("unexpected report origins: %+v", report)
+	}
+}
+
+func TestJSONReportPhaseAndCheckpoint(t *testing.T) {
+	t.Parallel()
+	logBuffer := &lockedWriterBuffer{buf: &bytes.Buffer{}}
+	options := immcheck.Options{
+		LogWriter:    logBuffer,
+		Flags:        immcheck.SkipPanicOnDetectedMutation,
+		ReportFormat: immcheck.JSONReportFormat,
+	}
+	order := &struct{ Amount int }{Amount: 100}
+	guard := immcheck.GuardPausable(order, options)
+	guard.Checkpoint()
+	guard.Phase("enrich") // phases are checkpoints as well
+	order.Amount = 250
+	guard.Check()
+
+	var report struct {
+		Checkpoint int    `json:"checkpoint"`
+		Phase      string `json:"phase"`
+	}
+	if err := json.Unmarshal([]byte(logBuffer.String()), &report); err != nil {
+		t.Fatalf("report isn't valid JSON: %v; %v", err, logBuffer.String())
+	}
+	if report.Phase != "enrich" || report.Checkpoint != 2 {
+		t.Fatalf("phase or checkpoint isn't reported: %v", logBuffer.String())
+	}
+}
+
+func TestJSONReportMutationDetails(t *testing.T) {
+	t.Parallel()
+	logBuffer := &lockedWriterBuffer{buf: &bytes.Buffer{}}
+	options := immcheck.Options{
+		LogWriter:    logBuffer,
+		Flags:        immcheck.SkipPanicOnDetectedMutation | immcheck.RenderDiffOnMutation,
+		ReportFormat: immcheck.JSONReportFormat,
+	}
+	owner := "owner"
+	account := &struct {
+		Owner  *string
+		Limits map[string]int
+	}{Owner: &owner, Limits: map[string]int{"daily": 100}}
+	func() {
+		defer immcheck.EnsureImmutabilityWithOptions(account, options)()
+		account.Owner = nil
+		account.Limits["monthly"] = 1000
+	}()
+
+	var report struct {
+		Error         string `json:"error"`
+		Released      bool   `json:"released"`
+		KeySetChanged bool   `json:"key_set_changed"`
+		Diff          string `json:"diff"`
+	}
+	if err := json.Unmarshal([]byte(logBuffer.String()), &report); err != nil {
+		t.Fatalf("report isn't valid JSON: %v; %v", err, logBuffer.String())
+	}
+	if !report.Released || !report.KeySetChanged || !strings.Contains(report.Diff, "- .Owner: ") ||
+		!strings.Contains(report.Error, "guarded value was released") {
+		t.Fatalf("mutation details aren't reported: %v", logBuffer.String())
+	}
+}
@@ -0,0 +1,52 @@
+package immcheck
+
+import (
+	"reflect"
+	"sync"
+	"unsafe"
+)
+
+// ReturnGuard wraps internal data returned by a library, so consumers that mutate it are caught.
+// The library returns immcheck.GuardReturn(v, options) and the consumer calls ReturnGuard.Unwrap,
+// that arms a finalization check of the data, as immcheck.CheckImmutabilityOnFinalizationWithOptions does.
+// ReturnGuard is a value type, so wrapping doesn't allocate.
+type ReturnGuard[T any] struct {
+	value   *T
+	options Options
+}
+
+// GuardReturn wraps v that must not be mutated by consumers into ReturnGuard,
+// checks are made according to settings specified in options.
+// v must be a pointer to the start of an allocation, like a pointer to a composite literal.
+func GuardReturn[T any](v *T, options Options) ReturnGuard[T] {
+	checkArenaConfined(options, "finalizer checks")
+	return ReturnGuard[T]{value: v, options: options}
+}
+
+//nolint:gochecknoglobals // armedReturns are global, since the same data can be returned by many calls
+var armedReturns = &sync.Map{} // visitedReference -> struct{}
+
+// Unwrap returns wrapped value and arms finalization check of it.
+// Values returned repeatedly, like cached data, are armed once: baseline is captured on the first Unwrap
+// and value is verified when it becomes unreachable, after that next Unwrap arms it again.
+// Returns nil for zero ReturnGuard.
+func (g ReturnGuard[T]) Unwrap() *T {
+	if g.value == nil || finalizerChecksDisabled() {
+		return g.value
+	}
+	key := visitedReference{pointer: uintptr(unsafe.Pointer(g.value)), kind: reflect.Ptr}
+	if _, armed := armedReturns.LoadOrStore(key, struct{}{}); armed {
+		return g.value
+	}
+	options := withDefaultOptions(g.options)
+	originalSnapshot := getTempSnapshot() // finalizer returns this snapshot to the pool
+	skipThreeFrames := 3
+	originalSnapshot = initValueSnapshot(originalSnapshot, options, skipThreeFrames)
+	originalSnapshot = captureChecksumMap(originalSnapshot, reflect.ValueOf(g.value), options)
+	lifecycle := newGuardLifecycle(originalSnapshot, options)
+	setFinalizationCheck(g.value, originalSnapshot, func() {
+		putTempSnapshot(originalSnapshot)
+		armedReturns.Delete(key)
+	}, captureChecksumMap, lifecycle, options)
+	return g.value
+}
@@ -0,0 +1,53 @@
+package immcheck_test
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+type returnedRoutes struct {
+	routes []string
+}
+
+func (r *returnedRoutes) Routes(options immcheck.Options) immcheck.ReturnGuard[[]string] {
+	return immcheck.GuardReturn(&r.routes, options)
+}
+
+func TestReturnGuard(t *testing.T) {
+	t.Parallel()
+	if immcheck.GuardReturn[int](nil, immcheck.Options{}).Unwrap() != nil {
+		t.Fatal("nil isn't unwrapped")
+	}
+
+	logBuffer := &lockedWriterBuffer{buf: &bytes.Buffer{}}
+	options := immcheck.Options{
+		Flags:     immcheck.SkipPanicOnDetectedMutation,
+		LogWriter: logBuffer,
+	}
+	func() {
+		library := &returnedRoutes{routes: []string{"/a", "/b"}}
+		routes := library.Routes(options).Unwrap()
+		// the same internal data is armed once
+		if library.Routes(options).Unwrap() != routes {
+			t.Error("unexpected value is unwrapped")
+		}
+		(*routes)[0] = "/c"
+	}()
+
+	for i := 0; i < 10 && !strings.Contains(logBuffer.String(), "[ERROR]"); i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	resultingLog := logBuffer.String()
+	if strings.Count(resultingLog, "[ERROR] runtime mutation detected; ") != 1 {
+		t.Fatalf("unnexpected log on GC: `%v`", resultingLog)
+	}
+	if !strings.Contains(resultingLog, "returnguard_test.go:") {
+		t.Fatalf("origin isn't reported: `%v`", resultingLog)
+	}
+}
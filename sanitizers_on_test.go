@@ -0,0 +1,7 @@
+//go:build asan || msan
+// +build asan msan
+
+package immcheck_test
+
+// sanitizersEnabled reports whether tests are built with -asan or -msan.
+const sanitizersEnabled = true
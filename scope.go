@@ -0,0 +1,91 @@
+package immcheck
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Scope verifies immutability of values snapshotted within one iteration of a hot loop.
+// Unlike immcheck.EnsureImmutability, Scope doesn't allocate closures and re-uses its snapshots between iterations,
+// so guarded hot loops produce almost no garbage.
+// Typical usage:
+//
+//	scope := immcheck.CheckScope()
+//	for _, item := range items {
+//	    scope.Snapshot(&item.Value)
+//	    process(item)
+//	    scope.Close()
+//	}
+//
+// Scope isn't safe for concurrent use.
+type Scope struct {
+	options Options
+	entries []scopeEntry
+	size    int
+	scratch *ValueSnapshot
+}
+
+type scopeEntry struct {
+	target   reflect.Value
+	snapshot *ValueSnapshot
+}
+
+// CheckScope creates new re-usable immcheck.Scope.
+func CheckScope() *Scope {
+	return CheckScopeWithOptions(Options{})
+}
+
+// CheckScopeWithOptions creates new re-usable immcheck.Scope
+// that verifies values according to settings specified in options.
+func CheckScopeWithOptions(options Options) *Scope {
+	options = withDefaultOptions(options)
+	return &Scope{
+		options: options,
+		scratch: newValueSnapshot(),
+	}
+}
+
+// Snapshot captures checksum of v. v will be verified on the next Scope.Close call.
+// If inline checks are switched off by immcheck.SetRuntimeToggles, v isn't captured and won't be verified.
+func (s *Scope) Snapshot(v interface{}) {
+	if v == nil {
+		panic(fmt.Errorf("%w. target value can't be nil", UnsupportedTypeError))
+	}
+	if inlineChecksDisabled() {
+		return
+	}
+	if s.size == len(s.entries) {
+		s.entries = append(s.entries, scopeEntry{snapshot: newValueSnapshot()})
+	}
+	entry := &s.entries[s.size]
+	s.size++
+
+	skipTwoFrames := 2
+	entry.target = reflect.ValueOf(v)
+	entry.snapshot = initValueSnapshot(entry.snapshot, s.options, skipTwoFrames)
+	entry.snapshot = captureChecksumMap(entry.snapshot, entry.target, s.options)
+}
+
+// Close verifies that all values snapshotted since the previous Close call were not mutated
+// and makes Scope ready for the next iteration.
+// If mutation is detected Close will panic, unless options specify otherwise.
+func (s *Scope) Close() {
+	defer s.reset()
+	for i := 0; i < s.size; i++ {
+		entry := &s.entries[i]
+		skipTwoFrames := 2
+		s.scratch = initValueSnapshot(s.scratch, s.options, skipTwoFrames)
+		s.scratch = captureChecksumMap(s.scratch, entry.target, s.options)
+		checkErr := entry.snapshot.CheckImmutabilityAgainst(s.scratch)
+		if checkErr != nil {
+			reportError(checkErr, s.options)
+		}
+	}
+}
+
+func (s *Scope) reset() {
+	for i := 0; i < s.size; i++ {
+		s.entries[i].target = reflect.Value{}
+	}
+	s.size = 0
+}
@@ -0,0 +1,60 @@
+package immcheck_test
+
+import (
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+func TestCheckScope(t *testing.T) {
+	t.Parallel()
+	type item struct {
+		id    int
+		value []byte
+	}
+	items := make([]item, 10)
+	for i := range items {
+		items[i] = item{id: i, value: []byte("value")}
+	}
+
+	scope := immcheck.CheckScope()
+	for i := range items {
+		func() {
+			defer scope.Close()
+			scope.Snapshot(&items[i])
+			scope.Snapshot(&items[i].value)
+		}()
+	}
+
+	panicMessage := expectMutationPanic(t, func() {
+		defer scope.Close()
+		scope.Snapshot(&items[3])
+		items[3].id = 42
+	})
+	checkMutationDetectionMessage(t, panicMessage)
+
+	// scope should be re-usable after detected mutation
+	func() {
+		defer scope.Close()
+		scope.Snapshot(&items[3])
+	}()
+}
+
+func TestCheckScopeDoesNotAllocate(t *testing.T) {
+	if sanitizersEnabled {
+		t.Skip("sanitizers instrumentation adds heap allocations")
+	}
+	values := make([]int64, 16)
+	scope := immcheck.CheckScopeWithOptions(immcheck.Options{Flags: immcheck.SkipOriginCapturing})
+	allocs := testing.AllocsPerRun(100, func() {
+		for i := range values {
+			scope.Snapshot(&values[i])
+			values[i]++
+			values[i]--
+			scope.Close()
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("unexpected allocations per run: %v", allocs)
+	}
+}
@@ -0,0 +1,146 @@
+package immcheck
+
+import (
+	"bytes"
+	"container/list"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"unsafe"
+)
+
+// SelfTestReport describes results of immcheck.SelfTest.
+type SelfTestReport struct {
+	// GoVersion, GOOS and GOARCH describe the platform the self-test was run on.
+	GoVersion string
+	GOOS      string
+	GOARCH    string
+	// Internals names implementation of access to Go runtime internals used for captures, layout or reflect,
+	// see internals toggle of immcheck.SetRuntimeToggles.
+	Internals string
+	// Cases are ordered the same way they are run.
+	Cases []SelfTestCase
+}
+
+// SelfTestCase describes result of a single shape of the self-test corpus.
+type SelfTestCase struct {
+	// Name describes the shape, like "cycles".
+	Name string
+	// Err is nil if immcheck didn't report unchanged shape and reported its mutation.
+	Err error
+}
+
+// Passed reports whether all cases passed.
+func (r *SelfTestReport) Passed() bool {
+	for _, selfTestCase := range r.Cases {
+		if selfTestCase.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// String provides human-readable diagnostics, one case per line.
+func (r *SelfTestReport) String() string {
+	buf := &bytes.Buffer{}
+	_, _ = fmt.Fprintf(
+		buf, "immcheck self-test on %v %v/%v using %v internals\n",
+		r.GoVersion, r.GOOS, r.GOARCH, r.Internals,
+	)
+	for _, selfTestCase := range r.Cases {
+		if selfTestCase.Err != nil {
+			_, _ = fmt.Fprintf(buf, "FAIL %v: %v\n", selfTestCase.Name, selfTestCase.Err)
+			continue
+		}
+		_, _ = fmt.Fprintf(buf, "ok   %v\n", selfTestCase.Name)
+	}
+	return buf.String()
+}
+
+// SelfTest exercises captures against a built-in corpus of tricky shapes, like cycles, strings sharing memory
+// with byte slices, interfaces and shared backing arrays, on the current platform and Go version.
+// immcheck relies on unsafe internals of Go runtime, so run it, for example, in a test,
+// before relying on immcheck with a new Go release.
+func SelfTest() *SelfTestReport {
+	report := &SelfTestReport{
+		GoVersion: runtime.Version(), GOOS: runtime.GOOS, GOARCH: runtime.GOARCH,
+		Internals: internalsName(currentInternals()),
+	}
+	for _, shape := range selfTestCorpus() {
+		report.Cases = append(report.Cases, SelfTestCase{Name: shape.name, Err: runSelfTestShape(shape)})
+	}
+	return report
+}
+
+// selfTestShape is a value that has to be verified as unchanged and then as mutated after mutate is called.
+type selfTestShape struct {
+	name    string
+	value   interface{}
+	options Options
+	mutate  func()
+}
+
+type selfTestNode struct {
+	value int
+	next  *selfTestNode
+	any   interface{}
+}
+
+func selfTestCorpus() []selfTestShape {
+	cycle := &selfTestNode{value: 1}
+	cycle.next = &selfTestNode{value: 2, next: cycle}
+	cycle.any = cycle
+
+	stringBytes := []byte("shared")
+	sharedString := *(*string)(unsafe.Pointer(&stringBytes))
+
+	interfaces := []interface{}{1, "two", &selfTestNode{value: 3}, nil}
+
+	backingArray := make([]int, 4, 8)
+	guardedSlice, otherSlice := backingArray[:2], backingArray[1:3]
+
+	selfReferencingMap := map[string]interface{}{"key": "value"}
+	selfReferencingMap["self"] = selfReferencingMap
+
+	byValue := selfTestNode{value: 4, any: []int{1, 2}}
+	unexportedField := reflect.ValueOf(struct{ node selfTestNode }{node: byValue}).Field(0)
+
+	containerList := list.New()
+	containerList.PushBack(&selfTestNode{value: 5})
+
+	return []selfTestShape{
+		{name: "cycles", value: cycle, mutate: func() { cycle.next.value = 3 }},
+		{name: "strings sharing memory", value: &sharedString, mutate: func() { stringBytes[0] = 'S' }},
+		{name: "interfaces", value: &interfaces, mutate: func() { interfaces[0] = int64(1) }},
+		{name: "shared backing arrays", value: &guardedSlice, mutate: func() { otherSlice[0] = 1 }},
+		{
+			name: "spare capacity", value: &guardedSlice, options: Options{Flags: CaptureSliceCapacity},
+			mutate: func() { _ = append(otherSlice, 1) },
+		},
+		{name: "self-referencing maps", value: selfReferencingMap, mutate: func() { selfReferencingMap["key"] = "other" }},
+		{
+			name: "unexported fields", value: unexportedField, options: Options{Flags: AllowUnexportedAccess},
+			mutate: func() { byValue.any.([]int)[0] = 3 },
+		},
+		{name: "containers", value: containerList, mutate: func() { containerList.Front().Value.(*selfTestNode).value = 6 }},
+	}
+}
+
+func runSelfTestShape(shape selfTestShape) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("capture panicked: %v", recovered)
+		}
+	}()
+	verifyUnchanged := EnsureImmutabilityErr(shape.value, shape.options)
+	if err := verifyUnchanged(); err != nil {
+		return fmt.Errorf("unchanged value is reported: %w", err)
+	}
+	verifyMutated := EnsureImmutabilityErr(shape.value, shape.options)
+	shape.mutate()
+	if err := verifyMutated(); !errors.Is(err, MutationDetectedError) {
+		return fmt.Errorf("mutation isn't detected: %v", err)
+	}
+	return nil
+}
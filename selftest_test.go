@@ -0,0 +1,19 @@
+package immcheck_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+func TestSelfTest(t *testing.T) {
+	t.Parallel()
+	report := immcheck.SelfTest()
+	if !report.Passed() || len(report.Cases) == 0 {
+		t.Fatalf("self-test failed:\n%v", report)
+	}
+	if !strings.Contains(report.String(), "ok   cycles") {
+		t.Fatalf("unexpected diagnostics:\n%v", report)
+	}
+}
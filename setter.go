@@ -0,0 +1,280 @@
+package immcheck
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Guarded holds value that is immutable except through Guarded.Set, the official setter.
+// Snapshot of a struct value is split into units, one per top-level field,
+// so Set updates the baseline incrementally: only the unit of written field is verified, and besides it
+// only units that hold references, which can share memory with the written field, are captured again.
+// Values of other kinds and structs with immcheck tags form a single unit.
+// Guarded is safe for concurrent use, but the value itself must be read only while no Set is in progress.
+type Guarded[T any] struct {
+	mutex   sync.Mutex
+	options Options
+	value   *T
+	// units are snapshots of top-level fields of the value, or a single snapshot of the whole value
+	units       []*ValueSnapshot
+	newSnapshot *ValueSnapshot
+}
+
+// Guard captures snapshot of *v according to settings specified in options and returns Guarded setter for it.
+// *v must not be mutated after this call other than by Guarded.Set.
+// If inline checks are switched off by immcheck.SetRuntimeToggles, returned setter has no units and verifies nothing.
+func Guard[T any](v *T, options Options) *Guarded[T] {
+	if v == nil {
+		panic(fmt.Errorf("%w. target value can't be nil", UnsupportedTypeError))
+	}
+	options = withDefaultOptions(options)
+	guarded := &Guarded[T]{
+		options:     options,
+		value:       v,
+		newSnapshot: newValueSnapshot(),
+	}
+	if inlineChecksDisabled() {
+		return guarded
+	}
+	unitsCount := 1
+	if valueType := reflect.TypeOf(v).Elem(); valueType.Kind() == reflect.Struct && typeFieldRules(valueType) == nil {
+		unitsCount = valueType.NumField()
+	}
+	guarded.units = make([]*ValueSnapshot, unitsCount)
+	for i := range guarded.units {
+		skipTwoFrames := 2
+		guarded.units[i] = guarded.captureUnit(newValueSnapshot(), i, skipTwoFrames)
+	}
+	return guarded
+}
+
+// Get returns pointer to guarded value without verification. Callers must not write through returned pointer.
+func (g *Guarded[T]) Get() *T {
+	return g.value
+}
+
+// Check verifies that guarded value wasn't mutated other than by Guarded.Set.
+// Detected mutations are reported according to settings specified in options.
+func (g *Guarded[T]) Check() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	for i := range g.units {
+		skipTwoFrames := 2
+		g.verifyUnit(i, skipTwoFrames)
+	}
+}
+
+// Set assigns value to the part of guarded value at path and updates the baseline incrementally.
+// path uses the same format as immcheck.Difference.Path: .Field, [index] and ["key"] or [key] segments
+// for map entries; pointers and interfaces are dereferenced transparently, empty path is the whole value.
+// Unit that is written is verified before the assignment, so mutations made without Set aren't laundered.
+// Returns error wrapping immcheck.UnsupportedTypeError if path can't be resolved, isn't settable,
+// or value isn't assignable to it.
+func (g *Guarded[T]) Set(path string, value interface{}) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	segments, err := parseValuePath(path)
+	if err != nil {
+		return err
+	}
+	// units [from, to) are written
+	from, to := 0, len(g.units)
+	if len(g.units) > 1 && len(segments) > 0 {
+		field, ok := reflect.TypeOf(g.value).Elem().FieldByName(segments[0].field)
+		if !ok || len(field.Index) != 1 {
+			return fmt.Errorf("%w. %T has no field at path %q", UnsupportedTypeError, g.value, path)
+		}
+		from, to = field.Index[0], field.Index[0]+1
+	}
+	skipTwoFrames := 2
+	for unit := from; unit < to; unit++ {
+		g.verifyUnit(unit, skipTwoFrames)
+	}
+	if err := assignAtPath(reflect.ValueOf(g.value).Elem(), segments, value); err != nil {
+		return fmt.Errorf("%w. can't set %q of %T: %v", UnsupportedTypeError, path, g.value, err)
+	}
+	for unit := range g.units {
+		// fields can share referenced memory, so assignment can change content of units that aren't written
+		if (unit >= from && unit < to) || g.unitHoldsReferences(unit) {
+			g.units[unit] = g.captureUnit(g.units[unit], unit, skipTwoFrames)
+		}
+	}
+	return nil
+}
+
+// unitHoldsReferences reports whether unit holds pointers, interfaces, slices or maps,
+// whose content can be shared with other units.
+func (g *Guarded[T]) unitHoldsReferences(unit int) bool {
+	unitType := reflect.TypeOf(g.value).Elem()
+	if len(g.units) > 1 {
+		unitType = unitType.Field(unit).Type
+	}
+	return typeInlineContent(unitType)&(inlineReferences|inlineHeaders) != 0
+}
+
+func (g *Guarded[T]) captureUnit(dst *ValueSnapshot, unit int, framesToSkip int) *ValueSnapshot {
+	dst = initValueSnapshot(dst, g.options, framesToSkip+1)
+	if len(g.units) == 1 {
+		return captureChecksumMap(dst, reflect.ValueOf(g.value), g.options)
+	}
+	return captureChecksumMap(dst, reflect.ValueOf(g.value).Elem().Field(unit), g.options)
+}
+
+func (g *Guarded[T]) verifyUnit(unit int, framesToSkip int) {
+	g.newSnapshot = g.captureUnit(g.newSnapshot, unit, framesToSkip+1)
+	checkErr := g.units[unit].CheckImmutabilityAgainst(g.newSnapshot)
+	if checkErr == nil {
+		return
+	}
+	if mutationErr, ok := checkErr.(*MutationError); ok && len(g.units) > 1 {
+		// describe the whole guarded value instead of the unit
+		mutationErr.Type = fmt.Sprintf("%T", g.value)
+		mutationErr.Elements = len(g.units)
+	}
+	// re-arm, so the same mutation isn't reported twice
+	g.units[unit], g.newSnapshot = g.newSnapshot, g.units[unit]
+	reportError(checkErr, g.options)
+}
+
+// pathSegment is a segment of a value path: field name, slice or array index, or map key.
+type pathSegment struct {
+	field string
+	index string
+	// quoted is true if index is a quoted map key
+	quoted bool
+}
+
+func parseValuePath(path string) ([]pathSegment, error) {
+	var segments []pathSegment
+	for rest := path; rest != ""; {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("%w. empty field name in path %q", UnsupportedTypeError, path)
+			}
+			segments = append(segments, pathSegment{field: rest[1 : end+1]})
+			rest = rest[end+1:]
+		case '[':
+			segment, length, err := parseIndexSegment(rest)
+			if err != nil {
+				return nil, fmt.Errorf("%w. malformed index in path %q: %v", UnsupportedTypeError, path, err)
+			}
+			segments = append(segments, segment)
+			rest = rest[length:]
+		default:
+			return nil, fmt.Errorf("%w. path %q should start with . or [", UnsupportedTypeError, path)
+		}
+	}
+	return segments, nil
+}
+
+// parseIndexSegment parses [index] or ["key"] segment at the start of s and returns its length.
+func parseIndexSegment(s string) (pathSegment, int, error) {
+	if strings.HasPrefix(s, `["`) {
+		quoted, err := strconv.QuotedPrefix(s[1:])
+		if err != nil {
+			return pathSegment{}, 0, err
+		}
+		if !strings.HasPrefix(s[1+len(quoted):], "]") {
+			return pathSegment{}, 0, fmt.Errorf("missing ]")
+		}
+		key, err := strconv.Unquote(quoted)
+		if err != nil {
+			return pathSegment{}, 0, err
+		}
+		return pathSegment{index: key, quoted: true}, len(quoted) + 2, nil
+	}
+	end := strings.IndexByte(s, ']')
+	if end < 0 {
+		return pathSegment{}, 0, fmt.Errorf("missing ]")
+	}
+	return pathSegment{index: s[1:end]}, end + 1, nil
+}
+
+func assignAtPath(target reflect.Value, segments []pathSegment, value interface{}) error {
+	for i, segment := range segments {
+		for target.Kind() == reflect.Ptr || target.Kind() == reflect.Interface {
+			if target.IsNil() {
+				return fmt.Errorf("nil reference at segment %v", i)
+			}
+			target = target.Elem()
+		}
+		switch {
+		case segment.field != "":
+			if target.Kind() != reflect.Struct {
+				return fmt.Errorf("%v isn't a struct", target.Type())
+			}
+			target = target.FieldByName(segment.field)
+			if !target.IsValid() {
+				return fmt.Errorf("no field %v", segment.field)
+			}
+		case target.Kind() == reflect.Map:
+			key, err := parseMapKey(segment, target.Type().Key())
+			if err != nil {
+				return err
+			}
+			if i != len(segments)-1 {
+				// map entries aren't addressable, so only whole entries can be set
+				return fmt.Errorf("map entries can be set only as a whole")
+			}
+			newValue, err := assignableValue(value, target.Type().Elem())
+			if err != nil {
+				return err
+			}
+			if !target.CanInterface() {
+				return fmt.Errorf("unexported map can't be set")
+			}
+			target.SetMapIndex(key, newValue)
+			return nil
+		case target.Kind() == reflect.Slice || target.Kind() == reflect.Array:
+			index, err := strconv.Atoi(segment.index)
+			if err != nil || index < 0 || index >= target.Len() {
+				return fmt.Errorf("index %v is out of range of %v items", segment.index, target.Len())
+			}
+			target = target.Index(index)
+		default:
+			return fmt.Errorf("%v can't be indexed", target.Type())
+		}
+	}
+	if !target.CanSet() {
+		return fmt.Errorf("%v isn't settable", target.Type())
+	}
+	newValue, err := assignableValue(value, target.Type())
+	if err != nil {
+		return err
+	}
+	target.Set(newValue)
+	return nil
+}
+
+func parseMapKey(segment pathSegment, keyType reflect.Type) (reflect.Value, error) {
+	if keyType.Kind() == reflect.String {
+		if !segment.quoted {
+			return reflect.Value{}, fmt.Errorf("string map key should be quoted")
+		}
+		return reflect.ValueOf(segment.index).Convert(keyType), nil
+	}
+	key := reflect.New(keyType)
+	if _, err := fmt.Sscan(segment.index, key.Interface()); err != nil {
+		return reflect.Value{}, fmt.Errorf("can't parse map key %v as %v: %v", segment.index, keyType, err)
+	}
+	return key.Elem(), nil
+}
+
+func assignableValue(value interface{}, targetType reflect.Type) (reflect.Value, error) {
+	if value == nil {
+		return reflect.Zero(targetType), nil
+	}
+	newValue := reflect.ValueOf(value)
+	if !newValue.Type().AssignableTo(targetType) {
+		return reflect.Value{}, fmt.Errorf("%v isn't assignable to %v", newValue.Type(), targetType)
+	}
+	return newValue, nil
+}
@@ -0,0 +1,130 @@
+package immcheck_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+type guardedConfig struct {
+	Name    string
+	Limits  []int
+	Labels  map[string]string
+	Weights map[int]float64
+	Owner   *guardedOwner
+	secret  string
+}
+
+type guardedOwner struct {
+	Email string
+}
+
+func newGuardedConfig() *guardedConfig {
+	return &guardedConfig{
+		Name:    "billing",
+		Limits:  []int{10, 20},
+		Labels:  map[string]string{"env": "prod"},
+		Weights: map[int]float64{1: 0.5},
+		Owner:   &guardedOwner{Email: "a@example.com"},
+		secret:  "s",
+	}
+}
+
+func TestGuardedSet(t *testing.T) {
+	t.Parallel()
+	config := newGuardedConfig()
+	guarded := immcheck.Guard(config, immcheck.Options{})
+	sets := []struct {
+		path  string
+		value interface{}
+	}{
+		{path: ".Name", value: "payments"},
+		{path: ".Limits[1]", value: 30},
+		{path: `.Labels["env"]`, value: "staging"},
+		{path: ".Weights[2]", value: 0.25},
+		{path: ".Owner.Email", value: "b@example.com"},
+		{path: ".Limits", value: nil},
+	}
+	for _, set := range sets {
+		if err := guarded.Set(set.path, set.value); err != nil {
+			t.Fatalf("can't set %v: %v", set.path, err)
+		}
+	}
+	guarded.Check()
+	if config.Name != "payments" || config.Limits != nil || config.Labels["env"] != "staging" ||
+		config.Weights[2] != 0.25 || config.Owner.Email != "b@example.com" || guarded.Get() != config {
+		t.Fatalf("values aren't set: %+v", config)
+	}
+	if err := guarded.Set("", *newGuardedConfig()); err != nil {
+		t.Fatalf("can't set the whole value: %v", err)
+	}
+	guarded.Check()
+	if config.Name != "billing" {
+		t.Fatalf("whole value isn't set: %+v", config)
+	}
+}
+
+func TestGuardedSetThroughSharedReference(t *testing.T) {
+	t.Parallel()
+	type aliased struct {
+		Cfg   *guardedOwner
+		Alias *guardedOwner
+	}
+	owner := &guardedOwner{Email: "a@example.com"}
+	guarded := immcheck.Guard(&aliased{Cfg: owner, Alias: owner}, immcheck.Options{})
+	if err := guarded.Set(".Cfg.Email", "b@example.com"); err != nil {
+		t.Fatalf("can't set through shared reference: %v", err)
+	}
+	guarded.Check()
+	if guarded.Get().Alias.Email != "b@example.com" {
+		t.Fatalf("value isn't set: %+v", guarded.Get().Alias)
+	}
+}
+
+func TestGuardedSetRejectsInvalidPaths(t *testing.T) {
+	t.Parallel()
+	guarded := immcheck.Guard(newGuardedConfig(), immcheck.Options{})
+	sets := []struct {
+		path  string
+		value interface{}
+	}{
+		{path: "Name", value: "x"},
+		{path: ".Missing", value: "x"},
+		{path: ".Name", value: 1},
+		{path: ".Limits[5]", value: 1},
+		{path: ".Labels[env]", value: "x"},
+		{path: `.Labels["env"`, value: "x"},
+		{path: ".secret", value: "x"},
+		{path: ".Name[0]", value: "x"},
+	}
+	for _, set := range sets {
+		if err := guarded.Set(set.path, set.value); !errors.Is(err, immcheck.UnsupportedTypeError) {
+			t.Fatalf("invalid set of %v isn't rejected: %v", set.path, err)
+		}
+	}
+	guarded.Check()
+}
+
+func TestGuardedDetectsWritesBypassingSetter(t *testing.T) {
+	t.Parallel()
+	config := newGuardedConfig()
+	guarded := immcheck.Guard(config, immcheck.Options{})
+	config.Limits[0] = 11
+	checkMutationDetectionMessage(t, expectPanic(t, func() {
+		_ = guarded.Set(".Limits[1]", 30)
+	}, immcheck.MutationDetectedError))
+	// mutated unit is re-armed
+	guarded.Check()
+
+	config.Owner.Email = "c@example.com"
+	checkMutationDetectionMessage(t, expectPanic(t, guarded.Check, immcheck.MutationDetectedError))
+
+	counter := 1
+	guardedCounter := immcheck.Guard(&counter, immcheck.Options{})
+	if err := guardedCounter.Set("", 2); err != nil || counter != 2 {
+		t.Fatalf("counter isn't set: %v %v", counter, err)
+	}
+	counter = 3
+	checkMutationDetectionMessage(t, expectPanic(t, guardedCounter.Check, immcheck.MutationDetectedError))
+}
@@ -0,0 +1,153 @@
+package immcheck
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// SharedGuard is a reference-counted guard of a result shared between several callers,
+// for example, result of singleflight.Group.Do that is handed to all waiting callers.
+// Every caller acquires its own lease and releases it when done with the result.
+// Shared result is verified on every release, so the mutation is attributed to the first caller
+// that releases its lease after the mutation happened. SharedGuard is safe for concurrent use.
+type SharedGuard struct {
+	options Options
+	target  reflect.Value
+
+	m sync.Mutex
+	// baseline is nil if the guard is switched off by immcheck.SetRuntimeToggles
+	baseline     *ValueSnapshot
+	activeLeases int
+}
+
+// SharedLease is a single caller's reference to the result protected by immcheck.SharedGuard.
+type SharedLease struct {
+	guard    *SharedGuard
+	value    interface{}
+	released uint32
+}
+
+// GuardShared captures snapshot of shared result v before it is handed to callers.
+// If inline checks are switched off by immcheck.SetRuntimeToggles, leases of returned guard verify nothing.
+func GuardShared(v interface{}, options Options) *SharedGuard {
+	skipThreeFrames := 3
+	return guardShared(v, options, skipThreeFrames)
+}
+
+// Acquire registers new caller of shared result.
+func (g *SharedGuard) Acquire() *SharedLease {
+	g.m.Lock()
+	defer g.m.Unlock()
+	g.activeLeases++
+	return &SharedLease{guard: g, value: g.target.Interface()}
+}
+
+// ActiveLeases returns number of leases that aren't released yet.
+func (g *SharedGuard) ActiveLeases() int {
+	g.m.Lock()
+	defer g.m.Unlock()
+	return g.activeLeases
+}
+
+// Value returns shared result. Callers must not mutate it.
+func (l *SharedLease) Value() interface{} {
+	return l.value
+}
+
+// Release verifies that shared result wasn't mutated and releases the lease.
+// Detection origin of reported mutation points to the releasing caller.
+// Subsequent calls are no-op.
+func (l *SharedLease) Release() {
+	if !atomic.CompareAndSwapUint32(&l.released, 0, 1) {
+		return
+	}
+	skipThreeFrames := 3
+	l.guard.release(skipThreeFrames)
+}
+
+// Doer is implemented by golang.org/x/sync/singleflight.Group.
+type Doer interface {
+	Do(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool)
+}
+
+// GuardedDo executes fn through group and protects its result with immcheck.SharedGuard
+// before it is handed to waiting callers. Every caller gets its own lease that must be released.
+// Lease is nil if fn returned an error.
+func GuardedDo(
+	group Doer, key string, fn func() (interface{}, error), options Options,
+) (lease *SharedLease, shared bool, err error) {
+	options = withDefaultOptions(options)
+	var captureOrigin OriginID
+	if options.Flags&SkipOriginCapturing == 0 {
+		skipGuardedDoFrame := 1
+		captureOrigin = origins.captureOrigin(skipGuardedDoFrame)
+	}
+	result, err, shared := group.Do(key, func() (interface{}, error) {
+		v, err := fn()
+		if err != nil || v == nil {
+			return v, err
+		}
+		guard := guardShared(v, withFlags(options, options.Flags|SkipOriginCapturing), 0)
+		guard.options = options
+		if guard.baseline != nil {
+			guard.baseline.captureOrigin = captureOrigin
+		}
+		return guard, nil
+	})
+	if err != nil {
+		return nil, shared, err
+	}
+	guard, ok := result.(*SharedGuard)
+	if !ok {
+		return &SharedLease{value: result, released: 1}, shared, nil
+	}
+	return guard.Acquire(), shared, nil
+}
+
+func guardShared(v interface{}, options Options, framesToSkip int) *SharedGuard {
+	if v == nil {
+		panic(fmt.Errorf("%w. target value can't be nil", UnsupportedTypeError))
+	}
+	options = withDefaultOptions(options)
+	guard := &SharedGuard{
+		options: options,
+		target:  reflect.ValueOf(v),
+	}
+	if inlineChecksDisabled() {
+		return guard
+	}
+	guard.baseline = initValueSnapshot(newValueSnapshot(), options, framesToSkip)
+	guard.baseline = captureChecksumMap(guard.baseline, guard.target, options)
+	return guard
+}
+
+func (g *SharedGuard) release(framesToSkip int) {
+	if g.baseline == nil {
+		g.m.Lock()
+		g.activeLeases--
+		g.m.Unlock()
+		return
+	}
+	newSnapshot := getTempSnapshot()
+	newSnapshot = initValueSnapshot(newSnapshot, g.options, framesToSkip)
+	newSnapshot = captureChecksumMap(newSnapshot, g.target, g.options)
+
+	g.m.Lock()
+	g.activeLeases--
+	checkErr := g.baseline.CheckImmutabilityAgainst(newSnapshot)
+	if checkErr != nil {
+		// re-arm, so the same mutation isn't attributed to other callers,
+		// baseline is owned by the guard, while newSnapshot is returned to the pool
+		captureOrigin := g.baseline.captureOrigin
+		g.baseline.copyFrom(newSnapshot)
+		g.baseline.captureOrigin = captureOrigin
+	}
+	g.m.Unlock()
+	putTempSnapshot(newSnapshot)
+
+	if checkErr != nil {
+		reportError(checkErr, g.options)
+	}
+}
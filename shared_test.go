@@ -0,0 +1,109 @@
+package immcheck_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+// sharingGroup hands the result of the first call to all subsequent callers, like singleflight.Group
+// does for callers that wait for the same in-flight call.
+type sharingGroup struct {
+	results map[string]interface{}
+}
+
+func (g *sharingGroup) Do(key string, fn func() (interface{}, error)) (interface{}, error, bool) {
+	if result, ok := g.results[key]; ok {
+		return result, nil, true
+	}
+	result, err := fn()
+	if err == nil {
+		g.results[key] = result
+	}
+	return result, err, false
+}
+
+func TestSharedGuard(t *testing.T) {
+	t.Parallel()
+	result := &[]int{1, 2, 3}
+	guard := immcheck.GuardShared(result, immcheck.Options{})
+	first := guard.Acquire()
+	second := guard.Acquire()
+	if guard.ActiveLeases() != 2 || first.Value() != result {
+		t.Fatalf("unexpected guard state: %v", guard.ActiveLeases())
+	}
+	first.Release()
+	first.Release()
+	if guard.ActiveLeases() != 1 {
+		t.Fatalf("double release isn't ignored: %v", guard.ActiveLeases())
+	}
+
+	panicMessage := expectMutationPanic(t, func() {
+		(*second.Value().(*[]int))[0] = 42
+		second.Release()
+	})
+	checkMutationDetectionMessage(t, panicMessage)
+	if guard.ActiveLeases() != 0 {
+		t.Fatalf("lease isn't released: %v", guard.ActiveLeases())
+	}
+	guard.Acquire().Release() // mutation is reported only once
+}
+
+func TestSharedGuardReturnsSnapshotsToPool(t *testing.T) {
+	// not parallel, because tracking is process-wide
+	result := &[]int{1, 2, 3}
+	reporter := &recordingReporter{}
+	guard := immcheck.GuardShared(result, immcheck.Options{Reporter: reporter})
+	lease := guard.Acquire()
+	stop := immcheck.StartSnapshotCheckoutTracking()
+	(*result)[0] = 42
+	lease.Release()
+	stop()
+	for origin, outstanding := range immcheck.OutstandingSnapshotOrigins() {
+		if strings.HasSuffix(origin.File, "shared_test.go") {
+			t.Fatalf("snapshot that re-armed the guard isn't returned to the pool: %v %v", origin, outstanding)
+		}
+	}
+
+	// re-armed guard keeps verifying the value against its own baseline
+	guard.Acquire().Release()
+	lease = guard.Acquire()
+	(*result)[1] = 42
+	lease.Release()
+	if len(reporter.errs) != 2 {
+		t.Fatalf("unexpected reported mutations: %v", reporter.errs)
+	}
+}
+
+func TestGuardedDo(t *testing.T) {
+	t.Parallel()
+	group := &sharingGroup{results: map[string]interface{}{}}
+	load := func() (interface{}, error) {
+		return &[]string{"a"}, nil
+	}
+	first, shared, err := immcheck.GuardedDo(group, "key", load, immcheck.Options{})
+	if err != nil || shared {
+		t.Fatalf("unexpected result: %v %v", shared, err)
+	}
+	second, shared, err := immcheck.GuardedDo(group, "key", load, immcheck.Options{})
+	if err != nil || !shared || first.Value() != second.Value() {
+		t.Fatalf("result isn't shared: %v %v", shared, err)
+	}
+	first.Release()
+
+	panicMessage := expectMutationPanic(t, func() {
+		(*second.Value().(*[]string))[0] = "mutated by second caller"
+		second.Release()
+	})
+	checkMutationDetectionMessage(t, panicMessage)
+
+	failure := errors.New("load failed")
+	lease, _, err := immcheck.GuardedDo(group, "failing", func() (interface{}, error) {
+		return nil, failure
+	}, immcheck.Options{})
+	if !errors.Is(err, failure) || lease != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
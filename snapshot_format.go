@@ -0,0 +1,182 @@
+package immcheck
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// SnapshotFormatVersion is the version of binary format produced by ValueSnapshot.MarshalBinary.
+const SnapshotFormatVersion = 5
+
+// hashAlgorithmID identifies hashing algorithm used to compute checksums of a snapshot.
+type hashAlgorithmID uint8
+
+const (
+	// hashAlgorithmXXH3Low32 is the lower half of XXH3-64.
+	hashAlgorithmXXH3Low32 hashAlgorithmID = 1
+
+	currentHashAlgorithm = hashAlgorithmXXH3Low32
+)
+
+// checksumAffectingFlags is a bitmask of flags that change checksums of the same value.
+// Snapshots captured with different values of these flags can't be compared.
+const checksumAffectingFlags = CaptureSliceCapacity | CaptureStringIdentity | NormalizeFloats |
+	CompareReferencesByContent | CompareByValue
+
+//nolint:gochecknoglobals // snapshotFormatMagic is effectively a constant
+var snapshotFormatMagic = [4]byte{'I', 'M', 'C', 'K'}
+
+// Binary format layout, all numbers are little-endian:
+// magic [4]byte | format version uint8 | hash algorithm uint8 | internals uint8 | checksum mode uint32 |
+// origin file length uint32 | origin file | origin line uint32 | string identities uint32 | map key set uint32 |
+// content digest uint32 | nil references uint32 | sequence lengths uint32 | entries uint32 |
+// checksums count uint32 | (key uint32 | value uint32) sorted by key.
+const snapshotFormatHeaderSize = 4 + 1 + 1 + 1 + 4
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+// Note that checksums of pointers, maps and interfaces depend on memory addresses,
+// so restored snapshots can be verified only within the same process.
+// Use immcheck.ComputeStableDigest to verify values across processes.
+func (v *ValueSnapshot) MarshalBinary() ([]byte, error) {
+	origin, _ := LookupOrigin(v.captureOrigin)
+	const uint32Size = 4
+	size := snapshotFormatHeaderSize + uint32Size + len(origin.File) + uint32Size + uint32Size +
+		6*uint32Size + len(v.checksums)*2*uint32Size
+	result := make([]byte, 0, size)
+	result = append(result, snapshotFormatMagic[:]...)
+	result = append(result, SnapshotFormatVersion, byte(v.hashAlgorithm), byte(v.internals))
+	result = appendUint32(result, uint32(v.checksumMode))
+	result = appendUint32(result, uint32(len(origin.File)))
+	result = append(result, origin.File...)
+	result = appendUint32(result, uint32(origin.Line))
+	result = appendUint32(result, v.stringIdentities)
+	result = appendUint32(result, v.mapKeySet)
+	result = appendUint32(result, v.contentDigest)
+	result = appendUint32(result, uint32(v.nilReferences))
+	result = appendUint32(result, uint32(v.sequenceLengths))
+	result = appendUint32(result, uint32(v.entries))
+
+	keys := make([]uint32, 0, len(v.checksums))
+	for key := range v.checksums {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	result = appendUint32(result, uint32(len(keys)))
+	for _, key := range keys {
+		result = appendUint32(result, key)
+		result = appendUint32(result, v.checksums[key])
+	}
+	return result, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+// Returns immcheck.IncompatibleSnapshotError if data was produced by unsupported format version
+// or with unsupported hashing algorithm or internals and immcheck.InvalidSnapshotStateError if data is corrupted.
+func (v *ValueSnapshot) UnmarshalBinary(data []byte) error {
+	if len(data) < snapshotFormatHeaderSize || [4]byte{data[0], data[1], data[2], data[3]} != snapshotFormatMagic {
+		return fmt.Errorf("%w. snapshot header is missing", InvalidSnapshotStateError)
+	}
+	formatVersion, hashAlgorithm := data[4], hashAlgorithmID(data[5])
+	if formatVersion != SnapshotFormatVersion {
+		return fmt.Errorf(
+			"%w. unsupported snapshot format version: %v; supported version: %v",
+			IncompatibleSnapshotError, formatVersion, SnapshotFormatVersion,
+		)
+	}
+	if hashAlgorithm != currentHashAlgorithm {
+		return fmt.Errorf(
+			"%w. unsupported hashing algorithm: %v; supported algorithm: %v",
+			IncompatibleSnapshotError, hashAlgorithm, currentHashAlgorithm,
+		)
+	}
+	internals := internalsID(data[6])
+	if internals > reflectInternalsID {
+		return fmt.Errorf("%w. unsupported internals: %d", IncompatibleSnapshotError, internals)
+	}
+	reader := snapshotReader{data: data[7:]}
+	checksumMode := immutabilityCheckFlag(reader.uint32())
+	originFile := string(reader.bytes(int(reader.uint32())))
+	originLine := int(reader.uint32())
+	stringIdentities := reader.uint32()
+	mapKeySet := reader.uint32()
+	contentDigest := reader.uint32()
+	nilReferences := int(reader.uint32())
+	sequenceLengths := int(reader.uint32())
+	entries := int(reader.uint32())
+	checksumsCount := int(reader.uint32())
+	if reader.err != nil || len(reader.data) != checksumsCount*8 {
+		return fmt.Errorf("%w. snapshot data is corrupted", InvalidSnapshotStateError)
+	}
+
+	v.Reset()
+	v.hashAlgorithm = hashAlgorithm
+	v.checksumMode = checksumMode
+	v.internals = internals
+	v.stringIdentities = stringIdentities
+	v.mapKeySet = mapKeySet
+	v.contentDigest = contentDigest
+	v.nilReferences = nilReferences
+	v.sequenceLengths = sequenceLengths
+	v.entries = entries
+	if originFile != "" {
+		v.captureOrigin = origins.intern(Origin{File: originFile, Line: originLine})
+	}
+	for i := 0; i < checksumsCount; i++ {
+		key := reader.uint32()
+		v.checksums[key] = reader.uint32()
+	}
+	return nil
+}
+
+func checkSnapshotsCompatibility(originalSnapshot *ValueSnapshot, newSnapshot *ValueSnapshot) error {
+	if originalSnapshot.hashAlgorithm != newSnapshot.hashAlgorithm {
+		return fmt.Errorf(
+			"%w. snapshots were captured using different hashing algorithms: %v and %v",
+			IncompatibleSnapshotError, originalSnapshot.hashAlgorithm, newSnapshot.hashAlgorithm,
+		)
+	}
+	if originalSnapshot.checksumMode != newSnapshot.checksumMode {
+		return fmt.Errorf(
+			"%w. snapshots were captured using different options: %b and %b",
+			IncompatibleSnapshotError, originalSnapshot.checksumMode, newSnapshot.checksumMode,
+		)
+	}
+	if originalSnapshot.internals != newSnapshot.internals {
+		return fmt.Errorf(
+			"%w. snapshots were captured using different internals: %v and %v",
+			IncompatibleSnapshotError, originalSnapshot.internals, newSnapshot.internals,
+		)
+	}
+	return nil
+}
+
+func appendUint32(dst []byte, value uint32) []byte {
+	var encoded [4]byte
+	binary.LittleEndian.PutUint32(encoded[:], value)
+	return append(dst, encoded[:]...)
+}
+
+type snapshotReader struct {
+	data []byte
+	err  error
+}
+
+func (r *snapshotReader) uint32() uint32 {
+	const uint32Size = 4
+	valueBytes := r.bytes(uint32Size)
+	if valueBytes == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(valueBytes)
+}
+
+func (r *snapshotReader) bytes(n int) []byte {
+	if r.err != nil || n > len(r.data) {
+		r.err = InvalidSnapshotStateError
+		return nil
+	}
+	result := r.data[:n]
+	r.data = r.data[n:]
+	return result
+}
@@ -0,0 +1,81 @@
+package immcheck_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+func TestSnapshotBinaryRoundTrip(t *testing.T) {
+	t.Parallel()
+	value := map[string][]int{"a": {1, 2, 3}, "b": {4}}
+	snapshot := immcheck.CaptureSnapshot(&value, immcheck.NewValueSnapshot())
+	data, err := snapshot.MarshalBinary()
+	if err != nil {
+		t.Fatalf("unexpected error happened: %v", err)
+	}
+
+	restored := immcheck.NewValueSnapshot()
+	if err := restored.UnmarshalBinary(data); err != nil {
+		t.Fatalf("unexpected error happened: %v", err)
+	}
+	if restored.OriginID() != snapshot.OriginID() {
+		t.Fatalf("origin isn't restored: %v", restored)
+	}
+	err = restored.CheckImmutabilityAgainst(immcheck.CaptureSnapshot(&value, immcheck.NewValueSnapshot()))
+	if err != nil {
+		t.Fatalf("unexpected error happened: %v", err)
+	}
+
+	value["a"][0] = 0
+	err = restored.CheckImmutabilityAgainst(immcheck.CaptureSnapshot(&value, immcheck.NewValueSnapshot()))
+	if !errors.Is(err, immcheck.MutationDetectedError) {
+		t.Fatalf("mutation isn't detected: %v", err)
+	}
+}
+
+func TestSnapshotBinaryIncompatibility(t *testing.T) {
+	t.Parallel()
+	value := 1
+	data, err := immcheck.CaptureSnapshot(&value, immcheck.NewValueSnapshot()).MarshalBinary()
+	if err != nil {
+		t.Fatalf("unexpected error happened: %v", err)
+	}
+	{
+		unknownVersion := append([]byte{}, data...)
+		unknownVersion[4] = immcheck.SnapshotFormatVersion + 1
+		err := immcheck.NewValueSnapshot().UnmarshalBinary(unknownVersion)
+		if !errors.Is(err, immcheck.IncompatibleSnapshotError) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	{
+		unknownAlgorithm := append([]byte{}, data...)
+		unknownAlgorithm[5] = 0xFF
+		err := immcheck.NewValueSnapshot().UnmarshalBinary(unknownAlgorithm)
+		if !errors.Is(err, immcheck.IncompatibleSnapshotError) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	{
+		unknownInternals := append([]byte{}, data...)
+		unknownInternals[6] = 0xFF
+		err := immcheck.NewValueSnapshot().UnmarshalBinary(unknownInternals)
+		if !errors.Is(err, immcheck.IncompatibleSnapshotError) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	{
+		err := immcheck.NewValueSnapshot().UnmarshalBinary(data[:len(data)-1])
+		if !errors.Is(err, immcheck.InvalidSnapshotStateError) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	{
+		err := immcheck.NewValueSnapshot().UnmarshalBinary([]byte("garbage"))
+		if !errors.Is(err, immcheck.InvalidSnapshotStateError) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
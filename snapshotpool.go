@@ -0,0 +1,111 @@
+package immcheck
+
+import (
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+//nolint:gochecknoglobals // tempSnapshotsPool is global to maximise snapshot objects re-use
+var tempSnapshotsPool = &sync.Pool{
+	New: func() interface{} {
+		return newValueSnapshot()
+	},
+}
+
+//nolint:gochecknoglobals // checkouts of pooled snapshots are tracked process-wide
+var (
+	outstandingSnapshots int64
+	checkoutTrackers     int32
+	trackedCheckouts     int64
+	checkouts            = &snapshotCheckouts{origins: make(map[*ValueSnapshot]OriginID)}
+)
+
+type snapshotCheckouts struct {
+	m       sync.Mutex
+	origins map[*ValueSnapshot]OriginID
+}
+
+// OutstandingSnapshots returns the number of pooled snapshots that are currently in use.
+// Baseline snapshots of checks returned by immcheck.EnsureImmutability are in use until checks are called,
+// so steadily growing number means that some returned checks are never called.
+// Use immcheck.StartSnapshotCheckoutTracking to find such code paths.
+func OutstandingSnapshots() int64 {
+	return atomic.LoadInt64(&outstandingSnapshots)
+}
+
+// StartSnapshotCheckoutTracking starts recording of places where pooled snapshots are checked out
+// and returns function that stops it. Recorded places of snapshots that are still in use
+// can be listed using immcheck.OutstandingSnapshotOrigins.
+// Tracking adds overhead to every check, so it is meant for debugging.
+func StartSnapshotCheckoutTracking() (stop func()) {
+	atomic.AddInt32(&checkoutTrackers, 1)
+	stopped := int32(0)
+	return func() {
+		if atomic.CompareAndSwapInt32(&stopped, 0, 1) {
+			atomic.AddInt32(&checkoutTrackers, -1)
+		}
+	}
+}
+
+// OutstandingSnapshotOrigins returns the number of pooled snapshots that are still in use
+// by places in user code where they were checked out.
+// Only snapshots checked out while tracking was started with immcheck.StartSnapshotCheckoutTracking are counted.
+func OutstandingSnapshotOrigins() map[Origin]int {
+	checkouts.m.Lock()
+	defer checkouts.m.Unlock()
+	result := make(map[Origin]int, len(checkouts.origins))
+	for _, id := range checkouts.origins {
+		origin, _ := LookupOrigin(id)
+		result[origin]++
+	}
+	return result
+}
+
+func getTempSnapshot() *ValueSnapshot {
+	snapshot := tempSnapshotsPool.Get().(*ValueSnapshot)
+	atomic.AddInt64(&outstandingSnapshots, 1)
+	if atomic.LoadInt32(&checkoutTrackers) != 0 {
+		origin := callerOutsideImmcheck()
+		checkouts.m.Lock()
+		checkouts.origins[snapshot] = origin
+		atomic.AddInt64(&trackedCheckouts, 1)
+		checkouts.m.Unlock()
+	}
+	return snapshot
+}
+
+func putTempSnapshot(snapshot *ValueSnapshot) {
+	atomic.AddInt64(&outstandingSnapshots, -1)
+	// tracked checkouts can outlive tracking, so they are checked regardless of it
+	if atomic.LoadInt64(&trackedCheckouts) != 0 {
+		checkouts.m.Lock()
+		if _, tracked := checkouts.origins[snapshot]; tracked {
+			delete(checkouts.origins, snapshot)
+			atomic.AddInt64(&trackedCheckouts, -1)
+		}
+		checkouts.m.Unlock()
+	}
+	tempSnapshotsPool.Put(snapshot)
+}
+
+// callerOutsideImmcheck interns origin of the first caller outside of immcheck package.
+func callerOutsideImmcheck() OriginID {
+	const maxFrames = 16
+	pcs := [maxFrames]uintptr{}
+	skipRuntimeCallersAndThisFunctionFrames := 2
+	callersCount := runtime.Callers(skipRuntimeCallersAndThisFunctionFrames, pcs[:])
+	frames := runtime.CallersFrames(pcs[:callersCount])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, immcheckPackagePrefix) {
+			return origins.intern(Origin{File: frame.File, Line: frame.Line})
+		}
+		if !more {
+			return 0
+		}
+	}
+}
+
+const immcheckPackagePrefix = "github.com/goodbadreviewer/immcheck."
@@ -0,0 +1,67 @@
+package immcheck_test
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+func TestSnapshotCheckoutTracking(t *testing.T) {
+	// not parallel, because tracking is process-wide
+	value := []int{1, 2, 3}
+	stop := immcheck.StartSnapshotCheckoutTracking()
+	check := immcheck.EnsureImmutability(&value)
+	stop()
+	if immcheck.OutstandingSnapshots() < 1 {
+		t.Fatalf("baseline snapshot isn't counted: %v", immcheck.OutstandingSnapshots())
+	}
+	if countLeakedChecks(immcheck.OutstandingSnapshotOrigins()) != 1 {
+		t.Fatalf("checkout origin isn't recorded: %v", immcheck.OutstandingSnapshotOrigins())
+	}
+
+	check()
+	if countLeakedChecks(immcheck.OutstandingSnapshotOrigins()) != 0 {
+		t.Fatalf("checkout origin isn't released: %v", immcheck.OutstandingSnapshotOrigins())
+	}
+}
+
+func TestNeverVerifiedCheckIsReclaimed(t *testing.T) {
+	// not parallel, because tracking is process-wide
+	value := []int{1, 2, 3}
+	logBuffer := &lockedWriterBuffer{buf: &bytes.Buffer{}}
+	stop := immcheck.StartSnapshotCheckoutTracking()
+	_ = immcheck.EnsureImmutabilityWithOptions(&value, immcheck.Options{
+		Flags:     immcheck.ReportNeverVerifiedChecks,
+		LogWriter: logBuffer,
+	})
+	stop()
+	if countLeakedChecks(immcheck.OutstandingSnapshotOrigins()) != 1 {
+		t.Fatalf("checkout origin isn't recorded: %v", immcheck.OutstandingSnapshotOrigins())
+	}
+
+	for i := 0; i < 10 && !strings.Contains(logBuffer.String(), "[WARN]"); i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if countLeakedChecks(immcheck.OutstandingSnapshotOrigins()) != 0 {
+		t.Fatalf("baseline of dropped check isn't reclaimed: %v", immcheck.OutstandingSnapshotOrigins())
+	}
+	resultingLog := logBuffer.String()
+	if !strings.Contains(resultingLog, "[WARN] immutability check was never verified; snapshot was captured here ") {
+		t.Fatalf("unexpected log: `%v`", resultingLog)
+	}
+}
+
+func countLeakedChecks(origins map[immcheck.Origin]int) int {
+	count := 0
+	for origin, outstanding := range origins {
+		if strings.HasSuffix(origin.File, "snapshotpool_test.go") {
+			count += outstanding
+		}
+	}
+	return count
+}
@@ -0,0 +1,50 @@
+package immcheck
+
+import (
+	"sync/atomic"
+)
+
+// CaptureStats describes work done by captures.
+type CaptureStats struct {
+	// NodesVisited is the number of values visited by the walker.
+	NodesVisited uint64
+	// BytesHashed is the number of bytes that were hashed.
+	BytesHashed uint64
+}
+
+//nolint:gochecknoglobals // capture stats are global, because they are collected across all captures
+var (
+	captureStatsCollectors int32
+	nodesVisited           uint64
+	bytesHashed            uint64
+)
+
+// StartCaptureStats starts collection of capture stats and returns function that stops it
+// and returns stats of all captures made in the process in between.
+// Stats collection adds overhead to captures, so it is meant for benchmarks and diagnostics.
+func StartCaptureStats() (stop func() CaptureStats) {
+	atomic.AddInt32(&captureStatsCollectors, 1)
+	start := loadCaptureStats()
+	stopped := int32(0)
+	return func() CaptureStats {
+		end := loadCaptureStats()
+		if atomic.CompareAndSwapInt32(&stopped, 0, 1) {
+			atomic.AddInt32(&captureStatsCollectors, -1)
+		}
+		return CaptureStats{
+			NodesVisited: end.NodesVisited - start.NodesVisited,
+			BytesHashed:  end.BytesHashed - start.BytesHashed,
+		}
+	}
+}
+
+func loadCaptureStats() CaptureStats {
+	return CaptureStats{
+		NodesVisited: atomic.LoadUint64(&nodesVisited),
+		BytesHashed:  atomic.LoadUint64(&bytesHashed),
+	}
+}
+
+func captureStatsEnabled() bool {
+	return atomic.LoadInt32(&captureStatsCollectors) != 0
+}
@@ -0,0 +1,25 @@
+package immcheck_test
+
+import (
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+func TestCaptureStats(t *testing.T) {
+	// not parallel, because stats are process-wide
+	value := &struct {
+		Name  string
+		Items []uint64
+	}{Name: "name", Items: []uint64{1, 2}}
+	stop := immcheck.StartCaptureStats()
+	immcheck.CaptureSnapshot(value, immcheck.NewValueSnapshot())
+	stats := stop()
+	if stats.NodesVisited < 4 || stats.BytesHashed < 4+16 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	immcheck.CaptureSnapshot(value, immcheck.NewValueSnapshot())
+	if stop() != stats {
+		t.Fatalf("stats are collected after stop: %+v", stop())
+	}
+}
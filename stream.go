@@ -0,0 +1,30 @@
+package immcheck
+
+import (
+	"io"
+	"reflect"
+	"sync/atomic"
+
+	"github.com/zeebo/xxh3"
+)
+
+// AddStream hashes content read from r until io.EOF and adds it to the snapshot as an entry labeled with label.
+// Use it to guard a value together with its serialized form, for example, config and the file it was loaded from:
+// capture both into the same snapshot and verify them jointly against a snapshot captured the same way.
+// Entries of different labels don't match, so label should identify the source, not the moment of capture.
+// Returns error returned by r, the snapshot isn't modified in this case.
+func (v *ValueSnapshot) AddStream(label string, r io.Reader) error {
+	hasher := xxh3.New()
+	streamSize, err := io.Copy(hasher, r)
+	if err != nil {
+		return err
+	}
+	hashSum := uint32(xxh3.HashStringSeed(label, hasher.Sum64()))
+	v.capturedBytes += int(streamSize)
+	if captureStatsEnabled() {
+		atomic.AddUint64(&bytesHashed, uint64(streamSize))
+	}
+	v.contentDigest += hashSum
+	v.checksums[evalKey32(hashSum, reflect.String)] = hashSum
+	return nil
+}
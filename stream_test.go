@@ -0,0 +1,43 @@
+package immcheck_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+func TestSnapshotAddStream(t *testing.T) {
+	t.Parallel()
+	config := map[string]string{"mode": "strict"}
+	serialized := `{"mode":"strict"}`
+	capture := func(serialized string) *immcheck.ValueSnapshot {
+		snapshot := immcheck.CaptureSnapshot(&config, immcheck.NewValueSnapshot())
+		if err := snapshot.AddStream("config.json", strings.NewReader(serialized)); err != nil {
+			t.Fatalf("unexpected error happened: %v", err)
+		}
+		return snapshot
+	}
+	original := capture(serialized)
+	if err := original.CheckImmutabilityAgainst(capture(serialized)); err != nil {
+		t.Fatalf("unexpected error happened: %v", err)
+	}
+	err := original.CheckImmutabilityAgainst(capture(`{"mode":"lenient"}`))
+	if !errors.Is(err, immcheck.MutationDetectedError) {
+		t.Fatalf("mutation of stream isn't detected: %v", err)
+	}
+
+	relabeled := immcheck.CaptureSnapshot(&config, immcheck.NewValueSnapshot())
+	_ = relabeled.AddStream("other.json", strings.NewReader(serialized))
+	if err := original.CheckImmutabilityAgainst(relabeled); !errors.Is(err, immcheck.MutationDetectedError) {
+		t.Fatalf("streams with different labels are equal: %v", err)
+	}
+
+	failing := immcheck.NewValueSnapshot()
+	readErr := errors.New("read failed")
+	if err := failing.AddStream("broken", iotest.ErrReader(readErr)); !errors.Is(err, readErr) {
+		t.Fatalf("read error isn't returned: %v", err)
+	}
+}
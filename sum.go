@@ -0,0 +1,86 @@
+package immcheck
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"reflect"
+
+	"github.com/zeebo/xxh3"
+)
+
+// Sum64 returns order independent fold of all entries of the snapshot.
+// Snapshots that pass ValueSnapshot.CheckImmutabilityAgainst have equal sums,
+// so Sum64 can be used as a key in dedupe maps or consistent hashing without extra walks of the value.
+// Like snapshot itself, the sum depends on memory addresses of references reachable from captured value
+// and is meaningful only within the process. Use immcheck.ComputeStableDigest for process-independent digests.
+func (v *ValueSnapshot) Sum64() uint64 {
+	var sum uint64
+	for key, value := range v.checksums {
+		sum += mix64(uint64(key)<<32 | uint64(value))
+	}
+	sum += mix64(uint64(v.stringIdentities)<<32 | uint64(v.mapKeySet))
+	return sum
+}
+
+// mix64 is the finalizer of SplitMix64, it spreads bits of entries before they are folded.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// NewHash64 returns hash.Hash64 over v: Sum64 captures snapshot of v according to settings specified in options
+// and combines ValueSnapshot.Sum64 with XXH3-64 of bytes written to the hash so far.
+// So immcheck digests can be plugged into APIs that accept hash.Hash64.
+// Every call of Sum or Sum64 captures v again, so the sum reflects the current state of v.
+func NewHash64(v interface{}, options Options) hash.Hash64 {
+	if v == nil {
+		panic(fmt.Errorf("%w. target value can't be nil", UnsupportedTypeError))
+	}
+	options = withDefaultOptions(options)
+	return &valueHash64{
+		target:  reflect.ValueOf(v),
+		options: withFlags(options, options.Flags|SkipOriginCapturing),
+		written: xxh3.New(),
+	}
+}
+
+type valueHash64 struct {
+	target  reflect.Value
+	options Options
+	written *xxh3.Hasher
+}
+
+func (h *valueHash64) Write(p []byte) (int, error) {
+	return h.written.Write(p)
+}
+
+func (h *valueHash64) Sum(b []byte) []byte {
+	var sum [8]byte
+	binary.BigEndian.PutUint64(sum[:], h.Sum64())
+	return append(b, sum[:]...)
+}
+
+func (h *valueHash64) Reset() {
+	h.written.Reset()
+}
+
+func (h *valueHash64) Size() int {
+	return 8
+}
+
+func (h *valueHash64) BlockSize() int {
+	return h.written.BlockSize()
+}
+
+func (h *valueHash64) Sum64() uint64 {
+	snapshot := getTempSnapshot()
+	defer putTempSnapshot(snapshot)
+	snapshot = initValueSnapshot(snapshot, h.options, 0)
+	snapshot = captureChecksumMap(snapshot, h.target, h.options)
+	return mix64(snapshot.Sum64() ^ h.written.Sum64())
+}
@@ -0,0 +1,46 @@
+package immcheck_test
+
+import (
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+func TestSnapshotSum64(t *testing.T) {
+	t.Parallel()
+	values := map[string][]int{"a": {1, 2}, "b": {3}}
+	first := immcheck.CaptureSnapshot(&values, immcheck.NewValueSnapshot())
+	second := immcheck.CaptureSnapshot(&values, immcheck.NewValueSnapshot())
+	if first.Sum64() != second.Sum64() {
+		t.Fatalf("equal snapshots have different sums: %x != %x", first.Sum64(), second.Sum64())
+	}
+	values["a"][0] = 5
+	mutated := immcheck.CaptureSnapshot(&values, immcheck.NewValueSnapshot())
+	if first.Sum64() == mutated.Sum64() {
+		t.Fatal("mutation doesn't change sum")
+	}
+}
+
+func TestHash64(t *testing.T) {
+	t.Parallel()
+	counter := 1
+	h := immcheck.NewHash64(&counter, immcheck.Options{})
+	sum := h.Sum64()
+	if h.Sum64() != sum || len(h.Sum(nil)) != h.Size() {
+		t.Fatal("hash isn't stable")
+	}
+	_, _ = h.Write([]byte("salt"))
+	salted := h.Sum64()
+	if salted == sum {
+		t.Fatal("written bytes don't change hash")
+	}
+	counter++
+	if h.Sum64() == salted {
+		t.Fatal("mutation doesn't change hash")
+	}
+	h.Reset()
+	counter--
+	if h.Sum64() != sum {
+		t.Fatal("hash isn't reset")
+	}
+}
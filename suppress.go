@@ -0,0 +1,77 @@
+package immcheck
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+//nolint:gochecknoglobals // suppressions are process-wide, since they are keyed by goroutines
+var (
+	activeSuppressions int32
+	suppressionsMutex  sync.Mutex
+	// suppressions maps ids of goroutines within immcheck.Suppress to number of reports suppressed so far
+	suppressions = make(map[uint64]*int)
+)
+
+// Suppress runs f and drops mutations detected by guards verified within the dynamic extent of f,
+// so known false positives can be silenced during migrations without touching every guard site.
+// Dropped mutations are neither reported to Options.Reporter, nor logged, nor cause panics.
+// Suppression is tracked per goroutine: checks done by goroutines started by f,
+// finalizers and asynchronous checks aren't suppressed. Calls can be nested.
+// Returns the number of mutations that were suppressed.
+func Suppress(f func()) (suppressed int) {
+	id := currentGoroutineID()
+	counter := new(int)
+	suppressionsMutex.Lock()
+	outer, nested := suppressions[id]
+	if nested {
+		counter = outer
+	}
+	suppressed = -*counter
+	suppressions[id] = counter
+	suppressionsMutex.Unlock()
+	atomic.AddInt32(&activeSuppressions, 1)
+	defer func() {
+		atomic.AddInt32(&activeSuppressions, -1)
+		suppressionsMutex.Lock()
+		defer suppressionsMutex.Unlock()
+		suppressed += *counter
+		if !nested {
+			delete(suppressions, id)
+		}
+	}()
+	f()
+	return suppressed
+}
+
+// suppressReport reports whether mutation detected by the current goroutine is suppressed
+// and counts it as suppressed.
+func suppressReport() bool {
+	if atomic.LoadInt32(&activeSuppressions) == 0 {
+		return false
+	}
+	id := currentGoroutineID()
+	suppressionsMutex.Lock()
+	defer suppressionsMutex.Unlock()
+	counter, ok := suppressions[id]
+	if ok {
+		*counter++
+	}
+	return ok
+}
+
+// currentGoroutineID parses id of the current goroutine from its stack trace header, like "goroutine 42 [running]:".
+// It is slow, so it is used only while suppressions are active.
+func currentGoroutineID() uint64 {
+	header := make([]byte, 64)
+	header = header[:runtime.Stack(header, false)]
+	header = bytes.TrimPrefix(header, []byte("goroutine "))
+	if end := bytes.IndexByte(header, ' '); end >= 0 {
+		header = header[:end]
+	}
+	id, _ := strconv.ParseUint(string(header), 10, 64)
+	return id
+}
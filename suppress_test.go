@@ -0,0 +1,53 @@
+package immcheck_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+func TestSuppress(t *testing.T) {
+	t.Parallel()
+	options := immcheck.Options{Flags: immcheck.SkipLoggingOnMutation}
+	value := []int{1, 2, 3}
+	suppressed := immcheck.Suppress(func() {
+		check := immcheck.EnsureImmutabilityWithOptions(&value, options)
+		value[0] = 4
+		check()
+
+		nestedSuppressed := immcheck.Suppress(func() {
+			check := immcheck.EnsureImmutabilityWithOptions(&value, options)
+			value[1] = 5
+			check()
+		})
+		if nestedSuppressed != 1 {
+			t.Errorf("unexpected number of mutations suppressed by nested call: %v", nestedSuppressed)
+		}
+
+		// other goroutines aren't suppressed
+		var otherPanic interface{}
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { otherPanic = recover() }()
+			otherValue := []int{1}
+			check := immcheck.EnsureImmutabilityWithOptions(&otherValue, options)
+			otherValue[0] = 2
+			check()
+		}()
+		wg.Wait()
+		if otherPanic == nil {
+			t.Error("mutation detected by other goroutine is suppressed")
+		}
+	})
+	if suppressed != 2 {
+		t.Fatalf("unexpected number of suppressed mutations: %v", suppressed)
+	}
+
+	expectMutationPanic(t, func() {
+		defer immcheck.EnsureImmutabilityWithOptions(&value, options)()
+		value[2] = 6
+	})
+}
@@ -0,0 +1,312 @@
+package immcheck
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/zeebo/xxh3"
+)
+
+// tagName is the key of struct tags that declare capture rules of fields, like `immcheck:"unordered"`.
+//
+// Supported options:
+//   - unordered: slice or array field is hashed as a multiset of its items,
+//     so re-ordering of items isn't a mutation, while changes of items content still are.
+//   - ignore: field is excluded from snapshots, use it for fields of inherently unsafe types, like Func or Chan.
+//     Stable digests and immcheck.WalkPair don't honour it.
+//   - keys: only key set of map field is verified, so values can be updated in place,
+//     while adding, removing or replacing keys is still a mutation.
+//   - values: only values of map field are verified as a multiset, so re-keying entries isn't a mutation,
+//     while changes of values content, additions and removals of entries still are.
+//   - tolerance=<absolute>: float32 or float64 field is rounded to the closest multiple of absolute before hashing.
+//   - relative_tolerance=<relative>: mantissa of float32 or float64 field is rounded
+//     to the closest multiple of relative before hashing.
+//   - names of string normalizers, like trim or casefold: string field is hashed after it is transformed
+//     by normalizers in the order they are listed, see immcheck.RegisterStringNormalizer.
+//
+// Tolerances quantize values, so recomputed floats that differ in the last bits aren't mutations.
+// Values that are close to each other, but are on different sides of a rounding boundary are still reported.
+const tagName = "immcheck"
+
+// RegisterStringNormalizer registers normalize under the name, so string fields tagged with the name,
+// like `immcheck:"trim,nfc"`, are hashed after normalization.
+// Use it for values that are canonically equal but byte-different after round-tripping through external systems,
+// for example, to register Unicode NFC normalization from golang.org/x/text/unicode/norm.
+// trim (strings.TrimSpace) and casefold (strings.ToLower) are registered out of the box.
+// Register normalizers at startup: tags of a type are parsed once, on the first capture of the type.
+// Later registrations for the same name replace previous ones.
+func RegisterStringNormalizer(name string, normalize func(string) string) {
+	if name == "" || strings.ContainsAny(name, ",= ") {
+		panic("string normalizer name can't be empty or contain commas, spaces and equal signs")
+	}
+	switch name {
+	case "unordered", "ignore", "keys", "values", "tolerance", "relative_tolerance":
+		panic("string normalizer name can't be the name of built-in option")
+	}
+	if normalize == nil {
+		panic("string normalizer can't be nil")
+	}
+	stringNormalizers.Store(name, normalize)
+}
+
+//nolint:gochecknoglobals // stringNormalizers is global so registration is visible to every capture
+var stringNormalizers = newStringNormalizersRegistry()
+
+func newStringNormalizersRegistry() *sync.Map {
+	registry := &sync.Map{}
+	registry.Store("trim", strings.TrimSpace)
+	registry.Store("casefold", strings.ToLower)
+	return registry
+}
+
+// fieldRule is the capture rule of a struct field declared with immcheck struct tag.
+// Fields that are captured separately are excluded from raw bytes of the struct and captured according to their rule,
+// other fields are normalized in place within raw bytes of the struct.
+type fieldRule struct {
+	index     int
+	unordered bool
+	ignore    bool
+	// keysOnly and valuesOnly limit capture of map field to its key set or values
+	keysOnly   bool
+	valuesOnly bool
+	// tolerance and relativeTolerance are zero if they aren't specified
+	tolerance         float64
+	relativeTolerance float64
+	normalizers       []func(string) string
+}
+
+//nolint:gochecknoglobals // fieldRulesCache is global to share parsed struct tags between captures
+var fieldRulesCache = newPCache(maxPoolCacheSizePerGoroutine)
+
+// typeFieldRules returns rules of fields of struct type t ordered by field index, nil if no field of t is tagged.
+func typeFieldRules(t reflect.Type) []fieldRule {
+	if plan, ok := loadTypePlan(t); ok {
+		return plan.fieldRules
+	}
+	if rules, ok := fieldRulesCache.load(t); ok {
+		return rules.([]fieldRule)
+	}
+	rules := parseFieldRules(t)
+	fieldRulesCache.store(t, rules)
+	return rules
+}
+
+func parseFieldRules(t reflect.Type) []fieldRule {
+	var rules []fieldRule
+	numField := t.NumField()
+	for i := 0; i < numField; i++ {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup(tagName)
+		ignored := fieldIgnoredByTypeDefaults(t, field.Name)
+		if (!ok || tag == "") && !ignored {
+			continue
+		}
+		rule := fieldRule{index: i, ignore: ignored}
+		var tagOptions []string
+		if tag != "" {
+			tagOptions = strings.Split(tag, ",")
+		}
+		for _, option := range tagOptions {
+			option, value := splitTagOption(option)
+			switch option {
+			case "tolerance", "relative_tolerance":
+				tolerance, err := strconv.ParseFloat(value, 64)
+				if err != nil || tolerance <= 0 || math.IsInf(tolerance, 0) {
+					panic(fmt.Errorf("%w. %v should be positive number; field: %v.%v",
+						UnsupportedTypeError, option, t, field.Name))
+				}
+				if field.Type.Kind() != reflect.Float32 && field.Type.Kind() != reflect.Float64 {
+					panic(fmt.Errorf("%w. %v option is supported only by floats; field: %v.%v",
+						UnsupportedTypeError, option, t, field.Name))
+				}
+				if option == "tolerance" {
+					rule.tolerance = tolerance
+				} else {
+					rule.relativeTolerance = tolerance
+				}
+			case "unordered":
+				if field.Type.Kind() != reflect.Slice && field.Type.Kind() != reflect.Array {
+					panic(fmt.Errorf("%w. unordered option is supported only by slices and arrays; field: %v.%v",
+						UnsupportedTypeError, t, field.Name))
+				}
+				rule.unordered = true
+			case "ignore":
+				rule.ignore = true
+			case "keys", "values":
+				if field.Type.Kind() != reflect.Map {
+					panic(fmt.Errorf("%w. %v option is supported only by maps; field: %v.%v",
+						UnsupportedTypeError, option, t, field.Name))
+				}
+				rule.keysOnly = option == "keys"
+				rule.valuesOnly = option == "values"
+			default:
+				normalizer, ok := stringNormalizers.Load(option)
+				if !ok || value != "" {
+					panic(fmt.Errorf("%w. unknown %v tag option %q of field %v.%v",
+						UnsupportedTypeError, tagName, option, t, field.Name))
+				}
+				if field.Type.Kind() != reflect.String {
+					panic(fmt.Errorf("%w. %v normalizer is supported only by strings; field: %v.%v",
+						UnsupportedTypeError, option, t, field.Name))
+				}
+				rule.normalizers = append(rule.normalizers, normalizer.(func(string) string))
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+func splitTagOption(option string) (string, string) {
+	option = strings.TrimSpace(option)
+	if separator := strings.IndexByte(option, '='); separator >= 0 {
+		return strings.TrimSpace(option[:separator]), strings.TrimSpace(option[separator+1:])
+	}
+	return option, ""
+}
+
+// capturedSeparately reports whether field is excluded from raw bytes of the struct and captured on its own.
+func (r fieldRule) capturedSeparately() bool {
+	return r.unordered || r.ignore || r.keysOnly || r.valuesOnly
+}
+
+// fieldRuleOf returns rule of the field with index, rules are ordered by field index.
+func fieldRuleOf(rules []fieldRule, index int) (fieldRule, bool) {
+	for _, rule := range rules {
+		if rule.index == index {
+			return rule, true
+		}
+	}
+	return fieldRule{}, false
+}
+
+func captureFieldByRule(snapshot *ValueSnapshot, value reflect.Value, rule fieldRule, options Options) *ValueSnapshot {
+	if rule.ignore {
+		snapshot.ignoredFields++
+		snapshot.ignoredBytes += int(value.Type().Size())
+		return snapshot
+	}
+	if rule.unordered {
+		return captureUnorderedItems(snapshot, value, options)
+	}
+	if rule.keysOnly || rule.valuesOnly {
+		return captureMapPart(snapshot, value, rule.keysOnly, options)
+	}
+	return captureChecksumMap(snapshot, value, options)
+}
+
+// captureMapPart captures either key set or values of map, together with the number of its entries.
+// Checksums of values are order independent, so values captured without keys form a multiset.
+func captureMapPart(snapshot *ValueSnapshot, value reflect.Value, keys bool, options Options) *ValueSnapshot {
+	if value.IsNil() {
+		snapshot.nilReferences++
+		return capturePointer(snapshot, nil, reflect.Map)
+	}
+	entries := value.Len()
+	snapshot.entries += entries
+	const fnvPrime32 = 16777619
+	entriesChecksum := evalKey32(uint32(entries)*fnvPrime32, reflect.Map)
+	snapshot.checksums[entriesChecksum] = uint32(entries)
+	snapshot.contentDigest += entriesChecksum
+	iterator := exportedMapValue(value, internalsOf(options)).MapRange()
+	scope := snapshot.contentPosition
+	for iterator.Next() {
+		if keys {
+			snapshot = captureMapKey(snapshot, iterator.Key(), scope, options)
+			continue
+		}
+		// values form a multiset, so content they reference is positioned the same way for all of them
+		snapshot.contentPosition = scope
+		// map can reference itself in value, so we set doNotDetectRefLoop
+		snapshot = captureChecksumMap(snapshot, iterator.Value(), withFlags(options, options.Flags|doNotDetectRefLoop))
+	}
+	snapshot.contentPosition = scope + 1
+	return snapshot
+}
+
+// captureUnorderedItems captures slice or array as a multiset: order independent fold of hashes of its items.
+func captureUnorderedItems(snapshot *ValueSnapshot, value reflect.Value, options Options) *ValueSnapshot {
+	valueKind := value.Kind()
+	if valueKind == reflect.Slice {
+		snapshot.sequenceLengths += value.Len()
+	}
+	itemType := value.Type().Elem()
+	flags := options.Flags & normalizationFlags
+	itemsCount := value.Len()
+	const fnvPrime32 = 16777619
+	items := uint32(itemsCount) * fnvPrime32
+	content := items
+	for i := 0; i < itemsCount; i++ {
+		itemBytes := convertValueTypeToBytesSlice(value.Index(i), options)
+		normalized, buffer := normalizeValueBytes(itemBytes, itemType, 1, flags)
+		items += uint32(xxh3.Hash(normalized))
+		releaseNormalizedBytes(buffer)
+
+		// addresses of references aren't content
+		itemContent, contentBuffer := normalizeValueBytes(itemBytes, itemType, 1, flags|CompareReferencesByContent)
+		content += uint32(xxh3.Hash(itemContent))
+		releaseNormalizedBytes(contentBuffer)
+	}
+	snapshot.contentDigest += content
+	snapshot = recordRawBytesChecksum(snapshot, convertSliceBasedTypeToByteSlice(value, options), items, valueKind)
+	if itemsCount == 0 || valueIsPrimitive(value.Index(0)) {
+		return snapshot
+	}
+	scope := snapshot.contentPosition
+	for i := 0; i < itemsCount; i++ {
+		// items form a multiset, so content they reference is positioned the same way for all of them
+		snapshot.contentPosition = scope
+		snapshot = captureChecksumMap(snapshot, value.Index(i), options)
+	}
+	snapshot.contentPosition = scope + 1
+	return snapshot
+}
+
+// normalizeStringAt replaces string header at offset of buf with hash of the string transformed by normalizers,
+// so normalized content is hashed in place of the header as part of raw bytes of the struct.
+func normalizeStringAt(buf []byte, offset uintptr, rule fieldRule) {
+	value := *(*string)(unsafe.Pointer(&buf[offset]))
+	for _, normalize := range rule.normalizers {
+		value = normalize(value)
+	}
+	header := (*[2]uintptr)(unsafe.Pointer(&buf[offset]))
+	header[0] = uintptr(xxh3.HashString(value))
+	header[1] = 0
+}
+
+// quantizeFloatAt replaces float at offset of buf with its value rounded according to tolerances of the rule.
+func quantizeFloatAt(buf []byte, kind reflect.Kind, offset uintptr, rule fieldRule) {
+	if kind == reflect.Float32 {
+		bits := (*uint32)(unsafe.Pointer(&buf[offset]))
+		quantized := math.Float64frombits(quantizeFloat(float64(math.Float32frombits(*bits)), rule))
+		*bits = math.Float32bits(float32(quantized))
+		return
+	}
+	bits := (*uint64)(unsafe.Pointer(&buf[offset]))
+	*bits = quantizeFloat(math.Float64frombits(*bits), rule)
+}
+
+// quantizeFloat returns bits of value rounded according to tolerances of the rule.
+func quantizeFloat(value float64, rule fieldRule) uint64 {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		bits := math.Float64bits(value)
+		normalizeFloat64(&bits)
+		return bits
+	}
+	if rule.relativeTolerance != 0 {
+		fraction, exponent := math.Frexp(value)
+		value = math.Ldexp(math.Round(fraction/rule.relativeTolerance)*rule.relativeTolerance, exponent)
+	}
+	if rule.tolerance != 0 {
+		value = math.Round(value/rule.tolerance) * rule.tolerance
+	}
+	bits := math.Float64bits(value)
+	// -0.0 and +0.0 are the same quantized value
+	normalizeFloat64(&bits)
+	return bits
+}
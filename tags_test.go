@@ -0,0 +1,302 @@
+package immcheck_test
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+type taggedRoute struct {
+	Path    string
+	Methods []string `immcheck:"unordered"`
+	Weights [3]int   `immcheck:"unordered"`
+	Owners  []*owner `immcheck:"unordered"`
+}
+
+type owner struct {
+	Name string
+}
+
+func TestUnorderedTag(t *testing.T) {
+	t.Parallel()
+	route := &taggedRoute{
+		Path:    "/",
+		Methods: []string{"POST", "GET", "PUT"},
+		Weights: [3]int{3, 1, 2},
+		Owners:  []*owner{{Name: "b"}, {Name: "a"}},
+	}
+	verify := immcheck.EnsureImmutabilityErr(route, immcheck.Options{})
+	sort.Strings(route.Methods)
+	sort.Ints(route.Weights[:])
+	route.Owners[0], route.Owners[1] = route.Owners[1], route.Owners[0]
+	if err := verify(); err != nil {
+		t.Fatalf("re-ordering is reported as mutation: %v", err)
+	}
+
+	mutations := []func(){
+		func() { route.Methods[0] = "DELETE" },
+		func() { route.Weights[0] = 5 },
+		func() { route.Owners[0].Name = "c" },
+		func() { route.Methods = route.Methods[:2] },
+		func() { route.Path = "/other" },
+	}
+	for i, mutate := range mutations {
+		verify := immcheck.EnsureImmutabilityErr(route, immcheck.Options{})
+		mutate()
+		if err := verify(); !errors.Is(err, immcheck.MutationDetectedError) {
+			t.Fatalf("mutation %v isn't detected: %v", i, err)
+		}
+	}
+}
+
+func TestUnorderedTagOfPrecompiledSlice(t *testing.T) {
+	t.Parallel()
+	type item struct {
+		IDs []int `immcheck:"unordered"`
+	}
+	immcheck.Precompile[[]item]()
+	items := []item{{IDs: []int{1, 2}}, {IDs: []int{3, 4}}}
+	verify := immcheck.EnsureImmutabilityErr(&items, immcheck.Options{})
+	items[1].IDs[0], items[1].IDs[1] = items[1].IDs[1], items[1].IDs[0]
+	if err := verify(); err != nil {
+		t.Fatalf("re-ordering is reported as mutation: %v", err)
+	}
+	items[0].IDs[0] = 5
+	if err := verify(); !errors.Is(err, immcheck.MutationDetectedError) {
+		t.Fatalf("mutation isn't detected: %v", err)
+	}
+}
+
+func TestInvalidTag(t *testing.T) {
+	t.Parallel()
+	type invalid struct {
+		Name string `immcheck:"unordered"`
+	}
+	expectPanic(t, func() {
+		immcheck.EnsureImmutability(&invalid{})()
+	}, immcheck.UnsupportedTypeError)
+}
+
+type serviceRegistry struct {
+	Services map[string]*owner `immcheck:"keys"`
+	Aliases  map[string]string `immcheck:"values"`
+}
+
+func TestMapKeysAndValuesTags(t *testing.T) {
+	t.Parallel()
+	registry := &serviceRegistry{
+		Services: map[string]*owner{"billing": {Name: "a"}, "search": {Name: "b"}},
+		Aliases:  map[string]string{"pay": "billing", "find": "search"},
+	}
+	verify := immcheck.EnsureImmutabilityErr(registry, immcheck.Options{})
+	registry.Services["billing"].Name = "c"
+	registry.Services["search"] = &owner{Name: "d"}
+	delete(registry.Aliases, "pay")
+	registry.Aliases["payments"] = "billing"
+	if err := verify(); err != nil {
+		t.Fatalf("legitimate update is reported as mutation: %v", err)
+	}
+
+	mutations := []func(){
+		func() { registry.Services["ads"] = &owner{} },
+		func() { delete(registry.Services, "search") },
+		func() { registry.Services = nil },
+		func() { registry.Aliases["find"] = "ads" },
+		func() { registry.Aliases["lookup"] = "search" },
+		func() { delete(registry.Aliases, "find") },
+	}
+	for i, mutate := range mutations {
+		verify := immcheck.EnsureImmutabilityErr(registry, immcheck.Options{})
+		mutate()
+		if err := verify(); !errors.Is(err, immcheck.MutationDetectedError) {
+			t.Fatalf("mutation %v isn't detected: %v", i, err)
+		}
+	}
+
+	type invalid struct {
+		Names []string `immcheck:"keys"`
+	}
+	expectPanic(t, func() {
+		immcheck.EnsureImmutability(&invalid{})()
+	}, immcheck.UnsupportedTypeError)
+}
+
+type derivedMetrics struct {
+	Mean     float64 `immcheck:"tolerance=1e-9"`
+	Ratio    float32 `immcheck:"relative_tolerance=1e-3"`
+	Variance float64 `immcheck:"tolerance=1e-9,relative_tolerance=1e-6"`
+	Count    int
+}
+
+func TestToleranceTag(t *testing.T) {
+	t.Parallel()
+	metrics := []derivedMetrics{
+		{Mean: 0.1 + 0.2, Ratio: 1000, Variance: 2.5},
+		{Mean: 1, Ratio: 0.5, Variance: 0},
+	}
+	verify := immcheck.EnsureImmutabilityErr(&metrics, immcheck.Options{})
+	// recomputed values differ in the last bits
+	metrics[0].Mean = 0.3
+	metrics[0].Ratio = 1000.0001
+	metrics[1].Variance = math.Copysign(0, -1)
+	if err := verify(); err != nil {
+		t.Fatalf("values within tolerance are reported as mutation: %v", err)
+	}
+
+	mutations := []func(){
+		func() { metrics[0].Mean = 0.31 },
+		func() { metrics[0].Ratio = 1010 },
+		func() { metrics[1].Variance = 1e-3 },
+		func() { metrics[1].Count = 2 },
+		func() { metrics[0], metrics[1] = metrics[1], metrics[0] },
+	}
+	for i, mutate := range mutations {
+		verify := immcheck.EnsureImmutabilityErr(&metrics, immcheck.Options{})
+		mutate()
+		if err := verify(); !errors.Is(err, immcheck.MutationDetectedError) {
+			t.Fatalf("mutation %v isn't detected: %v", i, err)
+		}
+	}
+}
+
+func TestInvalidToleranceTag(t *testing.T) {
+	t.Parallel()
+	type notFloat struct {
+		Count int `immcheck:"tolerance=1"`
+	}
+	type negative struct {
+		Value float64 `immcheck:"tolerance=-1"`
+	}
+	expectPanic(t, func() {
+		immcheck.EnsureImmutability(&notFloat{})()
+	}, immcheck.UnsupportedTypeError)
+	expectPanic(t, func() {
+		immcheck.EnsureImmutability(&negative{})()
+	}, immcheck.UnsupportedTypeError)
+}
+
+type externalRecord struct {
+	Email string `immcheck:"trim,casefold"`
+	Name  string `immcheck:"sorted"`
+	ID    string
+}
+
+func TestStringNormalizers(t *testing.T) {
+	immcheck.RegisterStringNormalizer("sorted", func(s string) string {
+		runes := []rune(s)
+		sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+		return string(runes)
+	})
+	records := []externalRecord{{Email: "User@Example.com", Name: "abc", ID: "1"}}
+	verify := immcheck.EnsureImmutabilityErr(&records, immcheck.Options{Flags: immcheck.CaptureStringIdentity})
+	// values are canonically equal after round-tripping
+	records[0].Email = strings.Clone(" user@example.com\n")
+	records[0].Name = "cab"
+	if err := verify(); err != nil {
+		t.Fatalf("canonically equal values are reported as mutation: %v", err)
+	}
+
+	mutations := []func(){
+		func() { records[0].Email = "other@example.com" },
+		func() { records[0].Name = "abd" },
+		func() { records[0].ID = "2" },
+	}
+	for i, mutate := range mutations {
+		verify := immcheck.EnsureImmutabilityErr(&records, immcheck.Options{})
+		mutate()
+		if err := verify(); !errors.Is(err, immcheck.MutationDetectedError) {
+			t.Fatalf("mutation %v isn't detected: %v", i, err)
+		}
+	}
+}
+
+type server struct {
+	Name     string
+	Handlers []serverHandler
+}
+
+type serverHandler struct {
+	Pattern  string
+	Callback func() `immcheck:"ignore"`
+	Done     chan struct{}
+}
+
+func TestIgnoreTagAndUnsupportedTypePath(t *testing.T) {
+	t.Parallel()
+	srv := &server{Name: "api", Handlers: []serverHandler{{Pattern: "/", Callback: func() {}}}}
+	panicMessage := expectPanic(t, func() {
+		immcheck.EnsureImmutability(srv)
+	}, immcheck.UnsupportedTypeError)
+	checkUnsupportedTypeMessage(t, panicMessage, "chan")
+	if !strings.Contains(panicMessage, "path: (*immcheck_test.server).Handlers[].Done; "+
+		"to exclude it add `immcheck:\"ignore\"` tag to field Done of immcheck_test.serverHandler") {
+		t.Fatalf("path to unsupported field isn't reported: %v", panicMessage)
+	}
+
+	type ignoredServer struct {
+		Name     string
+		Handlers []serverHandler `immcheck:"ignore"`
+	}
+	ignored := &ignoredServer{Name: "api", Handlers: srv.Handlers}
+	check := immcheck.EnsureImmutability(ignored)
+	ignored.Handlers[0].Pattern = "/v2"
+	check()
+	check = immcheck.EnsureImmutability(ignored)
+	ignored.Name = "admin"
+	checkMutationDetectionMessage(t, expectMutationPanic(t, check))
+}
+
+type legacyService struct {
+	Name    string
+	Workers map[string]chan int
+	Hooks   []func()
+	Parent  *legacyService
+	Logger  interface{}
+	Cleanup func() `immcheck:"ignore"`
+}
+
+func TestValidateType(t *testing.T) {
+	t.Parallel()
+	unsupported := immcheck.ValidateType(reflect.TypeOf(&legacyService{}), immcheck.Options{})
+	if len(unsupported) != 2 {
+		t.Fatalf("unexpected unsupported values: %v", unsupported)
+	}
+	for i, expected := range []struct {
+		path string
+		kind reflect.Kind
+	}{{path: ".Workers[]", kind: reflect.Chan}, {path: ".Hooks[]", kind: reflect.Func}} {
+		if unsupported[i].Path != expected.path || unsupported[i].Kind != expected.kind ||
+			unsupported[i].FieldOwner != reflect.TypeOf(legacyService{}) ||
+			unsupported[i].SuggestedTag() != "`immcheck:\"ignore\"`" ||
+			!errors.Is(unsupported[i], immcheck.UnsupportedTypeError) {
+			t.Fatalf("unexpected unsupported value: %+v", unsupported[i])
+		}
+	}
+	if immcheck.ValidateType(reflect.TypeOf(&legacyService{}), immcheck.Options{
+		Flags: immcheck.AllowInherentlyUnsafeTypes,
+	}) != nil {
+		t.Fatal("unsafe types are reported despite of AllowInherentlyUnsafeTypes flag")
+	}
+
+	var unsupportedErr *immcheck.UnsupportedKindError
+	panicMessage := expectPanic(t, func() {
+		defer func() {
+			err := recover()
+			if !errors.As(err.(error), &unsupportedErr) {
+				t.Fatalf("unexpected panic: %v", err)
+			}
+			panic(err)
+		}()
+		immcheck.ComputeStableDigest(&serverHandler{Callback: func() {}}, immcheck.Options{})
+	}, immcheck.UnsupportedTypeError)
+	t.Log(panicMessage)
+	// stable digests don't honour ignore tag
+	if unsupportedErr.Path != ".Callback" || unsupportedErr.FieldOwner != nil {
+		t.Fatalf("unexpected unsupported value: %+v", unsupportedErr)
+	}
+}
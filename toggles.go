@@ -0,0 +1,156 @@
+package immcheck
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// TogglesEnvVar is the name of environment variable that is parsed at init by immcheck.SetRuntimeToggles,
+// so behavior of already deployed binaries can be tweaked operationally, like IMMCHECK=sample=100,panic=0.
+// GODEBUG=immcheck=off is supported as well, other settings don't fit into GODEBUG format.
+const TogglesEnvVar = "IMMCHECK"
+
+const (
+	unknownToggleError    mutationDetectionError = "unknown setting"
+	unknownInternalsError mutationDetectionError = "unknown internals"
+)
+
+// runtimeToggles are process-wide overrides of immcheck behavior, see immcheck.SetRuntimeToggles.
+type runtimeToggles struct {
+	off                 bool
+	skipInline          bool
+	skipFinalizer       bool
+	sampleEvery         uint32
+	maxReportsPerSecond float64
+	skipPanic           bool
+	skipLogging         bool
+	internals           runtimeInternals
+}
+
+//nolint:gochecknoglobals // toggles are process-wide operational overrides
+var toggles atomic.Value // runtimeToggles
+
+//nolint:gochecknoinits // toggles are parsed once at startup, like GODEBUG settings of Go runtime
+func init() {
+	spec := os.Getenv(TogglesEnvVar)
+	for _, setting := range strings.Split(os.Getenv("GODEBUG"), ",") {
+		if setting == "immcheck=off" || setting == "immcheck=0" {
+			spec = "off," + spec
+		}
+	}
+	// malformed settings are ignored, the same way Go runtime ignores unknown GODEBUG settings
+	_ = SetRuntimeToggles(spec)
+}
+
+// SetRuntimeToggles replaces process-wide toggles with settings from comma separated spec.
+// Toggles override options of every call and defaults set by immcheck.SetDefaultOptions.
+// Supported settings:
+//   - off: immcheck.EnsureImmutability, immcheck.CheckImmutabilityOnFinalization and their variants
+//     don't capture snapshots and return immcheck.NoopCheck, variants that return errors report no mutations.
+//     Guards, like immcheck.Scope, immcheck.PausableGuard, immcheck.Freeze, immcheck.Guard and immcheck.Publish,
+//     are created without snapshots and never report mutations. off=false keeps checks switched on.
+//   - inline=0: only immcheck.EnsureImmutability, its variants and guards are switched off, like off does.
+//   - finalizer=0: only finalizer checks are switched off: immcheck.CheckImmutabilityOnFinalization
+//     and its variants, AlsoCheckOnFinalization flag and immcheck.ReturnGuard.
+//     Together with immcheck_inline and immcheck_finalizer build flags, see immcheck.RaceInlineChecksEnabled,
+//     inline and finalizer toggles allow to enable each mechanism independently.
+//   - sample=N: the same as Options.SampleEvery.
+//   - maxreports=N: the same as Options.MaxReportsPerSecond.
+//   - panic=0: the same as SkipPanicOnDetectedMutation flag.
+//   - log=0: the same as SkipLoggingOnMutation flag.
+//   - internals=reflect: the same as Options.SafeMode. internals=layout forces use of memory layouts
+//     of Go runtime internals even if they weren't verified for the running Go version,
+//     internals=auto restores the default. Active guards keep using internals their baselines were captured with.
+//
+// Empty spec resets all toggles. Returns error wrapping immcheck.MalformedTogglesError for malformed spec,
+// in this case toggles aren't changed.
+func SetRuntimeToggles(spec string) error {
+	parsed := runtimeToggles{}
+	for _, setting := range strings.Split(spec, ",") {
+		name, value := splitTagOption(setting)
+		var err error
+		switch name {
+		case "":
+			continue
+		case "off":
+			parsed.off = true
+			if value != "" {
+				parsed.off, err = strconv.ParseBool(value)
+			}
+		case "inline":
+			parsed.skipInline, err = parseDisabledToggle(value)
+		case "finalizer":
+			parsed.skipFinalizer, err = parseDisabledToggle(value)
+		case "sample":
+			var sampleEvery uint64
+			sampleEvery, err = strconv.ParseUint(value, 10, 32)
+			parsed.sampleEvery = uint32(sampleEvery)
+		case "maxreports":
+			parsed.maxReportsPerSecond, err = strconv.ParseFloat(value, 64)
+		case "panic":
+			parsed.skipPanic, err = parseDisabledToggle(value)
+		case "log":
+			parsed.skipLogging, err = parseDisabledToggle(value)
+		case "internals":
+			var ok bool
+			if parsed.internals, ok = parseInternalsToggle(value); !ok {
+				err = unknownInternalsError
+			}
+		default:
+			err = unknownToggleError
+		}
+		if err != nil {
+			return fmt.Errorf("%w. %q: %v", MalformedTogglesError, setting, err)
+		}
+	}
+	toggles.Store(parsed)
+	activeInternals.Store(internalsHolder{internals: parsed.internals})
+	return nil
+}
+
+func parseDisabledToggle(value string) (bool, error) {
+	enabled, err := strconv.ParseBool(value)
+	return !enabled, err
+}
+
+func loadRuntimeToggles() runtimeToggles {
+	current, _ := toggles.Load().(runtimeToggles)
+	return current
+}
+
+// inlineChecksDisabled reports whether immcheck.EnsureImmutability, its variants and guards are switched off
+// by runtime toggles.
+func inlineChecksDisabled() bool {
+	current := loadRuntimeToggles()
+	return current.off || current.skipInline
+}
+
+// finalizerChecksDisabled reports whether finalizer checks are switched off by runtime toggles.
+func finalizerChecksDisabled() bool {
+	current := loadRuntimeToggles()
+	return current.off || current.skipFinalizer
+}
+
+// withRuntimeToggles applies runtime toggles on top of options. It is idempotent.
+func withRuntimeToggles(options Options) Options {
+	current := loadRuntimeToggles()
+	if current.sampleEvery != 0 {
+		options.SampleEvery = current.sampleEvery
+	}
+	if current.maxReportsPerSecond != 0 {
+		options.MaxReportsPerSecond = current.maxReportsPerSecond
+	}
+	if current.skipPanic {
+		options.Flags |= SkipPanicOnDetectedMutation
+	}
+	if current.skipLogging {
+		options.Flags |= SkipLoggingOnMutation
+	}
+	if options.internals == nil {
+		options.internals = currentInternals()
+	}
+	return options
+}
@@ -0,0 +1,160 @@
+package immcheck_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+func TestSetRuntimeToggles(t *testing.T) {
+	// toggles are process-wide, so the test isn't parallel
+	defer func() {
+		if err := immcheck.SetRuntimeToggles(""); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	if err := immcheck.SetRuntimeToggles("off"); err != nil {
+		t.Fatal(err)
+	}
+	counter := 1
+	if !immcheck.IsNoopCheck(immcheck.EnsureImmutability(&counter)) {
+		t.Fatal("checks aren't switched off")
+	}
+	options := immcheck.Options{}
+	checkErr := immcheck.EnsureImmutabilityErr(&counter, options)
+	checkAsync := immcheck.EnsureImmutabilityAsync(&counter, options)
+	partial := immcheck.EnsureImmutabilityPartial(&counter, options)
+	if !immcheck.IsNoopCheck(immcheck.EnsureImmutabilityOnNextGC(&counter, options)) {
+		t.Fatal("checks on the next GC aren't switched off")
+	}
+	counter = 5
+	if err := checkErr(); err != nil {
+		t.Fatalf("switched off check reported mutation: %v", err)
+	}
+	if err := <-checkAsync(); err != nil {
+		t.Fatalf("switched off async check reported mutation: %v", err)
+	}
+	if done, err := partial.VerifyNext(1); !done || err != nil || partial.Units() != 0 {
+		t.Fatalf("switched off partial verification isn't done: %v %v", done, err)
+	}
+	counter = 1
+	checkGuardsSwitchedOff(t, options)
+
+	for spec, off := range map[string]bool{"off=true": true, "off=1": true, "off=false": false, "off=0": false} {
+		if err := immcheck.SetRuntimeToggles(spec); err != nil {
+			t.Fatal(err)
+		}
+		if immcheck.IsNoopCheck(immcheck.EnsureImmutability(&counter)) != off {
+			t.Fatalf("%q isn't applied", spec)
+		}
+	}
+
+	if err := immcheck.SetRuntimeToggles("panic=0, log=false"); err != nil {
+		t.Fatal(err)
+	}
+	reporter := &recordingReporter{}
+	check := immcheck.EnsureImmutabilityWithOptions(&counter, immcheck.Options{Reporter: reporter})
+	counter = 2
+	check()
+	check = immcheck.EnsureImmutability(&counter)
+	counter = 3
+	// doesn't panic
+	check()
+	if len(reporter.errs) != 1 {
+		t.Fatalf("mutation isn't reported: %v", reporter.errs)
+	}
+
+	for _, malformed := range []string{"sample=x", "panic=maybe", "off=maybe", "verbose", "internals=x"} {
+		if err := immcheck.SetRuntimeToggles(malformed); !errors.Is(err, immcheck.MalformedTogglesError) {
+			t.Fatalf("malformed toggles %q are accepted: %v", malformed, err)
+		}
+	}
+	// malformed toggles don't replace previous ones
+	check = immcheck.EnsureImmutability(&counter)
+	counter = 4
+	check()
+}
+
+// checkGuardsSwitchedOff verifies that guards created while inline checks are switched off
+// neither report nor panic on mutations.
+func checkGuardsSwitchedOff(t *testing.T, options immcheck.Options) {
+	t.Helper()
+	counter := 1
+	items := []int{1}
+	entries := map[string]int{"a": 1}
+	scope := immcheck.CheckScopeWithOptions(options)
+	scope.Snapshot(&counter)
+	pausable := immcheck.GuardPausable(&counter, options)
+	frozen := immcheck.FreezeWithOptions(&counter, options)
+	slice := immcheck.NewImmutableSlice(items, options)
+	view := immcheck.NewImmutableMap(entries, options)
+	memo := immcheck.NewMemo(func(key int) ([]int, error) { return items, nil }, options)
+	if _, err := memo.Get(0); err != nil {
+		t.Fatal(err)
+	}
+	etagged := immcheck.GuardETag(&counter, options)
+	population := immcheck.GuardPopulationWithOptions(&counter, options)
+	lease := immcheck.GuardShared(&counter, options).Acquire()
+	cgo := immcheck.GuardCgo(&counter, options)
+	guarded := immcheck.Guard(&counter, options)
+
+	counter, items[0], entries["a"] = 2, 2, 2
+	scope.Close()
+	pausable.Check()
+	pausable.Checkpoint()
+	frozen.Get()
+	slice.At(0)
+	view.Get("a")
+	if _, err := memo.Get(0); err != nil {
+		t.Fatal(err)
+	}
+	etagged.Value()
+	population.Verify()
+	lease.Release()
+	cgo.Call("C.mutate", func() { counter = 3 })
+	guarded.Check()
+	if err := guarded.Set("", 4); err != nil || counter != 4 {
+		t.Fatalf("switched off setter doesn't set value: %v %v", counter, err)
+	}
+	if err := immcheck.GuardDuringWithOptions(&counter, func() error { counter = 5; return nil }, options); err != nil {
+		t.Fatalf("switched off guarded operation reported mutation: %v", err)
+	}
+	if err := immcheck.Publish(&counter, options, func(published *int) { *published = 6 }); err != nil {
+		t.Fatalf("switched off publish reported mutation: %v", err)
+	}
+	if counter != 6 {
+		t.Fatalf("subscribers aren't called: %v", counter)
+	}
+}
+
+func TestInlineAndFinalizerToggles(t *testing.T) {
+	// toggles are process-wide, so the test isn't parallel
+	defer func() {
+		if err := immcheck.SetRuntimeToggles(""); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	counter := 1
+	recorder := &lifecycleRecorder{}
+	options := immcheck.Options{Reporter: recorder}
+
+	if err := immcheck.SetRuntimeToggles("inline=0"); err != nil {
+		t.Fatal(err)
+	}
+	if !immcheck.IsNoopCheck(immcheck.EnsureImmutabilityWithOptions(&counter, options)) {
+		t.Fatal("inline checks aren't switched off")
+	}
+	immcheck.CheckImmutabilityOnFinalizationWithOptions(&counter, options)
+	expectEvents(t, recorder.eventNames(), "created")
+
+	if err := immcheck.SetRuntimeToggles("finalizer=false"); err != nil {
+		t.Fatal(err)
+	}
+	immcheck.CheckImmutabilityOnFinalizationWithOptions(&counter, options)
+	expectEvents(t, recorder.eventNames(), "created")
+	options.Flags = immcheck.AlsoCheckOnFinalization
+	immcheck.EnsureImmutabilityWithOptions(&counter, options)()
+	expectEvents(t, recorder.eventNames(), "created", "created", "verified")
+}
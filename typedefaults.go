@@ -0,0 +1,90 @@
+package immcheck
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// captureFlags are flags that change how values are captured, so they can be registered per type.
+const captureFlags = AllowInherentlyUnsafeTypes | SkipUnsupportedTypes | CaptureSliceCapacity |
+	CaptureStringIdentity | NormalizeFloats | CompareReferencesByContent | AllowUnexportedAccess | CompareByValue
+
+// typeDefaultsEntry holds capture flags registered for a type.
+type typeDefaultsEntry struct {
+	flags      immutabilityCheckFlag
+	clearFlags immutabilityCheckFlag
+}
+
+//nolint:gochecknoglobals // typeDefaults are global, so libraries can register them for their own types
+var (
+	typeDefaults           = &sync.Map{} // reflect.Type -> typeDefaultsEntry
+	typeDefaultsRegistered uint32
+	ignoredFieldsByType    = &sync.Map{} // reflect.Type -> map[string]struct{}
+)
+
+// SetTypeDefaults registers options of a library for its own type t, so when applications guard values
+// that contain values of t, recommended rules of the library apply automatically.
+// Capture flags of options, like AllowInherentlyUnsafeTypes or NormalizeFloats, are added to options of the capture
+// and ClearFlags are removed from them for values of t and everything reachable from them.
+// Values of t stored inline in memory of other values, like fields of structs without references,
+// are hashed according to options of the enclosing value. Other options are ignored.
+// Options.IgnoredFields exclude fields of struct type t from snapshots as if they were tagged with
+// `immcheck:"ignore"`, it panics with immcheck.UnsupportedTypeError if t has no such fields.
+// Register defaults at startup, for example, in init function of the library:
+// rules of a type are parsed once, on the first capture of the type.
+func SetTypeDefaults(t reflect.Type, options Options) {
+	if len(options.IgnoredFields) != 0 {
+		if t.Kind() != reflect.Struct {
+			panic(fmt.Errorf("%w. ignored fields can be registered only for structs: %v", UnsupportedTypeError, t))
+		}
+		ignoredFields := make(map[string]struct{}, len(options.IgnoredFields))
+		for _, name := range options.IgnoredFields {
+			if _, ok := t.FieldByName(name); !ok {
+				panic(fmt.Errorf("%w. %v has no field %v", UnsupportedTypeError, t, name))
+			}
+			ignoredFields[name] = struct{}{}
+		}
+		ignoredFieldsByType.Store(t, ignoredFields)
+	}
+	typeDefaults.Store(t, typeDefaultsEntry{
+		flags:      options.Flags & captureFlags,
+		clearFlags: options.ClearFlags & captureFlags,
+	})
+	atomic.StoreUint32(&typeDefaultsRegistered, 1)
+}
+
+// withTypeDefaults applies defaults registered for type of value on top of options. It is idempotent.
+func withTypeDefaults(options Options, value reflect.Value) Options {
+	if atomic.LoadUint32(&typeDefaultsRegistered) == 0 || !value.IsValid() {
+		return options
+	}
+	entry, ok := typeDefaults.Load(value.Type())
+	if !ok {
+		return options
+	}
+	defaults := entry.(typeDefaultsEntry)
+	options.Flags = (options.Flags | defaults.flags) &^ defaults.clearFlags
+	return options
+}
+
+// typeAllowsUnsupportedKinds reports whether defaults registered for t make values of unsupported kinds
+// reachable from t legal.
+func typeAllowsUnsupportedKinds(t reflect.Type) bool {
+	if atomic.LoadUint32(&typeDefaultsRegistered) == 0 {
+		return false
+	}
+	entry, ok := typeDefaults.Load(t)
+	return ok && entry.(typeDefaultsEntry).flags&(AllowInherentlyUnsafeTypes|SkipUnsupportedTypes) != 0
+}
+
+// fieldIgnoredByTypeDefaults reports whether field of struct type t is excluded by immcheck.SetTypeDefaults.
+func fieldIgnoredByTypeDefaults(t reflect.Type, name string) bool {
+	ignoredFields, ok := ignoredFieldsByType.Load(t)
+	if !ok {
+		return false
+	}
+	_, ignored := ignoredFields.(map[string]struct{})[name]
+	return ignored
+}
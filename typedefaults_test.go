@@ -0,0 +1,49 @@
+package immcheck_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+// libraryClient stands for a type of a third-party library that registers its own defaults.
+type libraryClient struct {
+	Endpoint string
+	requests chan string
+	stats    [8]int64
+}
+
+type application struct {
+	Name   string
+	Client *libraryClient
+}
+
+func TestSetTypeDefaults(t *testing.T) {
+	t.Parallel()
+	immcheck.SetTypeDefaults(reflect.TypeOf(libraryClient{}), immcheck.Options{
+		Flags:         immcheck.SkipUnsupportedTypes,
+		IgnoredFields: []string{"stats"},
+	})
+	app := &application{Name: "app", Client: &libraryClient{Endpoint: "localhost", requests: make(chan string)}}
+	if unsupported := immcheck.ValidateType(reflect.TypeOf(app), immcheck.Options{}); len(unsupported) != 0 {
+		t.Fatalf("type defaults aren't honoured by validation: %v", unsupported)
+	}
+	snapshot := immcheck.CaptureSnapshot(app, immcheck.NewValueSnapshot())
+	if _, _, skippedNodes := snapshot.Coverage(); skippedNodes != 2 {
+		t.Fatalf("unexpected skipped nodes: %v", skippedNodes)
+	}
+	app.Client.stats[0]++
+	if err := snapshot.Check(app, immcheck.Options{}); err != nil {
+		t.Fatalf("ignored field mutation is reported: %v", err)
+	}
+	app.Client.Endpoint = "remote"
+	if err := snapshot.Check(app, immcheck.Options{}); !errors.Is(err, immcheck.MutationDetectedError) {
+		t.Fatalf("mutation isn't detected: %v", err)
+	}
+
+	expectPanic(t, func() {
+		immcheck.SetTypeDefaults(reflect.TypeOf(libraryClient{}), immcheck.Options{IgnoredFields: []string{"missing"}})
+	}, immcheck.UnsupportedTypeError)
+}
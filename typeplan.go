@@ -0,0 +1,69 @@
+package immcheck
+
+import (
+	"reflect"
+	"sync"
+)
+
+// typePlan holds precomputed capture information of a type.
+type typePlan struct {
+	primitive bool
+	// inlineContent decides whether captured bytes of the type need normalization before hashing
+	inlineContent inlineContent
+	fieldRules    []fieldRule
+}
+
+// typePlans keeps plans of precompiled types. Unlike per-goroutine caches it is never evicted,
+// so it is filled only by explicit precompilation to avoid unbounded growth for dynamically created types.
+// Keys are reflect.Type, so every instantiation of a generic type, like List[int] and List[string], has its own plan.
+//
+//nolint:gochecknoglobals // typePlans is global to share precompiled plans between all captures
+var typePlans = &sync.Map{}
+
+// Precompile builds capture plans of T and all types reachable from it,
+// so the first capture of T in latency-sensitive services doesn't pay for type analysis.
+// Call it at startup for types you are going to guard.
+// Plans are consulted only for precompiled types: other types are analyzed on their first capture on every goroutine
+// and kept in bounded per-goroutine caches instead, see immcheck.SetTypeCacheSizePerGoroutine,
+// since plans are never evicted.
+func Precompile[T any]() {
+	PrecompileType(reflect.TypeOf((*T)(nil)).Elem())
+}
+
+// PrecompileType works the same way as immcheck.Precompile for already known reflect.Type.
+func PrecompileType(t reflect.Type) {
+	precompileType(t, make(map[reflect.Type]struct{}))
+}
+
+func precompileType(t reflect.Type, visited map[reflect.Type]struct{}) {
+	if _, ok := visited[t]; ok {
+		return
+	}
+	visited[t] = struct{}{}
+	//nolint:exhaustive
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Chan:
+		precompileType(t.Elem(), visited)
+	case reflect.Map:
+		precompileType(t.Key(), visited)
+		precompileType(t.Elem(), visited)
+	case reflect.Struct:
+		numField := t.NumField()
+		for i := 0; i < numField; i++ {
+			precompileType(t.Field(i).Type, visited)
+		}
+		typePlans.Store(t, &typePlan{
+			primitive:     typeIsPrimitive(t),
+			inlineContent: typeInlineContent(t),
+			fieldRules:    typeFieldRules(t),
+		})
+	}
+}
+
+func loadTypePlan(t reflect.Type) (*typePlan, bool) {
+	plan, ok := typePlans.Load(t)
+	if !ok {
+		return nil, false
+	}
+	return plan.(*typePlan), true
+}
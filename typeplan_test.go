@@ -0,0 +1,60 @@
+package immcheck_test
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"unsafe"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+type genericList[T any] struct {
+	value T
+	next  *genericList[T]
+}
+
+func TestPrecompileGenericInstantiations(t *testing.T) {
+	t.Parallel()
+	immcheck.Precompile[genericList[int]]()
+	immcheck.Precompile[genericList[string]]()
+	immcheck.PrecompileType(reflect.TypeOf(map[string][]genericList[uint8]{}))
+
+	{
+		list := &genericList[int]{value: 1, next: &genericList[int]{value: 2}}
+		immcheck.EnsureImmutability(&list)() // check that no mutation is fine
+		panicMessage := expectMutationPanic(t, func() {
+			defer immcheck.EnsureImmutability(&list)()
+			list.next.value = 3
+		})
+		checkMutationDetectionMessage(t, panicMessage)
+	}
+	{
+		// string instantiation isn't primitive, so contents of strings must be still checked
+		value := []byte("first")
+		list := &genericList[string]{value: string(value)}
+		list.next = &genericList[string]{value: *(*string)(unsafe.Pointer(&value))}
+		immcheck.EnsureImmutability(&list)() // check that no mutation is fine
+		panicMessage := expectMutationPanic(t, func() {
+			defer immcheck.EnsureImmutability(&list)()
+			value[0] = 'F'
+		})
+		checkMutationDetectionMessage(t, panicMessage)
+	}
+}
+
+type precompiledSample struct {
+	Ratio float64
+	Next  *precompiledSample
+}
+
+func TestPrecompiledTypeNormalization(t *testing.T) {
+	t.Parallel()
+	immcheck.Precompile[precompiledSample]()
+	sample := &precompiledSample{Ratio: 0, Next: &precompiledSample{Ratio: 1}}
+	options := immcheck.Options{Flags: immcheck.NormalizeFloats}
+	func() {
+		defer immcheck.EnsureImmutabilityWithOptions(sample, options)()
+		sample.Ratio = math.Copysign(0, -1)
+	}()
+}
@@ -0,0 +1,24 @@
+package immcheck
+
+import (
+	"reflect"
+)
+
+// targetValueOf returns reflect.Value of target v. If v is reflect.Value itself, like values handed by frameworks,
+// it is used as is, since reflect.Value internals can't be guarded meaningfully.
+func targetValueOf(v interface{}) reflect.Value {
+	if value, ok := v.(reflect.Value); ok {
+		return value
+	}
+	return reflect.ValueOf(v)
+}
+
+// accessibleValue returns view of value of unexported field that is both addressable and interfaceable,
+// see AllowUnexportedAccess flag. View shares memory with value, so addresses of its data are stable between captures.
+// Other values are returned as is.
+func accessibleValue(value reflect.Value, internals runtimeInternals) reflect.Value {
+	if !value.IsValid() || value.CanInterface() {
+		return value
+	}
+	return internals.accessibleValue(value)
+}
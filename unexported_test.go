@@ -0,0 +1,95 @@
+package immcheck_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+type unexportedInner struct {
+	id    int
+	items []int
+}
+
+type unexportedOuter struct {
+	inner unexportedInner
+	boxed interface{}
+}
+
+func TestAllowUnexportedAccess(t *testing.T) {
+	t.Parallel()
+	items := []int{1, 2, 3}
+	boxed := &unexportedOuter{boxed: unexportedInner{id: 1, items: items}}
+	expectPanic(t, func() {
+		immcheck.EnsureImmutability(boxed)
+	}, immcheck.UnsupportedTypeError)
+
+	options := immcheck.Options{Flags: immcheck.AllowUnexportedAccess | immcheck.SkipLoggingOnMutation}
+	immcheck.EnsureImmutabilityWithOptions(boxed, options)()
+	expectMutationPanic(t, func() {
+		defer immcheck.EnsureImmutabilityWithOptions(boxed, options)()
+		items[0] = 4
+	})
+
+	// frameworks hand values of unexported fields as reflect.Value
+	byValue := unexportedOuter{inner: unexportedInner{id: 2, items: items}}
+	field := reflect.ValueOf(byValue).Field(0)
+	if field.CanAddr() || field.CanInterface() {
+		t.Fatal("field is expected to be inaccessible")
+	}
+	expectPanic(t, func() {
+		immcheck.EnsureImmutability(field)
+	}, immcheck.UnsupportedTypeError)
+	immcheck.EnsureImmutabilityWithOptions(field, options)()
+	expectMutationPanic(t, func() {
+		defer immcheck.EnsureImmutabilityWithOptions(field, options)()
+		items[1] = 5
+	})
+}
+
+type bufferHolder struct {
+	buffers [1]bytes.Buffer
+}
+
+func TestUnexportedFieldsOfStdlibTypes(t *testing.T) {
+	t.Parallel()
+	buffer := bytes.NewBufferString("payload")
+	holder := bufferHolder{buffers: [1]bytes.Buffer{*buffer}}
+	expectPanic(t, func() {
+		immcheck.EnsureImmutability(holder)
+	}, immcheck.UnsupportedTypeError)
+
+	options := immcheck.Options{Flags: immcheck.AllowUnexportedAccess | immcheck.SkipLoggingOnMutation}
+	immcheck.EnsureImmutabilityWithOptions(holder, options)()
+	expectMutationPanic(t, func() {
+		defer immcheck.EnsureImmutabilityWithOptions(holder, options)()
+		// copies of bytes.Buffer share backing array
+		buffer.Bytes()[0] = 'P'
+	})
+
+	// visitors can compare unexported fields the way reflect.DeepEqual does
+	other := bufferHolder{buffers: [1]bytes.Buffer{*bytes.NewBufferString("PayloaD")}}
+	var unequalPaths []string
+	immcheck.WalkPair(holder, other, func(path string, a reflect.Value, b reflect.Value) bool {
+		if a.Kind() == reflect.Uint8 && !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			unequalPaths = append(unequalPaths, path)
+		}
+		return true
+	}, options)
+	if len(unequalPaths) != 1 || unequalPaths[0] != ".buffers[0].buf[6]" {
+		t.Fatalf("unexpected unequal paths: %v", unequalPaths)
+	}
+	var interfacePanic interface{}
+	func() {
+		defer func() { interfacePanic = recover() }()
+		immcheck.WalkPair(holder, other, func(path string, a reflect.Value, b reflect.Value) bool {
+			_ = a.Interface()
+			return true
+		}, immcheck.Options{})
+	}()
+	if interfacePanic == nil {
+		t.Fatal("values of unexported fields are interfaceable without AllowUnexportedAccess flag")
+	}
+}
@@ -0,0 +1,163 @@
+package immcheck
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+)
+
+// UnsupportedKindError describes value of inherently unsafe kind, like Func or Chan, met within guarded value.
+// It wraps immcheck.UnsupportedTypeError, so tooling can both match it with errors.Is
+// and extract details with errors.As, for example, to suggest `immcheck:"ignore"` tags.
+type UnsupportedKindError struct {
+	// RootType is the type of guarded root value. Nil if it is unknown.
+	RootType reflect.Type
+	// Path is Go-like path of the value relative to the root: .Field for fields,
+	// [] for items of slices and arrays and values of maps, {key} for keys of maps.
+	// Pointers are dereferenced transparently. Path is found by walking RootType, so if RootType holds
+	// several values of Kind, Path leads to the first declared one. Empty if the value is the root itself
+	// or path is unknown, for example, because the value is reachable only through interfaces.
+	Path string
+	// Kind is the kind of unsupported value.
+	Kind reflect.Kind
+	// FieldOwner and FieldName identify the innermost struct field on the path
+	// that can be excluded with `immcheck:"ignore"` tag. FieldOwner is nil if there is no such field
+	// or the tag isn't honoured, like by stable digests.
+	FieldOwner reflect.Type
+	FieldName  string
+}
+
+// Error provides human-readable description of unsupported value together with remediation hints.
+func (e *UnsupportedKindError) Error() string {
+	buf := &bytes.Buffer{}
+	_, _ = fmt.Fprintf(buf, "%v. UnsafePointer, Func, and Chan types are not supported, "+
+		"since there is no way for us to fully verify immutability for these types. "+
+		"If you still want to proceed and ignore fields of such type "+
+		"use Flags.AllowInherentlyUnsafeTypes option. "+
+		"Unsupported type kind: %v", UnsupportedTypeError, e.Kind.String())
+	if e.RootType != nil && e.Path != "" {
+		_, _ = fmt.Fprintf(buf, "; path: (%v)%v", e.RootType, e.Path)
+	}
+	if e.FieldOwner != nil {
+		_, _ = fmt.Fprintf(buf, "; to exclude it add %v tag to field %v of %v", e.SuggestedTag(), e.FieldName, e.FieldOwner)
+	}
+	return buf.String()
+}
+
+// SuggestedTag returns struct tag that excludes FieldName from snapshots. Empty if FieldOwner is nil.
+func (e *UnsupportedKindError) SuggestedTag() string {
+	if e.FieldOwner == nil {
+		return ""
+	}
+	return "`" + tagName + `:"ignore"` + "`"
+}
+
+// Unwrap returns immcheck.UnsupportedTypeError.
+func (e *UnsupportedKindError) Unwrap() error {
+	return UnsupportedTypeError
+}
+
+// ValidateType eagerly reports all values of inherently unsafe kinds reachable from values of type t,
+// that would make captures according to settings specified in options panic.
+// Fields excluded with `immcheck:"ignore"` tag are skipped. Values reachable only through interfaces
+// can't be found by type and are reported only by captures.
+// Use it in tests to print the complete list of exclusions needed to guard a legacy struct.
+func ValidateType(t reflect.Type, options Options) []*UnsupportedKindError {
+	options = withDefaultOptions(options)
+	if options.Flags&(AllowInherentlyUnsafeTypes|SkipUnsupportedTypes) != 0 {
+		return nil
+	}
+	finder := &unsupportedKindsFinder{
+		rootType:         t,
+		ignoreTagApplies: true,
+		visiting:         make(map[reflect.Type]struct{}),
+	}
+	finder.find(t, "", nil, "")
+	return finder.found
+}
+
+// unsupportedKindError returns error describing value of inherently unsafe kind met within value of rootType.
+// Path to the first value of such kind is found by walking rootType, so it costs nothing until the error happens.
+// ignoreTagApplies is false for walks that don't honour `immcheck:"ignore"` tag, like stable encoding.
+func unsupportedKindError(rootType reflect.Type, kind reflect.Kind, ignoreTagApplies bool) error {
+	if rootType == nil {
+		return &UnsupportedKindError{Kind: kind}
+	}
+	finder := &unsupportedKindsFinder{
+		rootType:         rootType,
+		kind:             kind,
+		firstOnly:        true,
+		ignoreTagApplies: ignoreTagApplies,
+		visiting:         make(map[reflect.Type]struct{}),
+	}
+	finder.find(rootType, "", nil, "")
+	if len(finder.found) == 0 {
+		return &UnsupportedKindError{RootType: rootType, Kind: kind}
+	}
+	return finder.found[0]
+}
+
+// unsupportedKindsFinder finds paths to values of unsupported kinds by walking types in declaration order.
+type unsupportedKindsFinder struct {
+	rootType reflect.Type
+	// kind limits search to a single kind, zero kind matches all unsupported kinds
+	kind             reflect.Kind
+	firstOnly        bool
+	ignoreTagApplies bool
+	// visiting holds types on the current walk path to stop on recursive types
+	visiting map[reflect.Type]struct{}
+	found    []*UnsupportedKindError
+}
+
+func (f *unsupportedKindsFinder) find(t reflect.Type, path string, fieldOwner reflect.Type, fieldName string) {
+	if f.firstOnly && len(f.found) != 0 {
+		return
+	}
+	switch t.Kind() {
+	case reflect.UnsafePointer, reflect.Func, reflect.Chan:
+		if f.kind == reflect.Invalid || f.kind == t.Kind() {
+			unsupported := &UnsupportedKindError{RootType: f.rootType, Path: path, Kind: t.Kind()}
+			if f.ignoreTagApplies && fieldOwner != nil {
+				unsupported.FieldOwner = fieldOwner
+				unsupported.FieldName = fieldName
+			}
+			f.found = append(f.found, unsupported)
+		}
+		return
+	}
+	if _, visiting := f.visiting[t]; visiting {
+		return
+	}
+	if f.ignoreTagApplies && typeAllowsUnsupportedKinds(t) {
+		return
+	}
+	f.visiting[t] = struct{}{}
+	defer delete(f.visiting, t)
+
+	//nolint:exhaustive
+	switch t.Kind() {
+	case reflect.Ptr:
+		f.find(t.Elem(), path, fieldOwner, fieldName)
+	case reflect.Slice, reflect.Array:
+		f.find(t.Elem(), path+"[]", fieldOwner, fieldName)
+	case reflect.Map:
+		f.find(t.Key(), path+"{key}", fieldOwner, fieldName)
+		f.find(t.Elem(), path+"[]", fieldOwner, fieldName)
+	case reflect.Struct:
+		rules := typeFieldRules(t)
+		numField := t.NumField()
+		for i := 0; i < numField; i++ {
+			field := t.Field(i)
+			rule, ok := fieldRuleOf(rules, i)
+			if ok && rule.ignore && f.ignoreTagApplies {
+				continue
+			}
+			if ok && rule.keysOnly && f.ignoreTagApplies {
+				// values of the map aren't captured
+				f.find(field.Type.Key(), path+"."+field.Name+"{key}", t, field.Name)
+				continue
+			}
+			f.find(field.Type, path+"."+field.Name, t, field.Name)
+		}
+	}
+}
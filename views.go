@@ -0,0 +1,211 @@
+package immcheck
+
+import (
+	"fmt"
+	"reflect"
+	"sync/atomic"
+)
+
+// ImmutableSlice is a read-only view of a slice.
+// It exposes only read accessors and verifies that underlying items weren't mutated on (sampled) reads.
+// Use Options.SampleEvery to verify only every N-th read.
+// The zero ImmutableSlice is an empty slice.
+type ImmutableSlice[T any] struct {
+	items []T
+	guard *accessGuard
+}
+
+// NewImmutableSlice creates ImmutableSlice that takes ownership of items.
+// Items must not be mutated after this call.
+// If inline checks are switched off by immcheck.SetRuntimeToggles, reads aren't verified.
+func NewImmutableSlice[T any](items []T, options Options) ImmutableSlice[T] {
+	skipThreeFrames := 3
+	return ImmutableSlice[T]{
+		items: items,
+		guard: newAccessGuard(&items, options, skipThreeFrames),
+	}
+}
+
+// Len returns number of items in the slice.
+func (s ImmutableSlice[T]) Len() int {
+	return len(s.items)
+}
+
+// At returns item at index i.
+func (s ImmutableSlice[T]) At(i int) T {
+	skipThreeFrames := 3
+	s.guard.onRead(skipThreeFrames)
+	return s.items[i]
+}
+
+// Range calls f for every item of the slice in order until f returns false.
+func (s ImmutableSlice[T]) Range(f func(i int, item T) bool) {
+	skipThreeFrames := 3
+	s.guard.onRead(skipThreeFrames)
+	for i, item := range s.items {
+		if !f(i, item) {
+			return
+		}
+	}
+}
+
+// Copy returns mutable copy of items.
+func (s ImmutableSlice[T]) Copy() []T {
+	skipThreeFrames := 3
+	s.guard.onRead(skipThreeFrames)
+	result := make([]T, len(s.items))
+	copy(result, s.items)
+	return result
+}
+
+// ImmutableMap is a read-only view of a map.
+// It exposes only read accessors and verifies that underlying entries weren't mutated on (sampled) reads.
+// Use Options.SampleEvery to verify only every N-th read.
+// The zero ImmutableMap is an empty map.
+type ImmutableMap[K comparable, V any] struct {
+	entries map[K]V
+	guard   *accessGuard
+}
+
+// NewImmutableMap creates ImmutableMap that takes ownership of entries.
+// Entries must not be mutated after this call.
+// If inline checks are switched off by immcheck.SetRuntimeToggles, reads aren't verified.
+func NewImmutableMap[K comparable, V any](entries map[K]V, options Options) ImmutableMap[K, V] {
+	skipThreeFrames := 3
+	return ImmutableMap[K, V]{
+		entries: entries,
+		guard:   newAccessGuard(&entries, options, skipThreeFrames),
+	}
+}
+
+// Len returns number of entries in the map.
+func (m ImmutableMap[K, V]) Len() int {
+	return len(m.entries)
+}
+
+// Get returns value associated with key and true, or zero value and false if there is no such key.
+func (m ImmutableMap[K, V]) Get(key K) (V, bool) {
+	skipThreeFrames := 3
+	m.guard.onRead(skipThreeFrames)
+	value, ok := m.entries[key]
+	return value, ok
+}
+
+// Range calls f for every entry of the map until f returns false. Iteration order is not specified.
+func (m ImmutableMap[K, V]) Range(f func(key K, value V) bool) {
+	skipThreeFrames := 3
+	m.guard.onRead(skipThreeFrames)
+	for key, value := range m.entries {
+		if !f(key, value) {
+			return
+		}
+	}
+}
+
+// Copy returns mutable copy of entries.
+func (m ImmutableMap[K, V]) Copy() map[K]V {
+	skipThreeFrames := 3
+	m.guard.onRead(skipThreeFrames)
+	result := make(map[K]V, len(m.entries))
+	for key, value := range m.entries {
+		result[key] = value
+	}
+	return result
+}
+
+// accessGuard verifies guarded value on sampled accesses. It is safe for concurrent use.
+// Guard isn't created if inline checks are switched off by immcheck.SetRuntimeToggles, see newAccessGuard.
+type accessGuard struct {
+	options  Options
+	target   reflect.Value
+	baseline *ValueSnapshot
+	reads    uint32
+}
+
+func newAccessGuard(v interface{}, options Options, framesToSkip int) *accessGuard {
+	if v == nil {
+		panic(fmt.Errorf("%w. target value can't be nil", UnsupportedTypeError))
+	}
+	if inlineChecksDisabled() {
+		// nil guard is never verified, see accessGuard.onRead
+		return nil
+	}
+	options = withDefaultOptions(options)
+	guard := &accessGuard{
+		options: options,
+		target:  reflect.ValueOf(v),
+	}
+	guard.baseline = initValueSnapshot(newValueSnapshot(), options, framesToSkip)
+	guard.baseline = captureChecksumMap(guard.baseline, guard.target, options)
+	return guard
+}
+
+// onRead verifies guarded value if this read is sampled.
+// Zero guard belongs to zero view or a view created while checks were switched off and is never verified.
+func (g *accessGuard) onRead(framesToSkip int) {
+	if g == nil {
+		return
+	}
+	reads := atomic.AddUint32(&g.reads, 1)
+	if g.options.SampleEvery > 1 && reads%g.options.SampleEvery != 0 {
+		return
+	}
+	g.verify(framesToSkip + 1)
+}
+
+func (g *accessGuard) verify(framesToSkip int) {
+	newSnapshot := getTempSnapshot()
+	defer putTempSnapshot(newSnapshot)
+	newSnapshot = initValueSnapshot(newSnapshot, g.options, framesToSkip)
+	newSnapshot = captureChecksumMap(newSnapshot, g.target, g.options)
+	checkErr := g.baseline.CheckImmutabilityAgainst(newSnapshot)
+	if checkErr != nil {
+		reportError(checkErr, g.options)
+	}
+}
+
+// Frozen carries a pointer to immutable value together with its snapshot,
+// so the guard travels with the value instead of living at one call site.
+// The zero Frozen holds nil pointer.
+type Frozen[T any] struct {
+	value *T
+	guard *accessGuard
+}
+
+// Freeze captures snapshot of *v and returns Frozen accessor for it.
+// *v must not be mutated after this call.
+// If inline checks are switched off by immcheck.SetRuntimeToggles, *v isn't captured and is never verified.
+func Freeze[T any](v *T) Frozen[T] {
+	skipFourFrames := 4
+	return freeze(v, Options{}, skipFourFrames)
+}
+
+// FreezeWithOptions works the same way as immcheck.Freeze
+// but captures and verifies snapshots according to settings specified in options.
+func FreezeWithOptions[T any](v *T, options Options) Frozen[T] {
+	skipFourFrames := 4
+	return freeze(v, options, skipFourFrames)
+}
+
+func freeze[T any](v *T, options Options, framesToSkip int) Frozen[T] {
+	if v == nil {
+		panic(fmt.Errorf("%w. target value can't be nil", UnsupportedTypeError))
+	}
+	return Frozen[T]{
+		value: v,
+		guard: newAccessGuard(v, options, framesToSkip),
+	}
+}
+
+// Get verifies (sampled) that frozen value wasn't mutated and returns pointer to it.
+// Callers must not write through returned pointer.
+func (f Frozen[T]) Get() *T {
+	skipThreeFrames := 3
+	f.guard.onRead(skipThreeFrames)
+	return f.value
+}
+
+// Unwrap returns pointer to frozen value without verification.
+func (f Frozen[T]) Unwrap() *T {
+	return f.value
+}
@@ -0,0 +1,117 @@
+package immcheck_test
+
+import (
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+func TestImmutableSlice(t *testing.T) {
+	t.Parallel()
+	items := []string{"a", "b", "c"}
+	view := immcheck.NewImmutableSlice(items, immcheck.Options{})
+	if view.Len() != 3 || view.At(1) != "b" {
+		t.Fatalf("unexpected view content: %v", view.Copy())
+	}
+	visited := 0
+	view.Range(func(i int, item string) bool {
+		visited++
+		return i < 1
+	})
+	if visited != 2 {
+		t.Fatalf("range isn't stopped: %v", visited)
+	}
+	copied := view.Copy()
+	copied[0] = "changed"
+	_ = view.At(0) // copy is detached from view
+
+	panicMessage := expectMutationPanic(t, func() {
+		items[0] = "changed"
+		_ = view.At(2)
+	})
+	checkMutationDetectionMessage(t, panicMessage)
+
+	var zero immcheck.ImmutableSlice[int]
+	if zero.Len() != 0 || len(zero.Copy()) != 0 {
+		t.Fatalf("zero view isn't empty")
+	}
+}
+
+func TestImmutableMap(t *testing.T) {
+	t.Parallel()
+	entries := map[string][]int{"a": {1}, "b": {2}}
+	view := immcheck.NewImmutableMap(entries, immcheck.Options{})
+	if value, ok := view.Get("a"); !ok || value[0] != 1 || view.Len() != 2 {
+		t.Fatalf("unexpected view content: %v", view.Copy())
+	}
+	if _, ok := view.Get("missing"); ok {
+		t.Fatalf("missing key is found")
+	}
+	visited := 0
+	view.Range(func(key string, value []int) bool {
+		visited++
+		return false
+	})
+	if visited != 1 {
+		t.Fatalf("range isn't stopped: %v", visited)
+	}
+
+	panicMessage := expectMutationPanic(t, func() {
+		value, _ := view.Get("b")
+		value[0] = 3 // values are shared with the view
+		view.Range(func(key string, value []int) bool { return true })
+	})
+	checkMutationDetectionMessage(t, panicMessage)
+
+	var zero immcheck.ImmutableMap[string, int]
+	if _, ok := zero.Get("a"); ok || zero.Len() != 0 {
+		t.Fatalf("zero view isn't empty")
+	}
+}
+
+func TestImmutableViewsSampling(t *testing.T) {
+	t.Parallel()
+	items := []int{1, 2, 3}
+	view := immcheck.NewImmutableSlice(items, immcheck.Options{SampleEvery: 4})
+	items[0] = 42
+	for i := 0; i < 3; i++ {
+		_ = view.At(i) // reads aren't sampled yet
+	}
+	expectMutationPanic(t, func() {
+		_ = view.At(0)
+	})
+}
+
+func TestFreeze(t *testing.T) {
+	t.Parallel()
+	type config struct {
+		Name  string
+		Ports []int
+	}
+	value := &config{Name: "service", Ports: []int{80}}
+	frozen := immcheck.Freeze(value)
+	if frozen.Get() != value || frozen.Unwrap() != value {
+		t.Fatalf("frozen accessor returns unexpected pointer")
+	}
+
+	frozen.Unwrap().Ports[0] = 8080 // Unwrap doesn't verify
+	panicMessage := expectMutationPanic(t, func() {
+		_ = frozen.Get()
+	})
+	checkMutationDetectionMessage(t, panicMessage)
+
+	sampled := immcheck.FreezeWithOptions(&config{}, immcheck.Options{SampleEvery: 2})
+	sampled.Unwrap().Name = "changed"
+	_ = sampled.Get()
+	expectMutationPanic(t, func() {
+		_ = sampled.Get()
+	})
+
+	var zero immcheck.Frozen[config]
+	if zero.Get() != nil {
+		t.Fatalf("zero frozen value isn't nil")
+	}
+	expectPanic(t, func() {
+		immcheck.Freeze[config](nil)
+	}, immcheck.UnsupportedTypeError)
+}
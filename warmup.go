@@ -0,0 +1,33 @@
+package immcheck
+
+import (
+	"reflect"
+	"runtime"
+)
+
+// Warmup prepares immcheck for guarding values like samples, so the first guarded request doesn't pay cold-start costs.
+// It precompiles type plans of samples, captures every sample once to prime hashing and per-goroutine caches,
+// and fills snapshot pools with snapshots sized for samples. Call it at startup.
+// Nil samples are ignored. Samples are only read.
+func Warmup(samples ...interface{}) {
+	options := Options{Flags: SkipOriginCapturing | AllowInherentlyUnsafeTypes}
+	snapshots := make([]*ValueSnapshot, runtime.GOMAXPROCS(0))
+	for i := range snapshots {
+		snapshots[i] = getTempSnapshot()
+	}
+	for _, sample := range samples {
+		if sample == nil {
+			continue
+		}
+		sampleValue := reflect.ValueOf(sample)
+		PrecompileType(sampleValue.Type())
+		for i, snapshot := range snapshots {
+			// capture into every snapshot, so their checksum maps grow to the size of the sample
+			snapshot = initValueSnapshot(snapshot, options, 0)
+			snapshots[i] = captureChecksumMap(snapshot, sampleValue, options)
+		}
+	}
+	for _, snapshot := range snapshots {
+		putTempSnapshot(snapshot)
+	}
+}
@@ -0,0 +1,27 @@
+package immcheck_test
+
+import (
+	"testing"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+func TestWarmup(t *testing.T) {
+	t.Parallel()
+	type request struct {
+		ID      int
+		Headers map[string][]string
+		Next    *request
+	}
+	sample := &request{ID: 1, Headers: map[string][]string{"a": {"b"}}}
+	sample.Next = sample
+	immcheck.Warmup(sample, nil, []genericList[float64]{{value: 1}})
+
+	guarded := &request{ID: 2, Headers: map[string][]string{"a": {"b"}}}
+	immcheck.EnsureImmutability(&guarded)() // check that no mutation is fine
+	panicMessage := expectMutationPanic(t, func() {
+		defer immcheck.EnsureImmutability(&guarded)()
+		guarded.Headers["a"][0] = "c"
+	})
+	checkMutationDetectionMessage(t, panicMessage)
+}
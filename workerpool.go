@@ -0,0 +1,196 @@
+package immcheck
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+const maxFinalizerWorkers = 4
+
+//nolint:gochecknoglobals // finalizerPool is global to maximise goroutine pool utilization
+var finalizerPool = newWorkerPool(runtime.GOMAXPROCS(0), maxFinalizerWorkers)
+
+func runInPool(task func()) {
+	finalizerPool.submit(task)
+}
+
+// Shutdown drains queued finalizer checks and stops worker goroutines,
+// so programs using goroutine leak detectors in tests or doing graceful shutdown can terminate cleanly.
+// Returns ctx.Err() if ctx is done before workers stop.
+// Finalizer checks scheduled after Shutdown start workers again.
+func Shutdown(ctx context.Context) error {
+	return finalizerPool.shutdown(ctx)
+}
+
+// workerPool is a sharded multi-producer multi-consumer task queue served by a small set of persistent workers.
+// Producers spread tasks across shards in round-robin order, so submission doesn't serialize on a single lock,
+// and every worker drains its own shard first and then steals from the others.
+type workerPool struct {
+	shards      []taskShard
+	nextShard   uint32
+	workers     int
+	wakeupQueue chan struct{}
+
+	// running is changed under lifecycle lock, submit holds it for reading while it enqueues,
+	// so tasks can't be enqueued after shutdown has stopped workers that would run them
+	running     uint32
+	lifecycle   sync.RWMutex
+	stopWorkers chan struct{}
+	stopped     *sync.WaitGroup
+}
+
+type taskShard struct {
+	m     sync.Mutex
+	tasks []func()
+	spare []func()
+}
+
+func newWorkerPool(shardsCount int, workers int) *workerPool {
+	if shardsCount < 1 {
+		shardsCount = 1
+	}
+	if workers > shardsCount {
+		workers = shardsCount
+	}
+	return &workerPool{
+		shards:      make([]taskShard, shardsCount),
+		workers:     workers,
+		wakeupQueue: make(chan struct{}, workers),
+	}
+}
+
+func (p *workerPool) submit(task func()) {
+	p.lifecycle.RLock()
+	for atomic.LoadUint32(&p.running) == 0 {
+		p.lifecycle.RUnlock()
+		p.start()
+		p.lifecycle.RLock()
+	}
+	shardIndex := atomic.AddUint32(&p.nextShard, 1) % uint32(len(p.shards))
+	shard := &p.shards[shardIndex]
+	shard.m.Lock()
+	shard.tasks = append(shard.tasks, task)
+	shard.m.Unlock()
+	p.lifecycle.RUnlock()
+	select {
+	case p.wakeupQueue <- struct{}{}:
+	default:
+		// all workers are already notified
+	}
+}
+
+func (p *workerPool) start() {
+	p.lifecycle.Lock()
+	defer p.lifecycle.Unlock()
+	if atomic.LoadUint32(&p.running) != 0 {
+		return
+	}
+	p.stopWorkers = make(chan struct{})
+	p.stopped = &sync.WaitGroup{}
+	for i := 0; i < p.workers; i++ {
+		p.stopped.Add(1)
+		go p.work(i, p.stopWorkers, p.stopped)
+	}
+	atomic.StoreUint32(&p.running, 1)
+}
+
+func (p *workerPool) shutdown(ctx context.Context) error {
+	p.lifecycle.Lock()
+	if atomic.LoadUint32(&p.running) == 0 {
+		p.lifecycle.Unlock()
+		return nil
+	}
+	atomic.StoreUint32(&p.running, 0)
+	close(p.stopWorkers)
+	stopped := p.stopped
+	p.lifecycle.Unlock()
+
+	workersStopped := make(chan struct{})
+	go func() {
+		stopped.Wait()
+		close(workersStopped)
+	}()
+	select {
+	case <-workersStopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	// run tasks submitted while workers were stopping
+	for p.drain(0) {
+		// keep draining while there are tasks
+	}
+	return nil
+}
+
+func (p *workerPool) work(homeShard int, stopWorkers chan struct{}, stopped *sync.WaitGroup) {
+	defer stopped.Done()
+	for {
+		for p.drain(homeShard) {
+			// keep draining while there are tasks
+		}
+		select {
+		case <-p.wakeupQueue:
+		case <-stopWorkers:
+			for p.drain(homeShard) {
+				// drain remaining tasks before exit
+			}
+			return
+		}
+	}
+}
+
+// drain runs all tasks from the home shard or steals them from other shards.
+// Returns false if all shards are empty.
+func (p *workerPool) drain(homeShard int) bool {
+	for i := 0; i < len(p.shards); i++ {
+		shard := &p.shards[(homeShard+i)%len(p.shards)]
+		if shard.runAll() {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *taskShard) runAll() bool {
+	s.m.Lock()
+	batch := s.tasks
+	s.tasks = s.spare[:0]
+	s.spare = nil
+	s.m.Unlock()
+	if len(batch) == 0 {
+		s.recycle(batch)
+		return false
+	}
+	for i, task := range batch {
+		batch[i] = nil
+		task()
+	}
+	s.recycle(batch)
+	return true
+}
+
+func (s *taskShard) recycle(batch []func()) {
+	s.m.Lock()
+	if s.spare == nil {
+		s.spare = batch[:0]
+	}
+	s.m.Unlock()
+}
+
+// PendingFinalizerChecks returns the number of finalizer checks that are queued but not started yet.
+func PendingFinalizerChecks() int {
+	return finalizerPool.pending()
+}
+
+func (p *workerPool) pending() int {
+	result := 0
+	for i := range p.shards {
+		shard := &p.shards[i]
+		shard.m.Lock()
+		result += len(shard.tasks)
+		shard.m.Unlock()
+	}
+	return result
+}
@@ -0,0 +1,134 @@
+package immcheck_test
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/goodbadreviewer/immcheck"
+)
+
+func TestFinalizerGuardsStress(t *testing.T) {
+	guardsCount := 1_000_000
+	if testing.Short() || immcheck.ImmcheckRaceEnabled {
+		guardsCount = 10_000
+	}
+	logBuffer := &lockedWriterBuffer{buf: &bytes.Buffer{}}
+	options := immcheck.Options{
+		Flags:     immcheck.SkipPanicOnDetectedMutation | immcheck.SkipOriginCapturing,
+		LogWriter: logBuffer,
+	}
+	type payload struct {
+		id   int
+		data []byte
+	}
+
+	goroutines := runtime.GOMAXPROCS(0)
+	wg := &sync.WaitGroup{}
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := g; i < guardsCount; i += goroutines {
+				immcheck.CheckImmutabilityOnFinalizationWithOptions(&payload{id: i, data: []byte("data")}, options)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	for i := 0; i < 5; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if logBuffer.String() != "" {
+		t.Fatalf("unnexpected log on finalization: %v", logBuffer.String())
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	logBuffer := &lockedWriterBuffer{buf: &bytes.Buffer{}}
+	options := immcheck.Options{Flags: immcheck.SkipPanicOnDetectedMutation, LogWriter: logBuffer}
+	for i := 0; i < 1000; i++ {
+		immcheck.CheckImmutabilityOnFinalizationWithOptions(&[]int{i}, options)
+	}
+	runtime.GC()
+	if err := immcheck.Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected error happened: %v", err)
+	}
+	if err := immcheck.Shutdown(context.Background()); err != nil {
+		t.Fatalf("repeated shutdown failed: %v", err)
+	}
+	if immcheck.PendingFinalizerChecks() != 0 {
+		t.Fatalf("finalizer checks aren't drained: %v", immcheck.PendingFinalizerChecks())
+	}
+	stacks := make([]byte, 1<<20)
+	stacks = stacks[:runtime.Stack(stacks, true)]
+	if bytes.Contains(stacks, []byte("immcheck.(*workerPool).work")) {
+		t.Fatalf("workers aren't stopped:\n%s", stacks)
+	}
+
+	// checks scheduled after shutdown start workers again
+	m := map[string]int{"a": 1}
+	immcheck.CheckImmutabilityOnFinalizationWithOptions(&m, options)
+	m["b"] = 2
+	deadline := time.Now().Add(10 * time.Second)
+	for logBuffer.String() == "" && time.Now().Before(deadline) {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if logBuffer.String() == "" {
+		t.Fatal("mutation isn't detected after shutdown")
+	}
+	if err := immcheck.Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected error happened: %v", err)
+	}
+}
+
+func TestSubmitDuringShutdown(t *testing.T) {
+	value := []int{1, 2, 3}
+	const submitters = 8
+	const checksPerSubmitter = 1000
+	stop := make(chan struct{})
+	shutdownsDone := make(chan struct{})
+	go func() {
+		defer close(shutdownsDone)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				_ = immcheck.Shutdown(context.Background())
+			}
+		}
+	}()
+
+	wg := &sync.WaitGroup{}
+	for g := 0; g < submitters; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < checksPerSubmitter; i++ {
+				// every submitted check runs even if workers are stopped concurrently
+				select {
+				case err := <-immcheck.EnsureImmutabilityAsync(&value, immcheck.Options{})():
+					if err != nil {
+						t.Errorf("unexpected error happened: %v", err)
+						return
+					}
+				case <-time.After(10 * time.Second):
+					t.Error("check submitted during shutdown is never run")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	<-shutdownsDone
+	if err := immcheck.Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected error happened: %v", err)
+	}
+}